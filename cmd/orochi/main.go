@@ -11,6 +11,7 @@ import (
 	"github.com/ayutaz/orochi/internal/config"
 	"github.com/ayutaz/orochi/internal/logger"
 	"github.com/ayutaz/orochi/internal/torrent"
+	"github.com/ayutaz/orochi/internal/tracker"
 	"github.com/ayutaz/orochi/internal/web"
 )
 
@@ -23,13 +24,17 @@ var (
 
 func main() {
 	var (
-		showVersion bool
-		port        int
-		downloadDir string
-		useReal     bool
+		showVersion   bool
+		port          int
+		peerPort      int
+		peerPortRange string
+		downloadDir   string
+		useReal       bool
 	)
 	flag.BoolVar(&showVersion, "version", false, "Show version information")
 	flag.IntVar(&port, "port", 8080, "Port to listen on")
+	flag.IntVar(&peerPort, "peer-port", config.DefaultPeerPort, "BitTorrent listen port (0 = random on every start)")
+	flag.StringVar(&peerPortRange, "peer-port-range", "", "Range random BitTorrent ports are picked from with --peer-port 0, as min-max")
 	flag.StringVar(&downloadDir, "download-dir", "./downloads", "Download directory")
 	flag.BoolVar(&useReal, "real", false, "Use real torrent client (experimental)")
 	flag.Parse()
@@ -50,10 +55,21 @@ func main() {
 	if downloadDir != "./downloads" {
 		cfg.DownloadDir = downloadDir
 	}
+	if peerPort != config.DefaultPeerPort {
+		cfg.PeerPort = peerPort
+	}
 
 	// Create logger
 	log := logger.NewWithLevel(logger.InfoLevel)
 
+	if peerPortRange != "" {
+		r, err := config.ParsePortRange(peerPortRange)
+		if err != nil {
+			log.Fatal("Invalid peer port range", logger.Err(err))
+		}
+		cfg.PeerPortRange = r
+	}
+
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		log.Fatal("Invalid configuration", logger.Err(err))
@@ -75,7 +91,12 @@ func main() {
 		manager = adapter
 	} else {
 		log.Info("Using stub torrent manager")
-		manager = torrent.NewManager()
+		// The stub does not listen, so a random port has no port to announce
+		peerPort := cfg.PeerPort
+		if peerPort == 0 {
+			peerPort = config.DefaultPeerPort
+		}
+		manager = torrent.NewManagerWithTracker(torrent.NewTracker(tracker.NewPeerID(), uint16(peerPort)))
 	}
 
 	// Create and configure web server
@@ -98,6 +119,7 @@ func main() {
 		for range ticker.C {
 			// Send actual torrent data via WebSocket
 			server.BroadcastTorrentData()
+			server.BroadcastPieceUpdates()
 		}
 	}()
 
@@ -0,0 +1,255 @@
+// Package blocklist keeps a hot-swappable IP blocklist for the torrent
+// client, loaded from files and refreshed from a URL.
+package blocklist
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+const (
+	// maxDownloadSize is the largest blocklist that is downloaded, before
+	// decompression.
+	maxDownloadSize = 64 << 20
+	// retryInterval is the longest wait before retrying a failed download.
+	retryInterval = 15 * time.Minute
+)
+
+// Stats describes the loaded blocklist.
+type Stats struct {
+	// Rules is the number of address ranges after merging overlaps.
+	Rules int
+	// UpdatedAt is when the rules were loaded, or zero if they never were.
+	UpdatedAt time.Time
+	// Blocked is the number of distinct addresses that matched a rule since
+	// startup, whether their connections were refused or they were left out
+	// of tracker, PEX and DHT results.
+	Blocked int
+	// Source is the file or URL the rules came from.
+	Source string
+	// LastError is the error of the last failed load.
+	LastError string
+}
+
+// rules are the ranges of one blocklist, per address family.
+type rules struct {
+	v4, v6 *iplist.IPList
+	count  int
+}
+
+// List is an iplist.Ranger whose rules can be replaced while the torrent
+// client uses it. A list without rules blocks nothing.
+type List struct {
+	rules atomic.Pointer[rules]
+
+	// HTTPClient downloads blocklists.
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	blocked   map[netip.Addr]struct{}
+	updatedAt time.Time
+	source    string
+	lastError string
+}
+
+// New creates an empty blocklist.
+func New() *List {
+	return &List{
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute},
+		blocked:    make(map[netip.Addr]struct{}),
+	}
+}
+
+// Lookup returns the range containing an address, recording the address as
+// blocked.
+func (l *List) Lookup(ip net.IP) (iplist.Range, bool) {
+	rs := l.rules.Load()
+	if rs == nil {
+		return iplist.Range{}, false
+	}
+
+	list := rs.v6
+	if v4 := ip.To4(); v4 != nil {
+		ip, list = v4, rs.v4
+	}
+	r, ok := list.Lookup(ip)
+	if ok {
+		if addr, valid := netip.AddrFromSlice(ip); valid {
+			l.mu.Lock()
+			l.blocked[addr] = struct{}{}
+			l.mu.Unlock()
+		}
+	}
+	return r, ok
+}
+
+// NumRanges returns the number of rules.
+func (l *List) NumRanges() int {
+	if rs := l.rules.Load(); rs != nil {
+		return rs.count
+	}
+	return 0
+}
+
+// Set replaces the rules.
+func (l *List) Set(ranges []iplist.Range, source string, updatedAt time.Time) {
+	var v4, v6 []iplist.Range
+	for _, r := range ranges {
+		if len(r.First) == net.IPv4len {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+	v4, v6 = merge(v4), merge(v6)
+	l.rules.Store(&rules{v4: iplist.New(v4), v6: iplist.New(v6), count: len(v4) + len(v6)})
+
+	l.mu.Lock()
+	l.updatedAt = updatedAt
+	l.source = source
+	l.lastError = ""
+	l.mu.Unlock()
+}
+
+// LoadFile replaces the rules with those of a file. The update time is the
+// time the file was last written.
+func (l *List) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return l.fail(errors.NotFoundf("cannot open blocklist %s: %v", path, err))
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return l.fail(errors.InternalWithError("cannot stat blocklist", err))
+	}
+	ranges, err := Parse(f)
+	if err != nil {
+		return l.fail(err)
+	}
+	l.Set(ranges, path, info.ModTime())
+	return nil
+}
+
+// Download replaces the rules with a list downloaded from a URL. If
+// cachePath is not empty, the list is saved there to be loaded at startup.
+func (l *List) Download(ctx context.Context, rawURL, cachePath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, http.NoBody)
+	if err != nil {
+		return l.fail(errors.InvalidInputf("invalid blocklist URL %q", rawURL))
+	}
+	resp, err := l.HTTPClient.Do(req)
+	if err != nil {
+		return l.fail(errors.NetworkError("failed to download blocklist", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return l.fail(errors.NetworkError("failed to download blocklist: "+resp.Status, nil))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return l.fail(errors.NetworkError("failed to download blocklist", err))
+	}
+	if len(data) > maxDownloadSize {
+		return l.fail(errors.InvalidInputf("blocklist is larger than %d bytes", maxDownloadSize))
+	}
+	ranges, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return l.fail(err)
+	}
+	l.Set(ranges, rawURL, time.Now())
+
+	if cachePath != "" {
+		if err := writeFile(cachePath, data); err != nil {
+			return errors.InternalWithError("failed to save blocklist", err)
+		}
+	}
+	return nil
+}
+
+// Run downloads the list from a URL every interval until the context is
+// done, retrying failed downloads sooner. The first download waits for the
+// rest of the interval if the rules are newer than that. An interval of zero
+// downloads once, and only if no rules are loaded.
+func (l *List) Run(ctx context.Context, rawURL, cachePath string, interval time.Duration) {
+	wait := time.Duration(0)
+	if updatedAt := l.Stats().UpdatedAt; !updatedAt.IsZero() {
+		if interval <= 0 {
+			return
+		}
+		wait = max(0, interval-time.Since(updatedAt))
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		err := l.Download(ctx, rawURL, cachePath)
+		switch {
+		case interval <= 0:
+			return
+		case err != nil:
+			timer.Reset(min(interval, retryInterval))
+		default:
+			timer.Reset(interval)
+		}
+	}
+}
+
+// Stats returns the state of the list.
+func (l *List) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{
+		Rules:     l.NumRanges(),
+		UpdatedAt: l.updatedAt,
+		Blocked:   len(l.blocked),
+		Source:    l.source,
+		LastError: l.lastError,
+	}
+}
+
+// fail records the error of a failed load and returns it.
+func (l *List) fail(err error) error {
+	l.mu.Lock()
+	l.lastError = err.Error()
+	l.mu.Unlock()
+	return err
+}
+
+// writeFile replaces a file without leaving it half-written.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,146 @@
+package blocklist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mixedList = `# PeerGuardian
+Bad Corp, Inc:1.2.3.0-1.2.3.255
+// eMule
+005.006.007.008 - 005.006.007.010 , 000 , Some ISP
+009.000.000.000 - 009.255.255.255 , 200 , Allowed range
+# CIDR
+10.0.0.0/8
+2001:db8::/32
+192.0.2.7
+not a rule
+`
+
+func TestParse(t *testing.T) {
+	ranges, err := Parse(strings.NewReader(mixedList))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(ranges) != 5 {
+		t.Fatalf("got %d ranges, want 5: %v", len(ranges), ranges)
+	}
+
+	l := New()
+	l.Set(ranges, "test", time.Now())
+
+	for ip, want := range map[string]bool{
+		"1.2.3.4":     true,
+		"1.2.4.0":     false,
+		"5.6.7.9":     true,
+		"5.6.7.11":    false,
+		"9.1.1.1":     false,
+		"10.200.0.1":  true,
+		"2001:db8::1": true,
+		"2001:db9::1": false,
+		"192.0.2.7":   true,
+		"192.0.2.8":   false,
+	} {
+		if _, got := l.Lookup(net.ParseIP(ip)); got != want {
+			t.Errorf("Lookup(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	// Addresses are counted once however often they are looked up.
+	l.Lookup(net.ParseIP("1.2.3.4"))
+	if got := l.Stats().Blocked; got != 5 {
+		t.Errorf("blocked = %d, want 5", got)
+	}
+}
+
+func TestParse_Gzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte("Bad:1.2.3.0-1.2.3.255\n"))
+	_ = gz.Close()
+
+	ranges, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(ranges) != 1 {
+		t.Errorf("got %d ranges, want 1", len(ranges))
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	if _, err := Parse(strings.NewReader("# nothing\n")); err == nil {
+		t.Error("expected an error for a list without rules")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ranges, err := Parse(strings.NewReader("1.0.0.0/24\n1.0.0.128/25\n1.0.1.0/24\n3.0.0.0/8\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	l := New()
+	l.Set(ranges, "test", time.Now())
+	if got := l.NumRanges(); got != 2 {
+		t.Errorf("NumRanges() = %d, want 2", got)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	body := "Bad:1.2.3.0-1.2.3.255\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cache := filepath.Join(t.TempDir(), "blocklist.p2p")
+	l := New()
+	if err := l.Download(context.Background(), srv.URL, cache); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if _, ok := l.Lookup(net.ParseIP("1.2.3.4")); !ok {
+		t.Error("expected downloaded rules to be used")
+	}
+
+	// The list is swapped in place.
+	body = "Bad:5.0.0.0-5.0.0.255\n"
+	if err := l.Download(context.Background(), srv.URL, cache); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if _, ok := l.Lookup(net.ParseIP("1.2.3.4")); ok {
+		t.Error("expected old rules to be replaced")
+	}
+
+	cached := New()
+	if err := cached.LoadFile(cache); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if stats := cached.Stats(); stats.Rules != 1 || stats.Source != cache || stats.UpdatedAt.IsZero() {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if err := l.Download(context.Background(), srv.URL+"/missing\x00", cache); err == nil {
+		t.Fatal("expected an error for an invalid URL")
+	}
+	if stats := l.Stats(); stats.LastError == "" || stats.Rules != 1 {
+		t.Errorf("failed download should keep the rules and record the error: %+v", stats)
+	}
+}
+
+func TestLoadFile_Missing(t *testing.T) {
+	l := New()
+	if err := l.LoadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if l.Stats().LastError == "" {
+		t.Error("expected the error to be recorded")
+	}
+}
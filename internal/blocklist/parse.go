@@ -0,0 +1,184 @@
+package blocklist
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// maxBlockedLevel is the highest eMule access level that is blocked. Ranges
+// with a higher level are explicitly allowed.
+const maxBlockedLevel = 127
+
+// Parse reads a blocklist in PeerGuardian P2P, eMule ipfilter.dat or CIDR
+// format, or a mix of them, optionally gzip-compressed. Lines that cannot be
+// parsed are skipped, but a list without any rule is an error.
+func Parse(r io.Reader) ([]iplist.Range, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.ParseError("invalid gzip blocklist", err)
+		}
+		defer func() { _ = gz.Close() }()
+		br = bufio.NewReader(gz)
+	}
+
+	var ranges []iplist.Range
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if r, ok := parseLine(scanner.Text()); ok {
+			ranges = append(ranges, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.ParseError("failed to read blocklist", err)
+	}
+	if len(ranges) == 0 {
+		return nil, errors.ParseError("blocklist has no rules", nil)
+	}
+	return ranges, nil
+}
+
+// parseLine parses one rule, reporting false for comments and lines that
+// are not rules.
+func parseLine(line string) (iplist.Range, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == ';' || strings.HasPrefix(line, "//") {
+		return iplist.Range{}, false
+	}
+
+	// eMule: "first - last , level , description".
+	if fields := strings.SplitN(line, ",", 3); len(fields) >= 2 {
+		if first, last, ok := parseRange(fields[0]); ok {
+			level, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+			if err != nil || level > maxBlockedLevel {
+				return iplist.Range{}, false
+			}
+			desc := ""
+			if len(fields) == 3 {
+				desc = strings.TrimSpace(fields[2])
+			}
+			return newRange(first, last, desc)
+		}
+	}
+
+	// PeerGuardian P2P: "description:first-last".
+	if i := strings.LastIndexByte(line, ':'); i >= 0 {
+		if first, last, ok := parseRange(line[i+1:]); ok {
+			return newRange(first, last, strings.TrimSpace(line[:i]))
+		}
+	}
+
+	// CIDR or a single address.
+	if prefix, err := netip.ParsePrefix(line); err == nil {
+		prefix = prefix.Masked()
+		return newRange(prefix.Addr(), lastAddr(prefix), "")
+	}
+	if addr, ok := parseAddr(line); ok {
+		return newRange(addr, addr, "")
+	}
+	return iplist.Range{}, false
+}
+
+// parseRange parses "first-last", with optional spaces around the hyphen.
+func parseRange(s string) (netip.Addr, netip.Addr, bool) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	a, ok := parseAddr(first)
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	b, ok := parseAddr(last)
+	if !ok || a.Is4() != b.Is4() {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	return a, b, true
+}
+
+// parseAddr parses an address, accepting the zero-padded IPv4 addresses of
+// ipfilter.dat files such as "001.002.003.004".
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return netip.Addr{}, false
+	}
+	var b [4]byte
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 255 {
+			return netip.Addr{}, false
+		}
+		b[i] = byte(n)
+	}
+	return netip.AddrFrom4(b), true
+}
+
+// lastAddr returns the last address of a prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+func newRange(first, last netip.Addr, desc string) (iplist.Range, bool) {
+	if last.Less(first) {
+		first, last = last, first
+	}
+	return iplist.Range{First: net.IP(first.AsSlice()), Last: net.IP(last.AsSlice()), Description: desc}, true
+}
+
+// merge sorts ranges of one address family and joins those that overlap or
+// touch, as iplist requires sorted ranges that do not overlap.
+func merge(ranges []iplist.Range) []iplist.Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].First, ranges[j].First) < 0
+	})
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && touches(merged[n-1].Last, r.First) {
+			if bytes.Compare(r.Last, merged[n-1].Last) > 0 {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// touches reports whether first is at most one address after last.
+func touches(last, first net.IP) bool {
+	if bytes.Compare(first, last) <= 0 {
+		return true
+	}
+	next := append(net.IP(nil), last...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return bytes.Equal(next, first)
+}
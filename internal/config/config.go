@@ -2,17 +2,42 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"net/netip"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ayutaz/orochi/internal/network"
 )
 
 // Validation errors.
 var (
-	ErrInvalidPort        = errors.New("invalid port number: must be between 1 and 65535")
-	ErrEmptyDownloadDir   = errors.New("download directory cannot be empty")
-	ErrInvalidMaxTorrents = errors.New("max torrents must be at least 1")
-	ErrInvalidMaxPeers    = errors.New("max peers must be at least 1")
+	ErrInvalidPort             = errors.New("invalid port number: must be between 1 and 65535")
+	ErrEmptyDownloadDir        = errors.New("download directory cannot be empty")
+	ErrInvalidMaxTorrents      = errors.New("max torrents must be at least 1")
+	ErrInvalidMaxPeers         = errors.New("max peers must be at least 1")
+	ErrSameIncompleteDir       = errors.New("incomplete directory must differ from download directory")
+	ErrInvalidDiskReserve      = errors.New("disk reserve cannot be negative")
+	ErrEmptyTrackerPasskey     = errors.New("tracker passkey cannot be empty")
+	ErrInvalidTrackerTimes     = errors.New("tracker interval must be at least 1 and shorter than peer expiry")
+	ErrInvalidBlocklistRefresh = errors.New("blocklist refresh interval cannot be negative")
+	ErrInvalidBanDuration      = errors.New("ban duration cannot be negative")
+	ErrInvalidProxyType        = errors.New("proxy type must be socks5 or http")
+	ErrInvalidProxyAddress     = errors.New("proxy address must be host:port")
+	ErrProxyDHTNeedsSOCKS5     = errors.New("DHT can only be proxied through a SOCKS5 proxy")
+	ErrProxyOnlyWithoutPeers   = errors.New("proxy_only requires proxying peer traffic")
+	ErrInvalidEncryptionPolicy = errors.New("encryption policy must be disabled, prefer or require")
+	ErrPrivateNeedsEncryption  = errors.New("require_private cannot be combined with encryption disabled")
+	ErrNoPeerTransport         = errors.New("uTP and TCP cannot both be disabled")
+	ErrNoIPVersion             = errors.New("IPv4 and IPv6 cannot both be disabled")
+	ErrInvalidPeerPort         = errors.New("invalid peer port: must be between 0 and 65535")
+	ErrInvalidPeerPortRange    = errors.New("invalid peer port range: must be min-max between 1 and 65535")
+	ErrInvalidPortMapMethod    = errors.New("port mapping method must be pcp, natpmp or upnp")
+	ErrInvalidPortMapGateway   = errors.New("port mapping gateway must be an IP address, optionally with a port")
+	ErrInvalidPortMapLifetime  = errors.New("port mapping lifetime cannot be negative")
+	ErrInvalidDHTBootstrapNode = errors.New("DHT bootstrap nodes must be host:port")
 )
 
 // Config represents the application configuration.
@@ -25,6 +50,317 @@ type Config struct {
 	DataDir        string             `json:"data_dir,omitempty"`
 	AllowedOrigins []string           `json:"allowed_origins,omitempty"`
 	VPN            *network.VPNConfig `json:"vpn,omitempty"`
+
+	// IncompleteDir holds data of unfinished torrents. Completed torrents are
+	// moved to DownloadDir. Empty means download straight into DownloadDir.
+	IncompleteDir string `json:"incomplete_dir,omitempty"`
+	// IncompletePartSuffix appends ".part" to files in IncompleteDir.
+	IncompletePartSuffix bool `json:"incomplete_part_suffix,omitempty"`
+
+	// DiskReserve is the number of bytes to keep free on the disk holding
+	// torrent data. Downloads are paused when free space drops below it.
+	DiskReserve int64 `json:"disk_reserve"`
+	// QueueOnLowDisk queues torrents that do not fit on disk instead of
+	// rejecting them. Queued torrents start once enough space is free.
+	QueueOnLowDisk bool `json:"queue_on_low_disk,omitempty"`
+	// Preallocate allocates the full size of files when a torrent is added.
+	Preallocate bool `json:"preallocate,omitempty"`
+
+	// Tracker configures the embedded tracker.
+	Tracker *TrackerConfig `json:"tracker,omitempty"`
+	// Blocklist configures the IP blocklist.
+	Blocklist *BlocklistConfig `json:"blocklist,omitempty"`
+	// Bans configures automatic banning of peers sending corrupt data.
+	Bans *BanConfig `json:"bans,omitempty"`
+	// Proxy routes traffic through a SOCKS5 or HTTP proxy.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+	// Encryption configures BitTorrent protocol encryption.
+	Encryption *EncryptionConfig `json:"encryption,omitempty"`
+	// Protocols turns BitTorrent features and transports off.
+	Protocols *ProtocolConfig `json:"protocols,omitempty"`
+
+	// PeerPort is the port BitTorrent connections are accepted on. Zero
+	// picks a random port every time the torrent client starts.
+	PeerPort int `json:"peer_port"`
+	// PeerPortRange is the range random peer ports are picked from. It is
+	// only used when PeerPort is zero; nil leaves the choice to the system.
+	PeerPortRange *PortRange `json:"peer_port_range,omitempty"`
+	// PortMapping maps the peer port on the router.
+	PortMapping *PortMappingConfig `json:"port_mapping,omitempty"`
+	// DHT configures how the DHT is joined.
+	DHT *DHTConfig `json:"dht,omitempty"`
+}
+
+// DefaultPeerPort is the peer port of the default configuration.
+const DefaultPeerPort = 6881
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// ParsePortRange parses a range written as min-max, such as 6881-6889.
+func ParsePortRange(s string) (*PortRange, error) {
+	minPort, maxPort, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return nil, ErrInvalidPeerPortRange
+	}
+	r := &PortRange{}
+	var err error
+	if r.Min, err = strconv.Atoi(strings.TrimSpace(minPort)); err != nil {
+		return nil, ErrInvalidPeerPortRange
+	}
+	if r.Max, err = strconv.Atoi(strings.TrimSpace(maxPort)); err != nil {
+		return nil, ErrInvalidPeerPortRange
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// String formats the range as ParsePortRange reads it.
+func (r *PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// Validate checks that the range holds at least one valid port.
+func (r *PortRange) Validate() error {
+	if r.Min < 1 || r.Max > 65535 || r.Min > r.Max {
+		return ErrInvalidPeerPortRange
+	}
+	return nil
+}
+
+// ValidatePeerPort checks a peer port and the range random ones are picked
+// from, which may be nil.
+func ValidatePeerPort(port int, r *PortRange) error {
+	if port < 0 || port > 65535 {
+		return ErrInvalidPeerPort
+	}
+	if r != nil {
+		return r.Validate()
+	}
+	return nil
+}
+
+// TrackerConfig configures the embedded tracker, which serves /announce and
+// /scrape for the torrents loaded in Orochi.
+type TrackerConfig struct {
+	Enabled bool `json:"enabled"`
+	// Passkey must be sent in the passkey query parameter by peers.
+	Passkey string `json:"passkey"`
+	// Interval is the announce interval given to peers, in seconds.
+	Interval int `json:"interval"`
+	// PeerExpiry is how long a peer that stops announcing is kept, in seconds.
+	PeerExpiry int `json:"peer_expiry"`
+}
+
+// BlocklistConfig configures the IP blocklist peers are checked against.
+type BlocklistConfig struct {
+	// Path is a PeerGuardian P2P, eMule ipfilter.dat or CIDR list, optionally
+	// gzip-compressed. Lists downloaded from URL are saved to it.
+	Path string `json:"path,omitempty"`
+	// URL is where the list is downloaded from.
+	URL string `json:"url,omitempty"`
+	// RefreshInterval is how often the list is downloaded from URL, in
+	// seconds. Zero downloads it only when there is no list at Path.
+	RefreshInterval int `json:"refresh_interval"`
+}
+
+// BanConfig configures automatic peer bans.
+type BanConfig struct {
+	// MaxHashFailures is the number of failed pieces a peer may contribute
+	// data to. Peers contributing to more are banned; a peer's count starts
+	// over after an hour without failures. Negative disables automatic bans.
+	MaxHashFailures int `json:"max_hash_failures"`
+	// Duration is how long automatic bans last, in seconds. Zero bans peers
+	// permanently.
+	Duration int `json:"duration"`
+}
+
+// Proxy types.
+const (
+	ProxySOCKS5 = "socks5"
+	ProxyHTTP   = "http"
+)
+
+// ProxyConfig configures the proxy traffic is sent through. HTTP downloads,
+// such as blocklists, always use the proxy; the other kinds of traffic are
+// chosen separately.
+type ProxyConfig struct {
+	// Type is socks5 or http. Empty disables the proxy.
+	Type     string `json:"type,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Trackers proxies tracker announces. UDP trackers need a SOCKS5 proxy.
+	Trackers bool `json:"trackers,omitempty"`
+	// Peers proxies outgoing peer connections. Peers cannot connect to the
+	// client while they are proxied.
+	Peers bool `json:"peers,omitempty"`
+	// DHT proxies the DHT, which needs a SOCKS5 proxy.
+	DHT bool `json:"dht,omitempty"`
+	// ProxyOnly refuses the traffic that is not proxied instead of sending
+	// it directly.
+	ProxyOnly bool `json:"proxy_only,omitempty"`
+}
+
+// Enabled reports whether a proxy is configured.
+func (p *ProxyConfig) Enabled() bool {
+	return p != nil && p.Type != ""
+}
+
+// Encryption policies.
+const (
+	EncryptionDisabled = "disabled"
+	EncryptionPrefer   = "prefer"
+	EncryptionRequire  = "require"
+)
+
+// EncryptionConfig configures BitTorrent protocol encryption (MSE/PE), which
+// hides torrent traffic from ISPs that throttle it.
+type EncryptionConfig struct {
+	// Policy is disabled, prefer or require. Disabled only makes plaintext
+	// connections; prefer tries encryption first and falls back to
+	// plaintext; require refuses peers that cannot encrypt the whole stream.
+	// Empty is prefer.
+	Policy string `json:"policy,omitempty"`
+	// RequirePrivate closes plaintext connections of private torrents,
+	// whatever the policy.
+	RequirePrivate bool `json:"require_private,omitempty"`
+}
+
+// ProtocolConfig turns BitTorrent features and transports off. Everything
+// is on by default. Private torrents never use DHT, PEX or LSD.
+type ProtocolConfig struct {
+	DisableDHT bool `json:"disable_dht,omitempty"`
+	DisablePEX bool `json:"disable_pex,omitempty"`
+	// DisableLSD turns off Local Service Discovery, which finds peers on the
+	// local network by multicast.
+	DisableLSD  bool `json:"disable_lsd,omitempty"`
+	DisableUTP  bool `json:"disable_utp,omitempty"`
+	DisableTCP  bool `json:"disable_tcp,omitempty"`
+	DisableIPv4 bool `json:"disable_ipv4,omitempty"`
+	DisableIPv6 bool `json:"disable_ipv6,omitempty"`
+}
+
+// DHT reports whether the DHT is used.
+func (p *ProtocolConfig) DHT() bool {
+	return p == nil || !p.DisableDHT
+}
+
+// PEX reports whether peer exchange is used.
+func (p *ProtocolConfig) PEX() bool {
+	return p == nil || !p.DisablePEX
+}
+
+// LSD reports whether Local Service Discovery is used.
+func (p *ProtocolConfig) LSD() bool {
+	return p == nil || !p.DisableLSD
+}
+
+// UTP reports whether peers are connected over uTP.
+func (p *ProtocolConfig) UTP() bool {
+	return p == nil || !p.DisableUTP
+}
+
+// TCP reports whether peers are connected over TCP.
+func (p *ProtocolConfig) TCP() bool {
+	return p == nil || !p.DisableTCP
+}
+
+// IPv4 reports whether IPv4 is used.
+func (p *ProtocolConfig) IPv4() bool {
+	return p == nil || !p.DisableIPv4
+}
+
+// IPv6 reports whether IPv6 is used.
+func (p *ProtocolConfig) IPv6() bool {
+	return p == nil || !p.DisableIPv6
+}
+
+// Validate checks that peers can still be connected to.
+func (p *ProtocolConfig) Validate() error {
+	if !p.UTP() && !p.TCP() {
+		return ErrNoPeerTransport
+	}
+	if !p.IPv4() && !p.IPv6() {
+		return ErrNoIPVersion
+	}
+	return nil
+}
+
+// Port mapping methods.
+const (
+	PortMapPCP    = "pcp"
+	PortMapNATPMP = "natpmp"
+	PortMapUPnP   = "upnp"
+)
+
+// PortMappingConfig configures mapping the peer port on the router with
+// PCP, NAT-PMP or UPnP-IGD, so peers outside the local network can connect.
+// The port is not mapped while VPN binding is enabled.
+type PortMappingConfig struct {
+	Enabled bool `json:"enabled"`
+	// Methods are tried in order until one maps the port. Empty tries pcp,
+	// natpmp and upnp.
+	Methods []string `json:"methods,omitempty"`
+	// Gateway is the PCP and NAT-PMP server, as an IP address with an
+	// optional port. Empty uses the default gateway.
+	Gateway string `json:"gateway,omitempty"`
+	// UPnPURL is the URL of the device description of the UPnP gateway.
+	// Empty searches the local network for one.
+	UPnPURL string `json:"upnp_url,omitempty"`
+	// Lifetime is the lease asked for, in seconds. Zero is two hours.
+	Lifetime int `json:"lifetime,omitempty"`
+}
+
+func (p *PortMappingConfig) validate() error {
+	for _, method := range p.Methods {
+		if method != PortMapPCP && method != PortMapNATPMP && method != PortMapUPnP {
+			return ErrInvalidPortMapMethod
+		}
+	}
+	if p.Gateway != "" {
+		if _, err := netip.ParseAddrPort(p.Gateway); err != nil {
+			if _, err := netip.ParseAddr(p.Gateway); err != nil {
+				return ErrInvalidPortMapGateway
+			}
+		}
+	}
+	if p.Lifetime < 0 {
+		return ErrInvalidPortMapLifetime
+	}
+	return nil
+}
+
+// DHTConfig configures how the DHT is joined. Unless persistence is
+// disabled, the nodes of the routing table are saved in DataDir and joined
+// through first on the next start.
+type DHTConfig struct {
+	// BootstrapNodes are nodes to join through, as host:port, tried along
+	// with the public routers.
+	BootstrapNodes []string `json:"bootstrap_nodes,omitempty"`
+	// DisablePublicBootstrap leaves the public routers out, for a private
+	// DHT joined through BootstrapNodes, such as one on a LAN.
+	DisablePublicBootstrap bool `json:"disable_public_bootstrap,omitempty"`
+	// DisablePersistence keeps the routing table in memory only.
+	DisablePersistence bool `json:"disable_persistence,omitempty"`
+}
+
+func (d *DHTConfig) validate() error {
+	for _, node := range d.BootstrapNodes {
+		host, port, err := net.SplitHostPort(node)
+		if err != nil || host == "" {
+			return ErrInvalidDHTBootstrapNode
+		}
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return ErrInvalidDHTBootstrapNode
+		}
+	}
+	return nil
 }
 
 // LoadDefault returns the default configuration.
@@ -37,6 +373,19 @@ func LoadDefault() *Config {
 		DataDir:        "./data",
 		AllowedOrigins: []string{}, // Empty means allow all origins
 		VPN:            network.NewVPNConfig(),
+		DiskReserve:    1 << 30, // 1GB
+		PeerPort:       DefaultPeerPort,
+		Tracker: &TrackerConfig{
+			Interval:   30 * 60,
+			PeerExpiry: 60 * 60,
+		},
+		Blocklist: &BlocklistConfig{
+			RefreshInterval: 24 * 60 * 60,
+		},
+		Bans: &BanConfig{
+			MaxHashFailures: 3,
+			Duration:        24 * 60 * 60,
+		},
 	}
 }
 
@@ -58,6 +407,69 @@ func (c *Config) Validate() error {
 		return ErrInvalidMaxPeers
 	}
 
+	if c.IncompleteDir != "" && c.GetAbsoluteIncompleteDir() == c.GetAbsoluteDownloadDir() {
+		return ErrSameIncompleteDir
+	}
+
+	if c.DiskReserve < 0 {
+		return ErrInvalidDiskReserve
+	}
+
+	if c.Tracker != nil && c.Tracker.Enabled {
+		if c.Tracker.Passkey == "" {
+			return ErrEmptyTrackerPasskey
+		}
+		if c.Tracker.Interval < 1 || c.Tracker.PeerExpiry <= c.Tracker.Interval {
+			return ErrInvalidTrackerTimes
+		}
+	}
+
+	if c.Blocklist != nil && c.Blocklist.RefreshInterval < 0 {
+		return ErrInvalidBlocklistRefresh
+	}
+
+	if c.Bans != nil && c.Bans.Duration < 0 {
+		return ErrInvalidBanDuration
+	}
+
+	if c.Proxy.Enabled() {
+		if err := c.Proxy.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Encryption != nil {
+		switch c.Encryption.Policy {
+		case "", EncryptionPrefer, EncryptionRequire:
+		case EncryptionDisabled:
+			if c.Encryption.RequirePrivate {
+				return ErrPrivateNeedsEncryption
+			}
+		default:
+			return ErrInvalidEncryptionPolicy
+		}
+	}
+
+	if err := c.Protocols.Validate(); err != nil {
+		return err
+	}
+
+	if err := ValidatePeerPort(c.PeerPort, c.PeerPortRange); err != nil {
+		return err
+	}
+
+	if c.PortMapping != nil && c.PortMapping.Enabled {
+		if err := c.PortMapping.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.DHT != nil {
+		if err := c.DHT.validate(); err != nil {
+			return err
+		}
+	}
+
 	// Validate VPN config if present
 	if c.VPN != nil {
 		if err := c.VPN.Validate(); err != nil {
@@ -77,6 +489,28 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+func (p *ProxyConfig) validate() error {
+	if p.Type != ProxySOCKS5 && p.Type != ProxyHTTP {
+		return ErrInvalidProxyType
+	}
+
+	host, port, err := net.SplitHostPort(p.Address)
+	if err != nil || host == "" {
+		return ErrInvalidProxyAddress
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return ErrInvalidProxyAddress
+	}
+
+	if p.DHT && p.Type != ProxySOCKS5 {
+		return ErrProxyDHTNeedsSOCKS5
+	}
+	if p.ProxyOnly && !p.Peers {
+		return ErrProxyOnlyWithoutPeers
+	}
+	return nil
+}
+
 // GetAbsoluteDownloadDir returns the absolute path of the download directory.
 func (c *Config) GetAbsoluteDownloadDir() string {
 	if filepath.IsAbs(c.DownloadDir) {
@@ -91,3 +525,18 @@ func (c *Config) GetAbsoluteDownloadDir() string {
 
 	return absPath
 }
+
+// GetAbsoluteIncompleteDir returns the absolute path of the incomplete
+// directory, or an empty string if none is configured.
+func (c *Config) GetAbsoluteIncompleteDir() string {
+	if c.IncompleteDir == "" {
+		return ""
+	}
+
+	absPath, err := filepath.Abs(c.IncompleteDir)
+	if err != nil {
+		return c.IncompleteDir
+	}
+
+	return absPath
+}
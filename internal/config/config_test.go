@@ -22,6 +22,10 @@ func TestLoadDefault(t *testing.T) {
 		if config.DownloadDir == "" {
 			t.Error("download directory should not be empty")
 		}
+
+		if config.PeerPort != DefaultPeerPort {
+			t.Errorf("expected peer port %d, got %d", DefaultPeerPort, config.PeerPort)
+		}
 	})
 }
 
@@ -71,6 +75,309 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "未完了ディレクトリがダウンロードディレクトリと同じ",
+			config: &Config{
+				Port:          8080,
+				DownloadDir:   "./downloads",
+				IncompleteDir: "downloads",
+				MaxTorrents:   5,
+				MaxPeers:      200,
+			},
+			wantErr: true,
+		},
+		{
+			name: "負のディスク予約領域",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				DiskReserve: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "パスキーのないトラッカー",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Tracker:     &TrackerConfig{Enabled: true, Interval: 1800, PeerExpiry: 3600},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ピア有効期限が間隔より短いトラッカー",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Tracker:     &TrackerConfig{Enabled: true, Passkey: "secret", Interval: 1800, PeerExpiry: 60},
+			},
+			wantErr: true,
+		},
+		{
+			name: "無効化されたトラッカーは検証しない",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Tracker:     &TrackerConfig{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "負のブロックリスト更新間隔",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Blocklist:   &BlocklistConfig{RefreshInterval: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "負の自動BAN期間",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Bans:        &BanConfig{MaxHashFailures: 3, Duration: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "不明なプロキシ種別",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Proxy:       &ProxyConfig{Type: "socks4", Address: "127.0.0.1:1080"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ポートのないプロキシアドレス",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Proxy:       &ProxyConfig{Type: ProxySOCKS5, Address: "127.0.0.1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "HTTPプロキシ経由のDHT",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Proxy:       &ProxyConfig{Type: ProxyHTTP, Address: "proxy:3128", DHT: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ピアを経由しないプロキシ限定",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Proxy:       &ProxyConfig{Type: ProxySOCKS5, Address: "proxy:1080", ProxyOnly: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "SOCKS5プロキシ限定",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Proxy: &ProxyConfig{
+					Type: ProxySOCKS5, Address: "proxy:1080",
+					Trackers: true, Peers: true, DHT: true, ProxyOnly: true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "不正な暗号化ポリシー",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Encryption:  &EncryptionConfig{Policy: "always"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "暗号化無効でプライベートのみ必須",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Encryption:  &EncryptionConfig{Policy: EncryptionDisabled, RequirePrivate: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "プライベートのみ暗号化必須",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Encryption:  &EncryptionConfig{Policy: EncryptionPrefer, RequirePrivate: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "uTPとTCPの両方を無効化",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Protocols:   &ProtocolConfig{DisableUTP: true, DisableTCP: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "IPv4とIPv6の両方を無効化",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Protocols:   &ProtocolConfig{DisableIPv4: true, DisableIPv6: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DHTとPEXとLSDを無効化",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				Protocols:   &ProtocolConfig{DisableDHT: true, DisablePEX: true, DisableLSD: true, DisableIPv6: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "負のピアポート",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				PeerPort:    -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "逆順のピアポート範囲",
+			config: &Config{
+				Port:          8080,
+				DownloadDir:   "./downloads",
+				MaxTorrents:   5,
+				MaxPeers:      200,
+				PeerPortRange: &PortRange{Min: 7000, Max: 6881},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ピアポート範囲からランダムに選ぶ",
+			config: &Config{
+				Port:          8080,
+				DownloadDir:   "./downloads",
+				MaxTorrents:   5,
+				MaxPeers:      200,
+				PeerPortRange: &PortRange{Min: 6881, Max: 6889},
+			},
+			wantErr: false,
+		},
+		{
+			name: "不明なポートマッピング方式",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				PortMapping: &PortMappingConfig{Enabled: true, Methods: []string{"upnp", "igd"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ホスト名のゲートウェイ",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				PortMapping: &PortMappingConfig{Enabled: true, Gateway: "router.local"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ゲートウェイを指定したポートマッピング",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				PortMapping: &PortMappingConfig{Enabled: true, Methods: []string{"natpmp"}, Gateway: "192.168.1.1:5351"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "ポートのないDHTブートストラップノード",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				DHT:         &DHTConfig{BootstrapNodes: []string{"192.168.1.10"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "LAN内のプライベートDHT",
+			config: &Config{
+				Port:        8080,
+				DownloadDir: "./downloads",
+				MaxTorrents: 5,
+				MaxPeers:    200,
+				DHT: &DHTConfig{
+					BootstrapNodes:         []string{"192.168.1.10:6881", "nas.local:6881", "[fd00::10]:6881"},
+					DisablePublicBootstrap: true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "別の未完了ディレクトリ",
+			config: &Config{
+				Port:          8080,
+				DownloadDir:   "./downloads",
+				IncompleteDir: "./incomplete",
+				MaxTorrents:   5,
+				MaxPeers:      200,
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -83,6 +390,29 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestParsePortRange(t *testing.T) {
+	t.Run("範囲を読み取れる", func(t *testing.T) {
+		r, err := ParsePortRange(" 6881 - 6889 ")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r.Min != 6881 || r.Max != 6889 {
+			t.Errorf("unexpected range: %+v", r)
+		}
+		if r.String() != "6881-6889" {
+			t.Errorf("unexpected string: %s", r.String())
+		}
+	})
+
+	t.Run("不正な範囲を拒否する", func(t *testing.T) {
+		for _, s := range []string{"", "6881", "a-b", "0-10", "6889-6881", "60000-70000"} {
+			if _, err := ParsePortRange(s); err != ErrInvalidPeerPortRange {
+				t.Errorf("expected ErrInvalidPeerPortRange for %q, got %v", s, err)
+			}
+		}
+	})
+}
+
 func TestConfig_GetAbsoluteDownloadDir(t *testing.T) {
 	t.Run("相対パスを絶対パスに変換する", func(t *testing.T) {
 		config := &Config{
@@ -79,6 +79,11 @@ func (l *Loader) loadFromEnv(config *Config) {
 		config.DownloadDir = dir
 	}
 
+	// Check for incomplete directory
+	if dir := os.Getenv(l.envPrefix + "INCOMPLETE_DIR"); dir != "" {
+		config.IncompleteDir = dir
+	}
+
 	// Check for max torrents
 	if maxStr := os.Getenv(l.envPrefix + "MAX_TORRENTS"); maxStr != "" {
 		if maxTorrents := parseInt(maxStr); maxTorrents > 0 {
@@ -33,6 +33,15 @@ type TorrentRecord struct {
 	Metadata     string     `json:"metadata"` // JSON encoded torrent file data
 }
 
+// BanRecord represents a banned address range in the database.
+type BanRecord struct {
+	Prefix    string
+	Reason    string
+	Automatic bool
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
 // NewDB creates a new database connection.
 func NewDB(dbPath string, log logger.Logger) (*DB, error) {
 	db, err := sql.Open("sqlite", dbPath)
@@ -98,6 +107,35 @@ func (d *DB) createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_torrents_status ON torrents(status);
 	CREATE INDEX IF NOT EXISTS idx_torrents_added_at ON torrents(added_at);
 
+	CREATE TABLE IF NOT EXISTS torrent_file_names (
+		torrent_id TEXT NOT NULL,
+		original_path TEXT NOT NULL,
+		path TEXT NOT NULL,
+		PRIMARY KEY (torrent_id, original_path)
+	);
+
+	CREATE TABLE IF NOT EXISTS torrent_file_priorities (
+		torrent_id TEXT NOT NULL,
+		file_index INTEGER NOT NULL,
+		priority TEXT NOT NULL,
+		PRIMARY KEY (torrent_id, file_index)
+	);
+
+	CREATE TABLE IF NOT EXISTS torrent_strategies (
+		torrent_id TEXT NOT NULL,
+		file_index INTEGER NOT NULL,
+		strategy TEXT NOT NULL,
+		PRIMARY KEY (torrent_id, file_index)
+	);
+
+	CREATE TABLE IF NOT EXISTS peer_bans (
+		prefix TEXT PRIMARY KEY,
+		reason TEXT NOT NULL,
+		automatic INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	);
+
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL,
@@ -243,6 +281,18 @@ func (d *DB) DeleteTorrent(id string) error {
 		return errors.InternalErrorf("failed to delete torrent: %v", err)
 	}
 
+	if _, err := d.db.Exec(`DELETE FROM torrent_file_names WHERE torrent_id = ?`, id); err != nil {
+		return errors.InternalErrorf("failed to delete torrent file names: %v", err)
+	}
+
+	if _, err := d.db.Exec(`DELETE FROM torrent_file_priorities WHERE torrent_id = ?`, id); err != nil {
+		return errors.InternalErrorf("failed to delete torrent file priorities: %v", err)
+	}
+
+	if _, err := d.db.Exec(`DELETE FROM torrent_strategies WHERE torrent_id = ?`, id); err != nil {
+		return errors.InternalErrorf("failed to delete torrent strategies: %v", err)
+	}
+
 	rows, err := result.RowsAffected()
 	if err != nil {
 		return errors.InternalErrorf("failed to get rows affected: %v", err)
@@ -305,6 +355,272 @@ func (d *DB) UpdateTorrentStatus(id, status string) error {
 	return nil
 }
 
+// UpdateTorrentDownloadPath updates where a torrent's data is stored.
+func (d *DB) UpdateTorrentDownloadPath(id, path string) error {
+	query := `
+	UPDATE torrents 
+	SET download_path = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+
+	result, err := d.db.Exec(query, path, id)
+	if err != nil {
+		return errors.InternalErrorf("failed to update torrent download path: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.InternalErrorf("failed to get rows affected: %v", err)
+	}
+
+	if rows == 0 {
+		return errors.NotFoundf("torrent %s not found", id)
+	}
+
+	return nil
+}
+
+// SaveFileNames replaces the renamed file paths of a torrent. Names map each
+// file's original path to its current one.
+func (d *DB) SaveFileNames(torrentID string, names map[string]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return errors.InternalErrorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec(`DELETE FROM torrent_file_names WHERE torrent_id = ?`, torrentID); err != nil {
+		return errors.InternalErrorf("failed to clear file names: %v", err)
+	}
+
+	for original, path := range names {
+		_, err := tx.Exec(
+			`INSERT INTO torrent_file_names (torrent_id, original_path, path) VALUES (?, ?, ?)`,
+			torrentID, original, path,
+		)
+		if err != nil {
+			return errors.InternalErrorf("failed to save file name: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.InternalErrorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetFileNames retrieves the renamed file paths of a torrent.
+func (d *DB) GetFileNames(torrentID string) (map[string]string, error) {
+	rows, err := d.db.Query(
+		`SELECT original_path, path FROM torrent_file_names WHERE torrent_id = ?`,
+		torrentID,
+	)
+	if err != nil {
+		return nil, errors.InternalErrorf("failed to get file names: %v", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var original, path string
+		if err := rows.Scan(&original, &path); err != nil {
+			return nil, errors.InternalErrorf("failed to scan file name: %v", err)
+		}
+		names[original] = path
+	}
+
+	return names, rows.Err()
+}
+
+// SaveFilePriorities replaces the file priorities of a torrent. Priorities
+// are given in file index order.
+func (d *DB) SaveFilePriorities(torrentID string, priorities []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return errors.InternalErrorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec(`DELETE FROM torrent_file_priorities WHERE torrent_id = ?`, torrentID); err != nil {
+		return errors.InternalErrorf("failed to clear file priorities: %v", err)
+	}
+
+	for i, priority := range priorities {
+		_, err := tx.Exec(
+			`INSERT INTO torrent_file_priorities (torrent_id, file_index, priority) VALUES (?, ?, ?)`,
+			torrentID, i, priority,
+		)
+		if err != nil {
+			return errors.InternalErrorf("failed to save file priority: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.InternalErrorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetFilePriorities retrieves the file priorities of a torrent in file index
+// order. It returns an empty slice if none have been saved.
+func (d *DB) GetFilePriorities(torrentID string) ([]string, error) {
+	rows, err := d.db.Query(
+		`SELECT file_index, priority FROM torrent_file_priorities WHERE torrent_id = ? ORDER BY file_index`,
+		torrentID,
+	)
+	if err != nil {
+		return nil, errors.InternalErrorf("failed to get file priorities: %v", err)
+	}
+	defer rows.Close()
+
+	var priorities []string
+	for rows.Next() {
+		var index int
+		var priority string
+		if err := rows.Scan(&index, &priority); err != nil {
+			return nil, errors.InternalErrorf("failed to scan file priority: %v", err)
+		}
+		for len(priorities) < index {
+			priorities = append(priorities, "")
+		}
+		priorities = append(priorities, priority)
+	}
+
+	return priorities, rows.Err()
+}
+
+// torrentStrategyIndex is the file index under which the strategy of the
+// whole torrent is stored.
+const torrentStrategyIndex = -1
+
+// SaveDownloadStrategies replaces the download strategies of a torrent: the
+// strategy of the torrent and per-file overrides keyed by file index.
+func (d *DB) SaveDownloadStrategies(torrentID, strategy string, files map[int]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return errors.InternalErrorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec(`DELETE FROM torrent_strategies WHERE torrent_id = ?`, torrentID); err != nil {
+		return errors.InternalErrorf("failed to clear download strategies: %v", err)
+	}
+
+	insert := `INSERT INTO torrent_strategies (torrent_id, file_index, strategy) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(insert, torrentID, torrentStrategyIndex, strategy); err != nil {
+		return errors.InternalErrorf("failed to save download strategy: %v", err)
+	}
+	for index, fileStrategy := range files {
+		if _, err := tx.Exec(insert, torrentID, index, fileStrategy); err != nil {
+			return errors.InternalErrorf("failed to save file download strategy: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.InternalErrorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetDownloadStrategies retrieves the download strategies of a torrent. The
+// strategy is empty if none has been saved.
+func (d *DB) GetDownloadStrategies(torrentID string) (string, map[int]string, error) {
+	rows, err := d.db.Query(
+		`SELECT file_index, strategy FROM torrent_strategies WHERE torrent_id = ?`,
+		torrentID,
+	)
+	if err != nil {
+		return "", nil, errors.InternalErrorf("failed to get download strategies: %v", err)
+	}
+	defer rows.Close()
+
+	var strategy string
+	files := make(map[int]string)
+	for rows.Next() {
+		var index int
+		var s string
+		if err := rows.Scan(&index, &s); err != nil {
+			return "", nil, errors.InternalErrorf("failed to scan download strategy: %v", err)
+		}
+		if index == torrentStrategyIndex {
+			strategy = s
+		} else {
+			files[index] = s
+		}
+	}
+
+	return strategy, files, rows.Err()
+}
+
+// SaveBan saves a peer ban, replacing an earlier ban of the same range.
+func (d *DB) SaveBan(record *BanRecord) error {
+	_, err := d.db.Exec(
+		`INSERT OR REPLACE INTO peer_bans (prefix, reason, automatic, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		record.Prefix, record.Reason, record.Automatic, record.CreatedAt, record.ExpiresAt,
+	)
+	if err != nil {
+		return errors.InternalErrorf("failed to save ban: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteBan deletes the ban of an address range.
+func (d *DB) DeleteBan(prefix string) error {
+	result, err := d.db.Exec(`DELETE FROM peer_bans WHERE prefix = ?`, prefix)
+	if err != nil {
+		return errors.InternalErrorf("failed to delete ban: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.InternalErrorf("failed to get rows affected: %v", err)
+	}
+
+	if rows == 0 {
+		return errors.NotFoundf("ban %s not found", prefix)
+	}
+
+	return nil
+}
+
+// ListBans retrieves all peer bans, deleting those that expired before now.
+func (d *DB) ListBans(now time.Time) ([]*BanRecord, error) {
+	if _, err := d.db.Exec(`DELETE FROM peer_bans WHERE expires_at IS NOT NULL AND expires_at <= ?`, now); err != nil {
+		return nil, errors.InternalErrorf("failed to delete expired bans: %v", err)
+	}
+
+	rows, err := d.db.Query(`SELECT prefix, reason, automatic, created_at, expires_at FROM peer_bans`)
+	if err != nil {
+		return nil, errors.InternalErrorf("failed to list bans: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*BanRecord
+	for rows.Next() {
+		var record BanRecord
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&record.Prefix, &record.Reason, &record.Automatic, &record.CreatedAt, &expiresAt); err != nil {
+			return nil, errors.InternalErrorf("failed to scan ban: %v", err)
+		}
+		if expiresAt.Valid {
+			record.ExpiresAt = &expiresAt.Time
+		}
+		records = append(records, &record)
+	}
+
+	return records, rows.Err()
+}
+
 // ProgressUpdate represents a batch progress update.
 type ProgressUpdate struct {
 	ID         string
@@ -62,6 +62,18 @@ func TestDatabase(t *testing.T) {
 			t.Errorf("failed to update progress: %v", err)
 		}
 
+		// Update download path
+		if err := db.UpdateTorrentDownloadPath("test-id", "/srv/library/Test Torrent"); err != nil {
+			t.Errorf("failed to update download path: %v", err)
+		}
+
+		retrieved, err = db.GetTorrent("test-id")
+		if err != nil {
+			t.Errorf("failed to get torrent: %v", err)
+		} else if retrieved.DownloadPath != "/srv/library/Test Torrent" {
+			t.Errorf("expected download path /srv/library/Test Torrent, got %s", retrieved.DownloadPath)
+		}
+
 		// List torrents
 		torrents, err := db.ListTorrents()
 		if err != nil {
@@ -77,6 +89,43 @@ func TestDatabase(t *testing.T) {
 			t.Errorf("failed to mark completed: %v", err)
 		}
 
+		// Save renamed file paths
+		names := map[string]string{"Test Torrent/a.mkv": "Test Torrent/Episode 1.mkv"}
+		if err := db.SaveFileNames("test-id", names); err != nil {
+			t.Errorf("failed to save file names: %v", err)
+		}
+
+		gotNames, err := db.GetFileNames("test-id")
+		if err != nil {
+			t.Errorf("failed to get file names: %v", err)
+		} else if gotNames["Test Torrent/a.mkv"] != "Test Torrent/Episode 1.mkv" || len(gotNames) != 1 {
+			t.Errorf("unexpected file names: %v", gotNames)
+		}
+
+		// Save file priorities
+		if err := db.SaveFilePriorities("test-id", []string{"skip", "high"}); err != nil {
+			t.Errorf("failed to save file priorities: %v", err)
+		}
+
+		priorities, err := db.GetFilePriorities("test-id")
+		if err != nil {
+			t.Errorf("failed to get file priorities: %v", err)
+		} else if len(priorities) != 2 || priorities[0] != "skip" || priorities[1] != "high" {
+			t.Errorf("unexpected file priorities: %v", priorities)
+		}
+
+		// Save download strategies
+		if err := db.SaveDownloadStrategies("test-id", "sequential", map[int]string{1: "first_last"}); err != nil {
+			t.Errorf("failed to save download strategies: %v", err)
+		}
+
+		strategy, fileStrategies, err := db.GetDownloadStrategies("test-id")
+		if err != nil {
+			t.Errorf("failed to get download strategies: %v", err)
+		} else if strategy != "sequential" || len(fileStrategies) != 1 || fileStrategies[1] != "first_last" {
+			t.Errorf("unexpected download strategies: %s %v", strategy, fileStrategies)
+		}
+
 		// Delete torrent
 		if err := db.DeleteTorrent("test-id"); err != nil {
 			t.Errorf("failed to delete torrent: %v", err)
@@ -87,6 +136,18 @@ func TestDatabase(t *testing.T) {
 		if err == nil {
 			t.Error("expected error for deleted torrent")
 		}
+
+		if gotNames, err := db.GetFileNames("test-id"); err != nil || len(gotNames) != 0 {
+			t.Errorf("expected file names to be deleted with torrent, got %v (%v)", gotNames, err)
+		}
+
+		if priorities, err := db.GetFilePriorities("test-id"); err != nil || len(priorities) != 0 {
+			t.Errorf("expected file priorities to be deleted with torrent, got %v (%v)", priorities, err)
+		}
+
+		if strategy, _, err := db.GetDownloadStrategies("test-id"); err != nil || strategy != "" {
+			t.Errorf("expected download strategies to be deleted with torrent, got %s (%v)", strategy, err)
+		}
 	})
 
 	// Test settings operations
@@ -130,4 +191,40 @@ func TestDatabase(t *testing.T) {
 			t.Errorf("expected language ja, got %v", retrieved["language"])
 		}
 	})
+	// Test ban operations
+	t.Run("BanOperations", func(t *testing.T) {
+		now := time.Now()
+		expired := now.Add(-time.Minute)
+		later := now.Add(time.Hour)
+
+		for _, record := range []*BanRecord{
+			{Prefix: "192.0.2.0/24", Reason: "manual", CreatedAt: now},
+			{Prefix: "198.51.100.7/32", Reason: "corrupt data", Automatic: true, CreatedAt: now, ExpiresAt: &later},
+			{Prefix: "203.0.113.1/32", Reason: "old", CreatedAt: now, ExpiresAt: &expired},
+		} {
+			if err := db.SaveBan(record); err != nil {
+				t.Fatalf("failed to save ban: %v", err)
+			}
+		}
+
+		bans, err := db.ListBans(now)
+		if err != nil {
+			t.Fatalf("failed to list bans: %v", err)
+		}
+		if len(bans) != 2 {
+			t.Fatalf("expected 2 bans, got %d", len(bans))
+		}
+		for _, ban := range bans {
+			if ban.Prefix == "198.51.100.7/32" && (!ban.Automatic || ban.ExpiresAt == nil) {
+				t.Errorf("unexpected automatic ban: %+v", ban)
+			}
+		}
+
+		if err := db.DeleteBan("192.0.2.0/24"); err != nil {
+			t.Errorf("failed to delete ban: %v", err)
+		}
+		if err := db.DeleteBan("192.0.2.0/24"); err == nil {
+			t.Error("expected an error deleting a missing ban")
+		}
+	})
 }
@@ -0,0 +1,48 @@
+// Package disk reports free space on the filesystems holding torrent data.
+package disk
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Usage describes the space on the filesystem holding a path.
+type Usage struct {
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"` // Available to the current user
+}
+
+// StatsProvider reports filesystem usage for a path.
+type StatsProvider interface {
+	Usage(path string) (Usage, error)
+}
+
+// NewStatsProvider returns a StatsProvider backed by the operating system.
+func NewStatsProvider() StatsProvider {
+	return osStatsProvider{}
+}
+
+// osStatsProvider queries the operating system for filesystem usage.
+type osStatsProvider struct{}
+
+// Usage implements StatsProvider. Paths that do not exist yet are resolved
+// to their closest existing parent, since that is the filesystem they will
+// be created on.
+func (osStatsProvider) Usage(path string) (Usage, error) {
+	return usage(existingParent(path))
+}
+
+// existingParent returns path or the closest ancestor of it that exists.
+func existingParent(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
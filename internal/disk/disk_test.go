@@ -0,0 +1,41 @@
+package disk
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStatsProvider(t *testing.T) {
+	t.Run("Existing directory", func(t *testing.T) {
+		u, err := NewStatsProvider().Usage(t.TempDir())
+		if err != nil {
+			t.Fatalf("Usage() error = %v", err)
+		}
+		if u.Total == 0 {
+			t.Error("expected non-zero total space")
+		}
+		if u.Free > u.Total {
+			t.Errorf("free space %d exceeds total %d", u.Free, u.Total)
+		}
+	})
+
+	t.Run("Directory not created yet", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "not", "yet", "created")
+		if _, err := NewStatsProvider().Usage(dir); err != nil {
+			t.Errorf("Usage() error = %v", err)
+		}
+	})
+}
+
+func TestExistingParent(t *testing.T) {
+	dir := t.TempDir()
+
+	if got := existingParent(dir); got != dir {
+		t.Errorf("existingParent(%q) = %q, want itself", dir, got)
+	}
+
+	missing := filepath.Join(dir, "a", "b")
+	if got := existingParent(missing); got != dir {
+		t.Errorf("existingParent(%q) = %q, want %q", missing, got, dir)
+	}
+}
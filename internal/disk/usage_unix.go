@@ -0,0 +1,19 @@
+//go:build !windows
+
+package disk
+
+import "syscall"
+
+// usage returns filesystem usage using statfs.
+func usage(path string) (Usage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Usage{}, err
+	}
+
+	blockSize := uint64(stat.Bsize) //nolint:gosec // block size is never negative
+	return Usage{
+		Total: uint64(stat.Blocks) * blockSize,
+		Free:  uint64(stat.Bavail) * blockSize,
+	}, nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package disk
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// usage returns filesystem usage using GetDiskFreeSpaceExW.
+func usage(path string) (Usage, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	var freeToCaller, total, totalFree uint64
+	ret, _, callErr := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&freeToCaller)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&totalFree)),
+	)
+	if ret == 0 {
+		return Usage{}, callErr
+	}
+
+	return Usage{Total: total, Free: freeToCaller}, nil
+}
@@ -32,6 +32,9 @@ const (
 
 	// ErrCodePermissionDenied indicates permission denied.
 	ErrCodePermissionDenied ErrorCode = "PERMISSION_DENIED"
+
+	// ErrCodeInsufficientStorage indicates there is not enough disk space.
+	ErrCodeInsufficientStorage ErrorCode = "INSUFFICIENT_STORAGE"
 )
 
 // AppError represents a structured application error.
@@ -137,6 +140,12 @@ func IsParseError(err error) bool {
 	return ok && e.Code == ErrCodeParseError
 }
 
+// IsConflict checks if an error is a CONFLICT error.
+func IsConflict(err error) bool {
+	e, ok := err.(*AppError)
+	return ok && e.Code == ErrCodeConflict
+}
+
 // AlreadyExistsf creates a new CONFLICT error with formatting.
 func AlreadyExistsf(format string, args ...interface{}) *AppError {
 	return &AppError{Code: ErrCodeConflict, Message: fmt.Sprintf(format, args...)}
@@ -167,3 +176,14 @@ func ValidationErrorf(format string, args ...interface{}) *AppError {
 func PermissionDeniedf(format string, args ...interface{}) *AppError {
 	return &AppError{Code: ErrCodePermissionDenied, Message: fmt.Sprintf(format, args...)}
 }
+
+// InsufficientStoragef creates a new INSUFFICIENT_STORAGE error with formatting.
+func InsufficientStoragef(format string, args ...interface{}) *AppError {
+	return &AppError{Code: ErrCodeInsufficientStorage, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsInsufficientStorage checks if an error is an INSUFFICIENT_STORAGE error.
+func IsInsufficientStorage(err error) bool {
+	e, ok := err.(*AppError)
+	return ok && e.Code == ErrCodeInsufficientStorage
+}
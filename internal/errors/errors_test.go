@@ -127,6 +127,12 @@ func TestErrorConstructors(t *testing.T) {
 			code:     ErrCodeTimeout,
 			contains: "operation timed out",
 		},
+		{
+			name:     "InsufficientStoragef",
+			fn:       func() *AppError { return InsufficientStoragef("need %d bytes", 1024) },
+			code:     ErrCodeInsufficientStorage,
+			contains: "need 1024 bytes",
+		},
 	}
 
 	for _, tt := range tests {
@@ -191,6 +197,18 @@ func TestErrorCheckers(t *testing.T) {
 			checkFn:  IsInternal,
 			expected: false,
 		},
+		{
+			name:     "IsConflict with Conflict error",
+			err:      AlreadyExistsf("file %s already exists", "a.txt"),
+			checkFn:  IsConflict,
+			expected: true,
+		},
+		{
+			name:     "IsConflict with other error",
+			err:      notFoundErr,
+			checkFn:  IsConflict,
+			expected: false,
+		},
 		{
 			name:     "Checker with non-AppError",
 			err:      errors.New("standard error"),
@@ -0,0 +1,499 @@
+package network
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// Binding holds the addresses of an interface that sockets are bound to, so
+// traffic cannot leave through another interface. The addresses are looked
+// up again by Refresh. A binding without an interface name binds nothing:
+// sockets listen on every address and connect from any.
+type Binding struct {
+	mu    sync.RWMutex
+	name  string
+	addrs []netip.Addr
+}
+
+// NewBinding creates a binding to an interface. It has no addresses until
+// Refresh is called.
+func NewBinding(interfaceName string) *Binding {
+	return &Binding{name: interfaceName}
+}
+
+// BindToInterface returns a binding to the current addresses of an
+// interface, which must exist and be up.
+func BindToInterface(interfaceName string) (*Binding, error) {
+	if interfaceName == "" {
+		return nil, errors.ValidationErrorf("interface name cannot be empty")
+	}
+
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return nil, errors.NotFoundf("interface %q not found", interfaceName)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, errors.ValidationErrorf("interface %q is not up", interfaceName)
+	}
+
+	b := NewBinding(interfaceName)
+	b.Refresh()
+	return b, nil
+}
+
+// InterfaceName returns the name of the bound interface, or "" if nothing
+// is bound.
+func (b *Binding) InterfaceName() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.name
+}
+
+// SetInterface binds to another interface, or to none if name is "", and
+// looks up its addresses. It reports whether the addresses changed; sockets
+// follow them on Rebind.
+func (b *Binding) SetInterface(name string) bool {
+	b.mu.Lock()
+	b.name = name
+	b.mu.Unlock()
+	return b.Refresh()
+}
+
+// Refresh looks up the addresses of the interface, reporting whether they
+// changed. An interface that is missing or down has no addresses.
+func (b *Binding) Refresh() bool {
+	name := b.InterfaceName()
+	addrs := interfaceAddrs(name)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.name != name || slices.Equal(addrs, b.addrs) {
+		// Unchanged, or SetInterface was called meanwhile and refreshes
+		return false
+	}
+	b.addrs = addrs
+	return true
+}
+
+// interfaceAddrs returns the addresses sockets can be bound to on an
+// interface. Link-local IPv6 addresses are skipped as they need a zone.
+// Without an interface the only address is the unspecified one, which
+// listens on every address.
+func interfaceAddrs(name string) []netip.Addr {
+	if name == "" {
+		return []netip.Addr{netip.IPv6Unspecified()}
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil || iface.Flags&net.FlagUp == 0 {
+		return nil
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+
+	var addrs []netip.Addr
+	for _, a := range ifaceAddrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr().Unmap()
+		if ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+			continue
+		}
+		addrs = append(addrs, ip)
+	}
+	return addrs
+}
+
+// Addrs returns the bound addresses.
+func (b *Binding) Addrs() []netip.Addr {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return slices.Clone(b.addrs)
+}
+
+// localAddr picks the bound address to send from. An IPv4 address is
+// preferred unless the remote address is IPv6. Without an interface it
+// returns the zero Addr, leaving the choice to the system.
+func (b *Binding) localAddr(network, remote string) (netip.Addr, error) {
+	wantV6 := network == "tcp6" || network == "udp6"
+	wantV4 := network == "tcp4" || network == "udp4"
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		if ip, err := netip.ParseAddr(host); err == nil {
+			wantV6 = ip.Unmap().Is6()
+			wantV4 = !wantV6
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.name == "" {
+		return netip.Addr{}, nil
+	}
+	for _, ip := range b.addrs {
+		if ip.Is4() && !wantV6 {
+			return ip, nil
+		}
+	}
+	for _, ip := range b.addrs {
+		if ip.Is6() && !wantV4 {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, errors.NetworkError("interface "+b.name+" has no address to send "+remote+" from", nil)
+}
+
+// DialContext connects from a bound address.
+func (b *Binding) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	local, err := b.localAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if !local.IsValid() {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	d := net.Dialer{}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		d.LocalAddr = &net.TCPAddr{IP: local.AsSlice()}
+		network = "tcp4"
+	case "udp", "udp4", "udp6":
+		d.LocalAddr = &net.UDPAddr{IP: local.AsSlice()}
+		network = "udp4"
+	default:
+		return nil, errors.InvalidInputf("network %s cannot be bound", network)
+	}
+	// Host names must resolve to the family of the bound address.
+	if local.Is6() {
+		network = network[:3] + "6"
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// DialUDP connects a UDP socket from a bound address.
+func (b *Binding) DialUDP(ctx context.Context, addr string) (net.Conn, error) {
+	return b.DialContext(ctx, "udp", addr)
+}
+
+// ListenUDP opens a UDP socket on a bound address of the given family, such
+// as for a proxy relay.
+func (b *Binding) ListenUDP(network string) (*net.UDPConn, error) {
+	local, err := b.localAddr(network, "")
+	if err != nil {
+		return nil, err
+	}
+	if !local.IsValid() {
+		return net.ListenUDP(network, nil)
+	}
+	return net.ListenUDP("udp", &net.UDPAddr{IP: local.AsSlice()})
+}
+
+// Listener accepts TCP connections on every bound address at one port.
+// Rebind moves it to the current addresses of the binding.
+type Listener struct {
+	binding *Binding
+	conns   chan net.Conn
+	done    chan struct{}
+
+	mu     sync.Mutex
+	port   int
+	inner  map[netip.Addr]net.Listener
+	closed bool
+}
+
+// Listen starts accepting connections on the bound addresses. If port is 0
+// one is chosen, and kept for the addresses bound later. The listener is
+// returned even if an address could not be listened on.
+func (b *Binding) Listen(port int) (*Listener, error) {
+	l := &Listener{
+		binding: b,
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+		port:    port,
+		inner:   make(map[netip.Addr]net.Listener),
+	}
+	return l, l.Rebind()
+}
+
+// Rebind closes the listeners on addresses that are no longer bound and
+// listens on the new ones.
+func (l *Listener) Rebind() error {
+	addrs := l.binding.Addrs()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+
+	for ip, ln := range l.inner {
+		if !slices.Contains(addrs, ip) {
+			_ = ln.Close()
+			delete(l.inner, ip)
+		}
+	}
+
+	var firstErr error
+	for _, ip := range addrs {
+		if _, ok := l.inner[ip]; ok {
+			continue
+		}
+		ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip.AsSlice(), Port: l.port})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.NetworkError("failed to listen on "+ip.String(), err)
+			}
+			continue
+		}
+		if l.port == 0 {
+			l.port = ln.Addr().(*net.TCPAddr).Port
+		}
+		l.inner[ip] = ln
+		go l.accept(ln)
+	}
+	return firstErr
+}
+
+func (l *Listener) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// Accept waits for a connection on any of the bound addresses.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Addr returns the first address listened on, or the unspecified address
+// if there are none.
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, ip := range l.binding.Addrs() {
+		if _, ok := l.inner[ip]; ok {
+			return &net.TCPAddr{IP: ip.AsSlice(), Port: l.port}
+		}
+	}
+	return &net.TCPAddr{IP: net.IPv4zero, Port: l.port}
+}
+
+// Port returns the port listened on, which is 0 if it is still to be
+// chosen.
+func (l *Listener) Port() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.port
+}
+
+// Addrs returns the addresses listened on.
+func (l *Listener) Addrs() []netip.AddrPort {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var addrs []netip.AddrPort
+	for _, ip := range l.binding.Addrs() {
+		if _, ok := l.inner[ip]; ok {
+			addrs = append(addrs, netip.AddrPortFrom(ip, uint16(l.port)))
+		}
+	}
+	return addrs
+}
+
+// Close stops listening.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	for ip, ln := range l.inner {
+		_ = ln.Close()
+		delete(l.inner, ip)
+	}
+	return nil
+}
+
+// PacketConn is a UDP socket on a bound address, preferring IPv4. Rebind
+// moves it to another address when its own is no longer bound; reads wait
+// while there is none.
+type PacketConn struct {
+	binding *Binding
+	done    chan struct{}
+
+	mu      sync.Mutex
+	port    int
+	conn    *net.UDPConn
+	ip      netip.Addr
+	changed chan struct{}
+	closed  bool
+}
+
+// ListenPacket opens a UDP socket on a bound address. If port is 0 one is
+// chosen, and kept when the socket is moved. The socket is returned even if
+// the address could not be listened on, and tries again on Rebind.
+func (b *Binding) ListenPacket(port int) (*PacketConn, error) {
+	c := &PacketConn{
+		binding: b,
+		done:    make(chan struct{}),
+		port:    port,
+		changed: make(chan struct{}),
+	}
+	return c, c.Rebind()
+}
+
+// Rebind moves the socket to a bound address if its own is gone.
+func (c *PacketConn) Rebind() error {
+	addrs := c.binding.Addrs()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	if c.conn != nil && slices.Contains(addrs, c.ip) {
+		return nil
+	}
+
+	var ip netip.Addr
+	for _, a := range addrs {
+		if a.Is4() {
+			ip = a
+			break
+		}
+	}
+	if !ip.IsValid() && len(addrs) > 0 {
+		ip = addrs[0]
+	}
+
+	var conn *net.UDPConn
+	var err error
+	if ip.IsValid() {
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip.AsSlice(), Port: c.port})
+		if err != nil {
+			err = errors.NetworkError("failed to listen on "+ip.String(), err)
+			ip = netip.Addr{}
+		} else if c.port == 0 {
+			c.port = conn.LocalAddr().(*net.UDPAddr).Port
+		}
+	}
+
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn = conn
+	c.ip = ip
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return err
+}
+
+// current returns the socket and a channel closed when it is replaced.
+func (c *PacketConn) current() (*net.UDPConn, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.changed
+}
+
+// ReadFrom reads a datagram, waiting while no address is bound.
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		conn, changed := c.current()
+		if conn == nil {
+			select {
+			case <-changed:
+				continue
+			case <-c.done:
+				return 0, nil, net.ErrClosed
+			}
+		}
+
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			select {
+			case <-changed:
+				// The socket was replaced while reading
+				continue
+			case <-c.done:
+				return 0, nil, net.ErrClosed
+			default:
+			}
+		}
+		return n, addr, err
+	}
+}
+
+// WriteTo sends a datagram from the bound address.
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	conn, _ := c.current()
+	if conn == nil {
+		return 0, errors.NetworkError("interface "+c.binding.InterfaceName()+" has no address to send from", nil)
+	}
+	return conn.WriteTo(b, addr)
+}
+
+// LocalAddr returns the address of the socket, or the unspecified address
+// if none is bound.
+func (c *PacketConn) LocalAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn.LocalAddr()
+	}
+	return &net.UDPAddr{IP: net.IPv4zero, Port: c.port}
+}
+
+// Close closes the socket.
+func (c *PacketConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// SetDeadline is not supported, as the socket may be replaced.
+func (c *PacketConn) SetDeadline(time.Time) error {
+	return errors.NetworkError("deadlines are not supported on bound sockets", nil)
+}
+
+// SetReadDeadline is not supported, as the socket may be replaced.
+func (c *PacketConn) SetReadDeadline(time.Time) error {
+	return errors.NetworkError("deadlines are not supported on bound sockets", nil)
+}
+
+// SetWriteDeadline is not supported, as the socket may be replaced.
+func (c *PacketConn) SetWriteDeadline(time.Time) error {
+	return errors.NetworkError("deadlines are not supported on bound sockets", nil)
+}
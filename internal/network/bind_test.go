@@ -0,0 +1,190 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+)
+
+// loopbackInterface returns the name of the loopback interface.
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestBinding(t *testing.T) {
+	b, err := BindToInterface(loopbackInterface(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Addrs()) == 0 {
+		t.Fatal("loopback interface has no addresses")
+	}
+	if b.Refresh() {
+		t.Error("Refresh reported a change when the addresses are the same")
+	}
+
+	t.Run("Listener", func(t *testing.T) {
+		l, err := b.Listen(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = l.Close() }()
+		if l.Port() == 0 {
+			t.Fatal("no port was chosen")
+		}
+
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = io.Copy(conn, conn)
+			_ = conn.Close()
+		}()
+
+		conn, err := b.DialContext(context.Background(), "tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		local := conn.LocalAddr().(*net.TCPAddr)
+		if !local.IP.IsLoopback() {
+			t.Errorf("connection was made from %s, not the bound interface", local)
+		}
+	})
+
+	t.Run("PacketConn", func(t *testing.T) {
+		pc, err := b.ListenPacket(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = pc.Close() }()
+
+		conn, err := b.DialUDP(context.Background(), pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 16)
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "ping" || from.String() != conn.LocalAddr().String() {
+			t.Errorf("got %q from %s", buf[:n], from)
+		}
+	})
+}
+
+func TestBinding_NoAddresses(t *testing.T) {
+	b := NewBinding("nonexistent-interface")
+	if b.Refresh() || len(b.Addrs()) != 0 {
+		t.Fatalf("expected no addresses, got %v", b.Addrs())
+	}
+
+	if _, err := b.DialContext(context.Background(), "tcp", "127.0.0.1:80"); err == nil {
+		t.Error("expected dialing without addresses to fail")
+	}
+
+	l, err := b.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Addrs()) != 0 {
+		t.Errorf("expected no listeners, got %v", l.Addrs())
+	}
+
+	pc, err := b.ListenPacket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.WriteTo([]byte("ping"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}); err == nil {
+		t.Error("expected sending without addresses to fail")
+	}
+
+	// Reads wait for an address and end when the socket is closed
+	done := make(chan error)
+	go func() {
+		_, _, err := pc.ReadFrom(make([]byte, 16))
+		done <- err
+	}()
+	_ = pc.Close()
+	_ = l.Close()
+	if err := <-done; err == nil {
+		t.Error("expected the read to fail after Close")
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Error("expected Accept to fail after Close")
+	}
+}
+
+func TestBinding_SetInterface(t *testing.T) {
+	loopback := loopbackInterface(t)
+	b, err := BindToInterface(loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := b.Listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	port := l.Port()
+
+	// Without an interface the listener takes every address at the same port
+	if !b.SetInterface("") {
+		t.Fatal("expected the addresses to change")
+	}
+	if err := l.Rebind(); err != nil {
+		t.Fatalf("failed to re-bind: %v", err)
+	}
+	want := []netip.AddrPort{netip.AddrPortFrom(netip.IPv6Unspecified(), uint16(port))}
+	if got := l.Addrs(); !slices.Equal(got, want) {
+		t.Errorf("listening on %v, want %v", got, want)
+	}
+	conn, err := b.DialContext(context.Background(), "tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("failed to connect unbound: %v", err)
+	}
+	_ = conn.Close()
+
+	if !b.SetInterface(loopback) || b.InterfaceName() != loopback {
+		t.Fatal("expected to be bound to the loopback interface again")
+	}
+	if err := l.Rebind(); err != nil {
+		t.Fatalf("failed to re-bind: %v", err)
+	}
+	for _, a := range l.Addrs() {
+		if a.Addr().IsUnspecified() {
+			t.Errorf("still listening on %v", a)
+		}
+	}
+}
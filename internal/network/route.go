@@ -0,0 +1,234 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math/bits"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// Route flags from the Linux kernel.
+const (
+	routeFlagUp     = 0x0001
+	routeFlagReject = 0x0200
+)
+
+// Route is an entry of the routing table.
+type Route struct {
+	Interface   string
+	Destination netip.Prefix
+	// Gateway is the next hop, or the zero Addr for a directly connected
+	// network.
+	Gateway netip.Addr
+	Metric  int
+}
+
+// String describes the route like the ip route command does.
+func (r Route) String() string {
+	s := r.Destination.String()
+	if r.Destination.Bits() == 0 {
+		s = "default"
+	}
+	if r.Gateway.IsValid() {
+		s += " via " + r.Gateway.String()
+	}
+	return s + " dev " + r.Interface
+}
+
+// RouteTable is a routing table.
+type RouteTable struct {
+	Routes []Route
+}
+
+// Lookup returns the route traffic to an address takes: the most specific
+// route covering it, and of those the one with the lowest metric.
+func (t *RouteTable) Lookup(addr netip.Addr) (Route, bool) {
+	addr = addr.Unmap()
+
+	var best Route
+	found := false
+	for _, r := range t.Routes {
+		if !r.Destination.Contains(addr) {
+			continue
+		}
+		bits, bestBits := r.Destination.Bits(), best.Destination.Bits()
+		if !found || bits > bestBits || (bits == bestBits && r.Metric < best.Metric) {
+			best = r
+			found = true
+		}
+	}
+	return best, found
+}
+
+// RouteProvider reads the routing table.
+type RouteProvider interface {
+	Routes() (*RouteTable, error)
+}
+
+// NewRouteProvider returns a RouteProvider that reads the main routing table
+// of the Linux kernel. Other systems have no route table to read. Policy
+// routing, such as the fwmark rules of wg-quick, is not taken into account.
+func NewRouteProvider() RouteProvider {
+	return NewProcRouteProvider("/proc/net")
+}
+
+// NewProcRouteProvider returns a RouteProvider that reads the route and
+// ipv6_route files of a directory laid out like /proc/net.
+func NewProcRouteProvider(dir string) RouteProvider {
+	return procRouteProvider{dir: dir}
+}
+
+// procRouteProvider reads the routing table from procfs.
+type procRouteProvider struct {
+	dir string
+}
+
+// Routes implements RouteProvider. A missing ipv6_route file, as on systems
+// without IPv6, yields only the IPv4 routes.
+func (p procRouteProvider) Routes() (*RouteTable, error) {
+	f, err := os.Open(filepath.Join(p.dir, "route"))
+	if err != nil {
+		return nil, errors.NotFoundf("route table not available: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	routes, err := ParseIPv4Routes(f)
+	if err != nil {
+		return nil, err
+	}
+
+	f6, err := os.Open(filepath.Join(p.dir, "ipv6_route"))
+	if err != nil {
+		return &RouteTable{Routes: routes}, nil
+	}
+	defer func() { _ = f6.Close() }()
+	routes6, err := ParseIPv6Routes(f6)
+	if err != nil {
+		return nil, err
+	}
+	return &RouteTable{Routes: append(routes, routes6...)}, nil
+}
+
+// ParseIPv4Routes parses routes in the format of /proc/net/route. Routes
+// that are down or reject traffic are skipped.
+func ParseIPv4Routes(r io.Reader) ([]Route, error) {
+	var routes []Route
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line == 1 || len(fields) == 0 {
+			continue // Header
+		}
+		if len(fields) < 8 {
+			return nil, errors.ParseError("route line "+strconv.Itoa(line)+" has too few fields", nil)
+		}
+
+		dst, err1 := parseHexIPv4(fields[1])
+		gateway, err2 := parseHexIPv4(fields[2])
+		flags, err3 := strconv.ParseUint(fields[3], 16, 32)
+		metric, err4 := strconv.Atoi(fields[6])
+		mask, err5 := parseHexIPv4(fields[7])
+		for _, err := range []error{err1, err2, err3, err4, err5} {
+			if err != nil {
+				return nil, errors.ParseError("invalid route on line "+strconv.Itoa(line), err)
+			}
+		}
+		if flags&routeFlagUp == 0 || flags&routeFlagReject != 0 {
+			continue
+		}
+
+		ones := 0
+		for _, b := range mask.As4() {
+			ones += bits.OnesCount8(b)
+		}
+		route := Route{
+			Interface:   fields[0],
+			Destination: netip.PrefixFrom(dst, ones).Masked(),
+			Metric:      metric,
+		}
+		if !gateway.IsUnspecified() {
+			route.Gateway = gateway
+		}
+		routes = append(routes, route)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.ParseError("failed to read routes", err)
+	}
+	return routes, nil
+}
+
+// ParseIPv6Routes parses routes in the format of /proc/net/ipv6_route.
+// Routes that are down or reject traffic are skipped.
+func ParseIPv6Routes(r io.Reader) ([]Route, error) {
+	var routes []Route
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 10 {
+			return nil, errors.ParseError("IPv6 route line "+strconv.Itoa(line)+" has too few fields", nil)
+		}
+
+		dst, err1 := parseHexIPv6(fields[0])
+		bits, err2 := strconv.ParseUint(fields[1], 16, 8)
+		gateway, err3 := parseHexIPv6(fields[4])
+		metric, err4 := strconv.ParseUint(fields[5], 16, 32)
+		flags, err5 := strconv.ParseUint(fields[8], 16, 32)
+		for _, err := range []error{err1, err2, err3, err4, err5} {
+			if err != nil {
+				return nil, errors.ParseError("invalid IPv6 route on line "+strconv.Itoa(line), err)
+			}
+		}
+		if flags&routeFlagUp == 0 || flags&routeFlagReject != 0 || bits > 128 {
+			continue
+		}
+
+		route := Route{
+			Interface:   fields[9],
+			Destination: netip.PrefixFrom(dst, int(bits)).Masked(),
+			Metric:      int(metric),
+		}
+		if !gateway.IsUnspecified() {
+			route.Gateway = gateway
+		}
+		routes = append(routes, route)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.ParseError("failed to read IPv6 routes", err)
+	}
+	return routes, nil
+}
+
+// parseHexIPv4 parses an IPv4 address written as a little-endian hex
+// number, as in /proc/net/route.
+func parseHexIPv4(s string) (netip.Addr, error) {
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(n))
+	return netip.AddrFrom4(b), nil
+}
+
+// parseHexIPv6 parses an IPv6 address written as 32 hex digits, as in
+// /proc/net/ipv6_route.
+func parseHexIPv6(s string) (netip.Addr, error) {
+	var b [16]byte
+	if len(s) != 32 {
+		return netip.Addr{}, errors.InvalidInputf("invalid IPv6 address %q", s)
+	}
+	if _, err := hex.Decode(b[:], []byte(s)); err != nil {
+		return netip.Addr{}, err
+	}
+	return netip.AddrFrom16(b), nil
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	f, err := os.Open("testdata/routes/vpn/route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	routes, err := ParseIPv4Routes(f)
+	if err != nil {
+		t.Fatalf("failed to parse routes: %v", err)
+	}
+	if len(routes) != 5 {
+		t.Fatalf("expected 5 routes, got %d", len(routes))
+	}
+	want := Route{
+		Interface:   "eth0",
+		Destination: netip.MustParsePrefix("0.0.0.0/0"),
+		Gateway:     netip.MustParseAddr("192.168.1.1"),
+		Metric:      100,
+	}
+	if routes[0] != want {
+		t.Errorf("got %+v, want %+v", routes[0], want)
+	}
+	if got := routes[2].Destination; got != netip.MustParsePrefix("128.0.0.0/1") {
+		t.Errorf("got destination %v, want 128.0.0.0/1", got)
+	}
+	if routes[3].Gateway.IsValid() {
+		t.Errorf("directly connected route has gateway %v", routes[3].Gateway)
+	}
+
+	f6, err := os.Open("testdata/routes/vpn/ipv6_route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f6.Close() }()
+	routes, err = ParseIPv6Routes(f6)
+	if err != nil {
+		t.Fatalf("failed to parse IPv6 routes: %v", err)
+	}
+	// The reject route on lo is skipped
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 IPv6 routes, got %d", len(routes))
+	}
+	if got := routes[0].Destination; got != netip.MustParsePrefix("2000::/3") {
+		t.Errorf("got destination %v, want 2000::/3", got)
+	}
+	if got := routes[2].String(); got != "default via fe80::1 dev eth0" {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := ParseIPv4Routes(strings.NewReader("Iface\tDestination\neth0\tzz\n")); err == nil {
+		t.Error("expected an error for a malformed route")
+	}
+}
+
+func TestRouteTable_Lookup(t *testing.T) {
+	table, err := NewProcRouteProvider("testdata/routes/vpn").Routes()
+	if err != nil {
+		t.Fatalf("failed to read routes: %v", err)
+	}
+
+	tests := map[string]string{
+		"8.8.8.8":              "tun0",
+		"208.67.222.222":       "tun0",
+		"192.168.1.20":         "eth0",
+		"10.8.0.9":             "tun0",
+		"2001:4860:4860::8888": "tun0",
+		"fe80::42":             "eth0",
+	}
+	for addr, want := range tests {
+		route, ok := table.Lookup(netip.MustParseAddr(addr))
+		if !ok || route.Interface != want {
+			t.Errorf("Lookup(%s) = %v, %v; want %s", addr, route, ok, want)
+		}
+	}
+
+	empty := &RouteTable{}
+	if _, ok := empty.Lookup(netip.MustParseAddr("8.8.8.8")); ok {
+		t.Error("expected no route in an empty table")
+	}
+}
@@ -3,6 +3,9 @@ package network
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"path"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +19,9 @@ type VPNConfig struct {
 	Enabled       bool   `json:"enabled"`
 	InterfaceName string `json:"interface_name"`
 	KillSwitch    bool   `json:"kill_switch"`
+	// InterfacePatterns are glob patterns, such as "corp-*", for interface
+	// names to treat as VPN interfaces besides the well-known prefixes.
+	InterfacePatterns []string `json:"interface_patterns,omitempty"`
 }
 
 // Interface represents a network interface.
@@ -27,15 +33,78 @@ type Interface struct {
 	IsUp      bool     `json:"is_up"`
 }
 
+// InterfaceProvider looks up network interfaces by name.
+type InterfaceProvider interface {
+	InterfaceByName(name string) (Interface, error)
+}
+
+// NewInterfaceProvider returns an InterfaceProvider backed by the operating
+// system.
+func NewInterfaceProvider() InterfaceProvider {
+	return osInterfaceProvider{}
+}
+
+// osInterfaceProvider queries the operating system for interfaces.
+type osInterfaceProvider struct{}
+
+// InterfaceByName implements InterfaceProvider.
+func (osInterfaceProvider) InterfaceByName(name string) (Interface, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return Interface{}, errors.NotFoundf("interface %q not found", name)
+	}
+	return toInterface(*iface), nil
+}
+
 // Monitor monitors network interfaces and VPN status.
 type Monitor struct {
 	config        *VPNConfig
+	provider      InterfaceProvider
+	routes        RouteProvider
 	logger        logger.Logger
 	checkInterval time.Duration
 	stopCh        chan struct{}
-	mu            sync.RWMutex
-	lastCheck     time.Time
-	vpnActive     bool
+	// checkMu keeps checks, and the OnChange calls they make, in order.
+	checkMu   sync.Mutex
+	mu        sync.RWMutex
+	lastCheck time.Time
+	// lastChange is when the VPN last went up or down, its addresses
+	// changed or a leak was found or fixed.
+	lastChange  time.Time
+	vpnActive   bool
+	addresses   []string
+	leak        string
+	onChange    []func(active bool)
+	subscribers map[chan Status]struct{}
+}
+
+// statusBuffer is how many statuses a subscriber can fall behind by before
+// they are dropped for it.
+const statusBuffer = 16
+
+// Status is the state of the VPN interface seen by a Monitor.
+type Status struct {
+	Active     bool      `json:"active"`
+	LastCheck  time.Time `json:"last_check"`
+	LastChange time.Time `json:"last_change"`
+	// Addresses are the addresses of the interface, in CIDR notation.
+	Addresses []string `json:"addresses"`
+	// Leak reports that the main routing table sends traffic for the
+	// internet around the VPN interface; LeakRoute is the route it takes.
+	// Policy routing is not read, so setups such as wg-quick, which route
+	// through another table by fwmark rules, are reported as leaking.
+	Leak      bool   `json:"leak"`
+	LeakRoute string `json:"leak_route,omitempty"`
+}
+
+// leakProbes are internet addresses whose routes show where peer traffic
+// goes. The IPv4 ones lie in either half of the address space, which VPN
+// clients often route as 0.0.0.0/1 and 128.0.0.0/1 to override the default
+// route.
+var leakProbes = []netip.Addr{
+	netip.MustParseAddr("8.8.8.8"),
+	netip.MustParseAddr("208.67.222.222"),
+	netip.MustParseAddr("2001:4860:4860::8888"),
 }
 
 // NewVPNConfig creates a new VPN configuration with defaults.
@@ -51,9 +120,40 @@ func (c *VPNConfig) Validate() error {
 	if c.Enabled && c.InterfaceName == "" {
 		return errors.ValidationErrorf("interface name is required when VPN binding is enabled")
 	}
+	for _, pattern := range c.InterfacePatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.ValidationErrorf("invalid interface pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// CheckInterface validates the configuration and, if VPN binding is enabled,
+// checks that the interface exists.
+func (c *VPNConfig) CheckInterface(provider InterfaceProvider) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if !c.Enabled {
+		return nil
+	}
+	if _, err := provider.InterfaceByName(c.InterfaceName); err != nil {
+		return errors.ValidationErrorf("interface %q not found", c.InterfaceName)
+	}
 	return nil
 }
 
+// IsVPNInterface checks if an interface name looks like a VPN interface or
+// matches one of the configured patterns.
+func (c *VPNConfig) IsVPNInterface(name string) bool {
+	for _, pattern := range c.InterfacePatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return IsVPNInterface(name)
+}
+
 // GetNetworkInterfaces returns all network interfaces.
 func GetNetworkInterfaces() ([]Interface, error) {
 	interfaces, err := net.Interfaces()
@@ -63,25 +163,30 @@ func GetNetworkInterfaces() ([]Interface, error) {
 
 	var result []Interface
 	for _, iface := range interfaces {
-		ni := Interface{
-			Name:  iface.Name,
-			Index: iface.Index,
-			IsVPN: IsVPNInterface(iface.Name),
-			IsUp:  iface.Flags&net.FlagUp != 0,
-		}
+		result = append(result, toInterface(iface))
+	}
 
-		// Get addresses
-		addrs, err := iface.Addrs()
-		if err == nil {
-			for _, addr := range addrs {
-				ni.Addresses = append(ni.Addresses, addr.String())
-			}
-		}
+	return result, nil
+}
 
-		result = append(result, ni)
+// toInterface describes a system network interface.
+func toInterface(iface net.Interface) Interface {
+	ni := Interface{
+		Name:  iface.Name,
+		Index: iface.Index,
+		IsVPN: IsVPNInterface(iface.Name),
+		IsUp:  iface.Flags&net.FlagUp != 0,
 	}
 
-	return result, nil
+	// Get addresses
+	addrs, err := iface.Addrs()
+	if err == nil {
+		for _, addr := range addrs {
+			ni.Addresses = append(ni.Addresses, addr.String())
+		}
+	}
+
+	return ni
 }
 
 // IsVPNInterface checks if an interface name looks like a VPN interface.
@@ -126,35 +231,28 @@ func GetVPNInterfaces() ([]Interface, error) {
 	return vpnInterfaces, nil
 }
 
-// BindToInterface binds network connections to a specific interface.
-// This is a placeholder - actual implementation would be platform-specific.
-func BindToInterface(interfaceName string) error {
-	if interfaceName == "" {
-		return errors.ValidationErrorf("interface name cannot be empty")
-	}
-
-	// Check if interface exists
-	iface, err := net.InterfaceByName(interfaceName)
-	if err != nil {
-		return errors.NotFoundf("interface %q not found", interfaceName)
-	}
-
-	// Check if interface is up
-	if iface.Flags&net.FlagUp == 0 {
-		return errors.ValidationErrorf("interface %q is not up", interfaceName)
-	}
+// NewNetworkMonitor creates a new network monitor.
+func NewNetworkMonitor(config *VPNConfig) *Monitor {
+	return NewNetworkMonitorWithProviders(config, NewInterfaceProvider(), NewRouteProvider())
+}
 
-	// Note: Actual binding would require platform-specific code
-	// and integration with the torrent client library
-	return nil
+// NewNetworkMonitorWithProvider creates a network monitor that looks up the
+// VPN interface with provider. It does not check routes for leaks.
+func NewNetworkMonitorWithProvider(config *VPNConfig, provider InterfaceProvider) *Monitor {
+	return NewNetworkMonitorWithProviders(config, provider, nil)
 }
 
-// NewNetworkMonitor creates a new network monitor.
-func NewNetworkMonitor(config *VPNConfig) *Monitor {
+// NewNetworkMonitorWithProviders creates a network monitor that looks up the
+// VPN interface with interfaces and checks for leaks in the routing table
+// read by routes. A nil routes skips the leak check.
+func NewNetworkMonitorWithProviders(config *VPNConfig, interfaces InterfaceProvider, routes RouteProvider) *Monitor {
 	monitor := &Monitor{
 		config:        config,
+		provider:      interfaces,
+		routes:        routes,
 		checkInterval: 5 * time.Second,
 		stopCh:        make(chan struct{}),
+		subscribers:   make(map[chan Status]struct{}),
 	}
 	// Set initial state
 	monitor.checkVPNStatus()
@@ -166,6 +264,16 @@ func (m *Monitor) SetLogger(log logger.Logger) {
 	m.logger = log
 }
 
+// OnChange registers a function called when the VPN goes down or comes back
+// up. It is called from the goroutine checking the interface, so it should
+// not block for long. Register functions before calling Start.
+func (m *Monitor) OnChange(fn func(active bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onChange = append(m.onChange, fn)
+}
+
 // Start starts monitoring network interfaces.
 func (m *Monitor) Start() {
 	go m.run()
@@ -194,17 +302,25 @@ func (m *Monitor) run() {
 	}
 }
 
+// Check checks the VPN interface now, without waiting for the next tick.
+func (m *Monitor) Check() {
+	m.checkVPNStatus()
+}
+
 // checkVPNStatus checks if the VPN interface is active.
 func (m *Monitor) checkVPNStatus() {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
 	if !m.config.Enabled {
-		m.setVPNActive(true) // VPN check disabled, always "active"
+		m.setState(true, nil, "") // VPN check disabled, always "active"
 		return
 	}
 
 	// Check if the configured interface exists and is up
-	iface, err := net.InterfaceByName(m.config.InterfaceName)
+	iface, err := m.provider.InterfaceByName(m.config.InterfaceName)
 	if err != nil {
-		m.setVPNActive(false)
+		m.setState(false, nil, "")
 		if m.logger != nil {
 			m.logger.Warn("VPN interface not found",
 				logger.String("interface", m.config.InterfaceName),
@@ -214,8 +330,12 @@ func (m *Monitor) checkVPNStatus() {
 		return
 	}
 
-	isUp := iface.Flags&net.FlagUp != 0
-	m.setVPNActive(isUp)
+	isUp := iface.IsUp
+	leak := ""
+	if isUp {
+		leak = m.checkLeak(iface)
+	}
+	m.setState(isUp, iface.Addresses, leak)
 
 	if !isUp && m.logger != nil {
 		m.logger.Warn("VPN interface is down",
@@ -224,13 +344,149 @@ func (m *Monitor) checkVPNStatus() {
 	}
 }
 
-// setVPNActive updates the VPN active status.
-func (m *Monitor) setVPNActive(active bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// checkLeak looks up the routes of the leak probes for the address families
+// of the VPN interface, and returns the first route that does not go through
+// it. It returns "" if traffic stays on the interface or the routing table
+// cannot be read.
+func (m *Monitor) checkLeak(iface Interface) string {
+	if m.routes == nil {
+		return ""
+	}
+	table, err := m.routes.Routes()
+	if err != nil {
+		if m.logger != nil {
+			m.logger.Debug("skipping VPN leak check", logger.Err(err))
+		}
+		return ""
+	}
+
+	has4, has6 := false, false
+	for _, a := range iface.Addresses {
+		prefix, err := netip.ParsePrefix(a)
+		if err != nil {
+			continue
+		}
+		if prefix.Addr().Is4() {
+			has4 = true
+		} else if prefix.Addr().IsGlobalUnicast() {
+			has6 = true
+		}
+	}
+	// An interface without addresses is checked as IPv4, which every VPN
+	// carries
+	if !has4 && !has6 {
+		has4 = true
+	}
+
+	for _, probe := range leakProbes {
+		if (probe.Is4() && !has4) || (probe.Is6() && !has6) {
+			continue
+		}
+		route, ok := table.Lookup(probe)
+		if ok && route.Interface != iface.Name {
+			return route.String()
+		}
+	}
+	return ""
+}
+
+// setState records the result of a check. The OnChange functions are called
+// if the VPN went up or down, and subscribers are sent the new status if
+// anything changed. leak is the route traffic leaks by, or "" for none.
+func (m *Monitor) setState(active bool, addresses []string, leak string) {
+	now := time.Now()
 
+	m.mu.Lock()
+	first := m.lastCheck.IsZero()
+	activeChanged := m.vpnActive != active && !first
+	leakChanged := m.leak != leak
+	changed := activeChanged || leakChanged || !slices.Equal(m.addresses, addresses)
 	m.vpnActive = active
-	m.lastCheck = time.Now()
+	m.addresses = addresses
+	m.leak = leak
+	m.lastCheck = now
+	if changed || first {
+		m.lastChange = now
+	}
+	status := m.status()
+	onChange := m.onChange
+	if changed && !first {
+		for ch := range m.subscribers {
+			select {
+			case ch <- status:
+			default:
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if leakChanged && m.logger != nil {
+		if leak != "" {
+			m.logger.Warn("traffic is routed around the VPN interface",
+				logger.String("interface", m.config.InterfaceName),
+				logger.String("route", leak),
+			)
+		} else {
+			m.logger.Info("traffic is routed through the VPN interface again",
+				logger.String("interface", m.config.InterfaceName),
+			)
+		}
+	}
+
+	if !activeChanged {
+		return
+	}
+	if m.logger != nil {
+		m.logger.Info("VPN status changed",
+			logger.String("interface", m.config.InterfaceName),
+			logger.Bool("active", active),
+		)
+	}
+	for _, fn := range onChange {
+		fn(active)
+	}
+}
+
+// Status returns the state of the VPN interface as of the last check.
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.status()
+}
+
+// status returns the current status. The caller must hold m.mu.
+func (m *Monitor) status() Status {
+	return Status{
+		Active:     m.vpnActive,
+		LastCheck:  m.lastCheck,
+		LastChange: m.lastChange,
+		Addresses:  slices.Clone(m.addresses),
+		Leak:       m.leak != "",
+		LeakRoute:  m.leak,
+	}
+}
+
+// Subscribe returns a channel receiving the status whenever the VPN goes up
+// or down, its addresses change or a leak is found or fixed, and a function that ends the
+// subscription. Statuses are dropped for a subscriber that falls too far
+// behind.
+func (m *Monitor) Subscribe() (<-chan Status, func()) {
+	ch := make(chan Status, statusBuffer)
+
+	m.mu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subscribers, ch)
+			m.mu.Unlock()
+			close(ch)
+		})
+	}
 }
 
 // IsVPNActive returns whether the VPN is currently active.
@@ -1,7 +1,12 @@
 package network
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+
+	"github.com/ayutaz/orochi/internal/errors"
 )
 
 func TestVPNBinding(t *testing.T) {
@@ -75,13 +80,13 @@ func TestVPNBinding(t *testing.T) {
 		// So we'll test error handling instead
 
 		// Test with invalid interface name
-		err := BindToInterface("nonexistent-interface")
+		_, err := BindToInterface("nonexistent-interface")
 		if err == nil {
 			t.Error("Expected error for non-existent interface")
 		}
 
 		// Test with empty interface name
-		err = BindToInterface("")
+		_, err = BindToInterface("")
 		if err == nil {
 			t.Error("Expected error for empty interface name")
 		}
@@ -134,6 +139,13 @@ func TestVPNConfig(t *testing.T) {
 				},
 				wantErr: true,
 			},
+			{
+				name: "Invalid - malformed interface pattern",
+				config: &VPNConfig{
+					InterfacePatterns: []string{"corp-["},
+				},
+				wantErr: true,
+			},
 		}
 
 		for _, tt := range tests {
@@ -147,6 +159,23 @@ func TestVPNConfig(t *testing.T) {
 	})
 }
 
+func TestVPNConfig_IsVPNInterface(t *testing.T) {
+	config := &VPNConfig{InterfacePatterns: []string{"corp-*", "enp0s31f6"}}
+
+	tests := map[string]bool{
+		"corp-vpn":  true,
+		"enp0s31f6": true,
+		"wg0":       true,
+		"eth0":      false,
+		"corp":      false,
+	}
+	for name, want := range tests {
+		if got := config.IsVPNInterface(name); got != want {
+			t.Errorf("IsVPNInterface(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
 func TestNetworkMonitor(t *testing.T) {
 	t.Run("NewNetworkMonitor", func(t *testing.T) {
 		config := &VPNConfig{
@@ -196,3 +225,171 @@ func TestNetworkMonitor(t *testing.T) {
 		}
 	})
 }
+
+// fakeInterfaces is an InterfaceProvider whose interfaces are set by tests.
+type fakeInterfaces map[string]Interface
+
+func (f fakeInterfaces) InterfaceByName(name string) (Interface, error) {
+	iface, ok := f[name]
+	if !ok {
+		return Interface{}, errors.NotFoundf("interface %q not found", name)
+	}
+	return iface, nil
+}
+
+func TestNetworkMonitor_OnChange(t *testing.T) {
+	interfaces := fakeInterfaces{"tun0": {Name: "tun0", Index: 1, IsUp: true}}
+	config := &VPNConfig{Enabled: true, InterfaceName: "tun0", KillSwitch: true}
+	monitor := NewNetworkMonitorWithProvider(config, interfaces)
+
+	var changes []bool
+	monitor.OnChange(func(active bool) { changes = append(changes, active) })
+
+	monitor.Check()
+	if len(changes) != 0 || !monitor.IsVPNActive() {
+		t.Fatalf("expected no change while the VPN is up, got %v", changes)
+	}
+
+	interfaces["tun0"] = Interface{Name: "tun0", Index: 1, IsUp: false}
+	monitor.Check()
+	if monitor.ShouldAllowConnection() {
+		t.Error("connections allowed while the VPN is down")
+	}
+
+	delete(interfaces, "tun0")
+	monitor.Check()
+
+	interfaces["tun0"] = Interface{Name: "tun0", Index: 1, IsUp: true}
+	monitor.Check()
+
+	if want := []bool{false, true}; !slices.Equal(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestNetworkMonitor_Subscribe(t *testing.T) {
+	interfaces := fakeInterfaces{"tun0": {Name: "tun0", Index: 1, IsUp: true, Addresses: []string{"10.8.0.2/24"}}}
+	monitor := NewNetworkMonitorWithProvider(&VPNConfig{Enabled: true, InterfaceName: "tun0"}, interfaces)
+
+	status := monitor.Status()
+	if !status.Active || status.LastCheck.IsZero() || status.LastChange.IsZero() ||
+		!slices.Equal(status.Addresses, []string{"10.8.0.2/24"}) {
+		t.Fatalf("unexpected initial status: %+v", status)
+	}
+
+	statuses, unsubscribe := monitor.Subscribe()
+	defer unsubscribe()
+
+	// Checks that find nothing new send nothing
+	monitor.Check()
+	select {
+	case s := <-statuses:
+		t.Fatalf("unexpected status without a change: %+v", s)
+	default:
+	}
+	if got := monitor.Status().LastChange; !got.Equal(status.LastChange) {
+		t.Errorf("last change moved from %v to %v without a change", status.LastChange, got)
+	}
+
+	interfaces["tun0"] = Interface{Name: "tun0", Index: 1, IsUp: true, Addresses: []string{"10.8.0.3/24"}}
+	monitor.Check()
+	s := <-statuses
+	if !s.Active || !slices.Equal(s.Addresses, []string{"10.8.0.3/24"}) || !s.LastChange.After(status.LastChange) {
+		t.Errorf("unexpected status after the address changed: %+v", s)
+	}
+
+	delete(interfaces, "tun0")
+	monitor.Check()
+	if s := <-statuses; s.Active || len(s.Addresses) != 0 {
+		t.Errorf("unexpected status after the interface went away: %+v", s)
+	}
+
+	unsubscribe()
+	if _, ok := <-statuses; ok {
+		t.Error("expected the channel to be closed after unsubscribing")
+	}
+}
+
+func TestNetworkMonitor_Leak(t *testing.T) {
+	interfaces := fakeInterfaces{"tun0": {Name: "tun0", Index: 1, IsUp: true, Addresses: []string{"10.8.0.2/24"}}}
+	config := &VPNConfig{Enabled: true, InterfaceName: "tun0", KillSwitch: true}
+
+	t.Run("RoutedThroughVPN", func(t *testing.T) {
+		monitor := NewNetworkMonitorWithProviders(config, interfaces, NewProcRouteProvider("testdata/routes/vpn"))
+		if status := monitor.Status(); status.Leak || status.LeakRoute != "" {
+			t.Errorf("unexpected leak: %+v", status)
+		}
+	})
+
+	t.Run("DefaultRouteAroundVPN", func(t *testing.T) {
+		monitor := NewNetworkMonitorWithProviders(config, interfaces, NewProcRouteProvider("testdata/routes/leak"))
+		status := monitor.Status()
+		if !status.Leak || status.LeakRoute != "default via 192.168.1.1 dev eth0" {
+			t.Errorf("expected a leak by the default route, got %+v", status)
+		}
+		if !monitor.ShouldAllowConnection() {
+			t.Error("a leak should be flagged, not block connections")
+		}
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		// Only the IPv6 default route bypasses the VPN
+		dir := t.TempDir()
+		copyFile(t, "testdata/routes/vpn/route", filepath.Join(dir, "route"))
+		copyFile(t, "testdata/routes/leak/ipv6_route", filepath.Join(dir, "ipv6_route"))
+
+		monitor := NewNetworkMonitorWithProviders(config, interfaces, NewProcRouteProvider(dir))
+		if monitor.Status().Leak {
+			t.Error("an IPv4-only VPN should not be checked for IPv6 leaks")
+		}
+
+		dual := fakeInterfaces{"tun0": {Name: "tun0", Index: 1, IsUp: true,
+			Addresses: []string{"10.8.0.2/24", "fd00::2/64", "2001:db8::2/64"}}}
+		monitor = NewNetworkMonitorWithProviders(config, dual, NewProcRouteProvider(dir))
+		status := monitor.Status()
+		if !status.Leak || status.LeakRoute != "default via fe80::1 dev eth0" {
+			t.Errorf("expected an IPv6 leak, got %+v", status)
+		}
+	})
+
+	t.Run("FixedLeakIsPublished", func(t *testing.T) {
+		routes := &fakeRoutes{dir: "testdata/routes/leak"}
+		monitor := NewNetworkMonitorWithProviders(config, interfaces, routes)
+		statuses, unsubscribe := monitor.Subscribe()
+		defer unsubscribe()
+
+		routes.dir = "testdata/routes/vpn"
+		monitor.Check()
+		if s := <-statuses; s.Leak || !s.Active {
+			t.Errorf("expected the leak to be fixed, got %+v", s)
+		}
+	})
+
+	t.Run("NoRouteTable", func(t *testing.T) {
+		monitor := NewNetworkMonitorWithProviders(config, interfaces, NewProcRouteProvider(t.TempDir()))
+		if status := monitor.Status(); status.Leak || !status.Active {
+			t.Errorf("an unreadable route table should skip the check, got %+v", status)
+		}
+	})
+}
+
+// fakeRoutes is a RouteProvider reading fixtures from a directory that tests
+// can switch.
+type fakeRoutes struct {
+	dir string
+}
+
+func (f *fakeRoutes) Routes() (*RouteTable, error) {
+	return NewProcRouteProvider(f.dir).Routes()
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// ServerPort is the port NAT-PMP and PCP servers listen on.
+const ServerPort = 5351
+
+// natpmpRetries bounds the requests sent to a NAT-PMP or PCP server that
+// does not answer. The first waits 250ms and each one waits twice as long,
+// as RFC 6886 recommends, though it gives up sooner.
+const natpmpRetries = 4
+
+// NAT-PMP opcodes.
+const (
+	natpmpOpExternalAddress = 0
+	natpmpOpMapUDP          = 1
+	natpmpOpMapTCP          = 2
+)
+
+// natpmpGateway maps ports with NAT-PMP (RFC 6886).
+type natpmpGateway struct {
+	addr netip.AddrPort
+}
+
+func (g *natpmpGateway) method() string { return NATPMP }
+
+func (g *natpmpGateway) String() string { return g.addr.String() }
+
+// externalIP asks the gateway for its external address.
+func (g *natpmpGateway) externalIP(ctx context.Context) (netip.Addr, error) {
+	resp, err := exchange(ctx, g.addr, []byte{0, natpmpOpExternalAddress}, func(b []byte) bool {
+		return len(b) >= 12 && b[0] == 0 && b[1] == 128+natpmpOpExternalAddress
+	})
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if err := natpmpResult(binary.BigEndian.Uint16(resp[2:4])); err != nil {
+		return netip.Addr{}, err
+	}
+	return netip.AddrFrom4([4]byte(resp[8:12])), nil
+}
+
+// mapPort maps or, with a zero lifetime, removes a port mapping.
+func (g *natpmpGateway) mapPort(ctx context.Context, m mapping, lifetime time.Duration) (mapping, error) {
+	op := byte(natpmpOpMapTCP)
+	if m.protocol == UDP {
+		op = natpmpOpMapUDP
+	}
+	req := make([]byte, 12)
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], uint16(m.internalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(m.externalPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime/time.Second))
+
+	resp, err := exchange(ctx, g.addr, req, func(b []byte) bool {
+		return len(b) >= 16 && b[0] == 0 && b[1] == 128+op &&
+			binary.BigEndian.Uint16(b[8:10]) == uint16(m.internalPort)
+	})
+	if err != nil {
+		return m, err
+	}
+	if err := natpmpResult(binary.BigEndian.Uint16(resp[2:4])); err != nil {
+		return m, err
+	}
+	m.externalPort = int(binary.BigEndian.Uint16(resp[10:12]))
+	m.lifetime = time.Duration(binary.BigEndian.Uint32(resp[12:16])) * time.Second
+	return m, nil
+}
+
+func (g *natpmpGateway) unmapPort(ctx context.Context, m mapping) error {
+	// The external port is left out, as RFC 6886 asks of deletions
+	m.externalPort = 0
+	_, err := g.mapPort(ctx, m, 0)
+	return err
+}
+
+// natpmpResult turns a NAT-PMP result code into an error.
+func natpmpResult(code uint16) error {
+	switch code {
+	case 0:
+		return nil
+	case 1:
+		return errors.NetworkError("NAT-PMP: unsupported version", nil)
+	case 2:
+		return errors.NetworkError("NAT-PMP: not authorized", nil)
+	case 3:
+		return errors.NetworkError("NAT-PMP: network failure", nil)
+	case 4:
+		return errors.NetworkError("NAT-PMP: out of resources", nil)
+	case 5:
+		return errors.NetworkError("NAT-PMP: unsupported opcode", nil)
+	default:
+		return errors.NetworkError(fmt.Sprintf("NAT-PMP: result code %d", code), nil)
+	}
+}
+
+// exchange sends a request to a NAT-PMP or PCP server and returns the first
+// datagram accepted by match, resending the request while none arrives.
+func exchange(ctx context.Context, addr netip.AddrPort, req []byte, match func([]byte) bool) ([]byte, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(addr))
+	if err != nil {
+		return nil, errors.NetworkError("failed to reach gateway "+addr.String(), err)
+	}
+	defer conn.Close()
+	return exchangeOn(ctx, conn, req, match)
+}
+
+// exchangeOn is exchange on a connected socket.
+func exchangeOn(ctx context.Context, conn *net.UDPConn, req []byte, match func([]byte) bool) ([]byte, error) {
+	buf := make([]byte, 1100)
+	wait := 250 * time.Millisecond
+	for range natpmpRetries {
+		if _, err := conn.Write(req); err != nil {
+			return nil, errors.NetworkError("failed to send to gateway", err)
+		}
+		deadline := time.Now().Add(wait)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		_ = conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if match(buf[:n]) {
+				return buf[:n], nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, errors.Timeout("gateway did not answer")
+		}
+		wait *= 2
+	}
+	return nil, errors.Timeout("gateway did not answer")
+}
@@ -0,0 +1,143 @@
+package portmap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// PCP constants (RFC 6887).
+const (
+	pcpVersion     = 2
+	pcpOpMap       = 1
+	pcpResponseBit = 0x80
+	pcpHeaderSize  = 24
+	pcpMapSize     = 36
+	pcpProtocolTCP = 6
+	pcpProtocolUDP = 17
+)
+
+// pcpGateway maps ports with the Port Control Protocol (RFC 6887), the
+// successor of NAT-PMP.
+type pcpGateway struct {
+	addr netip.AddrPort
+	// nonces identify the mappings to the server, which only lets the
+	// client that made a mapping renew or remove it.
+	nonces map[string][12]byte
+}
+
+func newPCPGateway(addr netip.AddrPort) *pcpGateway {
+	return &pcpGateway{addr: addr, nonces: make(map[string][12]byte)}
+}
+
+func (g *pcpGateway) method() string { return PCP }
+
+func (g *pcpGateway) String() string { return g.addr.String() }
+
+// externalIP is learnt from mappings, as PCP has no request for it.
+func (g *pcpGateway) externalIP(context.Context) (netip.Addr, error) {
+	return netip.Addr{}, nil
+}
+
+// mapPort maps or, with a zero lifetime, removes a port mapping with a MAP
+// request.
+func (g *pcpGateway) mapPort(ctx context.Context, m mapping, lifetime time.Duration) (mapping, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(g.addr))
+	if err != nil {
+		return m, errors.NetworkError("failed to reach gateway "+g.addr.String(), err)
+	}
+	defer conn.Close()
+
+	key := fmt.Sprintf("%s/%d", m.protocol, m.internalPort)
+	nonce, ok := g.nonces[key]
+	if !ok {
+		_, _ = rand.Read(nonce[:])
+		g.nonces[key] = nonce
+	}
+	protocol := byte(pcpProtocolTCP)
+	if m.protocol == UDP {
+		protocol = pcpProtocolUDP
+	}
+
+	// The server checks the client address against the request's source
+	client := conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr()
+	req := make([]byte, pcpHeaderSize+pcpMapSize)
+	req[0] = pcpVersion
+	req[1] = pcpOpMap
+	binary.BigEndian.PutUint32(req[4:8], uint32(lifetime/time.Second))
+	clientIP := client.As16()
+	copy(req[8:24], clientIP[:])
+	payload := req[pcpHeaderSize:]
+	copy(payload[0:12], nonce[:])
+	payload[12] = protocol
+	binary.BigEndian.PutUint16(payload[16:18], uint16(m.internalPort))
+	binary.BigEndian.PutUint16(payload[18:20], uint16(m.externalPort))
+	// Any external IPv4 address
+	payload[30], payload[31] = 0xff, 0xff
+
+	resp, err := exchangeOn(ctx, conn, req, func(b []byte) bool {
+		// NAT-PMP servers answer version 0 with an unsupported version
+		if len(b) >= 4 && b[0] == 0 {
+			return true
+		}
+		return len(b) >= pcpHeaderSize+pcpMapSize && b[0] == pcpVersion &&
+			b[1] == pcpResponseBit|pcpOpMap && [12]byte(b[pcpHeaderSize:pcpHeaderSize+12]) == nonce
+	})
+	if err != nil {
+		return m, err
+	}
+	if resp[0] != pcpVersion {
+		return m, errors.NetworkError("PCP: gateway only speaks NAT-PMP", nil)
+	}
+	if err := pcpResult(resp[3]); err != nil {
+		return m, err
+	}
+	if lifetime == 0 {
+		delete(g.nonces, key)
+	}
+
+	payload = resp[pcpHeaderSize:]
+	m.externalPort = int(binary.BigEndian.Uint16(payload[18:20]))
+	m.externalIP = netip.AddrFrom16([16]byte(payload[20:36])).Unmap()
+	m.lifetime = time.Duration(binary.BigEndian.Uint32(resp[4:8])) * time.Second
+	return m, nil
+}
+
+func (g *pcpGateway) unmapPort(ctx context.Context, m mapping) error {
+	_, err := g.mapPort(ctx, m, 0)
+	return err
+}
+
+// pcpResults names the PCP result codes.
+var pcpResults = map[byte]string{
+	1:  "unsupported version",
+	2:  "not authorized",
+	3:  "malformed request",
+	4:  "unsupported opcode",
+	5:  "unsupported option",
+	6:  "malformed option",
+	7:  "network failure",
+	8:  "no resources",
+	9:  "unsupported protocol",
+	10: "user exceeded quota",
+	11: "cannot provide external address",
+	12: "address mismatch",
+	13: "excessive remote peers",
+}
+
+// pcpResult turns a PCP result code into an error.
+func pcpResult(code byte) error {
+	if code == 0 {
+		return nil
+	}
+	if name, ok := pcpResults[code]; ok {
+		return errors.NetworkError("PCP: "+name, nil)
+	}
+	return errors.NetworkError(fmt.Sprintf("PCP: result code %d", code), nil)
+}
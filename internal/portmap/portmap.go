@@ -0,0 +1,436 @@
+// Package portmap maps ports on the router with PCP, NAT-PMP or UPnP-IGD,
+// so peers outside the local network can connect.
+package portmap
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+)
+
+// Mapping methods.
+const (
+	PCP    = "pcp"
+	NATPMP = "natpmp"
+	UPnP   = "upnp"
+)
+
+// Protocols of mapped ports.
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+const (
+	// DefaultLifetime is the lease asked for when none is configured.
+	DefaultLifetime = 2 * time.Hour
+	// retryInterval is the pause after failing to map the port.
+	retryInterval = time.Minute
+	// requestTimeout bounds the requests to a gateway for one protocol.
+	requestTimeout = 10 * time.Second
+	// minRenewInterval keeps gateways granting very short leases from
+	// being asked too often.
+	minRenewInterval = time.Second
+)
+
+// DefaultMethods are tried in order when none are configured.
+var DefaultMethods = []string{PCP, NATPMP, UPnP}
+
+// gateway is a router that maps ports by one method.
+type gateway interface {
+	method() string
+	// String describes the gateway, such as by its address.
+	String() string
+	// mapPort maps the internal port of m to its external port, or to the
+	// one the gateway picks, for lifetime. A zero lifetime in the result
+	// means the mapping is permanent.
+	mapPort(ctx context.Context, m mapping, lifetime time.Duration) (mapping, error)
+	unmapPort(ctx context.Context, m mapping) error
+	// externalIP returns the external address, or the zero Addr if the
+	// method has no way to ask for it.
+	externalIP(ctx context.Context) (netip.Addr, error)
+}
+
+// mapping is a port mapped on a gateway.
+type mapping struct {
+	protocol     string
+	internalPort int
+	externalPort int
+	// externalIP is set by methods that report it with the mapping.
+	externalIP netip.Addr
+	lifetime   time.Duration
+}
+
+// Options configures a Mapper.
+type Options struct {
+	// Methods are tried in order until one maps the port. Empty uses
+	// DefaultMethods.
+	Methods []string
+	// Gateway is the PCP and NAT-PMP server. The zero value uses the
+	// default gateway of Routes on ServerPort.
+	Gateway netip.AddrPort
+	// RootDesc is the URL of the description of the UPnP gateway. Empty
+	// searches for one with SSDP.
+	RootDesc string
+	// SSDPAddr is where UPnP gateways are searched for. The zero value is
+	// SSDPAddr.
+	SSDPAddr netip.AddrPort
+	// Lifetime is the lease asked for. Zero is DefaultLifetime.
+	Lifetime time.Duration
+	// Description names the mappings on UPnP gateways.
+	Description string
+	// Routes finds the default gateway. Nil reads the system routing
+	// table.
+	Routes network.RouteProvider
+	// HTTPClient talks to UPnP gateways. Nil uses a client that only
+	// reaches the local network, without a proxy.
+	HTTPClient *http.Client
+	Logger     logger.Logger
+}
+
+// Status is the state of the port mappings of a Mapper.
+type Status struct {
+	// Method is the method the port was mapped with.
+	Method string `json:"method,omitempty"`
+	// Gateway is the address or control URL of the gateway.
+	Gateway      string `json:"gateway,omitempty"`
+	ExternalIP   string `json:"external_ip,omitempty"`
+	InternalPort int    `json:"internal_port,omitempty"`
+	// Mappings are the ports mapped, empty while none are.
+	Mappings []MappingStatus `json:"mappings"`
+	// Error is why the port could not be mapped or renewed. Mappings made
+	// before a failed renewal are kept until they expire.
+	Error       string    `json:"error,omitempty"`
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// MappingStatus describes a mapped port.
+type MappingStatus struct {
+	Protocol     string `json:"protocol"`
+	ExternalPort int    `json:"external_port"`
+	// ExpiresAt is when the lease ends unless renewed, nil for permanent
+	// mappings.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Mapper maps a port and renews the leases until it is stopped, which
+// removes the mappings.
+type Mapper struct {
+	opts Options
+	// stop ends the mapping started last.
+	stop func()
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a Mapper. It maps nothing until Start is called.
+func New(opts Options) *Mapper {
+	if len(opts.Methods) == 0 {
+		opts.Methods = DefaultMethods
+	}
+	if opts.Lifetime <= 0 {
+		opts.Lifetime = DefaultLifetime
+	}
+	if !opts.SSDPAddr.IsValid() {
+		opts.SSDPAddr = SSDPAddr
+	}
+	if opts.Description == "" {
+		opts.Description = "Orochi"
+	}
+	if opts.Routes == nil {
+		opts.Routes = network.NewRouteProvider()
+	}
+	if opts.HTTPClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		opts.HTTPClient = &http.Client{Timeout: requestTimeout, Transport: transport}
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.NewWithLevel(logger.InfoLevel)
+	}
+	return &Mapper{
+		opts:   opts,
+		stop:   func() {},
+		status: Status{Mappings: []MappingStatus{}},
+	}
+}
+
+// Start maps port for protocols in the background, after removing the
+// mappings of an earlier call.
+func (m *Mapper) Start(port int, protocols []string) {
+	m.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.run(ctx, port, protocols)
+	}()
+	m.stop = func() {
+		cancel()
+		<-done
+	}
+}
+
+// Stop removes the mappings and stops renewing them. Start and Stop must
+// not be called concurrently.
+func (m *Mapper) Stop() {
+	m.stop()
+	m.stop = func() {}
+
+	m.mu.Lock()
+	m.status = Status{Mappings: []MappingStatus{}}
+	m.mu.Unlock()
+}
+
+// Status returns the state of the mappings.
+func (m *Mapper) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := m.status
+	status.Mappings = append([]MappingStatus{}, m.status.Mappings...)
+	return status
+}
+
+// run maps the port and renews the mappings until ctx is done, then
+// removes them. A gateway that fails to renew is looked for again.
+func (m *Mapper) run(ctx context.Context, port int, protocols []string) {
+	var gw gateway
+	var mapped []mapping
+	defer func() {
+		if gw != nil {
+			m.unmapAll(gw, mapped)
+		}
+	}()
+
+	// lastErr keeps a gateway that stays unreachable from filling the log
+	var lastErr string
+	for {
+		var err error
+		if gw != nil {
+			var renewed []mapping
+			if renewed, err = m.mapAll(ctx, gw, port, protocols, mapped); err == nil {
+				mapped = renewed
+			} else if ctx.Err() == nil {
+				m.opts.Logger.Warn("failed to renew port mapping",
+					logger.String("method", gw.method()),
+					logger.String("gateway", gw.String()),
+					logger.Err(err),
+				)
+				gw, mapped = nil, nil
+			}
+		}
+		if gw == nil {
+			gw, mapped, err = m.discover(ctx, port, protocols)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := retryInterval
+		if err != nil {
+			m.setError(port, err)
+			if err.Error() != lastErr {
+				m.opts.Logger.Warn("failed to map peer port", logger.Int("port", port), logger.Err(err))
+			}
+			lastErr = err.Error()
+		} else {
+			wait = m.setMapped(ctx, gw, port, mapped)
+			lastErr = ""
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// discover tries the methods in order until one maps the port.
+func (m *Mapper) discover(ctx context.Context, port int, protocols []string) (gateway, []mapping, error) {
+	var failures []string
+	for _, method := range m.opts.Methods {
+		gw, err := m.gateway(ctx, method)
+		if err == nil {
+			var mapped []mapping
+			if mapped, err = m.mapAll(ctx, gw, port, protocols, nil); err == nil {
+				m.opts.Logger.Info("peer port mapped",
+					logger.String("method", method),
+					logger.String("gateway", gw.String()),
+					logger.Int("port", port),
+				)
+				return gw, mapped, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		failures = append(failures, method+": "+err.Error())
+	}
+	return nil, nil, errors.NetworkError(strings.Join(failures, "; "), nil)
+}
+
+// gateway finds the gateway of a method.
+func (m *Mapper) gateway(ctx context.Context, method string) (gateway, error) {
+	switch method {
+	case PCP, NATPMP:
+		addr := m.opts.Gateway
+		if !addr.IsValid() {
+			gw, err := m.defaultGateway()
+			if err != nil {
+				return nil, err
+			}
+			addr = netip.AddrPortFrom(gw, ServerPort)
+		}
+		if method == PCP {
+			return newPCPGateway(addr), nil
+		}
+		return &natpmpGateway{addr: addr}, nil
+	case UPnP:
+		location := m.opts.RootDesc
+		if location == "" {
+			ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+			defer cancel()
+			var err error
+			if location, err = discoverUPnP(ctx, m.opts.SSDPAddr); err != nil {
+				return nil, err
+			}
+		}
+		return newUPnPGateway(ctx, m.opts.HTTPClient, location, m.opts.Description)
+	default:
+		return nil, errors.InvalidInputf("unknown port mapping method %q", method)
+	}
+}
+
+// defaultGateway returns the IPv4 default gateway.
+func (m *Mapper) defaultGateway() (netip.Addr, error) {
+	table, err := m.opts.Routes.Routes()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	route, ok := table.Lookup(netip.IPv4Unspecified())
+	if !ok || !route.Gateway.IsValid() {
+		return netip.Addr{}, errors.NotFound("no default gateway")
+	}
+	return route.Gateway, nil
+}
+
+// mapAll maps port for every protocol, renewing the mappings made before
+// with the external ports they were given.
+func (m *Mapper) mapAll(ctx context.Context, gw gateway, port int, protocols []string, mapped []mapping) ([]mapping, error) {
+	var result []mapping
+	for _, protocol := range protocols {
+		want := mapping{protocol: protocol, internalPort: port, externalPort: port}
+		for _, prev := range mapped {
+			if prev.protocol == protocol {
+				want.externalPort = prev.externalPort
+			}
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		got, err := gw.mapPort(reqCtx, want, m.opts.Lifetime)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, got)
+	}
+	return result, nil
+}
+
+// unmapAll removes mappings, giving the gateway a short while as the
+// mapper is stopping.
+func (m *Mapper) unmapAll(gw gateway, mapped []mapping) {
+	for _, mp := range mapped {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout/2)
+		err := gw.unmapPort(ctx, mp)
+		cancel()
+		if err != nil {
+			m.opts.Logger.Warn("failed to remove port mapping",
+				logger.String("method", gw.method()),
+				logger.String("protocol", mp.protocol),
+				logger.Int("port", mp.externalPort),
+				logger.Err(err),
+			)
+		}
+	}
+}
+
+// setMapped records the mappings and returns when to renew them.
+func (m *Mapper) setMapped(ctx context.Context, gw gateway, port int, mapped []mapping) time.Duration {
+	var externalIP netip.Addr
+	for _, mp := range mapped {
+		if mp.externalIP.IsValid() && !mp.externalIP.IsUnspecified() {
+			externalIP = mp.externalIP
+		}
+	}
+	if !externalIP.IsValid() {
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		externalIP, _ = gw.externalIP(reqCtx)
+		cancel()
+	}
+
+	now := time.Now()
+	renew := m.opts.Lifetime / 2
+	status := Status{
+		Method:       gw.method(),
+		Gateway:      gw.String(),
+		InternalPort: port,
+		Mappings:     make([]MappingStatus, 0, len(mapped)),
+		LastAttempt:  now,
+	}
+	if externalIP.IsValid() {
+		status.ExternalIP = externalIP.String()
+	}
+	for _, mp := range mapped {
+		ms := MappingStatus{Protocol: mp.protocol, ExternalPort: mp.externalPort}
+		if mp.lifetime > 0 {
+			expires := now.Add(mp.lifetime)
+			ms.ExpiresAt = &expires
+			renew = min(renew, mp.lifetime/2)
+		}
+		status.Mappings = append(status.Mappings, ms)
+	}
+
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+	return max(renew, minRenewInterval)
+}
+
+// setError records a failure to map the port. Mappings made before are
+// reported until they expire.
+func (m *Mapper) setError(port int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	kept := m.status.Mappings[:0:0]
+	for _, ms := range m.status.Mappings {
+		if ms.ExpiresAt == nil || ms.ExpiresAt.After(now) {
+			kept = append(kept, ms)
+		}
+	}
+	if len(kept) == 0 {
+		m.status.Method, m.status.Gateway, m.status.ExternalIP = "", "", ""
+	}
+	m.status.Mappings = kept
+	if m.status.Mappings == nil {
+		m.status.Mappings = []MappingStatus{}
+	}
+	m.status.InternalPort = port
+	m.status.Error = err.Error()
+	m.status.LastAttempt = now
+}
@@ -0,0 +1,166 @@
+package portmap
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+	"github.com/ayutaz/orochi/internal/portmap/portmaptest"
+)
+
+var quiet = logger.NewWithLevel(logger.ErrorLevel)
+
+// waitStatus waits for the mapper's status to satisfy done.
+func waitStatus(t *testing.T, m *Mapper, done func(Status) bool) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := m.Status()
+		if done(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for port mapping, status: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func mapped(n int) func(Status) bool {
+	return func(s Status) bool { return len(s.Mappings) == n }
+}
+
+func TestMapper_PCP(t *testing.T) {
+	server, err := portmaptest.NewNATPMP("203.0.113.7", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	m := New(Options{Methods: []string{PCP, NATPMP}, Gateway: server.Addr, Logger: quiet})
+	m.Start(6881, []string{TCP, UDP})
+
+	status := waitStatus(t, m, mapped(2))
+	if status.Method != PCP || status.Gateway != server.Addr.String() {
+		t.Errorf("expected PCP on %s, got %s on %s", server.Addr, status.Method, status.Gateway)
+	}
+	if status.ExternalIP != "203.0.113.7" || status.InternalPort != 6881 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	for _, ms := range status.Mappings {
+		if ms.ExternalPort != 6881 || ms.ExpiresAt == nil || time.Until(*ms.ExpiresAt) < time.Hour {
+			t.Errorf("unexpected mapping: %+v", ms)
+		}
+	}
+	if got := server.Mappings(); len(got) != 2 || got[0].Protocol != TCP || got[1].Protocol != UDP || got[0].Lifetime != DefaultLifetime {
+		t.Errorf("unexpected gateway mappings: %+v", got)
+	}
+
+	m.Stop()
+	if got := server.Mappings(); len(got) != 0 {
+		t.Errorf("expected the mappings to be removed, got %+v", got)
+	}
+	if status := m.Status(); len(status.Mappings) != 0 || status.Method != "" {
+		t.Errorf("expected an empty status, got %+v", status)
+	}
+}
+
+func TestMapper_NATPMPFallback(t *testing.T) {
+	server, err := portmaptest.NewNATPMP("203.0.113.8", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	m := New(Options{Methods: []string{PCP, NATPMP}, Gateway: server.Addr, Logger: quiet})
+	m.Start(6881, []string{TCP})
+	defer m.Stop()
+
+	status := waitStatus(t, m, mapped(1))
+	if status.Method != NATPMP || status.ExternalIP != "203.0.113.8" || status.Error != "" {
+		t.Errorf("expected NAT-PMP after PCP was refused, got %+v", status)
+	}
+}
+
+func TestMapper_Renew(t *testing.T) {
+	// Leases of two seconds are renewed every second
+	server, err := portmaptest.NewNATPMP("203.0.113.7", false, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	m := New(Options{Methods: []string{NATPMP}, Gateway: server.Addr, Logger: quiet})
+	m.Start(6881, []string{TCP})
+	defer m.Stop()
+
+	waitStatus(t, m, mapped(1))
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Requests() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the lease to be renewed, got %d requests", server.Requests())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMapper_Restart(t *testing.T) {
+	server, err := portmaptest.NewNATPMP("203.0.113.7", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	m := New(Options{Methods: []string{PCP}, Gateway: server.Addr, Logger: quiet})
+	m.Start(6881, []string{TCP})
+	waitStatus(t, m, mapped(1))
+
+	m.Start(6882, []string{TCP})
+	defer m.Stop()
+	waitStatus(t, m, mapped(1))
+	if got := server.Mappings(); len(got) != 1 || got[0].InternalPort != 6882 {
+		t.Errorf("expected only the new port to be mapped, got %+v", got)
+	}
+}
+
+func TestMapper_Unreachable(t *testing.T) {
+	// A port nothing listens on
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	conn.Close()
+
+	m := New(Options{Methods: []string{PCP, NATPMP}, Gateway: addr, Logger: quiet})
+	m.Start(6881, []string{TCP})
+	defer m.Stop()
+
+	status := waitStatus(t, m, func(s Status) bool { return s.Error != "" })
+	if len(status.Mappings) != 0 || status.LastAttempt.IsZero() {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestMapper_DefaultGateway(t *testing.T) {
+	dir := t.TempDir()
+	routes := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n"
+	if err := os.WriteFile(filepath.Join(dir, "route"), []byte(routes), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(Options{Routes: network.NewProcRouteProvider(dir), Logger: quiet})
+	gw, err := m.defaultGateway()
+	if err != nil {
+		t.Fatalf("failed to find default gateway: %v", err)
+	}
+	if gw != netip.MustParseAddr("192.168.1.1") {
+		t.Errorf("expected 192.168.1.1, got %s", gw)
+	}
+}
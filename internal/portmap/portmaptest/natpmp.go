@@ -0,0 +1,219 @@
+// Package portmaptest provides PCP, NAT-PMP and UPnP gateways on the
+// loopback interface for tests.
+package portmaptest
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Mapping is a port mapped on a stand-in gateway.
+type Mapping struct {
+	// Protocol is tcp or udp.
+	Protocol     string
+	InternalPort int
+	ExternalPort int
+	// Lifetime is the lease granted, zero for a permanent mapping.
+	Lifetime time.Duration
+}
+
+// mappings keeps the mappings of a gateway by protocol and internal port.
+type mappings struct {
+	mu       sync.Mutex
+	mappings map[string]Mapping
+	requests int
+}
+
+func key(protocol string, internalPort int) string {
+	return protocol + "/" + strconv.Itoa(internalPort)
+}
+
+func (ms *mappings) set(m Mapping) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.mappings == nil {
+		ms.mappings = make(map[string]Mapping)
+	}
+	ms.requests++
+	ms.mappings[key(m.Protocol, m.InternalPort)] = m
+}
+
+func (ms *mappings) remove(protocol string, internalPort int) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.requests++
+	delete(ms.mappings, key(protocol, internalPort))
+}
+
+// Mappings returns the ports mapped, by protocol.
+func (ms *mappings) Mappings() []Mapping {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	result := make([]Mapping, 0, len(ms.mappings))
+	for _, m := range ms.mappings {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Protocol < result[j].Protocol })
+	return result
+}
+
+// Requests returns the number of mapping and removal requests served.
+func (ms *mappings) Requests() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.requests
+}
+
+// NATPMP is a NAT-PMP server that also speaks PCP if asked to. Mappings get
+// the external port asked for, or the internal port.
+type NATPMP struct {
+	mappings
+
+	// Addr is the address the server listens on.
+	Addr netip.AddrPort
+
+	externalIP  netip.Addr
+	pcp         bool
+	maxLifetime time.Duration
+	conn        *net.UDPConn
+	done        chan struct{}
+}
+
+// NewNATPMP starts a server reporting externalIP. Without pcp, PCP requests
+// are answered as a NAT-PMP-only server does. Leases are capped at
+// maxLifetime if it is not zero.
+func NewNATPMP(externalIP string, pcp bool, maxLifetime time.Duration) (*NATPMP, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	s := &NATPMP{
+		Addr:        conn.LocalAddr().(*net.UDPAddr).AddrPort(),
+		externalIP:  netip.MustParseAddr(externalIP),
+		pcp:         pcp,
+		maxLifetime: maxLifetime,
+		conn:        conn,
+		done:        make(chan struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server.
+func (s *NATPMP) Close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+func (s *NATPMP) serve() {
+	defer close(s.done)
+	buf := make([]byte, 1100)
+	for {
+		n, from, err := s.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		var resp []byte
+		switch {
+		case n >= 2 && buf[0] == 0:
+			resp = s.natpmp(buf[:n])
+		case n >= 60 && buf[0] == 2 && s.pcp:
+			resp = s.pcpMap(buf[:n])
+		case n >= 2:
+			// Unsupported version, answered in NAT-PMP
+			resp = []byte{0, 128 + buf[1]&0x7f, 0, 1, 0, 0, 0, 0}
+		}
+		if resp != nil {
+			_, _ = s.conn.WriteToUDPAddrPort(resp, from)
+		}
+	}
+}
+
+// grant returns the lease granted for one asked for.
+func (s *NATPMP) grant(lifetime time.Duration) time.Duration {
+	if s.maxLifetime > 0 && lifetime > s.maxLifetime {
+		return s.maxLifetime
+	}
+	return lifetime
+}
+
+func (s *NATPMP) natpmp(req []byte) []byte {
+	op := req[1]
+	switch {
+	case op == 0:
+		resp := make([]byte, 12)
+		resp[1] = 128
+		ip := s.externalIP.As4()
+		copy(resp[8:12], ip[:])
+		return resp
+	case (op == 1 || op == 2) && len(req) >= 12:
+		protocol := "udp"
+		if op == 2 {
+			protocol = "tcp"
+		}
+		internal := int(binary.BigEndian.Uint16(req[4:6]))
+		external := int(binary.BigEndian.Uint16(req[6:8]))
+		lifetime := s.grant(time.Duration(binary.BigEndian.Uint32(req[8:12])) * time.Second)
+		if lifetime == 0 {
+			s.remove(protocol, internal)
+			external = 0
+		} else {
+			if external == 0 {
+				external = internal
+			}
+			s.set(Mapping{Protocol: protocol, InternalPort: internal, ExternalPort: external, Lifetime: lifetime})
+		}
+
+		resp := make([]byte, 16)
+		resp[1] = 128 + op
+		binary.BigEndian.PutUint16(resp[8:10], uint16(internal))
+		binary.BigEndian.PutUint16(resp[10:12], uint16(external))
+		binary.BigEndian.PutUint32(resp[12:16], uint32(lifetime/time.Second))
+		return resp
+	default:
+		// Unsupported opcode
+		return []byte{0, 128 + op, 0, 5, 0, 0, 0, 0}
+	}
+}
+
+func (s *NATPMP) pcpMap(req []byte) []byte {
+	resp := make([]byte, 60)
+	resp[0] = 2
+	resp[1] = 0x80 | req[1]
+	if req[1]&0x7f != 1 {
+		// Unsupported opcode
+		resp[3] = 4
+		return resp[:24]
+	}
+
+	payload := req[24:60]
+	protocol := "udp"
+	if payload[12] == 6 {
+		protocol = "tcp"
+	}
+	internal := int(binary.BigEndian.Uint16(payload[16:18]))
+	external := int(binary.BigEndian.Uint16(payload[18:20]))
+	if external == 0 {
+		external = internal
+	}
+	lifetime := s.grant(time.Duration(binary.BigEndian.Uint32(req[4:8])) * time.Second)
+	if lifetime == 0 {
+		s.remove(protocol, internal)
+	} else {
+		s.set(Mapping{Protocol: protocol, InternalPort: internal, ExternalPort: external, Lifetime: lifetime})
+	}
+
+	binary.BigEndian.PutUint32(resp[4:8], uint32(lifetime/time.Second))
+	copy(resp[24:60], payload)
+	binary.BigEndian.PutUint16(resp[24+18:24+20], uint16(external))
+	// IPv4 addresses are sent mapped to IPv6
+	ip := s.externalIP.As16()
+	copy(resp[24+20:24+36], ip[:])
+	return resp
+}
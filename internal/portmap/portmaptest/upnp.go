@@ -0,0 +1,242 @@
+package portmaptest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wanIPConnection is the service the gateway offers.
+const wanIPConnection = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+// rootDesc describes the gateway, with the service on an embedded device as
+// real gateways have it.
+const rootDesc = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <friendlyName>Stand-in gateway</friendlyName>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>` + wanIPConnection + `</serviceType>
+                <serviceId>urn:upnp-org:serviceId:WANIPConn1</serviceId>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+// IGD is a UPnP Internet Gateway Device answering SSDP searches.
+type IGD struct {
+	mappings
+
+	// RootDesc is the URL of the device description.
+	RootDesc string
+	// SSDPAddr is where the device answers searches.
+	SSDPAddr netip.AddrPort
+
+	externalIP string
+	server     *httptest.Server
+	ssdp       *net.UDPConn
+	done       chan struct{}
+
+	mu            sync.Mutex
+	permanentOnly bool
+	clients       []string
+}
+
+// NewIGD starts a gateway reporting externalIP.
+func NewIGD(externalIP string) (*IGD, error) {
+	ssdp, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	g := &IGD{
+		SSDPAddr:   ssdp.LocalAddr().(*net.UDPAddr).AddrPort(),
+		externalIP: externalIP,
+		ssdp:       ssdp,
+		done:       make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = io.WriteString(w, rootDesc)
+	})
+	mux.HandleFunc("/ctl/IPConn", g.control)
+	g.server = httptest.NewServer(mux)
+	g.RootDesc = g.server.URL + "/rootDesc.xml"
+	go g.serveSSDP()
+	return g, nil
+}
+
+// SetPermanentOnly makes the gateway refuse leases with a duration, as
+// some routers do.
+func (g *IGD) SetPermanentOnly(permanentOnly bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.permanentOnly = permanentOnly
+}
+
+// InternalClients returns the internal clients mappings were made for, in
+// order.
+func (g *IGD) InternalClients() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.clients...)
+}
+
+// Close stops the gateway.
+func (g *IGD) Close() error {
+	g.server.Close()
+	err := g.ssdp.Close()
+	<-g.done
+	return err
+}
+
+func (g *IGD) serveSSDP() {
+	defer close(g.done)
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := g.ssdp.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		if !bytes.HasPrefix(buf[:n], []byte("M-SEARCH * HTTP/1.1")) {
+			continue
+		}
+		resp := "HTTP/1.1 200 OK\r\n" +
+			"CACHE-CONTROL: max-age=120\r\n" +
+			"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+			"USN: uuid:stand-in::urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+			"EXT:\r\n" +
+			"LOCATION: " + g.RootDesc + "\r\n\r\n"
+		_, _ = g.ssdp.WriteToUDPAddrPort([]byte(resp), from)
+	}
+}
+
+// control serves the SOAP actions of the WANIPConnection service.
+func (g *IGD) control(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	service, action, ok := strings.Cut(action, "#")
+	if !ok || service != wanIPConnection {
+		soapFault(w, 401, "Invalid Action")
+		return
+	}
+	args, err := soapArgs(r.Body)
+	if err != nil {
+		soapFault(w, 402, "Invalid Args")
+		return
+	}
+
+	switch action {
+	case "GetExternalIPAddress":
+		soapResponse(w, action, "<NewExternalIPAddress>"+g.externalIP+"</NewExternalIPAddress>")
+	case "AddPortMapping":
+		internal, err1 := strconv.Atoi(args["NewInternalPort"])
+		external, err2 := strconv.Atoi(args["NewExternalPort"])
+		lease, err3 := strconv.Atoi(args["NewLeaseDuration"])
+		if err1 != nil || err2 != nil || err3 != nil {
+			soapFault(w, 402, "Invalid Args")
+			return
+		}
+		g.mu.Lock()
+		permanentOnly := g.permanentOnly
+		g.clients = append(g.clients, args["NewInternalClient"])
+		g.mu.Unlock()
+		if permanentOnly && lease != 0 {
+			soapFault(w, 725, "OnlyPermanentLeasesSupported")
+			return
+		}
+		g.set(Mapping{
+			Protocol:     strings.ToLower(args["NewProtocol"]),
+			InternalPort: internal,
+			ExternalPort: external,
+			Lifetime:     time.Duration(lease) * time.Second,
+		})
+		soapResponse(w, action, "")
+	case "DeletePortMapping":
+		external, err := strconv.Atoi(args["NewExternalPort"])
+		if err != nil {
+			soapFault(w, 402, "Invalid Args")
+			return
+		}
+		protocol := strings.ToLower(args["NewProtocol"])
+		for _, m := range g.Mappings() {
+			if m.Protocol == protocol && m.ExternalPort == external {
+				g.remove(protocol, m.InternalPort)
+				soapResponse(w, action, "")
+				return
+			}
+		}
+		soapFault(w, 714, "NoSuchEntryInArray")
+	default:
+		soapFault(w, 401, "Invalid Action")
+	}
+}
+
+// soapArgs returns the arguments of a SOAP action by name.
+func soapArgs(r io.Reader) (map[string]string, error) {
+	args := make(map[string]string)
+	dec := xml.NewDecoder(r)
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return args, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+			args[name] = ""
+		case xml.EndElement:
+			name = ""
+		case xml.CharData:
+			if name != "" {
+				args[name] += string(t)
+			}
+		}
+	}
+}
+
+func soapResponse(w http.ResponseWriter, action, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprintf(w, `<?xml version="1.0"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:%sResponse xmlns:u="%s">%s</u:%sResponse></s:Body></s:Envelope>`,
+		action, wanIPConnection, body, action)
+}
+
+func soapFault(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<?xml version="1.0"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring>`+
+		`<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0">`+
+		`<errorCode>%d</errorCode><errorDescription>%s</errorDescription>`+
+		`</UPnPError></detail></s:Fault></s:Body></s:Envelope>`,
+		code, description)
+}
@@ -0,0 +1,326 @@
+package portmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// SSDPAddr is the multicast group UPnP devices are searched on.
+var SSDPAddr = netip.MustParseAddrPort("239.255.255.250:1900")
+
+// ssdpWait is how long gateways have to answer a search.
+const ssdpWait = 2 * time.Second
+
+// igdDevices are the device types searched for.
+var igdDevices = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+}
+
+// igdServices are the services of an Internet Gateway Device that map
+// ports, preferred first.
+var igdServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnpOnlyPermanentLeases is the error of gateways that refuse leases with
+// a duration.
+const upnpOnlyPermanentLeases = 725
+
+// upnpGateway maps ports with the WANIPConnection or WANPPPConnection
+// service of a UPnP Internet Gateway Device.
+type upnpGateway struct {
+	httpClient *http.Client
+	controlURL string
+	service    string
+	// internalClient is the address the gateway reaches this host at.
+	internalClient netip.Addr
+	description    string
+}
+
+func (g *upnpGateway) method() string { return UPnP }
+
+func (g *upnpGateway) String() string { return g.controlURL }
+
+// discoverUPnP searches for an Internet Gateway Device with SSDP and
+// returns the URL of its description.
+func discoverUPnP(ctx context.Context, addr netip.AddrPort) (string, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", errors.NetworkError("failed to open SSDP socket", err)
+	}
+	defer conn.Close()
+
+	for _, device := range igdDevices {
+		msg := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + SSDPAddr.String() + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n" +
+			"ST: " + device + "\r\n\r\n"
+		if _, err := conn.WriteToUDPAddrPort([]byte(msg), addr); err != nil {
+			return "", errors.NetworkError("failed to send SSDP search", err)
+		}
+	}
+
+	deadline := time.Now().Add(ssdpWait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return "", errors.NetworkError("no UPnP gateway found", nil)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// upnpDevice is a device of a UPnP description, with its embedded devices.
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// findService returns the control URL of the first service of type
+// service in the device tree.
+func (d *upnpDevice) findService(service string) (string, bool) {
+	for _, s := range d.Services {
+		if strings.TrimSpace(s.ServiceType) == service {
+			return strings.TrimSpace(s.ControlURL), true
+		}
+	}
+	for i := range d.Devices {
+		if u, ok := d.Devices[i].findService(service); ok {
+			return u, true
+		}
+	}
+	return "", false
+}
+
+// newUPnPGateway reads the description of a gateway at location and finds
+// its port mapping service.
+func newUPnPGateway(ctx context.Context, httpClient *http.Client, location, description string) (*upnpGateway, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid UPnP description URL %q", location)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.NetworkError("failed to fetch UPnP description", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.NetworkError("failed to fetch UPnP description: "+resp.Status, nil)
+	}
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return nil, errors.ParseError("invalid UPnP description", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid UPnP description URL %q", location)
+	}
+	if root.URLBase != "" {
+		if u, err := url.Parse(strings.TrimSpace(root.URLBase)); err == nil {
+			base = u
+		}
+	}
+
+	for _, service := range igdServices {
+		controlURL, ok := root.Device.findService(service)
+		if !ok {
+			continue
+		}
+		u, err := base.Parse(controlURL)
+		if err != nil {
+			return nil, errors.ParseError("invalid UPnP control URL "+controlURL, err)
+		}
+		internalClient, err := localAddrFor(u)
+		if err != nil {
+			return nil, err
+		}
+		return &upnpGateway{
+			httpClient:     httpClient,
+			controlURL:     u.String(),
+			service:        service,
+			internalClient: internalClient,
+			description:    description,
+		}, nil
+	}
+	return nil, errors.NotFound("UPnP device has no port mapping service")
+}
+
+// localAddrFor returns the local address traffic to the host of u leaves
+// from.
+func localAddrFor(u *url.URL) (netip.Addr, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	conn, err := net.Dial("udp4", host)
+	if err != nil {
+		return netip.Addr{}, errors.NetworkError("failed to reach UPnP gateway", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
+
+// externalIP asks the gateway for its external address.
+func (g *upnpGateway) externalIP(ctx context.Context) (netip.Addr, error) {
+	values, err := g.soap(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(values["NewExternalIPAddress"]))
+	if err != nil {
+		return netip.Addr{}, errors.ParseError("invalid external address from UPnP gateway", err)
+	}
+	return addr, nil
+}
+
+// mapPort adds a port mapping, or renews it. Gateways that only grant
+// permanent leases are asked for one, which the returned zero lifetime
+// reports.
+func (g *upnpGateway) mapPort(ctx context.Context, m mapping, lifetime time.Duration) (mapping, error) {
+	add := func(lease time.Duration) error {
+		_, err := g.soap(ctx, "AddPortMapping", [][2]string{
+			{"NewRemoteHost", ""},
+			{"NewExternalPort", strconv.Itoa(m.externalPort)},
+			{"NewProtocol", strings.ToUpper(m.protocol)},
+			{"NewInternalPort", strconv.Itoa(m.internalPort)},
+			{"NewInternalClient", g.internalClient.String()},
+			{"NewEnabled", "1"},
+			{"NewPortMappingDescription", g.description},
+			{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+		})
+		return err
+	}
+
+	err := add(lifetime)
+	if upnpErr, ok := err.(*upnpError); ok && upnpErr.code == upnpOnlyPermanentLeases {
+		lifetime = 0
+		err = add(0)
+	}
+	if err != nil {
+		return m, err
+	}
+	m.lifetime = lifetime
+	return m, nil
+}
+
+func (g *upnpGateway) unmapPort(ctx context.Context, m mapping) error {
+	_, err := g.soap(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(m.externalPort)},
+		{"NewProtocol", strings.ToUpper(m.protocol)},
+	})
+	return err
+}
+
+// upnpError is an error returned by a UPnP action.
+type upnpError struct {
+	code        int
+	description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.code, e.description)
+}
+
+// soap calls an action of the port mapping service with arguments in
+// order, and returns the values of the response by element name.
+func (g *upnpGateway) soap(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, g.service)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		_ = xml.EscapeText(&body, []byte(arg[1]))
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.controlURL, &body)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid UPnP control URL %q", g.controlURL)
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+g.service+"#"+action+`"`)
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.NetworkError("UPnP "+action+" failed", err)
+	}
+	defer resp.Body.Close()
+
+	values, err := soapValues(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code, err := strconv.Atoi(values["errorCode"]); err == nil {
+			return nil, &upnpError{code: code, description: values["errorDescription"]}
+		}
+		return nil, errors.NetworkError("UPnP "+action+" failed: "+resp.Status, nil)
+	}
+	return values, nil
+}
+
+// soapValues returns the text of the elements of a SOAP envelope by local
+// name.
+func soapValues(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	dec := xml.NewDecoder(r)
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, errors.ParseError("invalid SOAP response", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+		case xml.EndElement:
+			name = ""
+		case xml.CharData:
+			if name != "" {
+				values[name] += string(t)
+			}
+		}
+	}
+}
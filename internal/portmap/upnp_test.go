@@ -0,0 +1,62 @@
+package portmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/portmap/portmaptest"
+)
+
+func TestMapper_UPnP(t *testing.T) {
+	igd, err := portmaptest.NewIGD("198.51.100.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer igd.Close()
+
+	// The gateway is found by searching for it
+	m := New(Options{Methods: []string{UPnP}, SSDPAddr: igd.SSDPAddr, Logger: quiet})
+	m.Start(6881, []string{TCP, UDP})
+
+	status := waitStatus(t, m, mapped(2))
+	if status.Method != UPnP || status.ExternalIP != "198.51.100.4" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if status.Gateway != igd.RootDesc[:len(igd.RootDesc)-len("/rootDesc.xml")]+"/ctl/IPConn" {
+		t.Errorf("unexpected gateway: %s", status.Gateway)
+	}
+	if got := igd.Mappings(); len(got) != 2 || got[0].ExternalPort != 6881 || got[0].Lifetime != DefaultLifetime {
+		t.Errorf("unexpected gateway mappings: %+v", got)
+	}
+	for _, client := range igd.InternalClients() {
+		if client != "127.0.0.1" {
+			t.Errorf("expected the loopback address as internal client, got %s", client)
+		}
+	}
+
+	m.Stop()
+	if got := igd.Mappings(); len(got) != 0 {
+		t.Errorf("expected the mappings to be removed, got %+v", got)
+	}
+}
+
+func TestMapper_UPnPPermanentOnly(t *testing.T) {
+	igd, err := portmaptest.NewIGD("198.51.100.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer igd.Close()
+	igd.SetPermanentOnly(true)
+
+	m := New(Options{Methods: []string{UPnP}, RootDesc: igd.RootDesc, Lifetime: time.Hour, Logger: quiet})
+	m.Start(6881, []string{TCP})
+	defer m.Stop()
+
+	status := waitStatus(t, m, mapped(1))
+	if status.Mappings[0].ExpiresAt != nil {
+		t.Errorf("expected a permanent mapping, got %+v", status.Mappings[0])
+	}
+	if got := igd.Mappings(); len(got) != 1 || got[0].Lifetime != 0 {
+		t.Errorf("unexpected gateway mappings: %+v", got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package proxy dials connections through SOCKS5 and HTTP proxies.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// Proxy types.
+const (
+	SOCKS5 = "socks5"
+	HTTP   = "http"
+)
+
+// Dialer connects to addresses through a proxy. Host names are resolved by
+// the proxy, so no DNS queries leave the client.
+type Dialer struct {
+	typ      string
+	address  string
+	username string
+	password string
+	// forward connects to the proxy itself.
+	forward Forward
+}
+
+// Forward opens the connections to the proxy itself.
+type Forward interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	// ListenUDP opens a socket for datagrams sent to a SOCKS5 relay.
+	ListenUDP(network string) (*net.UDPConn, error)
+}
+
+// directForward connects to the proxy through any interface.
+type directForward struct {
+	net.Dialer
+}
+
+func (f *directForward) ListenUDP(network string) (*net.UDPConn, error) {
+	return net.ListenUDP(network, nil)
+}
+
+// New creates a dialer for a SOCKS5 or HTTP proxy at address. The username
+// and password may be empty.
+func New(typ, address, username, password string) (*Dialer, error) {
+	if typ != SOCKS5 && typ != HTTP {
+		return nil, errors.InvalidInputf("unsupported proxy type %q", typ)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, errors.InvalidInputf("invalid proxy address %q", address)
+	}
+	return &Dialer{
+		typ:      typ,
+		address:  address,
+		username: username,
+		password: password,
+		forward:  &directForward{net.Dialer{Timeout: 30 * time.Second}},
+	}, nil
+}
+
+// SetForward changes how the proxy itself is connected to, such as to bind
+// those connections to an interface.
+func (d *Dialer) SetForward(f Forward) {
+	d.forward = f
+}
+
+// Type returns the proxy type.
+func (d *Dialer) Type() string {
+	return d.typ
+}
+
+// SupportsUDP reports whether UDP can be sent through the proxy, which only
+// SOCKS5 proxies do.
+func (d *Dialer) SupportsUDP() bool {
+	return d.typ == SOCKS5
+}
+
+// DialContext connects to a TCP address through the proxy.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.InvalidInputf("network %s cannot be proxied", network)
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, errors.NetworkError("failed to connect to proxy", err)
+	}
+	tunnel := conn
+	err = withContext(ctx, conn, func() error {
+		if d.typ == SOCKS5 {
+			_, err := d.socksConnect(conn, cmdConnect, addr)
+			return err
+		}
+		var err error
+		tunnel, err = d.httpConnect(conn, addr)
+		return err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// Transport returns an HTTP transport that sends requests through the proxy.
+func (d *Dialer) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if d.typ == HTTP {
+		u := &url.URL{Scheme: "http", Host: d.address}
+		if d.username != "" {
+			u.User = url.UserPassword(d.username, d.password)
+		}
+		t.Proxy = http.ProxyURL(u)
+		return t
+	}
+	t.Proxy = nil
+	t.DialContext = d.DialContext
+	return t
+}
+
+// httpConnect opens a tunnel with the CONNECT method.
+func (d *Dialer) httpConnect(conn net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.username + ":" + d.password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, errors.NetworkError("failed to send CONNECT to proxy", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, errors.NetworkError("failed to read proxy response", err)
+	}
+	// The body of a successful response is the tunnel, so it is not read.
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, errors.NetworkError("proxy refused connection to "+addr+": "+resp.Status, nil)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were read ahead.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// withContext runs a handshake on a connection, interrupting it when the
+// context is done.
+func withContext(ctx context.Context, conn net.Conn, handshake func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	done := make(chan struct{})
+	interrupted := make(chan bool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	err := handshake()
+	close(done)
+	if <-interrupted {
+		return errors.NetworkError("proxy handshake interrupted", ctx.Err())
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/proxy/proxytest"
+)
+
+func startSOCKS5(t *testing.T, username, password string) *proxytest.SOCKS5 {
+	t.Helper()
+	s, err := proxytest.NewSOCKS5(username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// startEcho starts a TCP server that echoes what it receives.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("got %q, want ping", buf)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New("socks4", "127.0.0.1:1080", "", ""); !errors.IsInvalidInput(err) {
+		t.Errorf("expected invalid input for unknown type, got %v", err)
+	}
+	if _, err := New(SOCKS5, "127.0.0.1", "", ""); !errors.IsInvalidInput(err) {
+		t.Errorf("expected invalid input for address without port, got %v", err)
+	}
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	echo := startEcho(t)
+
+	t.Run("without authentication", func(t *testing.T) {
+		s := startSOCKS5(t, "", "")
+		d, err := New(SOCKS5, s.Addr, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", echo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		assertEcho(t, conn)
+
+		if targets := s.Targets(); len(targets) != 1 || targets[0] != echo {
+			t.Errorf("proxy relayed to %v, want %s", targets, echo)
+		}
+	})
+
+	t.Run("with authentication", func(t *testing.T) {
+		s := startSOCKS5(t, "user", "secret")
+		d, err := New(SOCKS5, s.Addr, "user", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", echo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		assertEcho(t, conn)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		s := startSOCKS5(t, "user", "secret")
+		d, err := New(SOCKS5, s.Addr, "user", "wrong")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.DialContext(context.Background(), "tcp", echo); !errors.IsAuthenticationFailed(err) {
+			t.Errorf("expected authentication failure, got %v", err)
+		}
+	})
+
+	t.Run("host names are resolved by the proxy", func(t *testing.T) {
+		s := startSOCKS5(t, "", "")
+		d, err := New(SOCKS5, s.Addr, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, port, _ := net.SplitHostPort(echo)
+		conn, err := d.DialContext(context.Background(), "tcp", "localhost:"+port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		assertEcho(t, conn)
+
+		if targets := s.Targets(); len(targets) != 1 || targets[0] != "localhost:"+port {
+			t.Errorf("proxy relayed to %v, want localhost:%s", targets, port)
+		}
+	})
+
+	t.Run("unreachable target", func(t *testing.T) {
+		s := startSOCKS5(t, "", "")
+		d, err := New(SOCKS5, s.Addr, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		closed := ln.Addr().String()
+		_ = ln.Close()
+
+		_, err = d.DialContext(context.Background(), "tcp", closed)
+		if err == nil || !strings.Contains(err.Error(), "connection refused") {
+			t.Errorf("expected connection refused, got %v", err)
+		}
+	})
+}
+
+func TestSOCKS5Transport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := startSOCKS5(t, "", "")
+	d, err := New(SOCKS5, s.Addr, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: d.Transport()}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello" {
+		t.Errorf("got body %q", body)
+	}
+	if len(s.Targets()) == 0 {
+		t.Error("request did not go through the proxy")
+	}
+}
+
+func TestSOCKS5UDP(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = echo.Close() }()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = echo.WriteToUDP(buf[:n], from)
+		}
+	}()
+
+	s := startSOCKS5(t, "", "")
+	d, err := New(SOCKS5, s.Addr, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := d.DialUDP(context.Background(), echo.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	assertEcho(t, conn)
+
+	if targets := s.Targets(); len(targets) != 1 || targets[0] != echo.LocalAddr().String() {
+		t.Errorf("proxy relayed to %v, want %s", targets, echo.LocalAddr())
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	echo := startEcho(t)
+
+	var target string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+			http.Error(w, "forbidden", http.StatusProxyAuthRequired)
+			return
+		}
+		target = r.Host
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer func() { _ = upstream.Close() }()
+
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+	}))
+	defer proxyServer.Close()
+	proxyAddr := strings.TrimPrefix(proxyServer.URL, "http://")
+
+	d, err := New(HTTP, proxyAddr, "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	assertEcho(t, conn)
+	if target != echo {
+		t.Errorf("proxy connected to %q, want %s", target, echo)
+	}
+
+	d, err = New(HTTP, proxyAddr, "user", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DialContext(context.Background(), "tcp", echo); err == nil {
+		t.Error("expected the proxy to refuse wrong credentials")
+	}
+	if _, err := d.DialUDP(context.Background(), echo); !errors.IsInvalidInput(err) {
+		t.Errorf("expected UDP through an HTTP proxy to be refused, got %v", err)
+	}
+}
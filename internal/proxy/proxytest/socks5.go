@@ -0,0 +1,338 @@
+// Package proxytest provides a SOCKS5 proxy on the loopback interface for
+// tests.
+package proxytest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+)
+
+// SOCKS5 is a SOCKS5 proxy supporting CONNECT and UDP ASSOCIATE. It records
+// the addresses it relays traffic to.
+type SOCKS5 struct {
+	// Addr is the address the proxy listens on.
+	Addr string
+
+	username, password string
+	ln                 net.Listener
+	wg                 sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	conns   map[io.Closer]struct{}
+	targets []string
+}
+
+// NewSOCKS5 starts a proxy. If username is not empty, clients must log in
+// with it and the password.
+func NewSOCKS5(username, password string) (*SOCKS5, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SOCKS5{
+		Addr:     ln.Addr().String(),
+		username: username,
+		password: password,
+		ln:       ln,
+		conns:    make(map[io.Closer]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Targets returns the addresses traffic was relayed to, in order.
+func (s *SOCKS5) Targets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+// Close stops the proxy and closes all relayed connections.
+func (s *SOCKS5) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SOCKS5) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		if !s.track(conn) {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.handle(conn)
+		}()
+	}
+}
+
+// track remembers a connection to close, reporting false if the proxy is
+// closed.
+func (s *SOCKS5) track(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		_ = c.Close()
+		return false
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *SOCKS5) untrack(c io.Closer) {
+	_ = c.Close()
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+func (s *SOCKS5) record(target string) {
+	s.mu.Lock()
+	s.targets = append(s.targets, target)
+	s.mu.Unlock()
+}
+
+func (s *SOCKS5) handle(conn net.Conn) {
+	if !s.negotiate(conn) {
+		return
+	}
+
+	var head [3]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return
+	}
+	target, err := readAddr(conn)
+	if err != nil {
+		return
+	}
+
+	switch head[1] {
+	case 1:
+		s.connect(conn, target)
+	case 3:
+		s.associate(conn)
+	default:
+		_, _ = conn.Write(reply(7, netip.AddrPort{}))
+	}
+}
+
+// negotiate agrees on an authentication method and checks the credentials.
+func (s *SOCKS5) negotiate(conn net.Conn) bool {
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil || head[0] != 5 {
+		return false
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return false
+	}
+
+	want := byte(0)
+	if s.username != "" {
+		want = 2
+	}
+	if bytes.IndexByte(methods, want) < 0 {
+		_, _ = conn.Write([]byte{5, 0xff})
+		return false
+	}
+	if _, err := conn.Write([]byte{5, want}); err != nil {
+		return false
+	}
+	if want == 0 {
+		return true
+	}
+
+	var version [1]byte
+	if _, err := io.ReadFull(conn, version[:]); err != nil || version[0] != 1 {
+		return false
+	}
+	username, ok := readString(conn)
+	if !ok {
+		return false
+	}
+	password, ok := readString(conn)
+	if !ok {
+		return false
+	}
+	if username != s.username || password != s.password {
+		_, _ = conn.Write([]byte{1, 1})
+		return false
+	}
+	_, err := conn.Write([]byte{1, 0})
+	return err == nil
+}
+
+// readString reads a string prefixed with its length.
+func readString(r io.Reader) (string, bool) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", false
+	}
+	b := make([]byte, n[0])
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+func (s *SOCKS5) connect(conn net.Conn, target string) {
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write(reply(5, netip.AddrPort{}))
+		return
+	}
+	if !s.track(upstream) {
+		return
+	}
+	defer s.untrack(upstream)
+	s.record(target)
+
+	bound, _ := netip.ParseAddrPort(upstream.LocalAddr().String())
+	if _, err := conn.Write(reply(0, bound)); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		_ = upstream.Close()
+		close(done)
+	}()
+	_, _ = io.Copy(conn, upstream)
+	_ = conn.Close()
+	<-done
+}
+
+// associate relays datagrams between the client and any address until the
+// control connection closes.
+func (s *SOCKS5) associate(conn net.Conn) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		_, _ = conn.Write(reply(1, netip.AddrPort{}))
+		return
+	}
+	if !s.track(relay) {
+		return
+	}
+	defer s.untrack(relay)
+
+	if _, err := conn.Write(reply(0, relay.LocalAddr().(*net.UDPAddr).AddrPort())); err != nil {
+		return
+	}
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		_ = relay.Close()
+	}()
+
+	var client netip.AddrPort
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := relay.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+
+		if !client.IsValid() || from == client {
+			client = from
+			if n < 4 {
+				continue
+			}
+			packet := bytes.NewReader(buf[3:n])
+			target, err := readAddr(packet)
+			if err != nil {
+				continue
+			}
+			addr, err := net.ResolveUDPAddr("udp", target)
+			if err != nil {
+				continue
+			}
+			s.record(target)
+			_, _ = relay.WriteToUDP(buf[n-packet.Len():n], addr)
+			continue
+		}
+
+		packet := append(addrBytes([]byte{0, 0, 0}, from), buf[:n]...)
+		_, _ = relay.WriteToUDPAddrPort(packet, client)
+	}
+}
+
+// reply builds a reply with a status and bound address.
+func reply(status byte, bound netip.AddrPort) []byte {
+	if !bound.IsValid() {
+		bound = netip.AddrPortFrom(netip.IPv4Unspecified(), 0)
+	}
+	return addrBytes([]byte{5, status, 0}, bound)
+}
+
+func addrBytes(b []byte, addr netip.AddrPort) []byte {
+	ip := addr.Addr().Unmap()
+	if ip.Is4() {
+		b = append(b, 1)
+	} else {
+		b = append(b, 4)
+	}
+	b = append(b, ip.AsSlice()...)
+	return binary.BigEndian.AppendUint16(b, addr.Port())
+}
+
+// readAddr reads an address, which may be a host name.
+func readAddr(r io.Reader) (string, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch atyp[0] {
+	case 1, 4:
+		b := make([]byte, 4)
+		if atyp[0] == 4 {
+			b = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		ip, _ := netip.AddrFromSlice(b)
+		host = ip.String()
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return "", err
+		}
+		b := make([]byte, n[0])
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		host = string(b)
+	default:
+		return "", io.ErrUnexpectedEOF
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
@@ -0,0 +1,370 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// SOCKS5 protocol values from RFC 1928 and RFC 1929.
+const (
+	socksVersion = 5
+
+	authNone        = 0
+	authPassword    = 2
+	authPasswordV1  = 1
+	cmdConnect      = 1
+	cmdUDPAssociate = 3
+	atypIPv4        = 1
+	atypDomain      = 3
+	atypIPv6        = 4
+	replySucceeded  = 0
+	// udpHeaderMaxBytes is the longest header of a relayed datagram.
+	udpHeaderMaxBytes = 4 + 1 + 255 + 2
+)
+
+// socksConnect authenticates and sends a command for an address, returning
+// the address the proxy bound for it.
+func (d *Dialer) socksConnect(conn net.Conn, cmd byte, addr string) (netip.AddrPort, error) {
+	methods := []byte{authNone}
+	if d.username != "" {
+		methods = append(methods, authPassword)
+	}
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return netip.AddrPort{}, errors.NetworkError("failed to greet SOCKS5 proxy", err)
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return netip.AddrPort{}, errors.NetworkError("failed to read SOCKS5 greeting", err)
+	}
+	if reply[0] != socksVersion {
+		return netip.AddrPort{}, errors.NetworkError("proxy does not speak SOCKS5", nil)
+	}
+	switch reply[1] {
+	case authNone:
+	case authPassword:
+		if err := d.socksAuthenticate(conn); err != nil {
+			return netip.AddrPort{}, err
+		}
+	default:
+		return netip.AddrPort{}, errors.NetworkError("SOCKS5 proxy accepts none of our authentication methods", nil)
+	}
+
+	req, err := appendSocksAddr([]byte{socksVersion, cmd, 0}, addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return netip.AddrPort{}, errors.NetworkError("failed to send SOCKS5 request", err)
+	}
+
+	var head [3]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return netip.AddrPort{}, errors.NetworkError("failed to read SOCKS5 reply", err)
+	}
+	if head[1] != replySucceeded {
+		return netip.AddrPort{}, errors.NetworkError(
+			"SOCKS5 proxy refused connection to "+addr+": "+socksReplyText(head[1]), nil)
+	}
+	bound, err := readSocksAddr(conn)
+	if err != nil {
+		return netip.AddrPort{}, errors.NetworkError("failed to read SOCKS5 reply", err)
+	}
+	return bound, nil
+}
+
+// socksAuthenticate sends the username and password.
+func (d *Dialer) socksAuthenticate(conn net.Conn) error {
+	if len(d.username) > 255 || len(d.password) > 255 {
+		return errors.InvalidInput("SOCKS5 username and password must be at most 255 bytes")
+	}
+	req := []byte{authPasswordV1, byte(len(d.username))}
+	req = append(req, d.username...)
+	req = append(req, byte(len(d.password)))
+	req = append(req, d.password...)
+	if _, err := conn.Write(req); err != nil {
+		return errors.NetworkError("failed to authenticate with SOCKS5 proxy", err)
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return errors.NetworkError("failed to authenticate with SOCKS5 proxy", err)
+	}
+	if reply[1] != 0 {
+		return errors.AuthenticationFailedf("SOCKS5 proxy rejected the username or password")
+	}
+	return nil
+}
+
+// socksReplyText describes a SOCKS5 reply code.
+func socksReplyText(code byte) string {
+	switch code {
+	case 1:
+		return "general failure"
+	case 2:
+		return "connection not allowed by ruleset"
+	case 3:
+		return "network unreachable"
+	case 4:
+		return "host unreachable"
+	case 5:
+		return "connection refused"
+	case 6:
+		return "TTL expired"
+	case 7:
+		return "command not supported"
+	case 8:
+		return "address type not supported"
+	default:
+		return "unknown error " + strconv.Itoa(int(code))
+	}
+}
+
+// appendSocksAddr appends an address in SOCKS5 form. Host names are sent as
+// they are, for the proxy to resolve.
+func appendSocksAddr(b []byte, addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid address %q", addr)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid port in address %q", addr)
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		if ip.Is4() {
+			b = append(b, atypIPv4)
+		} else {
+			b = append(b, atypIPv6)
+		}
+		b = append(b, ip.AsSlice()...)
+	} else {
+		if len(host) > 255 {
+			return nil, errors.InvalidInputf("host name %q is too long", host)
+		}
+		b = append(b, atypDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+// readSocksAddr reads an address in SOCKS5 form. Host names cannot be
+// returned, so they read as the zero address.
+func readSocksAddr(r io.Reader) (netip.AddrPort, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	var host []byte
+	switch atyp[0] {
+	case atypIPv4:
+		host = make([]byte, 4)
+	case atypIPv6:
+		host = make([]byte, 16)
+	case atypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return netip.AddrPort{}, err
+		}
+		host = make([]byte, n[0])
+	default:
+		return netip.AddrPort{}, errors.ParseError("unknown SOCKS5 address type", nil)
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(r, host); err != nil {
+		return netip.AddrPort{}, err
+	}
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return netip.AddrPort{}, err
+	}
+	if atyp[0] == atypDomain {
+		return netip.AddrPortFrom(netip.Addr{}, binary.BigEndian.Uint16(port[:])), nil
+	}
+	ip, _ := netip.AddrFromSlice(host)
+	return netip.AddrPortFrom(ip, binary.BigEndian.Uint16(port[:])), nil
+}
+
+// ListenPacket returns a packet connection whose datagrams are relayed by a
+// SOCKS5 proxy. The relay lasts until the connection is closed or the proxy
+// drops it.
+func (d *Dialer) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	if !d.SupportsUDP() {
+		return nil, errors.InvalidInputf("UDP cannot be sent through an %s proxy", d.typ)
+	}
+
+	ctrl, err := d.forward.DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, errors.NetworkError("failed to connect to proxy", err)
+	}
+	var relay netip.AddrPort
+	err = withContext(ctx, ctrl, func() error {
+		var err error
+		relay, err = d.socksConnect(ctrl, cmdUDPAssociate, "0.0.0.0:0")
+		return err
+	})
+	if err != nil {
+		_ = ctrl.Close()
+		return nil, err
+	}
+
+	// A relay on an unspecified address is reached at the proxy's address.
+	if !relay.Addr().IsValid() || relay.Addr().IsUnspecified() {
+		proxyAddr, err := netip.ParseAddrPort(ctrl.RemoteAddr().String())
+		if err != nil {
+			_ = ctrl.Close()
+			return nil, errors.NetworkError("unknown SOCKS5 relay address", err)
+		}
+		relay = netip.AddrPortFrom(proxyAddr.Addr(), relay.Port())
+	}
+
+	network := "udp4"
+	if relay.Addr().Unmap().Is6() {
+		network = "udp6"
+	}
+	udp, err := d.forward.ListenUDP(network)
+	if err != nil {
+		_ = ctrl.Close()
+		return nil, errors.NetworkError("failed to open UDP socket", err)
+	}
+
+	pc := &packetConn{UDPConn: udp, ctrl: ctrl, relay: net.UDPAddrFromAddrPort(relay)}
+	// The association ends when the proxy closes the control connection.
+	go func() {
+		_, _ = io.Copy(io.Discard, ctrl)
+		_ = pc.Close()
+	}()
+	return pc, nil
+}
+
+// DialUDP returns a connection to a UDP address through a SOCKS5 proxy.
+func (d *Dialer) DialUDP(ctx context.Context, addr string) (net.Conn, error) {
+	if _, err := appendSocksAddr(nil, addr); err != nil {
+		return nil, err
+	}
+	pc, err := d.ListenPacket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &udpConn{packetConn: pc.(*packetConn), remote: addr}, nil
+}
+
+// packetConn wraps datagrams in SOCKS5 UDP headers and sends them to the
+// relay.
+type packetConn struct {
+	*net.UDPConn
+	ctrl  net.Conn
+	relay *net.UDPAddr
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// WriteTo sends a datagram to an address through the relay.
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.writeTo(b, addr.String())
+}
+
+func (c *packetConn) writeTo(b []byte, addr string) (int, error) {
+	packet, err := appendSocksAddr(make([]byte, 3, udpHeaderMaxBytes+len(b)), addr)
+	if err != nil {
+		return 0, err
+	}
+	packet = append(packet, b...)
+	if _, err := c.UDPConn.WriteTo(packet, c.relay); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ReadFrom receives a datagram from the relay, returning the address it was
+// sent from.
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(b)+udpHeaderMaxBytes)
+	for {
+		n, from, err := c.UDPConn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		if from.Port() != c.relay.AddrPort().Port() || from.Addr().Unmap() != c.relay.AddrPort().Addr().Unmap() {
+			continue
+		}
+
+		packet := buf[:n]
+		// Fragmented datagrams are not supported and are dropped.
+		if len(packet) < 4 || packet[2] != 0 {
+			continue
+		}
+		r := bytes.NewReader(packet[3:])
+		src, err := readSocksAddr(r)
+		if err != nil {
+			continue
+		}
+		return copy(b, packet[n-r.Len():]), net.UDPAddrFromAddrPort(src), nil
+	}
+}
+
+// Close ends the association.
+func (c *packetConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.UDPConn.Close()
+		_ = c.ctrl.Close()
+	})
+	return c.closeErr
+}
+
+// udpConn is a packetConn that exchanges datagrams with a single address.
+type udpConn struct {
+	*packetConn
+	remote string
+
+	mu sync.Mutex
+	// from is where the last datagram came from.
+	from net.Addr
+}
+
+func (c *udpConn) Read(b []byte) (int, error) {
+	n, from, err := c.ReadFrom(b)
+	if err == nil {
+		c.mu.Lock()
+		c.from = from
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *udpConn) Write(b []byte) (int, error) {
+	return c.writeTo(b, c.remote)
+}
+
+// RemoteAddr returns the address datagrams came from, which is the resolved
+// address when the connection was made to a host name.
+func (c *udpConn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.from != nil {
+		return c.from
+	}
+	if ap, err := netip.ParseAddrPort(c.remote); err == nil {
+		return net.UDPAddrFromAddrPort(ap)
+	}
+	return socksAddr(c.remote)
+}
+
+// socksAddr is an address that may be a host name.
+type socksAddr string
+
+func (a socksAddr) Network() string { return "udp" }
+func (a socksAddr) String() string  { return string(a) }
@@ -0,0 +1,122 @@
+package torrent
+
+import (
+	"time"
+
+	"github.com/ayutaz/orochi/internal/database"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	torrentclient "github.com/ayutaz/orochi/internal/torrent_client"
+)
+
+// BanInfo describes a banned IP address or CIDR range.
+type BanInfo struct {
+	Address   string     `json:"address"`
+	Reason    string     `json:"reason,omitempty"`
+	Automatic bool       `json:"automatic"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Bans returns the bans in effect.
+func (a *ClientAdapter) Bans() []BanInfo {
+	bans := a.client.Bans()
+	result := make([]BanInfo, len(bans))
+	for i, ban := range bans {
+		result[i] = banInfo(ban)
+	}
+	return result
+}
+
+// BanPeers persists a ban of an IP address or CIDR range, then puts it into
+// effect, disconnecting its peers. A duration of zero bans them permanently.
+func (a *ClientAdapter) BanPeers(address, reason string, duration time.Duration) (BanInfo, error) {
+	ban, err := torrentclient.NewBan(address, reason, duration)
+	if err != nil {
+		return BanInfo{}, err
+	}
+	if err := a.db.SaveBan(banRecord(ban)); err != nil {
+		return BanInfo{}, err
+	}
+	a.client.RestoreBans([]torrentclient.Ban{ban})
+	return banInfo(ban), nil
+}
+
+// UnbanPeers lifts the ban of an IP address or CIDR range.
+func (a *ClientAdapter) UnbanPeers(address string) error {
+	prefix, err := torrentclient.ParseBanTarget(address)
+	if err != nil {
+		return err
+	}
+	if err := a.client.UnbanPeers(address); err != nil {
+		return err
+	}
+	if err := a.db.DeleteBan(prefix.String()); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// restoreBans puts the saved bans into effect and starts saving automatic
+// bans.
+func (a *ClientAdapter) restoreBans() error {
+	a.client.SetBanHandler(func(ban torrentclient.Ban) {
+		if err := a.db.SaveBan(banRecord(ban)); err != nil {
+			a.logger.Error("failed to save ban", logger.String("address", ban.Prefix.String()), logger.Err(err))
+		}
+	})
+
+	records, err := a.db.ListBans(time.Now())
+	if err != nil {
+		return err
+	}
+
+	bans := make([]torrentclient.Ban, 0, len(records))
+	for _, record := range records {
+		prefix, err := torrentclient.ParseBanTarget(record.Prefix)
+		if err != nil {
+			a.logger.Error("invalid saved ban", logger.String("address", record.Prefix), logger.Err(err))
+			continue
+		}
+		ban := torrentclient.Ban{
+			Prefix:    prefix,
+			Reason:    record.Reason,
+			Automatic: record.Automatic,
+			CreatedAt: record.CreatedAt,
+		}
+		if record.ExpiresAt != nil {
+			ban.ExpiresAt = *record.ExpiresAt
+		}
+		bans = append(bans, ban)
+	}
+	a.client.RestoreBans(bans)
+	return nil
+}
+
+// banInfo converts a ban to ban info.
+func banInfo(ban torrentclient.Ban) BanInfo {
+	info := BanInfo{
+		Address:   ban.Prefix.String(),
+		Reason:    ban.Reason,
+		Automatic: ban.Automatic,
+		CreatedAt: ban.CreatedAt,
+	}
+	if !ban.ExpiresAt.IsZero() {
+		info.ExpiresAt = &ban.ExpiresAt
+	}
+	return info
+}
+
+// banRecord converts a ban to its database record.
+func banRecord(ban torrentclient.Ban) *database.BanRecord {
+	record := &database.BanRecord{
+		Prefix:    ban.Prefix.String(),
+		Reason:    ban.Reason,
+		Automatic: ban.Automatic,
+		CreatedAt: ban.CreatedAt,
+	}
+	if !ban.ExpiresAt.IsZero() {
+		record.ExpiresAt = &ban.ExpiresAt
+	}
+	return record
+}
@@ -15,6 +15,7 @@ func BenchmarkListTorrents(b *testing.B) {
 		Port:        0, // Random port for testing
 		DataDir:     b.TempDir(),
 		DownloadDir: b.TempDir(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.New(&logger.Config{
 		Level:  logger.InfoLevel,
@@ -65,6 +66,7 @@ func BenchmarkGetTorrent(b *testing.B) {
 		Port:        0,
 		DataDir:     b.TempDir(),
 		DownloadDir: b.TempDir(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.New(&logger.Config{
 		Level:  logger.InfoLevel,
@@ -102,6 +104,7 @@ func BenchmarkBatchUpdate(b *testing.B) {
 		Port:        0,
 		DataDir:     b.TempDir(),
 		DownloadDir: b.TempDir(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.New(&logger.Config{
 		Level:  logger.InfoLevel,
@@ -0,0 +1,35 @@
+package torrent
+
+import (
+	"context"
+	"time"
+)
+
+// BlocklistInfo describes the IP blocklist.
+type BlocklistInfo struct {
+	Rules     int        `json:"rules"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Blocked   int        `json:"blocked"`
+	Source    string     `json:"source,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Blocklist returns the state of the IP blocklist.
+func (a *ClientAdapter) Blocklist() BlocklistInfo {
+	stats := a.client.Blocklist()
+	info := BlocklistInfo{
+		Rules:     stats.Rules,
+		Blocked:   stats.Blocked,
+		Source:    stats.Source,
+		LastError: stats.LastError,
+	}
+	if !stats.UpdatedAt.IsZero() {
+		info.UpdatedAt = &stats.UpdatedAt
+	}
+	return info
+}
+
+// RefreshBlocklist reloads the IP blocklist.
+func (a *ClientAdapter) RefreshBlocklist(ctx context.Context) error {
+	return a.client.RefreshBlocklist(ctx)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/ayutaz/orochi/internal/config"
 	"github.com/ayutaz/orochi/internal/database"
+	"github.com/ayutaz/orochi/internal/disk"
 	"github.com/ayutaz/orochi/internal/errors"
 	"github.com/ayutaz/orochi/internal/logger"
 	torrentclient "github.com/ayutaz/orochi/internal/torrent_client"
@@ -15,10 +16,11 @@ import (
 
 // ClientAdapter adapts torrent_client.Client to the Manager interface.
 type ClientAdapter struct {
-	client  *torrentclient.Client
-	logger  logger.Logger
-	db      *database.DB
-	updater *ProgressUpdater
+	client    *torrentclient.Client
+	logger    logger.Logger
+	db        *database.DB
+	updater   *ProgressUpdater
+	diskGuard *DiskGuard
 }
 
 // NewClientAdapter creates a new adapter for the torrent client.
@@ -45,6 +47,15 @@ func NewClientAdapter(cfg *config.Config, log logger.Logger) (*ClientAdapter, er
 	adapter.updater = NewProgressUpdater(adapter, db, log)
 	adapter.updater.Start()
 
+	// Watch free disk space
+	adapter.diskGuard = NewDiskGuard(adapter, disk.NewStatsProvider(), cfg, log)
+	adapter.diskGuard.Start()
+
+	// Restore bans before torrents connect to peers
+	if err := adapter.restoreBans(); err != nil {
+		log.Error("failed to restore bans", logger.Err(err))
+	}
+
 	// Restore torrents from database
 	if err := adapter.restoreTorrents(); err != nil {
 		log.Error("failed to restore torrents", logger.Err(err))
@@ -71,6 +82,35 @@ func (a *ClientAdapter) restoreTorrents() error {
 			continue
 		}
 
+		// Renamed files must be known before the torrent opens its storage
+		names, err := a.db.GetFileNames(record.ID)
+		if err != nil {
+			a.logger.Error("failed to load renamed files",
+				logger.String("id", record.ID),
+				logger.Err(err),
+			)
+		} else if err := a.client.SetFileNames(record.InfoHash, names); err != nil {
+			a.logger.Error("failed to apply renamed files",
+				logger.String("id", record.ID),
+				logger.Err(err),
+			)
+		}
+
+		// Reapply saved file selections instead of downloading every file
+		if err := a.restoreFilePriorities(record); err != nil {
+			a.logger.Error("failed to apply file priorities",
+				logger.String("id", record.ID),
+				logger.Err(err),
+			)
+		}
+
+		if err := a.restoreStrategies(record); err != nil {
+			a.logger.Error("failed to apply download strategy",
+				logger.String("id", record.ID),
+				logger.Err(err),
+			)
+		}
+
 		// Add torrent back to client
 		ctx := context.Background()
 		_, err = a.client.AddTorrent(ctx, data)
@@ -91,15 +131,65 @@ func (a *ClientAdapter) restoreTorrents() error {
 	return nil
 }
 
+// AddOptions are optional settings for a torrent being added.
+type AddOptions struct {
+	// Strategy is the download strategy, rarest-first if empty.
+	Strategy string
+}
+
 // AddTorrent implements Manager.
 func (a *ClientAdapter) AddTorrent(data []byte) (string, error) {
+	return a.AddTorrentWithOptions(data, AddOptions{})
+}
+
+// AddTorrentWithOptions adds a torrent file with the given options.
+func (a *ClientAdapter) AddTorrentWithOptions(data []byte, opts AddOptions) (string, error) {
+	strategy, err := torrentclient.ParseDownloadStrategy(opts.Strategy)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := ParseTorrentFile(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Make sure the torrent fits on disk before it starts writing
+	spaceErr := a.diskGuard.CheckSpace(info.Length)
+	if spaceErr != nil && !(errors.IsInsufficientStorage(spaceErr) && a.diskGuard.QueueEnabled()) {
+		return "", spaceErr
+	}
+
+	// Strategies must be in place before the first pieces are requested
+	if err := a.client.SetDownloadStrategies(info.InfoHash, torrentclient.Strategies{Torrent: strategy}); err != nil {
+		return "", err
+	}
+
 	ctx := context.Background()
 	torr, err := a.client.AddTorrent(ctx, data)
 	if err != nil {
+		a.client.ClearDownloadStrategies(info.InfoHash)
 		return "", err
 	}
 
-	// Save to database
+	if spaceErr != nil {
+		if err := a.diskGuard.Hold(torr.InfoHash(), info.Length); err != nil {
+			a.logger.Error("failed to queue torrent", logger.Err(err))
+		}
+	}
+
+	a.saveTorrent(torr, data)
+
+	if err := a.saveStrategies(torr); err != nil {
+		a.logger.Error("failed to save download strategy", logger.Err(err))
+	}
+
+	return torr.InfoHash(), nil
+}
+
+// saveTorrent saves a newly added torrent to the database. Failures are
+// only logged, since the torrent is running either way.
+func (a *ClientAdapter) saveTorrent(torr *torrentclient.Torrent, data []byte) {
 	record := &database.TorrentRecord{
 		ID:           torr.InfoHash(),
 		InfoHash:     torr.InfoHash(),
@@ -109,21 +199,28 @@ func (a *ClientAdapter) AddTorrent(data []byte) (string, error) {
 		Progress:     0,
 		Downloaded:   0,
 		Uploaded:     0,
-		DownloadPath: torr.SavePath(),
+		DownloadPath: torr.DataPath(),
 		AddedAt:      time.Now(),
 		Metadata:     base64.StdEncoding.EncodeToString(data),
 	}
 
 	if err := a.db.SaveTorrent(record); err != nil {
 		a.logger.Error("failed to save torrent to database", logger.Err(err))
-		// Don't fail the operation, just log the error
 	}
-
-	return torr.InfoHash(), nil
 }
 
 // AddMagnet implements Manager.
 func (a *ClientAdapter) AddMagnet(magnetLink string) (string, error) {
+	return a.AddMagnetWithOptions(magnetLink, AddOptions{})
+}
+
+// AddMagnetWithOptions adds a magnet link with the given options.
+func (a *ClientAdapter) AddMagnetWithOptions(magnetLink string, opts AddOptions) (string, error) {
+	strategy, err := torrentclient.ParseDownloadStrategy(opts.Strategy)
+	if err != nil {
+		return "", err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -131,6 +228,36 @@ func (a *ClientAdapter) AddMagnet(magnetLink string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+
+	// The size is only known once metadata has arrived
+	remaining := torr.Length() - torr.BytesCompleted()
+	if err := a.diskGuard.CheckSpace(remaining); err != nil {
+		if !errors.IsInsufficientStorage(err) || !a.diskGuard.QueueEnabled() {
+			_ = torr.Remove()
+			return "", err
+		}
+		if err := a.diskGuard.Hold(torr.InfoHash(), remaining); err != nil {
+			a.logger.Error("failed to queue torrent", logger.Err(err))
+		}
+	}
+
+	// Metadata has arrived, so the magnet is saved like a torrent file and
+	// gets a record for completion to be tracked against
+	data, err := torr.Metainfo()
+	if err != nil {
+		a.logger.Error("failed to encode magnet metadata", logger.Err(err))
+	} else {
+		a.saveTorrent(torr, data)
+	}
+
+	if strategy != torrentclient.StrategyRarestFirst {
+		if err := torr.SetStrategies(torrentclient.Strategies{Torrent: strategy}); err != nil {
+			a.logger.Error("failed to apply download strategy", logger.Err(err))
+		} else if err := a.saveStrategies(torr); err != nil {
+			a.logger.Error("failed to save download strategy", logger.Err(err))
+		}
+	}
+
 	return torr.InfoHash(), nil
 }
 
@@ -143,9 +270,10 @@ func (a *ClientAdapter) GetTorrent(id string) (*Torrent, bool) {
 
 	// Get stats for upload data
 	stats := torr.GetStats()
+	seeders, leechers := torr.Swarm()
 
 	// Convert to our Torrent struct
-	return &Torrent{
+	t := &Torrent{
 		ID:           torr.InfoHash(),
 		Info:         a.createTorrentInfo(torr),
 		Status:       a.mapStatus(torr.Status()),
@@ -154,9 +282,21 @@ func (a *ClientAdapter) GetTorrent(id string) (*Torrent, bool) {
 		Uploaded:     stats.BytesWrittenData,
 		DownloadRate: torr.DownloadRate(),
 		UploadRate:   torr.UploadRate(),
+		Seeders:      seeders,
+		Leechers:     leechers,
 		AddedAt:      torr.AddedAt(),
 		Error:        "",
-	}, true
+	}
+	a.applyHold(t)
+	return t, true
+}
+
+// applyHold reports torrents held back by the disk guard as errored.
+func (a *ClientAdapter) applyHold(t *Torrent) {
+	if reason := a.diskGuard.Reason(t.ID); reason != "" {
+		t.Status = StatusError
+		t.Error = reason
+	}
 }
 
 // mapStatus converts client status to our Status type.
@@ -280,7 +420,8 @@ func (a *ClientAdapter) convertTorrent(torr *torrentclient.Torrent, infoHash str
 		uploaded = dbRecord.Uploaded
 	}
 
-	return &Torrent{
+	seeders, leechers := torr.Swarm()
+	t := &Torrent{
 		ID:           infoHash,
 		Info:         info,
 		Status:       status,
@@ -289,9 +430,13 @@ func (a *ClientAdapter) convertTorrent(torr *torrentclient.Torrent, infoHash str
 		Uploaded:     uploaded,
 		DownloadRate: torr.DownloadRate(),
 		UploadRate:   torr.UploadRate(),
+		Seeders:      seeders,
+		Leechers:     leechers,
 		AddedAt:      time.Now(),
 		Error:        "",
 	}
+	a.applyHold(t)
+	return t
 }
 
 // convertFiles converts torrent files to domain file info.
@@ -326,6 +471,8 @@ func (a *ClientAdapter) RemoveTorrent(id string) error {
 		return err
 	}
 
+	a.diskGuard.Release(id)
+
 	// Remove from database
 	if err := a.db.DeleteTorrent(id); err != nil {
 		a.logger.Error("failed to delete torrent from database", logger.Err(err))
@@ -337,6 +484,24 @@ func (a *ClientAdapter) RemoveTorrent(id string) error {
 
 // StartTorrent implements Manager.
 func (a *ClientAdapter) StartTorrent(id string) error {
+	if err := a.startTorrent(id); err != nil {
+		return err
+	}
+	a.diskGuard.Release(id)
+	return nil
+}
+
+// StopTorrent implements Manager.
+func (a *ClientAdapter) StopTorrent(id string) error {
+	if err := a.stopTorrent(id); err != nil {
+		return err
+	}
+	a.diskGuard.Release(id)
+	return nil
+}
+
+// startTorrent starts a torrent in the client.
+func (a *ClientAdapter) startTorrent(id string) error {
 	torr, err := a.client.GetTorrent(id)
 	if err != nil {
 		return err
@@ -345,8 +510,8 @@ func (a *ClientAdapter) StartTorrent(id string) error {
 	return nil
 }
 
-// StopTorrent implements Manager.
-func (a *ClientAdapter) StopTorrent(id string) error {
+// stopTorrent stops a torrent in the client.
+func (a *ClientAdapter) stopTorrent(id string) error {
 	torr, err := a.client.GetTorrent(id)
 	if err != nil {
 		return err
@@ -355,6 +520,317 @@ func (a *ClientAdapter) StopTorrent(id string) error {
 	return nil
 }
 
+// downloadingTorrents returns the IDs of torrents that are downloading.
+func (a *ClientAdapter) downloadingTorrents() []string {
+	var ids []string
+	for _, torr := range a.client.ListTorrents() {
+		if torr.Status() == "downloading" {
+			ids = append(ids, torr.InfoHash())
+		}
+	}
+	return ids
+}
+
+// FileStatus describes a file within a torrent.
+type FileStatus struct {
+	Index          int     `json:"index"`
+	Path           string  `json:"path"`
+	Length         int64   `json:"length"`
+	BytesCompleted int64   `json:"bytes_completed"`
+	Progress       float64 `json:"progress"`
+	Priority       string  `json:"priority"`
+	Selected       bool    `json:"selected"`
+}
+
+// FileUpdate changes the priority of a file. The file is addressed by Index
+// if set, otherwise by Path. Priority takes precedence over Selected.
+type FileUpdate struct {
+	Index    *int
+	Path     string
+	Selected *bool
+	Priority string
+}
+
+// Files returns the files of a torrent with their progress and priority.
+func (a *ClientAdapter) Files(id string) ([]FileStatus, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	files := torr.Files()
+	result := make([]FileStatus, len(files))
+	for i, f := range files {
+		progress := 100.0
+		if f.Length > 0 {
+			progress = float64(f.BytesCompleted) / float64(f.Length) * 100
+		}
+		result[i] = FileStatus{
+			Index:          i,
+			Path:           f.Path,
+			Length:         f.Length,
+			BytesCompleted: f.BytesCompleted,
+			Progress:       progress,
+			Priority:       f.Priority.String(),
+			Selected:       f.Priority != torrentclient.PrioritySkip,
+		}
+	}
+	return result, nil
+}
+
+// UpdateFiles changes the priority of the given files and persists the
+// result. Every update is validated before any is applied, so a bad entry
+// leaves the torrent unchanged.
+func (a *ClientAdapter) UpdateFiles(id string, updates []FileUpdate) error {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return err
+	}
+
+	files := torr.Files()
+	priorities := make(map[int]torrentclient.FilePriority, len(updates))
+	for _, update := range updates {
+		index, err := resolveFile(files, update)
+		if err != nil {
+			return err
+		}
+
+		priority := files[index].Priority
+		switch {
+		case update.Priority != "":
+			if priority, err = torrentclient.ParseFilePriority(update.Priority); err != nil {
+				return err
+			}
+		case update.Selected == nil:
+			return errors.InvalidInputf("file %d: priority or selected is required", index)
+		case !*update.Selected:
+			priority = torrentclient.PrioritySkip
+		case priority == torrentclient.PrioritySkip:
+			priority = torrentclient.PriorityNormal
+		}
+		priorities[index] = priority
+	}
+
+	for index, priority := range priorities {
+		if err := torr.SetFilePriority(index, priority); err != nil {
+			return err
+		}
+	}
+
+	return a.saveFilePriorities(torr)
+}
+
+// resolveFile returns the index of the file an update addresses.
+func resolveFile(files []torrentclient.File, update FileUpdate) (int, error) {
+	if update.Index != nil {
+		if *update.Index < 0 || *update.Index >= len(files) {
+			return 0, errors.InvalidInputf("file index %d out of range", *update.Index)
+		}
+		return *update.Index, nil
+	}
+
+	if update.Path == "" {
+		return 0, errors.InvalidInputf("file index or path is required")
+	}
+	for i, f := range files {
+		if f.Path == update.Path {
+			return i, nil
+		}
+	}
+	return 0, errors.InvalidInputf("file not found: %s", update.Path)
+}
+
+// saveFilePriorities persists the priority of every file of a torrent.
+func (a *ClientAdapter) saveFilePriorities(torr *torrentclient.Torrent) error {
+	files := torr.Files()
+	priorities := make([]string, len(files))
+	for i, f := range files {
+		priorities[i] = f.Priority.String()
+	}
+	return a.db.SaveFilePriorities(torr.InfoHash(), priorities)
+}
+
+// restoreFilePriorities hands the saved file priorities of a torrent to the
+// client so they apply as soon as it is added.
+func (a *ClientAdapter) restoreFilePriorities(record *database.TorrentRecord) error {
+	saved, err := a.db.GetFilePriorities(record.ID)
+	if err != nil || len(saved) == 0 {
+		return err
+	}
+
+	priorities := make([]torrentclient.FilePriority, len(saved))
+	for i, name := range saved {
+		priority, err := torrentclient.ParseFilePriority(name)
+		if err != nil {
+			priority = torrentclient.PriorityNormal
+		}
+		priorities[i] = priority
+	}
+	return a.client.SetFilePriorities(record.InfoHash, priorities)
+}
+
+// DownloadStrategyInfo describes the download strategy of a torrent and the
+// files that override it, keyed by file index.
+type DownloadStrategyInfo struct {
+	Strategy string         `json:"strategy"`
+	Files    map[int]string `json:"files,omitempty"`
+}
+
+// DownloadStrategy returns the download strategy of a torrent.
+func (a *ClientAdapter) DownloadStrategy(id string) (*DownloadStrategyInfo, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	strategies := torr.Strategies()
+	info := &DownloadStrategyInfo{Strategy: string(strategies.Torrent)}
+	if len(strategies.Files) > 0 {
+		info.Files = make(map[int]string, len(strategies.Files))
+		for index, strategy := range strategies.Files {
+			info.Files[index] = string(strategy)
+		}
+	}
+	return info, nil
+}
+
+// SetDownloadStrategy replaces the download strategy of a torrent and its
+// per-file overrides, and persists them.
+func (a *ClientAdapter) SetDownloadStrategy(id string, info DownloadStrategyInfo) error {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return err
+	}
+
+	strategies, err := parseStrategies(info.Strategy, info.Files)
+	if err != nil {
+		return err
+	}
+	if err := torr.SetStrategies(strategies); err != nil {
+		return err
+	}
+
+	return a.saveStrategies(torr)
+}
+
+// parseStrategies converts strategy names to torrent client strategies.
+func parseStrategies(strategy string, files map[int]string) (torrentclient.Strategies, error) {
+	var strategies torrentclient.Strategies
+	var err error
+	if strategies.Torrent, err = torrentclient.ParseDownloadStrategy(strategy); err != nil {
+		return strategies, err
+	}
+
+	if len(files) > 0 {
+		strategies.Files = make(map[int]torrentclient.DownloadStrategy, len(files))
+		for index, name := range files {
+			if strategies.Files[index], err = torrentclient.ParseDownloadStrategy(name); err != nil {
+				return strategies, err
+			}
+		}
+	}
+	return strategies, nil
+}
+
+// saveStrategies persists the download strategies of a torrent.
+func (a *ClientAdapter) saveStrategies(torr *torrentclient.Torrent) error {
+	strategies := torr.Strategies()
+	files := make(map[int]string, len(strategies.Files))
+	for index, strategy := range strategies.Files {
+		files[index] = string(strategy)
+	}
+	return a.db.SaveDownloadStrategies(torr.InfoHash(), string(strategies.Torrent), files)
+}
+
+// restoreStrategies hands the saved download strategies of a torrent to the
+// client so they apply as soon as it is added.
+func (a *ClientAdapter) restoreStrategies(record *database.TorrentRecord) error {
+	strategy, files, err := a.db.GetDownloadStrategies(record.ID)
+	if err != nil || (strategy == "" && len(files) == 0) {
+		return err
+	}
+
+	strategies, err := parseStrategies(strategy, files)
+	if err != nil {
+		return err
+	}
+	return a.client.SetDownloadStrategies(record.InfoHash, strategies)
+}
+
+// OpenFile returns a reader for a file of a torrent that can be used while
+// the torrent downloads. The caller must close it.
+func (a *ClientAdapter) OpenFile(ctx context.Context, id string, fileIndex int) (*torrentclient.FileReader, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+	return torr.NewFileReader(ctx, fileIndex)
+}
+
+// RenameFile renames a file within a torrent and persists the new name.
+func (a *ClientAdapter) RenameFile(id string, fileIndex int, name string) error {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return err
+	}
+
+	if err := torr.RenameFile(fileIndex, name); err != nil {
+		return err
+	}
+	return a.saveFileNames(torr)
+}
+
+// RenameFolder renames a folder within a torrent and persists the new names
+// of the files inside it.
+func (a *ClientAdapter) RenameFolder(id, folder, name string) error {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return err
+	}
+
+	if err := torr.RenameFolder(folder, name); err != nil {
+		return err
+	}
+	return a.saveFileNames(torr)
+}
+
+// saveFileNames persists a torrent's renamed files and its data path, which
+// changes when the top-level folder is renamed.
+func (a *ClientAdapter) saveFileNames(torr *torrentclient.Torrent) error {
+	if err := a.db.SaveFileNames(torr.InfoHash(), torr.FileNames()); err != nil {
+		return err
+	}
+
+	if err := a.db.UpdateTorrentDownloadPath(torr.InfoHash(), torr.DataPath()); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// completed reports whether every file of a torrent that is not skipped
+// has been downloaded.
+func (a *ClientAdapter) completed(id string) bool {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return false
+	}
+	return torr.Complete()
+}
+
+// moveCompleted moves a completed torrent to its save path and returns that
+// path.
+func (a *ClientAdapter) moveCompleted(id string) (string, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return "", err
+	}
+
+	if err := torr.MoveCompleted(); err != nil {
+		return "", err
+	}
+	return torr.SavePath(), nil
+}
+
 // Count implements Manager.
 func (a *ClientAdapter) Count() int {
 	return len(a.client.ListTorrents())
@@ -367,6 +843,11 @@ func (a *ClientAdapter) Close() error {
 		a.updater.Stop()
 	}
 
+	// Stop disk guard
+	if a.diskGuard != nil {
+		a.diskGuard.Stop()
+	}
+
 	// Close database
 	if a.db != nil {
 		_ = a.db.Close()
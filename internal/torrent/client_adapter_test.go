@@ -1,9 +1,15 @@
 package torrent
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/ayutaz/orochi/internal/config"
 	"github.com/ayutaz/orochi/internal/logger"
 )
@@ -20,6 +26,7 @@ func TestClientAdapter(t *testing.T) {
 		Port:        0, // Use random port
 		DownloadDir: tmpDir,
 		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -103,6 +110,7 @@ func TestClientAdapterErrors(t *testing.T) {
 		Port:        0, // Use random port
 		DownloadDir: tmpDir,
 		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -150,6 +158,7 @@ func TestClientAdapterMapStatus(t *testing.T) {
 		Port:        0, // Use random port
 		DownloadDir: tmpDir,
 		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -176,3 +185,398 @@ func TestClientAdapterMapStatus(t *testing.T) {
 		}
 	}
 }
+
+func TestClientAdapterRenameFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:        0, // Use random port
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	log := logger.NewWithLevel(logger.ErrorLevel)
+
+	adapter, err := NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+
+	id, err := adapter.AddTorrent(CreateTestTorrent())
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	if err := adapter.RenameFile(id, 0, "../escape.txt"); err == nil {
+		t.Error("expected error for name with path separator")
+	}
+	if err := adapter.RenameFile(id, 5, "other.txt"); err == nil {
+		t.Error("expected error for out of range index")
+	}
+	if err := adapter.RenameFolder(id, "", "folder"); err == nil {
+		t.Error("expected error renaming folder of single-file torrent")
+	}
+
+	if err := adapter.RenameFile(id, 0, "renamed.txt"); err != nil {
+		t.Fatalf("failed to rename file: %v", err)
+	}
+
+	torr, _ := adapter.GetTorrent(id)
+	if got := torr.Info.Files[0].Path; len(got) != 1 || got[0] != "renamed.txt" {
+		t.Errorf("expected renamed path, got %v", got)
+	}
+
+	// The new name must survive a restart.
+	if err := adapter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	adapter, err = NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to recreate adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	torr, ok := adapter.GetTorrent(id)
+	if !ok {
+		t.Fatal("torrent not restored")
+	}
+	if got := torr.Info.Files[0].Path; len(got) != 1 || got[0] != "renamed.txt" {
+		t.Errorf("expected renamed path after restart, got %v", got)
+	}
+}
+
+func TestClientAdapterUpdateFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:        0, // Use random port
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	log := logger.NewWithLevel(logger.ErrorLevel)
+
+	adapter, err := NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+
+	id, err := adapter.AddTorrent(CreateTestTorrent())
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	files, err := adapter.Files(id)
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "test.txt" || files[0].Priority != "normal" || !files[0].Selected {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+
+	// A bad entry must leave every file unchanged.
+	index := 0
+	err = adapter.UpdateFiles(id, []FileUpdate{
+		{Index: &index, Priority: "high"},
+		{Path: "missing.txt", Priority: "low"},
+	})
+	if err == nil {
+		t.Error("expected error for unknown path")
+	}
+	if files, _ := adapter.Files(id); files[0].Priority != "normal" {
+		t.Errorf("expected priority to be unchanged, got %s", files[0].Priority)
+	}
+
+	selected := false
+	if err := adapter.UpdateFiles(id, []FileUpdate{{Path: "test.txt", Selected: &selected}}); err != nil {
+		t.Fatalf("failed to deselect file: %v", err)
+	}
+	if files, _ := adapter.Files(id); files[0].Priority != "skip" || files[0].Selected {
+		t.Errorf("expected file to be skipped, got %+v", files[0])
+	}
+
+	// The selection must survive a restart.
+	if err := adapter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	adapter, err = NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to recreate adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	files, err = adapter.Files(id)
+	if err != nil {
+		t.Fatalf("failed to list files after restart: %v", err)
+	}
+	if files[0].Priority != "skip" {
+		t.Errorf("expected skipped file after restart, got %s", files[0].Priority)
+	}
+}
+
+func TestClientAdapterDownloadStrategy(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:        0, // Use random port
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	log := logger.NewWithLevel(logger.ErrorLevel)
+
+	adapter, err := NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+
+	if _, err := adapter.AddTorrentWithOptions(CreateTestTorrent(), AddOptions{Strategy: "random"}); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+
+	id, err := adapter.AddTorrentWithOptions(CreateTestTorrent(), AddOptions{Strategy: "sequential"})
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	strategy, err := adapter.DownloadStrategy(id)
+	if err != nil {
+		t.Fatalf("failed to get strategy: %v", err)
+	}
+	if strategy.Strategy != "sequential" || len(strategy.Files) != 0 {
+		t.Errorf("unexpected strategy: %+v", strategy)
+	}
+
+	if err := adapter.SetDownloadStrategy(id, DownloadStrategyInfo{Files: map[int]string{1: "first_last"}}); err == nil {
+		t.Error("expected error for out of range file index")
+	}
+
+	update := DownloadStrategyInfo{Strategy: "rarest_first", Files: map[int]string{0: "first_last"}}
+	if err := adapter.SetDownloadStrategy(id, update); err != nil {
+		t.Fatalf("failed to set strategy: %v", err)
+	}
+
+	// The strategy must survive a restart.
+	if err := adapter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	adapter, err = NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to recreate adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	strategy, err = adapter.DownloadStrategy(id)
+	if err != nil {
+		t.Fatalf("failed to get strategy after restart: %v", err)
+	}
+	if strategy.Strategy != "rarest_first" || strategy.Files[0] != "first_last" {
+		t.Errorf("unexpected strategy after restart: %+v", strategy)
+	}
+}
+
+func TestClientAdapterCompletionWithSkippedFile(t *testing.T) {
+	// Two files of one piece each, of which only the first is wanted
+	src := filepath.Join(t.TempDir(), "album")
+	contents := map[string][]byte{
+		"a.bin": bytes.Repeat([]byte("a"), 16384),
+		"b.bin": bytes.Repeat([]byte("b"), 16384),
+	}
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range contents {
+		if err := os.WriteFile(filepath.Join(src, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info := metainfo.Info{PieceLength: 16384}
+	if err := info.BuildFromFilePath(src); err != nil {
+		t.Fatalf("failed to build info: %v", err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+	var data bytes.Buffer
+	if err := mi.Write(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:          0, // Use random port
+		DownloadDir:   filepath.Join(tmpDir, "downloads"),
+		IncompleteDir: filepath.Join(tmpDir, "incomplete"),
+		DataDir:       tmpDir,
+		Protocols:     &config.ProtocolConfig{DisableDHT: true},
+	}
+	hex := mi.HashInfoBytes().HexString()
+	incomplete := filepath.Join(cfg.IncompleteDir, hex, "album", "a.bin")
+	if err := os.MkdirAll(filepath.Dir(incomplete), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(incomplete, contents["a.bin"], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	adapter, err := NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+	adapter.updater.Stop()
+
+	id, err := adapter.AddTorrent(data.Bytes())
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	skipped := 1
+	selected := false
+	if err := adapter.UpdateFiles(id, []FileUpdate{{Index: &skipped, Selected: &selected}}); err != nil {
+		t.Fatalf("failed to skip file: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		adapter.updater.updateAll()
+		record, err := adapter.db.GetTorrent(id)
+		if err != nil {
+			t.Fatalf("failed to get torrent record: %v", err)
+		}
+		if record.CompletedAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("torrent with a skipped file did not complete")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if torr, ok := adapter.GetTorrent(id); !ok || torr.Progress >= 100 {
+		t.Errorf("expected progress below 100 with a skipped file, got %+v", torr)
+	}
+	got, err := os.ReadFile(filepath.Join(cfg.DownloadDir, hex, "album", "a.bin"))
+	if err != nil || !bytes.Equal(got, contents["a.bin"]) {
+		t.Errorf("expected the wanted file in the download dir: %v", err)
+	}
+}
+
+func TestClientAdapterBanPeers(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:        0, // Use random port
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	adapter, err := NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	if _, err := adapter.BanPeers("192.0.2.1", "testing", 0); err != nil {
+		t.Fatalf("failed to ban peers: %v", err)
+	}
+
+	// A ban that cannot be saved must not take effect
+	if err := adapter.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.BanPeers("192.0.2.2", "testing", 0); err == nil {
+		t.Fatal("expected an error when the ban cannot be saved")
+	}
+	if bans := adapter.Bans(); len(bans) != 1 || bans[0].Address != "192.0.2.1/32" {
+		t.Errorf("expected only the saved ban, got %+v", bans)
+	}
+}
+
+func TestClientAdapterMagnetCompletion(t *testing.T) {
+	contents := bytes.Repeat([]byte("m"), 16384)
+	src := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(src, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 16384}
+	if err := info.BuildFromFilePath(src); err != nil {
+		t.Fatalf("failed to build info: %v", err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+	var data bytes.Buffer
+	if err := mi.Write(&data); err != nil {
+		t.Fatal(err)
+	}
+	hex := mi.HashInfoBytes().HexString()
+
+	// The seeder already has the file where its storage looks for it
+	seederDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(seederDir, hex), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seederDir, hex, "movie.mkv"), contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	seeder, err := NewClientAdapter(&config.Config{
+		DownloadDir: seederDir,
+		DataDir:     seederDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create seeder: %v", err)
+	}
+	defer seeder.Close()
+	if _, err := seeder.AddTorrent(data.Bytes()); err != nil {
+		t.Fatalf("failed to add torrent to seeder: %v", err)
+	}
+	seederClient, err := seeder.GetClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DownloadDir:   filepath.Join(tmpDir, "downloads"),
+		IncompleteDir: filepath.Join(tmpDir, "incomplete"),
+		DataDir:       tmpDir,
+		Protocols:     &config.ProtocolConfig{DisableDHT: true},
+	}
+	adapter, err := NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+	adapter.updater.Stop()
+
+	magnet := fmt.Sprintf("magnet:?xt=urn:btih:%s&x.pe=127.0.0.1:%d", hex, seederClient.ListenPort())
+	id, err := adapter.AddMagnet(magnet)
+	if err != nil {
+		t.Fatalf("failed to add magnet: %v", err)
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		adapter.updater.updateAll()
+		record, err := adapter.db.GetTorrent(id)
+		if err != nil {
+			t.Fatalf("expected a record for the magnet: %v", err)
+		}
+		if record.CompletedAt != nil {
+			if want := filepath.Join(cfg.DownloadDir, hex, "movie.mkv"); record.DownloadPath != want {
+				t.Errorf("expected download path %s, got %s", want, record.DownloadPath)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("magnet did not complete")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	got, err := os.ReadFile(filepath.Join(cfg.DownloadDir, hex, "movie.mkv"))
+	if err != nil || !bytes.Equal(got, contents) {
+		t.Errorf("expected the file in the download dir: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/disk"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// diskResumeMargin is how much space above the reserve must be free before
+// downloads paused for low disk space are resumed. It keeps downloads from
+// flapping between paused and running around the threshold.
+const diskResumeMargin = 64 << 20 // 64MB
+
+// Reasons reported for torrents held back by the disk guard.
+const (
+	reasonLowDisk = "paused: free disk space is below the configured reserve"
+	reasonQueued  = "queued: waiting for %d bytes of free disk space"
+)
+
+// diskHold records a torrent the disk guard has stopped.
+type diskHold struct {
+	reason string
+	needed int64 // Bytes required to start a queued torrent; 0 for low-disk pauses
+}
+
+// DiskGuard keeps downloads from filling the disk that holds torrent data.
+// It rejects or queues torrents that do not fit, pauses running downloads
+// when free space falls below the reserve and resumes them once space is
+// freed.
+type DiskGuard struct {
+	adapter  *ClientAdapter
+	provider disk.StatsProvider
+	path     string
+	reserve  int64
+	queue    bool
+	logger   logger.Logger
+	interval time.Duration
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	lowDisk bool
+	held    map[string]diskHold
+}
+
+// NewDiskGuard creates a disk guard for the directory torrents download to.
+func NewDiskGuard(
+	adapter *ClientAdapter, provider disk.StatsProvider, cfg *config.Config, log logger.Logger,
+) *DiskGuard {
+	path := cfg.GetAbsoluteIncompleteDir()
+	if path == "" {
+		path = cfg.GetAbsoluteDownloadDir()
+	}
+
+	return &DiskGuard{
+		adapter:  adapter,
+		provider: provider,
+		path:     path,
+		reserve:  cfg.DiskReserve,
+		queue:    cfg.QueueOnLowDisk,
+		logger:   log,
+		interval: 5 * time.Second,
+		held:     make(map[string]diskHold),
+	}
+}
+
+// Start starts watching free disk space.
+func (g *DiskGuard) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+
+	go g.run(ctx)
+}
+
+// Stop stops watching free disk space.
+func (g *DiskGuard) Stop() {
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// run is the main loop for watching free disk space.
+func (g *DiskGuard) run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.check()
+		}
+	}
+}
+
+// Available returns the number of bytes that can be written before the
+// reserve is reached. It is negative when the reserve has been breached.
+func (g *DiskGuard) Available() (int64, error) {
+	usage, err := g.provider.Usage(g.path)
+	if err != nil {
+		return 0, errors.InternalWithError("failed to get disk usage", err)
+	}
+
+	free := int64(usage.Free) //nolint:gosec // free space never exceeds int64
+	if free < 0 {
+		free = 0
+	}
+	return free - g.reserve, nil
+}
+
+// CheckSpace returns an INSUFFICIENT_STORAGE error if size bytes do not fit
+// on disk without breaching the reserve.
+func (g *DiskGuard) CheckSpace(size int64) error {
+	available, err := g.Available()
+	if err != nil {
+		return err
+	}
+
+	if size > available {
+		return errors.InsufficientStoragef(
+			"not enough disk space: need %d bytes, %d available after %d byte reserve",
+			size, max(available, 0), g.reserve)
+	}
+	return nil
+}
+
+// QueueEnabled reports whether torrents that do not fit are queued rather
+// than rejected.
+func (g *DiskGuard) QueueEnabled() bool {
+	return g.queue
+}
+
+// Hold stops a torrent until needed bytes are available.
+func (g *DiskGuard) Hold(id string, needed int64) error {
+	if err := g.adapter.stopTorrent(id); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.held[id] = diskHold{reason: fmt.Sprintf(reasonQueued, needed), needed: needed}
+	g.mu.Unlock()
+
+	g.logger.Warn("torrent queued for disk space",
+		logger.String("id", id),
+		logger.Int64("needed", needed),
+	)
+	return nil
+}
+
+// Reason returns why the disk guard is holding a torrent back, or an empty
+// string if it is not.
+func (g *DiskGuard) Reason(id string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.held[id].reason
+}
+
+// Release forgets a torrent, for example when it is removed or started by
+// the user.
+func (g *DiskGuard) Release(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.held, id)
+}
+
+// check pauses downloads when the reserve is reached and resumes paused or
+// queued torrents once enough space is free.
+func (g *DiskGuard) check() {
+	available, err := g.Available()
+	if err != nil {
+		g.logger.Error("failed to check free disk space", logger.Err(err))
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch {
+	case !g.lowDisk && available <= 0:
+		g.pauseAll()
+	case g.lowDisk && available >= diskResumeMargin:
+		g.resumePaused()
+	}
+
+	if g.lowDisk {
+		return
+	}
+
+	// Start queued torrents that now fit, in no particular order.
+	for id, hold := range g.held {
+		if hold.needed == 0 || hold.needed > available {
+			continue
+		}
+		if err := g.adapter.startTorrent(id); err != nil {
+			g.logger.Error("failed to start queued torrent", logger.String("id", id), logger.Err(err))
+			continue
+		}
+		delete(g.held, id)
+		available -= hold.needed
+		g.logger.Info("queued torrent started", logger.String("id", id))
+	}
+}
+
+// pauseAll stops every running download. The caller must hold g.mu.
+func (g *DiskGuard) pauseAll() {
+	g.lowDisk = true
+
+	for _, id := range g.adapter.downloadingTorrents() {
+		if _, ok := g.held[id]; ok {
+			continue
+		}
+		if err := g.adapter.stopTorrent(id); err != nil {
+			g.logger.Error("failed to pause torrent", logger.String("id", id), logger.Err(err))
+			continue
+		}
+		g.held[id] = diskHold{reason: reasonLowDisk}
+	}
+
+	g.logger.Warn("free disk space below reserve, downloads paused",
+		logger.String("path", g.path),
+		logger.Int64("reserve", g.reserve),
+	)
+}
+
+// resumePaused restarts downloads paused for low disk space. The caller must
+// hold g.mu.
+func (g *DiskGuard) resumePaused() {
+	g.lowDisk = false
+
+	for id, hold := range g.held {
+		if hold.needed != 0 {
+			continue
+		}
+		if err := g.adapter.startTorrent(id); err != nil {
+			g.logger.Error("failed to resume torrent", logger.String("id", id), logger.Err(err))
+		}
+		delete(g.held, id)
+	}
+
+	g.logger.Info("free disk space recovered, downloads resumed",
+		logger.String("path", g.path),
+	)
+}
@@ -0,0 +1,123 @@
+package torrent
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/disk"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// fakeStats is a disk.StatsProvider with adjustable free space.
+type fakeStats struct {
+	mu   sync.Mutex
+	free uint64
+}
+
+func (f *fakeStats) Usage(_ string) (disk.Usage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return disk.Usage{Total: 1 << 40, Free: f.free}, nil
+}
+
+func (f *fakeStats) setFree(free uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.free = free
+}
+
+// newGuardedAdapter creates an adapter whose disk guard reads from stats.
+func newGuardedAdapter(t *testing.T, cfg *config.Config, stats *fakeStats) *ClientAdapter {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	cfg.DownloadDir = tmpDir
+	cfg.DataDir = tmpDir
+	log := logger.NewWithLevel(logger.ErrorLevel)
+
+	adapter, err := NewClientAdapter(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	t.Cleanup(func() { _ = adapter.Close() })
+
+	adapter.diskGuard.Stop()
+	adapter.diskGuard = NewDiskGuard(adapter, stats, cfg, log)
+	return adapter
+}
+
+func TestDiskGuardRejectsTorrent(t *testing.T) {
+	stats := &fakeStats{free: 1 << 20}
+	adapter := newGuardedAdapter(t, &config.Config{DiskReserve: 1 << 20, Protocols: &config.ProtocolConfig{DisableDHT: true}}, stats)
+
+	_, err := adapter.AddTorrent(CreateTestTorrent())
+	if !errors.IsInsufficientStorage(err) {
+		t.Fatalf("expected insufficient storage error, got %v", err)
+	}
+	if adapter.Count() != 0 {
+		t.Errorf("expected rejected torrent not to be added, got %d", adapter.Count())
+	}
+}
+
+func TestDiskGuardQueuesTorrent(t *testing.T) {
+	stats := &fakeStats{free: 1 << 20}
+	adapter := newGuardedAdapter(t, &config.Config{DiskReserve: 1 << 20, QueueOnLowDisk: true, Protocols: &config.ProtocolConfig{DisableDHT: true}}, stats)
+
+	id, err := adapter.AddTorrent(CreateTestTorrent())
+	if err != nil {
+		t.Fatalf("expected torrent to be queued, got %v", err)
+	}
+
+	torr, ok := adapter.GetTorrent(id)
+	if !ok {
+		t.Fatal("queued torrent not found")
+	}
+	if torr.Status != StatusError || torr.Error == "" {
+		t.Errorf("expected queued torrent to report a reason, got %s %q", torr.Status, torr.Error)
+	}
+
+	// Once space is freed the queued torrent starts.
+	stats.setFree(2 << 20)
+	adapter.diskGuard.check()
+
+	torr, _ = adapter.GetTorrent(id)
+	if torr.Error != "" {
+		t.Errorf("expected queued torrent to start, got %q", torr.Error)
+	}
+}
+
+func TestDiskGuardPausesAndResumes(t *testing.T) {
+	stats := &fakeStats{free: 1 << 30}
+	adapter := newGuardedAdapter(t, &config.Config{DiskReserve: 1 << 20, Protocols: &config.ProtocolConfig{DisableDHT: true}}, stats)
+
+	id, err := adapter.AddTorrent(CreateTestTorrent())
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	stats.setFree(1 << 20)
+	adapter.diskGuard.check()
+
+	torr, _ := adapter.GetTorrent(id)
+	if torr.Error != reasonLowDisk {
+		t.Errorf("expected torrent to be paused for low disk, got %q", torr.Error)
+	}
+
+	// Freeing less than the margin keeps downloads paused.
+	stats.setFree(1<<20 + 1)
+	adapter.diskGuard.check()
+	if torr, _ = adapter.GetTorrent(id); torr.Error != reasonLowDisk {
+		t.Errorf("expected torrent to stay paused, got %q", torr.Error)
+	}
+
+	stats.setFree(1<<20 + diskResumeMargin)
+	adapter.diskGuard.check()
+	if torr, _ = adapter.GetTorrent(id); torr.Error != "" {
+		t.Errorf("expected torrent to resume, got %q", torr.Error)
+	}
+	if torr.Status == StatusStopped {
+		t.Error("expected resumed torrent not to be stopped")
+	}
+}
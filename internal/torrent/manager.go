@@ -31,6 +31,8 @@ type Torrent struct {
 	Uploaded     int64        `json:"uploaded"`
 	DownloadRate int64        `json:"download_rate"`
 	UploadRate   int64        `json:"upload_rate"`
+	Seeders      int          `json:"seeders"`
+	Leechers     int          `json:"leechers"`
 	AddedAt      time.Time    `json:"added_at"`
 	Error        string       `json:"error,omitempty"`
 }
@@ -39,6 +41,7 @@ type Torrent struct {
 type manager struct {
 	mu       sync.RWMutex
 	torrents map[string]*Torrent
+	tracker  Tracker
 }
 
 // NewManager creates a new torrent manager.
@@ -48,6 +51,15 @@ func NewManager() Manager {
 	}
 }
 
+// NewManagerWithTracker creates a new torrent manager that scrapes the
+// trackers of started torrents for their swarm counts.
+func NewManagerWithTracker(tracker Tracker) Manager {
+	return &manager{
+		torrents: make(map[string]*Torrent),
+		tracker:  tracker,
+	}
+}
+
 // AddTorrent adds a torrent from torrent file data.
 func (m *manager) AddTorrent(data []byte) (string, error) {
 	info, err := ParseTorrentFile(data)
@@ -165,9 +177,27 @@ func (m *manager) StartTorrent(id string) error {
 	// TODO: Actually start the torrent download
 	torrent.Status = StatusDownloading
 
+	if m.tracker != nil {
+		go m.scrape(torrent)
+	}
+
 	return nil
 }
 
+// scrape updates the swarm counts of a torrent from its trackers.
+func (m *manager) scrape(torrent *Torrent) {
+	resp, err := m.tracker.Scrape(torrent)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	torrent.Seeders = resp.Seeders
+	torrent.Leechers = resp.Leechers
+}
+
 // StopTorrent stops a torrent.
 func (m *manager) StopTorrent(id string) error {
 	m.mu.Lock()
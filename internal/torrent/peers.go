@@ -0,0 +1,86 @@
+package torrent
+
+// PeerStatus describes a peer connected to a torrent.
+type PeerStatus struct {
+	Address       string  `json:"address"`
+	IP            string  `json:"ip"`
+	Port          int     `json:"port"`
+	Client        string  `json:"client"`
+	Version       string  `json:"version,omitempty"`
+	Source        string  `json:"source"`
+	Incoming      bool    `json:"incoming"`
+	Encrypted     bool    `json:"encrypted"`
+	Encryption    string  `json:"encryption"`
+	UTP           bool    `json:"utp"`
+	Choked        bool    `json:"choked"`
+	Interested    bool    `json:"interested"`
+	Progress      float64 `json:"progress"`
+	DownloadRate  int64   `json:"download_rate"`
+	RequestedRate int64   `json:"requested_rate"`
+}
+
+// peerSources names the anacrolix peer source codes.
+var peerSources = map[string]string{
+	"Tr": "tracker",
+	"I":  "incoming",
+	"Hg": "dht",
+	"Ha": "dht",
+	"X":  "pex",
+	"M":  "manual",
+	"C":  "holepunch",
+	"L":  "lsd",
+}
+
+// Peers returns the peers connected to a torrent.
+func (a *ClientAdapter) Peers(id string) ([]PeerStatus, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := torr.Peers()
+	result := make([]PeerStatus, len(peers))
+	for i, p := range peers {
+		source, ok := peerSources[p.Source]
+		if !ok {
+			source = "unknown"
+		}
+		result[i] = PeerStatus{
+			Address:       p.Address,
+			IP:            p.IP,
+			Port:          p.Port,
+			Client:        p.Client,
+			Version:       p.Version,
+			Source:        source,
+			Incoming:      p.Incoming,
+			Encrypted:     p.Encrypted,
+			Encryption:    p.Encryption,
+			UTP:           p.UTP,
+			Choked:        p.Choked,
+			Interested:    p.Interested,
+			Progress:      p.Progress,
+			DownloadRate:  p.DownloadRate,
+			RequestedRate: p.RequestedRate,
+		}
+	}
+	return result, nil
+}
+
+// DisconnectPeer closes the connection to a peer of a torrent.
+func (a *ClientAdapter) DisconnectPeer(id, address string) error {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return err
+	}
+	return torr.DisconnectPeer(address)
+}
+
+// AddPeers adds peers to a torrent by ip:port address and returns how many
+// were new.
+func (a *ClientAdapter) AddPeers(id string, addrs []string) (int, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return 0, err
+	}
+	return torr.AddPeers(addrs)
+}
@@ -0,0 +1,158 @@
+package torrent
+
+import (
+	"math"
+
+	torrentclient "github.com/ayutaz/orochi/internal/torrent_client"
+)
+
+// PieceState is the state of a single piece. It is sent over WebSocket for
+// pieces that changed since the last update.
+type PieceState struct {
+	Index        int  `json:"index"`
+	Completed    bool `json:"completed"`
+	Partial      bool `json:"partial"`
+	Checking     bool `json:"checking"`
+	Wanted       bool `json:"wanted"`
+	Availability int  `json:"availability"`
+}
+
+// AvailabilityRun is a run of consecutive pieces with the same availability.
+type AvailabilityRun struct {
+	Availability int `json:"availability"`
+	Length       int `json:"length"`
+}
+
+// PieceMap is a compact map of the pieces of a torrent. The state fields are
+// base64-encoded bitfields where the high bit of the first byte is piece 0,
+// the same layout as the BitTorrent bitfield message.
+type PieceMap struct {
+	NumPieces         int               `json:"num_pieces"`
+	PieceLength       int               `json:"piece_length"`
+	Completed         []byte            `json:"completed"`
+	Partial           []byte            `json:"partial"`
+	Checking          []byte            `json:"checking"`
+	Wanted            []byte            `json:"wanted"`
+	Availability      []AvailabilityRun `json:"availability"`
+	DistributedCopies float64           `json:"distributed_copies"`
+}
+
+// PieceStates returns the state of every piece of a torrent.
+func (a *ClientAdapter) PieceStates(id string) ([]PieceState, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+	return pieceStates(torr), nil
+}
+
+// pieceStates converts the piece statuses of a torrent to piece states.
+func pieceStates(torr *torrentclient.Torrent) []PieceState {
+	statuses := torr.PieceStatuses()
+	states := make([]PieceState, len(statuses))
+	for i, s := range statuses {
+		states[i] = PieceState{
+			Index:        i,
+			Completed:    s.Complete,
+			Partial:      s.Partial,
+			Checking:     s.Checking,
+			Wanted:       s.Wanted,
+			Availability: s.Availability,
+		}
+	}
+	return states
+}
+
+// PieceMap returns the piece map of a torrent.
+func (a *ClientAdapter) PieceMap(id string) (*PieceMap, error) {
+	_, m, err := a.PieceSnapshot(id)
+	return m, err
+}
+
+// PieceSnapshot returns the piece states of a torrent together with the
+// piece map encoding them, so later states can be compared to the map.
+func (a *ClientAdapter) PieceSnapshot(id string) ([]PieceState, *PieceMap, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	states := pieceStates(torr)
+	return states, NewPieceMap(states, torr.PieceLength()), nil
+}
+
+// NewPieceMap encodes piece states as a piece map.
+func NewPieceMap(states []PieceState, pieceLength int) *PieceMap {
+	size := (len(states) + 7) / 8
+	m := &PieceMap{
+		NumPieces:         len(states),
+		PieceLength:       pieceLength,
+		Completed:         make([]byte, size),
+		Partial:           make([]byte, size),
+		Checking:          make([]byte, size),
+		Wanted:            make([]byte, size),
+		Availability:      []AvailabilityRun{},
+		DistributedCopies: DistributedCopies(states),
+	}
+
+	for i, s := range states {
+		bit := byte(0x80) >> (i % 8)
+		if s.Completed {
+			m.Completed[i/8] |= bit
+		}
+		if s.Partial {
+			m.Partial[i/8] |= bit
+		}
+		if s.Checking {
+			m.Checking[i/8] |= bit
+		}
+		if s.Wanted {
+			m.Wanted[i/8] |= bit
+		}
+
+		if n := len(m.Availability); n > 0 && m.Availability[n-1].Availability == s.Availability {
+			m.Availability[n-1].Length++
+		} else {
+			m.Availability = append(m.Availability, AvailabilityRun{Availability: s.Availability, Length: 1})
+		}
+	}
+
+	return m
+}
+
+// DistributedCopies returns how many full copies of the torrent the connected
+// peers hold: the availability of the rarest piece plus the fraction of
+// pieces that are more available than it.
+func DistributedCopies(states []PieceState) float64 {
+	if len(states) == 0 {
+		return 0
+	}
+
+	lowest := math.MaxInt
+	for _, s := range states {
+		lowest = min(lowest, s.Availability)
+	}
+
+	above := 0
+	for _, s := range states {
+		if s.Availability > lowest {
+			above++
+		}
+	}
+	return float64(lowest) + float64(above)/float64(len(states))
+}
+
+// ChangedPieces returns the pieces of next whose state differs from prev.
+// Every piece is returned if the number of pieces differs.
+func ChangedPieces(prev, next []PieceState) []PieceState {
+	if len(prev) != len(next) {
+		return next
+	}
+
+	var changed []PieceState
+	for i := range next {
+		if next[i] != prev[i] {
+			changed = append(changed, next[i])
+		}
+	}
+	return changed
+}
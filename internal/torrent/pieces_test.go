@@ -0,0 +1,78 @@
+package torrent
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewPieceMap(t *testing.T) {
+	states := make([]PieceState, 10)
+	for i := range states {
+		states[i] = PieceState{Index: i, Wanted: true, Availability: 2}
+	}
+	states[0] = PieceState{Index: 0, Completed: true, Availability: 3}
+	states[8] = PieceState{Index: 8, Completed: true, Availability: 3}
+	states[3].Partial = true
+	states[9] = PieceState{Index: 9, Checking: true, Availability: 2}
+
+	m := NewPieceMap(states, 16384)
+
+	if m.NumPieces != 10 || m.PieceLength != 16384 {
+		t.Errorf("unexpected size: %d pieces of %d", m.NumPieces, m.PieceLength)
+	}
+	if !bytes.Equal(m.Completed, []byte{0x80, 0x80}) {
+		t.Errorf("unexpected completed bitfield: %08b", m.Completed)
+	}
+	if !bytes.Equal(m.Partial, []byte{0x10, 0x00}) {
+		t.Errorf("unexpected partial bitfield: %08b", m.Partial)
+	}
+	if !bytes.Equal(m.Checking, []byte{0x00, 0x40}) {
+		t.Errorf("unexpected checking bitfield: %08b", m.Checking)
+	}
+	if !bytes.Equal(m.Wanted, []byte{0x7f, 0x00}) {
+		t.Errorf("unexpected wanted bitfield: %08b", m.Wanted)
+	}
+
+	want := []AvailabilityRun{{3, 1}, {2, 7}, {3, 1}, {2, 1}}
+	if len(m.Availability) != len(want) {
+		t.Fatalf("expected %d availability runs, got %v", len(want), m.Availability)
+	}
+	for i := range want {
+		if m.Availability[i] != want[i] {
+			t.Errorf("run %d: expected %v, got %v", i, want[i], m.Availability[i])
+		}
+	}
+
+	if m.DistributedCopies != 2.2 {
+		t.Errorf("expected 2.2 distributed copies, got %v", m.DistributedCopies)
+	}
+}
+
+func TestChangedPieces(t *testing.T) {
+	prev := []PieceState{{Index: 0}, {Index: 1}, {Index: 2}}
+	next := []PieceState{{Index: 0}, {Index: 1, Completed: true}, {Index: 2, Availability: 1}}
+
+	changed := ChangedPieces(prev, next)
+	if len(changed) != 2 || changed[0].Index != 1 || changed[1].Index != 2 {
+		t.Errorf("unexpected changed pieces: %v", changed)
+	}
+
+	if changed := ChangedPieces(nil, next); len(changed) != 3 {
+		t.Errorf("expected every piece when sizes differ, got %v", changed)
+	}
+
+	if changed := ChangedPieces(next, next); len(changed) != 0 {
+		t.Errorf("expected no changes, got %v", changed)
+	}
+}
+
+func TestDistributedCopies(t *testing.T) {
+	if got := DistributedCopies(nil); got != 0 {
+		t.Errorf("expected 0 for no pieces, got %v", got)
+	}
+
+	states := []PieceState{{Availability: 0}, {Availability: 1}, {Availability: 1}, {Availability: 5}}
+	if got := DistributedCopies(states); got != 0.75 {
+		t.Errorf("expected 0.75, got %v", got)
+	}
+}
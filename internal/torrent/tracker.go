@@ -0,0 +1,126 @@
+package torrent
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/tracker"
+)
+
+// trackerTimeout bounds a request to a single tracker.
+const trackerTimeout = 30 * time.Second
+
+// trackerClient implements Tracker with the native tracker client.
+type trackerClient struct {
+	client *tracker.Client
+	peerID [20]byte
+	port   uint16
+}
+
+// NewTracker creates a Tracker that announces with the given peer ID and
+// listen port. A torrent's trackers are tried in order until one answers.
+func NewTracker(peerID [20]byte, port uint16) Tracker {
+	return &trackerClient{
+		client: tracker.NewClient(),
+		peerID: peerID,
+		port:   port,
+	}
+}
+
+// Announce implements Tracker.
+func (tc *trackerClient) Announce(t *Torrent) ([]Peer, error) {
+	ih, err := infoHashBytes(t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := tracker.AnnounceRequest{
+		InfoHash:   ih,
+		PeerID:     tc.peerID,
+		Port:       tc.port,
+		Uploaded:   t.Uploaded,
+		Downloaded: t.Downloaded,
+		Left:       -1,
+		NumWant:    -1,
+	}
+	if t.Info != nil && t.Info.Length > 0 {
+		req.Left = max(t.Info.Length-t.Downloaded, 0)
+	}
+
+	var lastErr error = errors.NotFoundf("torrent %s has no supported trackers", t.ID)
+	for _, u := range trackerURLs(t.Info) {
+		ctx, cancel := context.WithTimeout(context.Background(), trackerTimeout)
+		resp, err := tc.client.Announce(ctx, u, req)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		peers := make([]Peer, len(resp.Peers))
+		for i, p := range resp.Peers {
+			peers[i] = Peer{IP: p.Addr.Addr().String(), Port: int(p.Addr.Port())}
+		}
+		return peers, nil
+	}
+	return nil, lastErr
+}
+
+// Scrape implements Tracker.
+func (tc *trackerClient) Scrape(t *Torrent) (*ScrapeResponse, error) {
+	ih, err := infoHashBytes(t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error = errors.NotFoundf("torrent %s has no supported trackers", t.ID)
+	for _, u := range trackerURLs(t.Info) {
+		ctx, cancel := context.WithTimeout(context.Background(), trackerTimeout)
+		results, err := tc.client.Scrape(ctx, u, ih)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		r, ok := results[ih]
+		if !ok {
+			lastErr = errors.NotFoundf("tracker %s does not know torrent %s", u, t.ID)
+			continue
+		}
+		return &ScrapeResponse{Seeders: r.Seeders, Leechers: r.Leechers, Completed: r.Completed}, nil
+	}
+	return nil, lastErr
+}
+
+// trackerURLs returns the supported tracker URLs of a torrent without
+// duplicates, the announce URL first.
+func trackerURLs(info *TorrentInfo) []string {
+	if info == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	for _, u := range append([]string{info.Announce}, info.Trackers...) {
+		if u == "" || seen[u] || !tracker.Supported(u) {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// infoHashBytes decodes a hex info hash.
+func infoHashBytes(id string) ([20]byte, error) {
+	var ih [20]byte
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != len(ih) {
+		return ih, errors.InvalidInputf("invalid info hash %q", id)
+	}
+	copy(ih[:], b)
+	return ih, nil
+}
@@ -0,0 +1,111 @@
+package torrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/tracker"
+	"github.com/zeebo/bencode"
+)
+
+// newFakeTracker starts an HTTP tracker that returns one peer and a swarm of
+// 5 seeders and 3 leechers for every torrent.
+func newFakeTracker(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case "/announce":
+			resp = map[string]interface{}{
+				"interval":   1800,
+				"complete":   5,
+				"incomplete": 3,
+				"peers":      "\xc0\x00\x02\x01\x1a\xe1",
+			}
+		case "/scrape":
+			resp = map[string]interface{}{
+				"files": map[string]interface{}{
+					r.URL.Query().Get("info_hash"): map[string]int{"complete": 5, "downloaded": 9, "incomplete": 3},
+				},
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		_ = bencode.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTracker(t *testing.T) {
+	srv := newFakeTracker(t)
+	torrent := &Torrent{
+		ID: "0123456789abcdef0123456789abcdef01234567",
+		Info: &TorrentInfo{
+			Announce: "wss://tracker.example.com/announce",
+			Trackers: []string{srv.URL + "/announce"},
+			Length:   1024,
+		},
+	}
+	tr := NewTracker(tracker.NewPeerID(), 6881)
+
+	t.Run("アナウンスでピアを取得できる", func(t *testing.T) {
+		peers, err := tr.Announce(torrent)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(peers) != 1 || peers[0].IP != "192.0.2.1" || peers[0].Port != 6881 {
+			t.Errorf("unexpected peers: %+v", peers)
+		}
+	})
+
+	t.Run("スクレイプでスウォームを取得できる", func(t *testing.T) {
+		resp, err := tr.Scrape(torrent)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *resp != (ScrapeResponse{Seeders: 5, Leechers: 3, Completed: 9}) {
+			t.Errorf("unexpected scrape response: %+v", resp)
+		}
+	})
+
+	t.Run("対応するトラッカーがない場合はエラー", func(t *testing.T) {
+		noTrackers := &Torrent{ID: torrent.ID, Info: &TorrentInfo{Announce: "wss://tracker.example.com/announce"}}
+		if _, err := tr.Scrape(noTrackers); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestManager_ScrapesStartedTorrents(t *testing.T) {
+	srv := newFakeTracker(t)
+	mgr := NewManagerWithTracker(NewTracker(tracker.NewPeerID(), 6881))
+
+	id, err := mgr.AddMagnet("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&tr=" + srv.URL + "/announce")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mgr.StartTorrent(id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		torrent, _ := mgr.GetTorrent(id)
+		m := mgr.(*manager)
+		m.mu.RLock()
+		seeders, leechers := torrent.Seeders, torrent.Leechers
+		m.mu.RUnlock()
+		if seeders == 5 && leechers == 3 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("swarm was not scraped: %d seeders, %d leechers", seeders, leechers)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
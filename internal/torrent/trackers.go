@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"time"
+
+	torrentclient "github.com/ayutaz/orochi/internal/torrent_client"
+)
+
+// TrackerInfo describes a tracker of a torrent and its last announce.
+type TrackerInfo struct {
+	URL          string     `json:"url"`
+	Tier         int        `json:"tier"`
+	Status       string     `json:"status"`
+	LastAnnounce *time.Time `json:"last_announce,omitempty"`
+	NextAnnounce *time.Time `json:"next_announce,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Message      string     `json:"message,omitempty"`
+	Seeders      int        `json:"seeders"`
+	Leechers     int        `json:"leechers"`
+	Completed    int        `json:"completed"`
+	Peers        int        `json:"peers"`
+}
+
+// Trackers returns the trackers of a torrent.
+func (a *ClientAdapter) Trackers(id string) ([]TrackerInfo, error) {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	states := torr.Trackers()
+	result := make([]TrackerInfo, len(states))
+	for i, s := range states {
+		result[i] = trackerInfo(s)
+	}
+	return result, nil
+}
+
+// trackerInfo converts a tracker state to tracker info.
+func trackerInfo(s torrentclient.TrackerState) TrackerInfo {
+	info := TrackerInfo{
+		URL:       s.URL,
+		Tier:      s.Tier,
+		Status:    string(s.Status),
+		LastError: s.LastError,
+		Message:   s.Message,
+		Seeders:   s.Seeders,
+		Leechers:  s.Leechers,
+		Completed: s.Completed,
+		Peers:     s.Peers,
+	}
+	if !s.LastAnnounce.IsZero() {
+		info.LastAnnounce = &s.LastAnnounce
+	}
+	if !s.NextAnnounce.IsZero() {
+		info.NextAnnounce = &s.NextAnnounce
+	}
+	return info
+}
+
+// Reannounce makes a torrent announce to all its trackers now.
+func (a *ClientAdapter) Reannounce(id string) error {
+	torr, err := a.client.GetTorrent(id)
+	if err != nil {
+		return err
+	}
+	return torr.Reannounce()
+}
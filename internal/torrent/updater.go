@@ -62,6 +62,13 @@ func (u *ProgressUpdater) updateAll() {
 	torrents := u.adapter.ListTorrents()
 
 	for _, torrent := range torrents {
+		// Completion is checked regardless of status, since a torrent that
+		// finished without connected peers is reported as stopped, and
+		// regardless of progress, which skipped files keep below 100.
+		if u.adapter.completed(torrent.ID) {
+			u.handleCompletion(torrent)
+		}
+
 		// Only update if downloading or seeding
 		if torrent.Status != StatusDownloading && torrent.Status != StatusSeeding {
 			continue
@@ -82,28 +89,53 @@ func (u *ProgressUpdater) updateAll() {
 			continue
 		}
 
-		// Update status if needed
-		if torrent.Status == StatusDownloading && torrent.Progress >= 100 {
-			// Mark as completed
-			if err := u.db.MarkTorrentCompleted(torrent.ID); err != nil {
-				u.logger.Error("failed to mark torrent completed",
-					logger.String("id", torrent.ID),
-					logger.Err(err),
-				)
-			} else {
-				u.logger.Info("torrent completed",
-					logger.String("id", torrent.ID),
-					logger.String("name", torrent.Info.Name),
-				)
-			}
-		} else {
-			// Update status
-			if err := u.db.UpdateTorrentStatus(torrent.ID, string(torrent.Status)); err != nil {
-				u.logger.Error("failed to update torrent status",
-					logger.String("id", torrent.ID),
-					logger.Err(err),
-				)
-			}
+		// Update status
+		if err := u.db.UpdateTorrentStatus(torrent.ID, string(torrent.Status)); err != nil {
+			u.logger.Error("failed to update torrent status",
+				logger.String("id", torrent.ID),
+				logger.Err(err),
+			)
 		}
 	}
 }
+
+// handleCompletion moves a newly completed torrent to its save path and
+// records it as completed. Torrents already marked completed are skipped; if
+// the move fails it is retried on the next update.
+func (u *ProgressUpdater) handleCompletion(torrent *Torrent) {
+	record, err := u.db.GetTorrent(torrent.ID)
+	if err != nil || record.CompletedAt != nil {
+		return
+	}
+
+	path, err := u.adapter.moveCompleted(torrent.ID)
+	if err != nil {
+		u.logger.Error("failed to move completed torrent",
+			logger.String("id", torrent.ID),
+			logger.Err(err),
+		)
+		return
+	}
+
+	if err := u.db.UpdateTorrentDownloadPath(torrent.ID, path); err != nil {
+		u.logger.Error("failed to update torrent download path",
+			logger.String("id", torrent.ID),
+			logger.Err(err),
+		)
+		return
+	}
+
+	if err := u.db.MarkTorrentCompleted(torrent.ID); err != nil {
+		u.logger.Error("failed to mark torrent completed",
+			logger.String("id", torrent.ID),
+			logger.Err(err),
+		)
+		return
+	}
+
+	u.logger.Info("torrent completed",
+		logger.String("id", torrent.ID),
+		logger.String("name", torrent.Info.Name),
+		logger.String("path", path),
+	)
+}
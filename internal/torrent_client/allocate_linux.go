@@ -0,0 +1,18 @@
+//go:build linux
+
+package torrentclient
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocateFile reserves size bytes of disk space for f. fallocate is used so
+// the blocks are actually reserved; filesystems that do not support it fall
+// back to extending the file.
+func allocateFile(f *os.File, size int64) error {
+	if err := syscall.Fallocate(int(f.Fd()), 0, 0, size); err == nil {
+		return nil
+	}
+	return f.Truncate(size)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package torrentclient
+
+import "os"
+
+// allocateFile extends f to size bytes. On platforms without fallocate the
+// file may be sparse, so this only guarantees the file has its final length.
+func allocateFile(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
@@ -0,0 +1,409 @@
+package torrentclient
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/blocklist"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// Ban keeps the peers of an address range from connecting.
+type Ban struct {
+	Prefix netip.Prefix
+	Reason string
+	// Automatic is set for peers banned for sending corrupt data.
+	Automatic bool
+	CreatedAt time.Time
+	// ExpiresAt is when the ban is lifted, or zero if it is permanent.
+	ExpiresAt time.Time
+}
+
+// expired reports whether the ban has been lifted.
+func (b Ban) expired(now time.Time) bool {
+	return !b.ExpiresAt.IsZero() && !now.Before(b.ExpiresAt)
+}
+
+// ParseBanTarget parses an IP address or CIDR range to ban.
+func ParseBanTarget(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, errors.InvalidInputf("invalid CIDR range %q", s)
+		}
+		if prefix.Addr().Is4In6() {
+			return netip.Prefix{}, errors.InvalidInputf("invalid CIDR range %q", s)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return netip.Prefix{}, errors.InvalidInputf("invalid IP address %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// banFailureWindow is how long a peer's failed pieces are counted. A peer
+// that sends no corrupt data for that long starts over, so occasional
+// failures never add up to a ban.
+const banFailureWindow = time.Hour
+
+// peerFailures counts the failed pieces a peer contributed to.
+type peerFailures struct {
+	count int
+	last  time.Time
+}
+
+// pieceContribution is who sent the data of a piece that is not verified
+// yet.
+type pieceContribution struct {
+	bytes int64
+	peers map[netip.Addr]struct{}
+}
+
+// banManager keeps the banned address ranges and counts the failed pieces
+// peers contributed to. Its lookups run under the torrent client's lock, so
+// it must not call into the client while holding mu.
+type banManager struct {
+	// maxFailures is the number of failed pieces a peer may contribute to,
+	// or negative if peers are never banned automatically.
+	maxFailures int
+	duration    time.Duration
+
+	mu       sync.Mutex
+	bans     map[netip.Prefix]Ban
+	failures map[netip.Addr]peerFailures
+	// prunedAt is when failures were last pruned.
+	prunedAt time.Time
+	pieces   map[metainfo.Hash]map[int]*pieceContribution
+	// onBan is called with automatic bans.
+	onBan func(Ban)
+}
+
+func newBanManager(maxFailures int, duration time.Duration) *banManager {
+	return &banManager{
+		maxFailures: maxFailures,
+		duration:    duration,
+		bans:        make(map[netip.Prefix]Ban),
+		failures:    make(map[netip.Addr]peerFailures),
+		pieces:      make(map[metainfo.Hash]map[int]*pieceContribution),
+	}
+}
+
+// lookup returns the ban range containing an address.
+func (bm *banManager) lookup(ip net.IP) (iplist.Range, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return iplist.Range{}, false
+	}
+	addr = addr.Unmap()
+	now := time.Now()
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for prefix, ban := range bm.bans {
+		if prefix.Contains(addr) && !ban.expired(now) {
+			return iplist.Range{
+				First:       net.IP(addr.AsSlice()),
+				Last:        net.IP(addr.AsSlice()),
+				Description: "banned: " + ban.Reason,
+			}, true
+		}
+	}
+	return iplist.Range{}, false
+}
+
+// len returns the number of bans.
+func (bm *banManager) len() int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return len(bm.bans)
+}
+
+// receivedData records the peer that sent a block.
+func (bm *banManager) receivedData(event torrent.ReceivedUsefulDataEvent) {
+	if bm.maxFailures < 0 {
+		return
+	}
+	ap, err := netip.ParseAddrPort(event.Peer.RemoteAddr.String())
+	if err != nil {
+		// Web seeds have no address.
+		return
+	}
+	ih := event.Peer.Torrent().InfoHash()
+	index := int(event.Message.Index)
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	pieces, ok := bm.pieces[ih]
+	if !ok {
+		pieces = make(map[int]*pieceContribution)
+		bm.pieces[ih] = pieces
+	}
+	pc, ok := pieces[index]
+	if !ok {
+		pc = &pieceContribution{peers: make(map[netip.Addr]struct{})}
+		pieces[index] = pc
+	}
+	pc.bytes += int64(len(event.Message.Piece))
+	pc.peers[ap.Addr().Unmap()] = struct{}{}
+}
+
+// pieceVerified forgets who sent the data of a piece and, if it failed the
+// hash check, returns the ranges of the peers that are banned for it.
+func (bm *banManager) pieceVerified(ih metainfo.Hash, index int, length int64, ok bool) []Ban {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	pc := bm.pieces[ih][index]
+	if pc == nil {
+		return nil
+	}
+	delete(bm.pieces[ih], index)
+	// A piece that fails before all of it arrived was not sent by peers.
+	if ok || pc.bytes < length {
+		return nil
+	}
+
+	var banned []Ban
+	now := time.Now()
+	bm.pruneFailures(now)
+	for addr := range pc.peers {
+		f := bm.failures[addr]
+		if now.Sub(f.last) > banFailureWindow {
+			f.count = 0
+		}
+		f.count++
+		f.last = now
+		bm.failures[addr] = f
+		if f.count <= bm.maxFailures {
+			continue
+		}
+
+		ban := Ban{
+			Prefix:    netip.PrefixFrom(addr, addr.BitLen()),
+			Reason:    fmt.Sprintf("sent data for %d pieces that failed the hash check", f.count),
+			Automatic: true,
+			CreatedAt: now,
+		}
+		if bm.duration > 0 {
+			ban.ExpiresAt = now.Add(bm.duration)
+		}
+		bm.bans[ban.Prefix] = ban
+		delete(bm.failures, addr)
+		banned = append(banned, ban)
+	}
+	return banned
+}
+
+// pruneFailures forgets the failures of peers that sent no corrupt data
+// for banFailureWindow, at most once per window. The caller holds mu.
+func (bm *banManager) pruneFailures(now time.Time) {
+	if now.Sub(bm.prunedAt) < banFailureWindow {
+		return
+	}
+	bm.prunedAt = now
+	for addr, f := range bm.failures {
+		if now.Sub(f.last) > banFailureWindow {
+			delete(bm.failures, addr)
+		}
+	}
+}
+
+// dropTorrent forgets the pieces of a removed torrent.
+func (bm *banManager) dropTorrent(ih metainfo.Hash) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	delete(bm.pieces, ih)
+}
+
+// peerFilter refuses connections to banned peers and peers in the blocklist.
+type peerFilter struct {
+	bans      *banManager
+	blocklist *blocklist.List
+}
+
+// Lookup returns the ban or blocklist range containing an address.
+func (f peerFilter) Lookup(ip net.IP) (iplist.Range, bool) {
+	if r, ok := f.bans.lookup(ip); ok {
+		return r, true
+	}
+	return f.blocklist.Lookup(ip)
+}
+
+// NumRanges returns the number of bans and blocklist rules.
+func (f peerFilter) NumRanges() int {
+	return f.bans.len() + f.blocklist.NumRanges()
+}
+
+// watchHashFailures bans peers that send data for pieces that fail the hash
+// check, until the torrent is removed.
+func (c *Client) watchHashFailures(t *torrent.Torrent) {
+	if c.bans.maxFailures < 0 {
+		return
+	}
+
+	sub := t.SubscribePieceStateChanges()
+	defer sub.Close()
+	defer c.bans.dropTorrent(t.InfoHash())
+
+	checking := make(map[int]bool)
+	for {
+		select {
+		case <-t.Closed():
+			return
+		case change, ok := <-sub.Values:
+			if !ok {
+				return
+			}
+			if change.Checking {
+				checking[change.Index] = true
+				continue
+			}
+			if !checking[change.Index] {
+				continue
+			}
+			delete(checking, change.Index)
+
+			length := t.Piece(change.Index).Info().Length()
+			for _, ban := range c.bans.pieceVerified(t.InfoHash(), change.Index, length, change.Complete) {
+				c.logger.Warn("peer banned",
+					logger.String("range", ban.Prefix.String()),
+					logger.String("reason", ban.Reason),
+				)
+				c.disconnectBanned(ban.Prefix)
+				c.bans.mu.Lock()
+				onBan := c.bans.onBan
+				c.bans.mu.Unlock()
+				if onBan != nil {
+					onBan(ban)
+				}
+			}
+		}
+	}
+}
+
+// disconnectBanned closes the connections to peers in a banned range.
+func (c *Client) disconnectBanned(prefix netip.Prefix) {
+	for _, t := range c.torrentClient().Torrents() {
+		for _, pc := range t.PeerConns() {
+			ap, err := netip.ParseAddrPort(pc.RemoteAddr.String())
+			if err == nil && prefix.Contains(ap.Addr().Unmap()) {
+				_ = pc.Close()
+			}
+		}
+	}
+}
+
+// SetBanHandler sets a function that is called with every automatic ban, so
+// it can be persisted.
+func (c *Client) SetBanHandler(fn func(Ban)) {
+	c.bans.mu.Lock()
+	defer c.bans.mu.Unlock()
+	c.bans.onBan = fn
+}
+
+// NewBan creates a ban of an IP address or CIDR range starting now, to be
+// put into effect with RestoreBans. A duration of zero bans them
+// permanently.
+func NewBan(target, reason string, duration time.Duration) (Ban, error) {
+	prefix, err := ParseBanTarget(target)
+	if err != nil {
+		return Ban{}, err
+	}
+	if duration < 0 {
+		return Ban{}, errors.InvalidInputf("ban duration cannot be negative")
+	}
+
+	ban := Ban{Prefix: prefix, Reason: reason, CreatedAt: time.Now()}
+	if duration > 0 {
+		ban.ExpiresAt = ban.CreatedAt.Add(duration)
+	}
+	return ban, nil
+}
+
+// BanPeers bans an IP address or CIDR range and disconnects its peers. A
+// duration of zero bans them permanently.
+func (c *Client) BanPeers(target, reason string, duration time.Duration) (Ban, error) {
+	ban, err := NewBan(target, reason, duration)
+	if err != nil {
+		return Ban{}, err
+	}
+	c.RestoreBans([]Ban{ban})
+	return ban, nil
+}
+
+// RestoreBans puts bans into effect, such as bans saved before a restart.
+// Expired bans are ignored.
+func (c *Client) RestoreBans(bans []Ban) {
+	now := time.Now()
+	var added []netip.Prefix
+
+	c.bans.mu.Lock()
+	for _, ban := range bans {
+		if !ban.expired(now) {
+			c.bans.bans[ban.Prefix] = ban
+			added = append(added, ban.Prefix)
+		}
+	}
+	c.bans.mu.Unlock()
+
+	for _, prefix := range added {
+		c.disconnectBanned(prefix)
+	}
+}
+
+// UnbanPeers lifts the ban of an IP address or CIDR range.
+func (c *Client) UnbanPeers(target string) error {
+	prefix, err := ParseBanTarget(target)
+	if err != nil {
+		return err
+	}
+
+	c.bans.mu.Lock()
+	defer c.bans.mu.Unlock()
+
+	if _, ok := c.bans.bans[prefix]; !ok {
+		return errors.NotFoundf("%s is not banned", prefix)
+	}
+	delete(c.bans.bans, prefix)
+	return nil
+}
+
+// Bans returns the bans in effect, oldest first.
+func (c *Client) Bans() []Ban {
+	now := time.Now()
+
+	c.bans.mu.Lock()
+	defer c.bans.mu.Unlock()
+
+	bans := make([]Ban, 0, len(c.bans.bans))
+	for prefix, ban := range c.bans.bans {
+		if ban.expired(now) {
+			delete(c.bans.bans, prefix)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		if !bans[i].CreatedAt.Equal(bans[j].CreatedAt) {
+			return bans[i].CreatedAt.Before(bans[j].CreatedAt)
+		}
+		return bans[i].Prefix.String() < bans[j].Prefix.String()
+	})
+	return bans
+}
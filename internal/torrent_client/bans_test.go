@@ -0,0 +1,238 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// alwaysComplete claims every piece is complete without checking it.
+type alwaysComplete struct{}
+
+func (alwaysComplete) Get(metainfo.PieceKey) (storage.Completion, error) {
+	return storage.Completion{Complete: true, Ok: true}, nil
+}
+func (alwaysComplete) Set(metainfo.PieceKey, bool) error { return nil }
+func (alwaysComplete) Close() error                      { return nil }
+
+// newCorruptSeeder creates a client that serves garbage for every piece of
+// a torrent and returns its address.
+func newCorruptSeeder(t *testing.T, data []byte) string {
+	t.Helper()
+
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, info.Name), bytes.Repeat([]byte("x"), int(info.Length)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.ListenPort = 0
+	cfg.Seed = true
+	cfg.NoDHT = true
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: alwaysComplete{},
+	})
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	if _, err := cl.AddTorrent(mi); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("127.0.0.1:%d", cl.LocalPort())
+}
+
+func TestParseBanTarget(t *testing.T) {
+	valid := map[string]string{
+		"192.0.2.1":        "192.0.2.1/32",
+		"::ffff:192.0.2.1": "192.0.2.1/32",
+		"2001:db8::1":      "2001:db8::1/128",
+		"192.0.2.77/24":    "192.0.2.0/24",
+		" 2001:db8::/32 ":  "2001:db8::/32",
+	}
+	for target, want := range valid {
+		prefix, err := ParseBanTarget(target)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", target, err)
+		} else if prefix.String() != want {
+			t.Errorf("expected %s for %q, got %s", want, target, prefix)
+		}
+	}
+
+	for _, target := range []string{"", "example.com", "192.0.2.1/33", "192.0.2.1:6881"} {
+		if _, err := ParseBanTarget(target); !errors.IsInvalidInput(err) {
+			t.Errorf("expected invalid input for %q, got %v", target, err)
+		}
+	}
+}
+
+func TestBanPeers(t *testing.T) {
+	seeder, data := newSeeder(t, 4)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+	leecher, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer leecher.Close()
+
+	torr, err := leecher.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !connected(torr, addr) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	ban, err := leecher.BanPeers("127.0.0.0/8", "testing", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if ban.ExpiresAt.IsZero() {
+		t.Error("expected the ban to expire")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if connected(torr, addr) {
+		t.Error("banned peer is still connected")
+	}
+
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if connected(torr, addr) {
+		t.Fatal("banned peer was connected again")
+	}
+
+	if bans := leecher.Bans(); len(bans) != 1 || bans[0].Reason != "testing" {
+		t.Errorf("unexpected bans: %+v", bans)
+	}
+	if err := leecher.UnbanPeers("127.0.0.1/8"); err != nil {
+		t.Fatalf("failed to unban: %v", err)
+	}
+	if err := leecher.UnbanPeers("127.0.0.0/8"); !errors.IsNotFound(err) {
+		t.Errorf("expected not found for a lifted ban, got %v", err)
+	}
+
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitComplete(t, torr)
+}
+
+func TestExpiredBans(t *testing.T) {
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	prefix, _ := ParseBanTarget("192.0.2.1")
+	client.RestoreBans([]Ban{{
+		Prefix:    prefix,
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	}})
+	if bans := client.Bans(); len(bans) != 0 {
+		t.Errorf("expected expired bans to be ignored, got %+v", bans)
+	}
+}
+
+func TestAutomaticBans(t *testing.T) {
+	data := createMultiPieceTorrent(t, 4)
+	addr := newCorruptSeeder(t, data)
+
+	cfg := &config.Config{DownloadDir: t.TempDir(), Bans: &config.BanConfig{MaxHashFailures: 1}, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+	leecher, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer leecher.Close()
+
+	banned := make(chan Ban, 1)
+	leecher.SetBanHandler(func(ban Ban) { banned <- ban })
+
+	torr, err := leecher.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+
+	select {
+	case ban := <-banned:
+		if ban.Prefix.String() != "127.0.0.1/32" || !ban.Automatic || !ban.ExpiresAt.IsZero() {
+			t.Errorf("unexpected ban: %+v", ban)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("peer sending corrupt data was not banned")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if connected(torr, addr) {
+		t.Error("banned peer is still connected")
+	}
+}
+
+func TestBanFailureWindow(t *testing.T) {
+	bm := newBanManager(1, 0)
+	ih := metainfo.Hash{1}
+	peer := netip.MustParseAddr("192.0.2.1")
+	fail := func() []Ban {
+		bm.pieces[ih] = map[int]*pieceContribution{0: {bytes: 16384, peers: map[netip.Addr]struct{}{peer: {}}}}
+		return bm.pieceVerified(ih, 0, 16384, false)
+	}
+
+	if banned := fail(); len(banned) != 0 {
+		t.Fatalf("expected no ban for the first failure, got %+v", banned)
+	}
+
+	// A failure outside the window starts the count over
+	f := bm.failures[peer]
+	f.last = time.Now().Add(-banFailureWindow - time.Second)
+	bm.failures[peer] = f
+	if banned := fail(); len(banned) != 0 {
+		t.Fatalf("expected an old failure not to count, got %+v", banned)
+	}
+	if banned := fail(); len(banned) != 1 {
+		t.Fatalf("expected a ban for two failures in the window, got %+v", banned)
+	}
+
+	// Peers that stopped failing are forgotten
+	other := netip.MustParseAddr("192.0.2.2")
+	bm.failures[other] = peerFailures{count: 1, last: time.Now().Add(-banFailureWindow - time.Second)}
+	bm.prunedAt = time.Time{}
+	fail()
+	if _, ok := bm.failures[other]; ok {
+		t.Error("expected the failures of an idle peer to be pruned")
+	}
+}
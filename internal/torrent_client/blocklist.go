@@ -0,0 +1,58 @@
+package torrentclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/blocklist"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// startBlocklist loads the configured blocklist file and starts refreshing
+// the list from the configured URL.
+func (c *Client) startBlocklist() {
+	cfg := c.config.Blocklist
+	if cfg == nil {
+		return
+	}
+
+	if cfg.Path != "" {
+		if err := c.blocklist.LoadFile(cfg.Path); err != nil && cfg.URL == "" {
+			c.logger.Warn("failed to load blocklist", logger.Err(err))
+		}
+	}
+	if cfg.URL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.stopBlocklist = func() {
+		cancel()
+		<-done
+	}
+	go func() {
+		defer close(done)
+		c.blocklist.Run(ctx, cfg.URL, cfg.Path, time.Duration(cfg.RefreshInterval)*time.Second)
+	}()
+}
+
+// Blocklist returns the state of the IP blocklist.
+func (c *Client) Blocklist() blocklist.Stats {
+	return c.blocklist.Stats()
+}
+
+// RefreshBlocklist reloads the IP blocklist from the configured URL, or from
+// the configured file if there is no URL.
+func (c *Client) RefreshBlocklist(ctx context.Context) error {
+	cfg := c.config.Blocklist
+	switch {
+	case cfg != nil && cfg.URL != "":
+		return c.blocklist.Download(ctx, cfg.URL, cfg.Path)
+	case cfg != nil && cfg.Path != "":
+		return c.blocklist.LoadFile(cfg.Path)
+	default:
+		return errors.InvalidInput("no blocklist is configured")
+	}
+}
@@ -0,0 +1,73 @@
+package torrentclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+func TestBlocklist(t *testing.T) {
+	seeder, data := newSeeder(t, 4)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("127.0.0.0/8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{DownloadDir: t.TempDir(), Blocklist: &config.BlocklistConfig{Path: path}, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+	leecher, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer leecher.Close()
+
+	if stats := leecher.Blocklist(); stats.Rules != 1 || stats.Source != path {
+		t.Fatalf("unexpected blocklist stats: %+v", stats)
+	}
+
+	torr, err := leecher.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if connected(torr, addr) {
+		t.Fatal("blocked peer was connected")
+	}
+	if got := leecher.Blocklist().Blocked; got != 1 {
+		t.Errorf("expected the blocked peer to be counted once, got %d", got)
+	}
+
+	// The new list is used without restarting the client.
+	if err := os.WriteFile(path, []byte("10.0.0.0/8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := leecher.RefreshBlocklist(context.Background()); err != nil {
+		t.Fatalf("failed to refresh blocklist: %v", err)
+	}
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitComplete(t, torr)
+}
+
+func TestRefreshBlocklistWithoutConfig(t *testing.T) {
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.RefreshBlocklist(context.Background()); !errors.IsInvalidInput(err) {
+		t.Errorf("expected invalid input, got %v", err)
+	}
+}
@@ -4,16 +4,24 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/url"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
-	"github.com/anacrolix/torrent/storage"
+	"github.com/ayutaz/orochi/internal/blocklist"
 	"github.com/ayutaz/orochi/internal/config"
 	"github.com/ayutaz/orochi/internal/errors"
 	"github.com/ayutaz/orochi/internal/logger"
 	"github.com/ayutaz/orochi/internal/network"
+	"github.com/ayutaz/orochi/internal/portmap"
+	"github.com/ayutaz/orochi/internal/tracker"
 )
 
 // Client wraps the anacrolix torrent client.
@@ -21,43 +29,133 @@ type Client struct {
 	client         *torrent.Client
 	logger         logger.Logger
 	config         *config.Config
+	storage        *fileStorage
 	networkMonitor *network.Monitor
+	killSwitch     *killSwitch
+	peers          *peerTracker
+	trackerClient  *tracker.Client
+	blocklist      *blocklist.List
+	bans           *banManager
+	// stopBlocklist stops blocklist refreshes, if they were started.
+	stopBlocklist func()
+	// closeDHT stops the DHT relayed through the proxy, if it was started.
+	closeDHT func()
+	// stopDHTSaver stops saving the DHT routing table, if it was started.
+	stopDHTSaver func()
+	// dhtPeers keeps the peers announced to the DHT servers across
+	// restarts. dhtAnnounces counts announces of torrents to the DHT, and
+	// dhtReceived announces received from peers.
+	dhtPeers     *dhtPeerStore
+	dhtAnnounces atomic.Int64
+	dhtReceived  atomic.Int64
+	// privateMSE is set if plaintext connections of private torrents
+	// are closed.
+	privateMSE bool
+	// binding is the sockets bound to the VPN interface, if VPN binding was
+	// enabled when the client was created.
+	binding *vpnBinding
+	// interfaces and routes are used by the network monitor.
+	interfaces network.InterfaceProvider
+	routes     network.RouteProvider
+	// protocols are the features and transports the client was started
+	// with.
+	protocols *config.ProtocolConfig
+	// peerPort is the port peers connect to, zero for a random one picked
+	// from peerPortRange if set.
+	peerPort      int
+	peerPortRange *config.PortRange
+	// peerID is kept across restarts, so trackers see the same client.
+	peerID string
+	// lsd announces torrents on the local network, if LSD is running.
+	lsd *lsdService
+	// portMapper maps the peer port on the router, if port mapping is
+	// enabled. portMapSkipped tells why the current port is not mapped.
+	portMapper     *portmap.Mapper
+	portMapSkipped string
+
+	// dhtSaveMu serializes saving the DHT routing table and guards what
+	// was saved last.
+	dhtSaveMu     sync.Mutex
+	dhtSavedNodes int
+	dhtSavedAt    time.Time
+
+	// configMu keeps configuration changes in order. monitorMu guards
+	// networkMonitor, which VPN changes replace, and clientMu guards client
+	// and the state made with it, which restarts replace: binding,
+	// closeDHT, privateMSE, protocols, the peer port and its mapping. It
+	// also guards lsd.
+	configMu  sync.Mutex
+	monitorMu sync.RWMutex
+	clientMu  sync.RWMutex
+
+	mu         sync.Mutex
+	stopped    map[metainfo.Hash]bool
+	priorities map[metainfo.Hash][]FilePriority
+	strategies map[metainfo.Hash]*strategyState
+	trackers   map[metainfo.Hash][]*trackerAnnouncer
 }
 
 // NewClient creates a new torrent client.
 func NewClient(cfg *config.Config, log logger.Logger) (*Client, error) {
-	clientConfig := torrent.NewDefaultClientConfig()
-	clientConfig.DataDir = cfg.GetAbsoluteDownloadDir()
-	// Use configured port for BitTorrent, or 0 for random (useful in tests)
-	if cfg.Port == 0 {
-		clientConfig.ListenPort = 0 // Random port
-	} else {
-		clientConfig.ListenPort = 6881 // BitTorrent default port
+	// Create storage
+	storageImpl := newFileStorage(fileStorageOpts{
+		DownloadDir:   cfg.GetAbsoluteDownloadDir(),
+		IncompleteDir: cfg.GetAbsoluteIncompleteDir(),
+		PartSuffix:    cfg.IncompletePartSuffix,
+		Preallocate:   cfg.Preallocate,
+	})
+
+	// The blocklist is swapped in place, as the client cannot be given a new one
+	ipBlocklist := blocklist.New()
+	bans := newBanManager(-1, 0)
+	if cfg.Bans != nil {
+		bans = newBanManager(cfg.Bans.MaxHashFailures, time.Duration(cfg.Bans.Duration)*time.Second)
 	}
-	clientConfig.Seed = true
-	// clientConfig.Logger = log // TODO: implement logger adapter
 
-	// Create storage
-	storageImpl := storage.NewFileByInfoHash(cfg.GetAbsoluteDownloadDir())
-	clientConfig.DefaultStorage = storageImpl
+	client := &Client{
+		logger:        log,
+		config:        cfg,
+		storage:       storageImpl,
+		peers:         newPeerTracker(),
+		trackerClient: tracker.NewClient(),
+		blocklist:     ipBlocklist,
+		bans:          bans,
+		killSwitch:    newKillSwitch(),
+		interfaces:    network.NewInterfaceProvider(),
+		routes:        network.NewRouteProvider(),
+		protocols:     cfg.Protocols,
+		peerPort:      cfg.PeerPort,
+		peerPortRange: cfg.PeerPortRange,
+		portMapper:    newPortMapper(cfg.PortMapping, log),
+		stopBlocklist: func() {},
+		closeDHT:      func() {},
+		stopDHTSaver:  func() {},
+		dhtPeers:      newDHTPeerStore(),
+		stopped:       make(map[metainfo.Hash]bool),
+		priorities:    make(map[metainfo.Hash][]FilePriority),
+		strategies:    make(map[metainfo.Hash]*strategyState),
+		trackers:      make(map[metainfo.Hash][]*trackerAnnouncer),
+	}
 
-	// Create torrent client
-	torrentClient, err := torrent.NewClient(clientConfig)
+	torrentClient, err := client.start()
 	if err != nil {
-		return nil, errors.InternalWithError("failed to create torrent client", err)
+		_ = storageImpl.Close()
+		return nil, err
 	}
-
-	client := &Client{
-		client: torrentClient,
-		logger: log,
-		config: cfg,
+	client.client = torrentClient
+	peerID := torrentClient.PeerID()
+	client.peerID = string(peerID[:])
+	client.mapPeerPort(torrentClient)
+
+	client.startBlocklist()
+	client.startDHTSaver()
+	if cfg.Protocols.LSD() {
+		client.startLSD()
 	}
 
 	// Set up VPN monitoring if enabled
 	if cfg.VPN != nil && cfg.VPN.Enabled {
-		client.networkMonitor = network.NewNetworkMonitor(cfg.VPN)
-		client.networkMonitor.SetLogger(log)
-		client.networkMonitor.Start()
+		client.startMonitor(client.newMonitor(cfg.VPN))
 
 		log.Info("VPN binding enabled",
 			logger.String("interface", cfg.VPN.InterfaceName),
@@ -68,10 +166,80 @@ func NewClient(cfg *config.Config, log logger.Logger) (*Client, error) {
 	return client, nil
 }
 
+// start creates an anacrolix client from the configuration and routes its
+// traffic through the proxy and the VPN binding. During a restart the caller
+// holds clientMu.
+func (c *Client) start() (*torrent.Client, error) {
+	cfg := c.config
+	clientConfig := torrent.NewDefaultClientConfig()
+	clientConfig.DataDir = cfg.GetAbsoluteDownloadDir()
+	clientConfig.PeerID = c.peerID
+	clientConfig.Seed = true
+	// Trackers are announced to by the client itself so their state is known
+	clientConfig.DisableTrackers = true
+	// clientConfig.Logger = log // TODO: implement logger adapter
+
+	clientConfig.DefaultStorage = c.storage
+	c.peers.install(clientConfig)
+	clientConfig.IPBlocklist = peerFilter{bans: c.bans, blocklist: c.blocklist}
+	clientConfig.Callbacks.ReceivedUsefulData = append(clientConfig.Callbacks.ReceivedUsefulData, c.bans.receivedData)
+
+	c.privateMSE = configureEncryption(cfg.Encryption, clientConfig)
+	if c.privateMSE {
+		requirePrivateEncryption(clientConfig)
+	}
+	configureProtocols(c.protocols, clientConfig)
+	c.configureDHT(clientConfig)
+	// The port mapper replaces the client's own UPnP forwarding
+	clientConfig.NoDefaultPortForwarding = c.portMapper != nil
+
+	binding := configureBinding(cfg, clientConfig)
+	proxyDialer, err := configureProxy(cfg.Proxy, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	if binding != nil && proxyDialer != nil {
+		// The proxy itself is reached through the VPN
+		proxyDialer.SetForward(binding)
+	}
+
+	// Create torrent client, trying the next port if one is taken
+	var torrentClient *torrent.Client
+	for _, port := range c.listenPorts() {
+		clientConfig.ListenPort = port
+		if torrentClient, err = torrent.NewClient(clientConfig); err == nil {
+			break
+		}
+		c.logger.Debug("failed to listen on peer port", logger.Int("port", port), logger.Err(err))
+	}
+	if err != nil {
+		return nil, errors.InternalWithError("failed to create torrent client", err)
+	}
+
+	c.closeDHT = func() {}
+	c.binding = nil
+	if proxyDialer != nil {
+		c.startProxy(torrentClient, proxyDialer)
+	}
+	if binding != nil {
+		c.startBinding(torrentClient, binding, clientConfig.ListenPort)
+	}
+	return torrentClient, nil
+}
+
+// torrentClient returns the anacrolix client, which is replaced when the
+// client restarts.
+func (c *Client) torrentClient() *torrent.Client {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+
+	return c.client
+}
+
 // AddTorrent adds a torrent from file data.
 func (c *Client) AddTorrent(_ context.Context, data []byte) (*Torrent, error) {
 	// Check VPN status if kill switch is enabled
-	if c.networkMonitor != nil && !c.networkMonitor.ShouldAllowConnection() {
+	if !c.connectionAllowed() {
 		return nil, errors.PermissionDeniedf("VPN kill switch active - VPN connection required")
 	}
 
@@ -82,13 +250,18 @@ func (c *Client) AddTorrent(_ context.Context, data []byte) (*Torrent, error) {
 	}
 
 	// Add torrent to client
-	t, err := c.client.AddTorrent(metaInfo)
+	t, err := c.torrentClient().AddTorrent(metaInfo)
 	if err != nil {
 		return nil, errors.InternalWithError("failed to add torrent", err)
 	}
 
 	// Start downloading
-	t.DownloadAll()
+	c.applyFilePriorities(t)
+	c.applyStrategies(t)
+	c.startTrackers(t)
+	go c.watchHashFailures(t)
+	go c.announceDHT(t)
+	c.announceLSD()
 
 	c.logger.Info("torrent added",
 		logger.String("name", t.Name()),
@@ -106,30 +279,45 @@ func (c *Client) AddTorrent(_ context.Context, data []byte) (*Torrent, error) {
 // AddMagnet adds a torrent from a magnet link.
 func (c *Client) AddMagnet(ctx context.Context, magnetLink string) (*Torrent, error) {
 	// Check VPN status if kill switch is enabled
-	if c.networkMonitor != nil && !c.networkMonitor.ShouldAllowConnection() {
+	if !c.connectionAllowed() {
 		return nil, errors.PermissionDeniedf("VPN kill switch active - VPN connection required")
 	}
 
+	// Peer hints are dialed as given, so reject malformed ones up front
+	if u, err := url.Parse(magnetLink); err == nil {
+		for _, addr := range u.Query()["x.pe"] {
+			if _, err := ParsePeerAddr(addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Add magnet link
-	t, err := c.client.AddMagnet(magnetLink)
+	t, err := c.torrentClient().AddMagnet(magnetLink)
 	if err != nil {
 		return nil, errors.ParseError("failed to add magnet link", err)
 	}
+	go c.announceDHT(t)
+	c.announceLSD()
+	// Trackers are the only source of peers for some magnets, so they are
+	// announced to with left unknown until the metadata arrives
+	c.startTrackers(t)
 
 	// Wait for info to be available
-	select {
-	case <-t.GotInfo():
-		c.logger.Info("torrent metadata received",
-			logger.String("name", t.Name()),
-			logger.String("info_hash", t.InfoHash().HexString()),
-		)
-	case <-ctx.Done():
-		t.Drop()
-		return nil, errors.Timeout("timeout waiting for torrent metadata")
+	if t, err = c.waitInfo(ctx, t); err != nil {
+		return nil, err
 	}
+	c.closePlaintextPeers(t)
+	c.closePEXPeers(t)
+	c.logger.Info("torrent metadata received",
+		logger.String("name", t.Name()),
+		logger.String("info_hash", t.InfoHash().HexString()),
+	)
 
 	// Start downloading
-	t.DownloadAll()
+	c.applyFilePriorities(t)
+	c.applyStrategies(t)
+	go c.watchHashFailures(t)
 
 	return &Torrent{
 		torrent:    t,
@@ -139,6 +327,28 @@ func (c *Client) AddMagnet(ctx context.Context, magnetLink string) (*Torrent, er
 	}, nil
 }
 
+// waitInfo waits for the metadata of a magnet. A restart closes the torrent
+// and adds it back to the new client, which is then waited on instead.
+func (c *Client) waitInfo(ctx context.Context, t *torrent.Torrent) (*torrent.Torrent, error) {
+	for {
+		select {
+		case <-t.GotInfo():
+			return t, nil
+		case <-ctx.Done():
+			c.stopTrackers(t.InfoHash())
+			t.Drop()
+			return nil, errors.Timeout("timeout waiting for torrent metadata")
+		case <-t.Closed():
+			// restart holds clientMu until the torrent is back
+			readded, ok := c.torrentClient().Torrent(t.InfoHash())
+			if !ok || readded == t {
+				return nil, errors.Conflict("torrent was removed while waiting for torrent metadata")
+			}
+			t = readded
+		}
+	}
+}
+
 // GetTorrent returns a torrent by info hash.
 func (c *Client) GetTorrent(infoHash string) (*Torrent, error) {
 	// Validate info hash length
@@ -150,7 +360,7 @@ func (c *Client) GetTorrent(infoHash string) (*Torrent, error) {
 	ih := metainfo.NewHashFromHex(infoHash)
 
 	// Find torrent
-	t, ok := c.client.Torrent(ih)
+	t, ok := c.torrentClient().Torrent(ih)
 	if !ok {
 		return nil, errors.NotFoundf("torrent not found: %s", infoHash)
 	}
@@ -169,7 +379,7 @@ func (c *Client) GetTorrentsBatch(infoHashes []string) (map[string]*Torrent, err
 	result := make(map[string]*Torrent, len(infoHashes))
 
 	// Get all torrents once
-	allTorrents := c.client.Torrents()
+	allTorrents := c.torrentClient().Torrents()
 	torrentMap := make(map[metainfo.Hash]*torrent.Torrent, len(allTorrents))
 
 	// Build a map for O(1) lookup
@@ -206,7 +416,7 @@ func (c *Client) GetTorrentsBatch(infoHashes []string) (map[string]*Torrent, err
 
 // ListTorrents returns all torrents.
 func (c *Client) ListTorrents() []*Torrent {
-	torrents := c.client.Torrents()
+	torrents := c.torrentClient().Torrents()
 	result := make([]*Torrent, 0, len(torrents))
 
 	for _, t := range torrents {
@@ -224,16 +434,101 @@ func (c *Client) ListTorrents() []*Torrent {
 // Close closes the torrent client.
 func (c *Client) Close() error {
 	// Stop network monitor if running
-	if c.networkMonitor != nil {
-		c.networkMonitor.Stop()
+	if m := c.GetNetworkMonitor(); m != nil {
+		m.Stop()
 	}
 
+	c.stopBlocklist()
+	c.stopDHTSaver()
+	c.stopLSD()
+	c.stopAllTrackers()
+
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	if c.portMapper != nil {
+		c.portMapper.Stop()
+	}
+	c.saveDHTNodes(c.client)
 	c.client.Close()
+	c.closeDHT()
+	c.closeBinding()
+	return c.storage.Close()
+}
+
+// setStopped records whether a torrent has been stopped.
+func (c *Client) setStopped(ih metainfo.Hash, stopped bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stopped {
+		c.stopped[ih] = true
+	} else {
+		delete(c.stopped, ih)
+	}
+}
+
+// isStopped reports whether a torrent has been stopped.
+func (c *Client) isStopped(ih metainfo.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stopped[ih]
+}
+
+// SetFileNames records the renamed paths of a torrent's files so they are
+// used when the torrent is added. Names are keyed by the file's original
+// path relative to the torrent's directory, as returned by Torrent.FileNames.
+func (c *Client) SetFileNames(infoHash string, names map[string]string) error {
+	if len(infoHash) != 40 {
+		return errors.InvalidInputf("invalid info hash length: %d (expected 40)", len(infoHash))
+	}
+
+	c.storage.setFileNames(metainfo.NewHashFromHex(infoHash), names)
 	return nil
 }
 
+// SetFilePriorities records the priorities of a torrent's files, by file
+// index, so they are applied when the torrent is added instead of
+// downloading every file.
+func (c *Client) SetFilePriorities(infoHash string, priorities []FilePriority) error {
+	if len(infoHash) != 40 {
+		return errors.InvalidInputf("invalid info hash length: %d (expected 40)", len(infoHash))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ih := metainfo.NewHashFromHex(infoHash)
+	if len(priorities) == 0 {
+		delete(c.priorities, ih)
+	} else {
+		c.priorities[ih] = priorities
+	}
+	return nil
+}
+
+// applyFilePriorities sets the priority of every file of a newly added
+// torrent, using priorities recorded with SetFilePriorities and normal
+// priority for the rest.
+func (c *Client) applyFilePriorities(t *torrent.Torrent) {
+	c.mu.Lock()
+	priorities := c.priorities[t.InfoHash()]
+	delete(c.priorities, t.InfoHash())
+	c.mu.Unlock()
+
+	for i, f := range t.Files() {
+		priority := PriorityNormal
+		if i < len(priorities) {
+			priority = priorities[i]
+		}
+		f.SetPriority(priority.piecePriority())
+	}
+}
+
 // GetNetworkMonitor returns the network monitor if available.
 func (c *Client) GetNetworkMonitor() *network.Monitor {
+	c.monitorMu.RLock()
+	defer c.monitorMu.RUnlock()
 	return c.networkMonitor
 }
 
@@ -261,6 +556,14 @@ func (t *Torrent) Length() int64 {
 	return t.torrent.Length()
 }
 
+// Metainfo returns the torrent file, built from the metadata for magnets.
+func (t *Torrent) Metainfo() ([]byte, error) {
+	if t.torrent.Info() == nil {
+		return nil, errors.Conflict("torrent metadata is not available yet")
+	}
+	return bencode.Marshal(t.torrent.Metainfo())
+}
+
 // PieceLength returns the length of each piece.
 func (t *Torrent) PieceLength() int {
 	info := t.torrent.Info()
@@ -293,11 +596,7 @@ func (t *Torrent) KnownPeers() []torrent.PeerInfo {
 
 // Private returns whether the torrent is private.
 func (t *Torrent) Private() bool {
-	info := t.torrent.Info()
-	if info != nil && info.Private != nil {
-		return *info.Private
-	}
-	return false
+	return isPrivate(t.torrent)
 }
 
 // AddedAt returns when the torrent was added.
@@ -322,14 +621,33 @@ func (t *Torrent) Progress() float64 {
 	return float64(t.torrent.BytesCompleted()) / float64(t.torrent.Length()) * 100
 }
 
+// Complete reports whether every file that is not skipped has been
+// downloaded. Skipped files keep Progress below 100 for good.
+func (t *Torrent) Complete() bool {
+	if t.torrent.Info() == nil {
+		return false
+	}
+	for _, f := range t.torrent.Files() {
+		if f.Priority() != torrent.PiecePriorityNone && f.BytesCompleted() < f.Length() {
+			return false
+		}
+	}
+	return true
+}
+
 // Status returns the torrent's status.
 func (t *Torrent) Status() string {
-	if t.torrent.Seeding() {
-		return "seeding"
+	if t.client.isStopped(t.torrent.InfoHash()) || t.client.isHeld(t.torrent.InfoHash()) {
+		return "stopped"
 	}
-	if t.torrent.BytesCompleted() < t.torrent.Length() {
+	// Seeding reports true while data is still missing because the client
+	// is configured to seed, so completeness has to be checked first.
+	if !t.Complete() {
 		return "downloading"
 	}
+	if t.torrent.Seeding() {
+		return "seeding"
+	}
 	return "stopped"
 }
 
@@ -385,7 +703,7 @@ func (t *Torrent) UploadRate() int64 {
 // Start starts downloading the torrent.
 func (t *Torrent) Start() {
 	// Check VPN status if kill switch is enabled
-	if t.client.networkMonitor != nil && !t.client.networkMonitor.ShouldAllowConnection() {
+	if !t.client.connectionAllowed() {
 		t.client.logger.Warn("torrent start blocked by VPN kill switch",
 			logger.String("name", t.Name()),
 			logger.String("info_hash", t.InfoHash()),
@@ -393,7 +711,10 @@ func (t *Torrent) Start() {
 		return
 	}
 
-	t.torrent.DownloadAll()
+	t.client.setStopped(t.torrent.InfoHash(), false)
+	t.torrent.AllowDataUpload()
+	t.torrent.AllowDataDownload()
+	t.client.kickTrackers(t.torrent.InfoHash())
 	t.client.logger.Info("torrent started",
 		logger.String("name", t.Name()),
 		logger.String("info_hash", t.InfoHash()),
@@ -402,8 +723,10 @@ func (t *Torrent) Start() {
 
 // Stop stops the torrent.
 func (t *Torrent) Stop() {
+	t.client.setStopped(t.torrent.InfoHash(), true)
 	t.torrent.DisallowDataDownload()
 	t.torrent.DisallowDataUpload()
+	t.client.kickTrackers(t.torrent.InfoHash())
 	t.client.logger.Info("torrent stopped",
 		logger.String("name", t.Name()),
 		logger.String("info_hash", t.InfoHash()),
@@ -412,7 +735,11 @@ func (t *Torrent) Stop() {
 
 // Remove removes the torrent.
 func (t *Torrent) Remove() error {
+	t.client.stopTrackers(t.torrent.InfoHash())
 	t.torrent.Drop()
+	t.client.setStopped(t.torrent.InfoHash(), false)
+	t.client.storage.setFileNames(t.torrent.InfoHash(), nil)
+	t.client.dropStrategies(t.torrent.InfoHash())
 	t.client.logger.Info("torrent removed",
 		logger.String("name", t.Name()),
 		logger.String("info_hash", t.InfoHash()),
@@ -420,59 +747,236 @@ func (t *Torrent) Remove() error {
 	return nil
 }
 
-// Files returns the torrent's files.
+// Files returns the torrent's files. Paths reflect any renames.
 func (t *Torrent) Files() []File {
 	files := t.torrent.Files()
 	result := make([]File, 0, len(files))
 
-	for _, f := range files {
+	var paths []string
+	if ts, ok := t.client.storage.get(t.torrent.InfoHash()); ok {
+		paths = ts.displayPaths()
+	}
+
+	for i, f := range files {
+		filePath := f.Path()
+		if i < len(paths) {
+			filePath = paths[i]
+		}
 		result = append(result, File{
-			Path:   f.Path(),
-			Length: f.Length(),
+			Path:           filePath,
+			Length:         f.Length(),
+			BytesCompleted: f.BytesCompleted(),
+			Priority:       filePriorityOf(f.Priority()),
 		})
 	}
 
 	return result
 }
 
-// SavePath returns the path where the torrent is saved.
+// SavePath returns the final path of the torrent's content, which is where
+// the data ends up once the torrent has completed.
 func (t *Torrent) SavePath() string {
-	return filepath.Join(t.client.config.GetAbsoluteDownloadDir(), t.torrent.Name())
+	if ts, ok := t.client.storage.get(t.torrent.InfoHash()); ok {
+		return ts.savePath()
+	}
+	return filepath.Join(t.client.storage.downloadDir, t.InfoHash(), t.torrent.Name())
+}
+
+// RenameFile renames a file within the torrent. The name replaces the last
+// element of the file's path and must not contain path separators.
+func (t *Torrent) RenameFile(fileIndex int, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	ts, err := t.fileStorage()
+	if err != nil {
+		return err
+	}
+
+	files := t.torrent.Files()
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return errors.InvalidInputf("file index %d out of range", fileIndex)
+	}
+
+	fi := files[fileIndex].FileInfo()
+	ts.mu.RLock()
+	from := ts.currentPath(&fi)
+	ts.mu.RUnlock()
+
+	if err := ts.rename(from, path.Join(path.Dir(from), name)); err != nil {
+		return err
+	}
+
+	t.client.logger.Info("torrent file renamed",
+		logger.String("info_hash", t.InfoHash()),
+		logger.String("from", from),
+		logger.String("name", name),
+	)
+	return nil
+}
+
+// RenameFolder renames a folder within the torrent. The folder is given as
+// a slash-separated path relative to the torrent's top-level folder, as in
+// Files; an empty path renames the top-level folder itself.
+func (t *Torrent) RenameFolder(folder, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	info := t.torrent.Info()
+	if info == nil {
+		return errors.InvalidInputf("torrent %s has no metadata yet", t.InfoHash())
+	}
+	if !info.IsDir() {
+		return errors.InvalidInputf("torrent %s has no folders", t.InfoHash())
+	}
+
+	ts, err := t.fileStorage()
+	if err != nil {
+		return err
+	}
+
+	ts.mu.RLock()
+	from := path.Join(ts.rootName(), strings.Trim(folder, "/"))
+	ts.mu.RUnlock()
+
+	// A file matches its own path exactly; folders only match as a prefix.
+	for _, f := range t.Files() {
+		if f.Path == strings.Trim(folder, "/") {
+			return errors.InvalidInputf("%s is a file, not a folder", folder)
+		}
+	}
+
+	if err := ts.rename(from, path.Join(path.Dir(from), name)); err != nil {
+		return err
+	}
+
+	t.client.logger.Info("torrent folder renamed",
+		logger.String("info_hash", t.InfoHash()),
+		logger.String("from", from),
+		logger.String("name", name),
+	)
+	return nil
+}
+
+// FileNames returns the renamed paths of the torrent's files, keyed by
+// their original path relative to the torrent's directory. Persist them and
+// pass them to Client.SetFileNames to keep the names across restarts.
+func (t *Torrent) FileNames() map[string]string {
+	ts, ok := t.client.storage.get(t.torrent.InfoHash())
+	if !ok {
+		return nil
+	}
+	return ts.fileNames()
+}
+
+// fileStorage returns the storage of the torrent.
+func (t *Torrent) fileStorage() (*torrentStorage, error) {
+	if t.torrent.Info() == nil {
+		return nil, errors.InvalidInputf("torrent %s has no metadata yet", t.InfoHash())
+	}
+
+	ts, ok := t.client.storage.get(t.torrent.InfoHash())
+	if !ok {
+		return nil, errors.NotFoundf("storage for torrent %s not found", t.InfoHash())
+	}
+	return ts, nil
+}
+
+// validateName checks that name can be used as a single file or folder name.
+func validateName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return errors.InvalidInputf("name must not be empty")
+	case name == "." || name == "..":
+		return errors.InvalidInputf("invalid name: %s", name)
+	case strings.ContainsAny(name, "/\\\x00"):
+		return errors.InvalidInputf("name must not contain path separators: %s", name)
+	}
+	return nil
+}
+
+// DataPath returns where the torrent's content currently lives. This is in
+// the incomplete directory until the torrent has been moved on completion.
+func (t *Torrent) DataPath() string {
+	ts, ok := t.client.storage.get(t.torrent.InfoHash())
+	if !ok {
+		return t.SavePath()
+	}
+	return ts.dataPath()
+}
+
+// MoveCompleted moves a completed torrent from the incomplete directory to
+// its save path. It is a no-op if the data is already there.
+func (t *Torrent) MoveCompleted() error {
+	if !t.Complete() {
+		return errors.InvalidInputf("torrent %s is not complete", t.InfoHash())
+	}
+
+	ts, ok := t.client.storage.get(t.torrent.InfoHash())
+	if !ok {
+		return errors.NotFoundf("storage for torrent %s not found", t.InfoHash())
+	}
+
+	if err := ts.moveToDownloadDir(); err != nil {
+		return errors.InternalWithError("failed to move completed torrent", err)
+	}
+
+	t.client.logger.Info("completed torrent moved",
+		logger.String("name", t.Name()),
+		logger.String("info_hash", t.InfoHash()),
+		logger.String("path", t.SavePath()),
+	)
+	return nil
 }
 
 // SetFilePriority sets the priority for a specific file.
-func (t *Torrent) SetFilePriority(fileIndex, priority int) error {
+func (t *Torrent) SetFilePriority(fileIndex int, priority FilePriority) error {
 	files := t.torrent.Files()
 	if fileIndex < 0 || fileIndex >= len(files) {
 		return errors.InvalidInputf("file index %d out of range", fileIndex)
 	}
 
-	// Set priority: 0 = don't download, 1 = normal, 2 = high
-	// Convert int to PiecePriority type
-	var piecePrio torrent.PiecePriority
-	switch priority {
-	case 0:
-		piecePrio = torrent.PiecePriorityNone
-	case 1:
-		piecePrio = torrent.PiecePriorityNormal
-	case 2:
-		piecePrio = torrent.PiecePriorityHigh
-	default:
-		piecePrio = torrent.PiecePriorityNormal
-	}
-	files[fileIndex].SetPriority(piecePrio)
+	files[fileIndex].SetPriority(priority.piecePriority())
+	t.client.updatePiecePriorities(t.torrent)
 	return nil
 }
 
 // SetFileSelected sets whether a file should be downloaded.
 func (t *Torrent) SetFileSelected(fileIndex int, selected bool) error {
-	priority := 0
+	priority := PrioritySkip
 	if selected {
-		priority = 1
+		priority = PriorityNormal
 	}
 	return t.SetFilePriority(fileIndex, priority)
 }
 
+// NewFileReader returns a reader for a file of the torrent. It can be used
+// while the torrent downloads: reads wait for missing pieces, and the pieces
+// at and just ahead of the read position are downloaded first. Reads give up
+// when ctx is done.
+func (t *Torrent) NewFileReader(ctx context.Context, fileIndex int) (*FileReader, error) {
+	if t.torrent.Info() == nil {
+		return nil, errors.InvalidInputf("torrent %s has no metadata yet", t.InfoHash())
+	}
+
+	files := t.torrent.Files()
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return nil, errors.InvalidInputf("file index %d out of range", fileIndex)
+	}
+
+	reader := files[fileIndex].NewReader()
+	reader.SetReadahead(streamReadahead)
+
+	return &FileReader{
+		reader: reader,
+		ctx:    ctx,
+		path:   t.Files()[fileIndex].Path,
+		length: files[fileIndex].Length(),
+	}, nil
+}
+
 // GetStats returns torrent statistics in our format.
 func (t *Torrent) GetStats() Stats {
 	stats := t.torrent.Stats()
@@ -504,8 +1008,48 @@ func (t *Torrent) countSeeders() int {
 
 // File represents a file in a torrent.
 type File struct {
-	Path   string
-	Length int64
+	Path           string
+	Length         int64
+	BytesCompleted int64
+	Priority       FilePriority
+}
+
+// streamReadahead is how far ahead of the read position a file reader asks
+// for pieces, so playback does not stall at every piece boundary.
+const streamReadahead = 16 << 20 // 16MB
+
+// FileReader reads a file of a torrent while it downloads. It implements
+// io.ReadSeekCloser.
+type FileReader struct {
+	reader torrent.Reader
+	ctx    context.Context
+	path   string
+	length int64
+}
+
+// Read implements io.Reader. It blocks until data is available.
+func (r *FileReader) Read(p []byte) (int, error) {
+	return r.reader.ReadContext(r.ctx, p)
+}
+
+// Seek implements io.Seeker. Seeking moves the prioritized window.
+func (r *FileReader) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.Seek(offset, whence)
+}
+
+// Close releases the reader and its piece priorities.
+func (r *FileReader) Close() error {
+	return r.reader.Close()
+}
+
+// Path returns the file's path within the torrent.
+func (r *FileReader) Path() string {
+	return r.path
+}
+
+// Length returns the file's length in bytes.
+func (r *FileReader) Length() int64 {
+	return r.length
 }
 
 // Stats represents torrent statistics.
@@ -61,6 +61,7 @@ func TestNewClient(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -86,6 +87,7 @@ func TestAddTorrent(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port1,
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -132,6 +134,7 @@ func TestAddMagnet(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port2,
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -164,6 +167,7 @@ func TestGetTorrent(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port3,
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -209,6 +213,7 @@ func TestListTorrents(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port4,
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -252,6 +257,7 @@ func TestTorrentOperations(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port5,
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -345,6 +351,7 @@ func TestInvalidInfoHash(t *testing.T) {
 	cfg := &config.Config{
 		Port:        0, // Use random port6,
 		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
 	}
 	log := logger.NewWithLevel(logger.ErrorLevel)
 
@@ -360,3 +367,73 @@ func TestInvalidInfoHash(t *testing.T) {
 		t.Error("expected error for invalid info hash")
 	}
 }
+
+func TestFilePriorities(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:        0, // Use random port
+		DownloadDir: tmpDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	log := logger.NewWithLevel(logger.ErrorLevel)
+
+	client, err := NewClient(cfg, log)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	torr, err := client.AddTorrent(ctx, createTestTorrent())
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	if got := torr.Files()[0].Priority; got != PriorityNormal {
+		t.Errorf("expected new files to have normal priority, got %s", got)
+	}
+
+	for _, priority := range []FilePriority{PrioritySkip, PriorityLow, PriorityHigh, PriorityMaximum, PriorityNormal} {
+		if err := torr.SetFilePriority(0, priority); err != nil {
+			t.Fatalf("failed to set priority %s: %v", priority, err)
+		}
+		if got := torr.Files()[0].Priority; got != priority {
+			t.Errorf("expected priority %s, got %s", priority, got)
+		}
+	}
+
+	if err := torr.SetFilePriority(1, PriorityHigh); err == nil {
+		t.Error("expected error for out of range file index")
+	}
+
+	// Priorities recorded before the torrent is added replace the default.
+	if err := torr.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetFilePriorities(torr.InfoHash(), []FilePriority{PrioritySkip}); err != nil {
+		t.Fatal(err)
+	}
+	torr, err = client.AddTorrent(ctx, createTestTorrent())
+	if err != nil {
+		t.Fatalf("failed to re-add torrent: %v", err)
+	}
+	if got := torr.Files()[0].Priority; got != PrioritySkip {
+		t.Errorf("expected restored priority skip, got %s", got)
+	}
+}
+
+func TestParseFilePriority(t *testing.T) {
+	for _, name := range []string{"skip", "low", "normal", "high", "maximum"} {
+		priority, err := ParseFilePriority(name)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", name, err)
+		}
+		if priority.String() != name {
+			t.Errorf("expected %q, got %q", name, priority.String())
+		}
+	}
+
+	if _, err := ParseFilePriority("urgent"); err == nil {
+		t.Error("expected error for unknown priority")
+	}
+}
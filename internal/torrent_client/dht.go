@@ -0,0 +1,373 @@
+package torrentclient
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	peer_store "github.com/anacrolix/dht/v2/peer-store"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+const (
+	// dhtNodesFile is the file in DataDir the DHT routing table is saved in.
+	dhtNodesFile = "dht_nodes.dat"
+	// dhtSaveInterval is how often the routing table is saved while
+	// running, so little of it is lost if the process dies.
+	dhtSaveInterval = 10 * time.Minute
+
+	// dhtPeerExpiry is how long a peer announced to the client is handed
+	// out, as BEP 5 suggests.
+	dhtPeerExpiry = 30 * time.Minute
+	// dhtMaxTorrents and dhtMaxPeers bound the announced peers kept.
+	dhtMaxTorrents = 10000
+	dhtMaxPeers    = 200
+	// dhtPeersPerReply keeps get_peers replies within a datagram.
+	dhtPeersPerReply = 50
+)
+
+// DHTStats describes the DHT servers of the client, one per socket.
+// Server figures start over when the client restarts; announce counts do
+// not.
+type DHTStats struct {
+	Servers int
+	// Nodes is the size of the routing tables, of which GoodNodes answered
+	// lately or have not been asked yet.
+	Nodes     int
+	GoodNodes int
+	// BadNodes is the number of nodes blocked for misbehaving.
+	BadNodes int
+	// OutstandingQueries are waiting for an answer.
+	OutstandingQueries int
+	QueriesSent        int64
+	// Announces is the number of times torrents were announced, and
+	// AnnouncesAccepted the announce_peer queries nodes accepted for them.
+	Announces         int64
+	AnnouncesAccepted int64
+	// AnnouncesReceived counts announce_peer queries from other peers,
+	// whose peers are handed out to nodes that ask: StoredPeers of
+	// StoredTorrents.
+	AnnouncesReceived int64
+	StoredPeers       int
+	StoredTorrents    int
+	// SavedNodes were saved in DataDir at SavedAt, which is zero if nothing
+	// was saved yet.
+	SavedNodes int
+	SavedAt    time.Time
+}
+
+// configureDHT makes DHT servers join through the saved nodes, the
+// configured bootstrap nodes and, unless left out, the public routers. The
+// peers announced to them are kept, so a private DHT finds peers too.
+func (c *Client) configureDHT(clientConfig *torrent.ClientConfig) {
+	cfg := c.config.DHT
+	if cfg == nil {
+		cfg = &config.DHTConfig{}
+	}
+	clientConfig.ConfigureAnacrolixDhtServer = func(sc *dht.ServerConfig) {
+		// The network anacrolix passes is "udp" for either family
+		network := dhtNetwork(sc.Conn.LocalAddr())
+		sc.StartingNodes = func() ([]dht.Addr, error) {
+			return c.dhtStartingNodes(cfg, network)
+		}
+		sc.PeerStore = c.dhtPeers
+		onAnnouncePeer := sc.OnAnnouncePeer
+		sc.OnAnnouncePeer = func(ih metainfo.Hash, ip net.IP, port int, portOk bool) {
+			c.dhtReceived.Add(1)
+			if onAnnouncePeer != nil {
+				onAnnouncePeer(ih, ip, port, portOk)
+			}
+		}
+	}
+}
+
+// dhtNetwork returns "udp4" or "udp6" for the address of a DHT socket, or
+// "udp" if the family is unknown.
+func dhtNetwork(addr net.Addr) string {
+	udp, ok := addr.(*net.UDPAddr)
+	switch {
+	case !ok || udp.IP == nil:
+		return "udp"
+	case udp.IP.To4() != nil:
+		return "udp4"
+	default:
+		return "udp6"
+	}
+}
+
+// dhtStartingNodes returns the addresses a DHT server with an empty
+// routing table joins through, of the address family of network.
+func (c *Client) dhtStartingNodes(cfg *config.DHTConfig, network string) ([]dht.Addr, error) {
+	var addrs []dht.Addr
+	for _, ni := range c.savedDHTNodes() {
+		if udpFamily(network, ni.Addr.IP) {
+			addrs = append(addrs, dht.NewAddr(ni.Addr.UDP()))
+		}
+	}
+	for _, node := range cfg.BootstrapNodes {
+		addr, err := net.ResolveUDPAddr(network, node)
+		if err != nil {
+			// Nodes of only the other family are for the other server
+			if _, err := net.ResolveUDPAddr("udp", node); err != nil {
+				c.logger.Warn("failed to resolve DHT bootstrap node", logger.String("node", node), logger.Err(err))
+			}
+			continue
+		}
+		addrs = append(addrs, dht.NewAddr(addr))
+	}
+	if !cfg.DisablePublicBootstrap {
+		// Routers are resolved to both families whatever the network
+		public, err := dht.GlobalBootstrapAddrs(network)
+		if err != nil && len(addrs) == 0 {
+			return nil, errors.NetworkError("failed to resolve DHT routers", err)
+		}
+		for _, addr := range public {
+			if udpFamily(network, addr.IP()) {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.NotFound("no DHT nodes to join through")
+	}
+	return addrs, nil
+}
+
+// udpFamily reports whether ip can be reached over a UDP network.
+func udpFamily(network string, ip net.IP) bool {
+	switch network {
+	case "udp4":
+		return ip.To4() != nil
+	case "udp6":
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// dhtPeerStore keeps the peers announced to the DHT servers of the
+// client. Without one, servers hand out no tokens and so accept no
+// announces.
+type dhtPeerStore struct {
+	mu    sync.Mutex
+	peers map[metainfo.Hash]map[string]dhtStoredPeer
+}
+
+type dhtStoredPeer struct {
+	addr krpc.NodeAddr
+	at   time.Time
+}
+
+func newDHTPeerStore() *dhtPeerStore {
+	return &dhtPeerStore{peers: make(map[metainfo.Hash]map[string]dhtStoredPeer)}
+}
+
+// AddPeer records an announced peer. When the store is full, expired
+// peers are dropped to make room, and the peer is left out if none were.
+func (s *dhtPeerStore) AddPeer(ih peer_store.InfoHash, addr krpc.NodeAddr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	peers := s.peers[ih]
+	key := addr.String()
+	if _, ok := peers[key]; !ok && (len(s.peers) >= dhtMaxTorrents || len(peers) >= dhtMaxPeers) {
+		s.expire(time.Now())
+		peers = s.peers[ih]
+		if (peers == nil && len(s.peers) >= dhtMaxTorrents) || len(peers) >= dhtMaxPeers {
+			return
+		}
+	}
+	if peers == nil {
+		peers = make(map[string]dhtStoredPeer)
+		s.peers[ih] = peers
+	}
+	peers[key] = dhtStoredPeer{addr: addr, at: time.Now()}
+}
+
+// GetPeers returns peers announced for a torrent lately, the most recent
+// first.
+func (s *dhtPeerStore) GetPeers(ih peer_store.InfoHash) []krpc.NodeAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var recent []dhtStoredPeer
+	for key, p := range s.peers[ih] {
+		if time.Since(p.at) > dhtPeerExpiry {
+			delete(s.peers[ih], key)
+			continue
+		}
+		recent = append(recent, p)
+	}
+	if len(s.peers[ih]) == 0 {
+		delete(s.peers, ih)
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].at.After(recent[j].at) })
+	addrs := make([]krpc.NodeAddr, 0, min(len(recent), dhtPeersPerReply))
+	for _, p := range recent[:min(len(recent), dhtPeersPerReply)] {
+		addrs = append(addrs, p.addr)
+	}
+	return addrs
+}
+
+// expire drops the peers announced before dhtPeerExpiry.
+func (s *dhtPeerStore) expire(now time.Time) {
+	for ih, peers := range s.peers {
+		for key, p := range peers {
+			if now.Sub(p.at) > dhtPeerExpiry {
+				delete(peers, key)
+			}
+		}
+		if len(peers) == 0 {
+			delete(s.peers, ih)
+		}
+	}
+}
+
+// counts returns the number of peers and torrents kept.
+func (s *dhtPeerStore) counts() (peers, torrents int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	for _, p := range s.peers {
+		peers += len(p)
+	}
+	return peers, len(s.peers)
+}
+
+// dhtNodesPath returns the file the routing table is saved in, or "" if it
+// is not saved.
+func (c *Client) dhtNodesPath() string {
+	if c.config.DataDir == "" || (c.config.DHT != nil && c.config.DHT.DisablePersistence) {
+		return ""
+	}
+	return filepath.Join(c.config.DataDir, dhtNodesFile)
+}
+
+// savedDHTNodes returns the nodes saved by the last run.
+func (c *Client) savedDHTNodes() []krpc.NodeInfo {
+	path := c.dhtNodesPath()
+	if path == "" {
+		return nil
+	}
+	nodes, err := dht.ReadNodesFromFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		c.logger.Warn("failed to read saved DHT nodes", logger.String("path", path), logger.Err(err))
+	}
+	return nodes
+}
+
+// saveDHTNodes saves the routing tables of the DHT servers of cl. Empty
+// tables are not saved, so a run that could not join keeps the nodes of
+// the last one that did. The caller holds clientMu or cl is not shared.
+func (c *Client) saveDHTNodes(cl *torrent.Client) {
+	path := c.dhtNodesPath()
+	if path == "" {
+		return
+	}
+	var nodes []krpc.NodeInfo
+	seen := make(map[string]bool)
+	for _, s := range cl.DhtServers() {
+		w, ok := s.(torrent.AnacrolixDhtServerWrapper)
+		if !ok {
+			continue
+		}
+		for _, ni := range w.Server.Nodes() {
+			if addr := ni.Addr.String(); !seen[addr] {
+				seen[addr] = true
+				nodes = append(nodes, ni)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	c.dhtSaveMu.Lock()
+	defer c.dhtSaveMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		c.logger.Warn("failed to save DHT nodes", logger.Err(err))
+		return
+	}
+	// Written aside and renamed, so a crash leaves the previous file
+	tmp := path + ".tmp"
+	if err := dht.WriteNodesToFile(nodes, tmp); err != nil {
+		c.logger.Warn("failed to save DHT nodes", logger.Err(err))
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		c.logger.Warn("failed to save DHT nodes", logger.Err(err))
+		return
+	}
+	c.dhtSavedNodes = len(nodes)
+	c.dhtSavedAt = time.Now()
+	c.logger.Debug("saved DHT nodes", logger.String("path", path), logger.Int("nodes", len(nodes)))
+}
+
+// startDHTSaver saves the routing table every dhtSaveInterval until
+// stopDHTSaver is called.
+func (c *Client) startDHTSaver() {
+	if c.dhtNodesPath() == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.stopDHTSaver = func() {
+		cancel()
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(dhtSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.clientMu.RLock()
+				c.saveDHTNodes(c.client)
+				c.clientMu.RUnlock()
+			}
+		}
+	}()
+}
+
+// DHTStats returns the state of the DHT servers.
+func (c *Client) DHTStats() DHTStats {
+	stats := DHTStats{
+		Announces:         c.dhtAnnounces.Load(),
+		AnnouncesReceived: c.dhtReceived.Load(),
+	}
+	stats.StoredPeers, stats.StoredTorrents = c.dhtPeers.counts()
+	for _, s := range c.torrentClient().DhtServers() {
+		w, ok := s.(torrent.AnacrolixDhtServerWrapper)
+		if !ok {
+			continue
+		}
+		ss := w.Server.Stats()
+		stats.Servers++
+		stats.Nodes += ss.Nodes
+		stats.GoodNodes += ss.GoodNodes
+		stats.BadNodes += int(ss.BadNodes)
+		stats.OutstandingQueries += ss.OutstandingTransactions
+		stats.QueriesSent += ss.OutboundQueriesAttempted
+		stats.AnnouncesAccepted += ss.SuccessfulOutboundAnnouncePeerQueries
+	}
+
+	c.dhtSaveMu.Lock()
+	stats.SavedNodes = c.dhtSavedNodes
+	stats.SavedAt = c.dhtSavedAt
+	c.dhtSaveMu.Unlock()
+	return stats
+}
@@ -0,0 +1,202 @@
+package torrentclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"golang.org/x/time/rate"
+)
+
+func TestMain(m *testing.M) {
+	// anacrolix/dht rate-limits the queries of every server in the process
+	// together and drops some over the limit, which fails bootstraps and
+	// announces when the tests run many DHT servers.
+	dht.DefaultSendLimiter.SetLimit(rate.Inf)
+	os.Exit(m.Run())
+}
+
+// waitDHT waits for the DHT stats of a client to satisfy ok.
+func waitDHT(t *testing.T, client *Client, what string, ok func(DHTStats) bool) DHTStats {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		stats := client.DHTStats()
+		if ok(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s: %+v", what, stats)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDHT(t *testing.T) {
+	noLSD := &config.ProtocolConfig{DisableLSD: true}
+	node, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		Protocols:   noLSD,
+		DHT:         &config.DHTConfig{DisablePublicBootstrap: true, DisablePersistence: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer node.Close()
+
+	dataDir := t.TempDir()
+	joiner, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		DataDir:     dataDir,
+		Protocols:   noLSD,
+		DHT: &config.DHTConfig{
+			BootstrapNodes:         []string{fmt.Sprintf("127.0.0.1:%d", node.ListenPort())},
+			DisablePublicBootstrap: true,
+		},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer joiner.Close()
+
+	t.Run("Bootstrap", func(t *testing.T) {
+		waitDHT(t, joiner, "the bootstrap node", func(s DHTStats) bool { return s.Nodes > 0 && s.GoodNodes > 0 })
+		if stats := joiner.DHTStats(); stats.Servers == 0 || stats.QueriesSent == 0 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("Announce", func(t *testing.T) {
+		if _, err := joiner.AddTorrent(context.Background(), createTestTorrent()); err != nil {
+			t.Fatalf("failed to add torrent: %v", err)
+		}
+		waitDHT(t, joiner, "the announce", func(s DHTStats) bool { return s.Announces > 0 && s.AnnouncesAccepted > 0 })
+		stats := waitDHT(t, node, "the announce to arrive", func(s DHTStats) bool { return s.AnnouncesReceived > 0 })
+		if stats.StoredPeers == 0 || stats.StoredTorrents != 1 {
+			t.Errorf("expected the announced peer to be kept: %+v", stats)
+		}
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		if err := joiner.Close(); err != nil {
+			t.Fatalf("failed to close client: %v", err)
+		}
+		if stats := joiner.DHTStats(); stats.SavedNodes == 0 || stats.SavedAt.IsZero() {
+			t.Fatalf("expected the nodes to be saved on close: %+v", stats)
+		}
+		if _, err := os.Stat(filepath.Join(dataDir, dhtNodesFile)); err != nil {
+			t.Fatalf("expected a nodes file: %v", err)
+		}
+
+		// Without bootstrap nodes, only the saved ones lead to the DHT
+		rejoined, err := NewClient(&config.Config{
+			DownloadDir: t.TempDir(),
+			DataDir:     dataDir,
+			Protocols:   noLSD,
+			DHT:         &config.DHTConfig{DisablePublicBootstrap: true},
+		}, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer rejoined.Close()
+		waitDHT(t, rejoined, "the saved node", func(s DHTStats) bool { return s.GoodNodes > 0 })
+	})
+}
+
+func TestDHTStartingNodes(t *testing.T) {
+	dataDir := t.TempDir()
+	saved := []krpc.NodeInfo{
+		{ID: krpc.RandomNodeID(), Addr: krpc.NodeAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}},
+		{ID: krpc.RandomNodeID(), Addr: krpc.NodeAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}},
+	}
+	if err := dht.WriteNodesToFile(saved, filepath.Join(dataDir, dhtNodesFile)); err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{config: &config.Config{DataDir: dataDir}, logger: logger.NewWithLevel(logger.ErrorLevel)}
+	cfg := &config.DHTConfig{
+		BootstrapNodes:         []string{"127.0.0.1:6881", "[::1]:6881"},
+		DisablePublicBootstrap: true,
+	}
+
+	tests := []struct {
+		network string
+		want    []string
+	}{
+		{"udp4", []string{"10.0.0.1:6881", "127.0.0.1:6881"}},
+		{"udp6", []string{"[2001:db8::1]:6881", "[::1]:6881"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			addrs, err := client.dhtStartingNodes(cfg, tt.network)
+			if err != nil {
+				t.Fatalf("failed to get starting nodes: %v", err)
+			}
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDHTPeerStore(t *testing.T) {
+	store := newDHTPeerStore()
+	ih := metainfo.Hash{1}
+	for i := range dhtMaxPeers + 1 {
+		store.AddPeer(ih, krpc.NodeAddr{IP: net.IPv4(10, 0, byte(i/256), byte(i%256)), Port: 6881})
+	}
+	if peers, torrents := store.counts(); peers != dhtMaxPeers || torrents != 1 {
+		t.Fatalf("expected %d peers of 1 torrent, got %d of %d", dhtMaxPeers, peers, torrents)
+	}
+	if n := len(store.GetPeers(ih)); n != dhtPeersPerReply {
+		t.Errorf("expected %d peers in a reply, got %d", dhtPeersPerReply, n)
+	}
+
+	// Expired peers make room for new ones
+	for key, p := range store.peers[ih] {
+		p.at = time.Now().Add(-dhtPeerExpiry - time.Second)
+		store.peers[ih][key] = p
+	}
+	late := krpc.NodeAddr{IP: net.IPv4(192, 168, 1, 2), Port: 6881}
+	store.AddPeer(ih, late)
+	peers := store.GetPeers(ih)
+	if len(peers) != 1 || !peers[0].Equal(late) {
+		t.Errorf("expected only the late peer, got %v", peers)
+	}
+	if n := len(store.GetPeers(metainfo.Hash{2})); n != 0 {
+		t.Errorf("expected no peers of another torrent, got %d", n)
+	}
+}
+
+func TestDHT_Disabled(t *testing.T) {
+	dataDir := t.TempDir()
+	client, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		DataDir:     dataDir,
+		Protocols:   &config.ProtocolConfig{DisableDHT: true, DisableLSD: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if stats := client.DHTStats(); stats.Servers != 0 || stats.Nodes != 0 {
+		t.Errorf("expected no DHT servers, got %+v", stats)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("failed to close client: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, dhtNodesFile)); !os.IsNotExist(err) {
+		t.Errorf("expected no nodes file, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package torrentclient
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// configureEncryption applies the encryption policy to the torrent client
+// configuration. It returns whether plaintext connections of private
+// torrents must be closed.
+func configureEncryption(cfg *config.EncryptionConfig, clientConfig *torrent.ClientConfig) bool {
+	policy := config.EncryptionPrefer
+	requirePrivate := false
+	if cfg != nil {
+		if cfg.Policy != "" {
+			policy = cfg.Policy
+		}
+		requirePrivate = cfg.RequirePrivate
+	}
+
+	switch policy {
+	case config.EncryptionDisabled:
+		clientConfig.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        false,
+			RequirePreferred: true,
+		}
+		clientConfig.CryptoProvides = mse.CryptoMethodPlaintext
+		clientConfig.CryptoSelector = selectPlaintext
+	case config.EncryptionRequire:
+		clientConfig.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        true,
+			RequirePreferred: true,
+		}
+		clientConfig.CryptoProvides = mse.CryptoMethodRC4
+		clientConfig.CryptoSelector = selectRC4
+	default:
+		clientConfig.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{
+			Preferred:        true,
+			RequirePreferred: false,
+		}
+		clientConfig.CryptoProvides = mse.AllSupportedCrypto
+		clientConfig.CryptoSelector = preferRC4
+	}
+
+	return requirePrivate && policy != config.EncryptionRequire
+}
+
+// selectPlaintext accepts only plaintext after an obfuscated handshake. A
+// zero result fails the handshake.
+func selectPlaintext(provided mse.CryptoMethod) mse.CryptoMethod {
+	return provided & mse.CryptoMethodPlaintext
+}
+
+// selectRC4 accepts only an RC4 encrypted stream.
+func selectRC4(provided mse.CryptoMethod) mse.CryptoMethod {
+	return provided & mse.CryptoMethodRC4
+}
+
+// preferRC4 picks an RC4 encrypted stream if the peer offers one, unlike
+// the anacrolix default, which prefers plaintext for speed.
+func preferRC4(provided mse.CryptoMethod) mse.CryptoMethod {
+	if provided&mse.CryptoMethodRC4 != 0 {
+		return mse.CryptoMethodRC4
+	}
+	return mse.CryptoMethodPlaintext
+}
+
+// requirePrivateEncryption closes plaintext connections of private torrents
+// as they are added. The BitTorrent handshake has already been exchanged by
+// then, but no torrent data is.
+func requirePrivateEncryption(clientConfig *torrent.ClientConfig) {
+	clientConfig.Callbacks.PeerConnAdded = append(clientConfig.Callbacks.PeerConnAdded, func(pc *torrent.PeerConn) {
+		if isPrivate(pc.Torrent()) && peerEncryption(pc) == EncryptionNone {
+			// The client lock is held during the callback, and Close takes it
+			go func() { _ = pc.Close() }()
+		}
+	})
+}
+
+// closePlaintextPeers closes the plaintext connections of a private torrent
+// if encryption is required for them. It is used once the metadata of a
+// magnet link arrives, as whether the torrent is private is unknown before.
+func (c *Client) closePlaintextPeers(t *torrent.Torrent) {
+	c.clientMu.RLock()
+	privateMSE := c.privateMSE
+	c.clientMu.RUnlock()
+
+	if !privateMSE || !isPrivate(t) {
+		return
+	}
+	closed := 0
+	for _, pc := range t.PeerConns() {
+		if peerEncryption(pc) == EncryptionNone {
+			_ = pc.Close()
+			closed++
+		}
+	}
+	if closed > 0 {
+		c.logger.Info("closed plaintext connections of private torrent",
+			logger.String("info_hash", t.InfoHash().HexString()),
+			logger.Int("peers", closed),
+		)
+	}
+}
+
+// isPrivate reports whether a torrent is private. Torrents whose metadata
+// has not arrived are not.
+func isPrivate(t *torrent.Torrent) bool {
+	info := t.Info()
+	if info != nil && info.Private != nil {
+		return *info.Private
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/mse"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// makePrivate returns a torrent with the private flag set.
+func makePrivate(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := true
+	info.Private = &private
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// leech downloads a torrent from addr with an encryption configuration.
+func leech(t *testing.T, enc *config.EncryptionConfig, data []byte, addr string) *Torrent {
+	t.Helper()
+
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Encryption: enc, Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	torr, err := client.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	// Connections are dropped once the download completes, so it is held
+	// until the peer has been inspected
+	torr.torrent.DisallowDataDownload()
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	return torr
+}
+
+// waitPeer waits for a connection to a peer and allows the download.
+func waitPeer(t *testing.T, torr *Torrent) Peer {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if peers := torr.Peers(); len(peers) == 1 {
+			torr.torrent.AllowDataDownload()
+			return peers[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no peer connected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// expectNoDownload checks that nothing is downloaded for a while.
+func expectNoDownload(t *testing.T, torr *Torrent) {
+	t.Helper()
+
+	torr.torrent.AllowDataDownload()
+	time.Sleep(time.Second)
+	if n := torr.BytesCompleted(); n != 0 {
+		t.Errorf("expected nothing to be downloaded, got %d bytes", n)
+	}
+}
+
+func TestEncryptionPolicy(t *testing.T) {
+	data := createMultiPieceTorrent(t, 4)
+	seeder := seed(t, &config.Config{Encryption: &config.EncryptionConfig{Policy: config.EncryptionRequire}, Protocols: &config.ProtocolConfig{DisableDHT: true}}, data)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+	t.Run("PlaintextRefused", func(t *testing.T) {
+		torr := leech(t, &config.EncryptionConfig{Policy: config.EncryptionDisabled}, data, addr)
+		expectNoDownload(t, torr)
+	})
+
+	t.Run("Encrypted", func(t *testing.T) {
+		torr := leech(t, &config.EncryptionConfig{Policy: config.EncryptionPrefer}, data, addr)
+		if peer := waitPeer(t, torr); !peer.Encrypted || peer.Encryption != EncryptionRC4 {
+			t.Errorf("expected an RC4 connection, got %q", peer.Encryption)
+		}
+		waitComplete(t, torr)
+	})
+}
+
+func TestEncryptionPolicy_RequirePrivate(t *testing.T) {
+	plaintext := &config.Config{
+		Encryption: &config.EncryptionConfig{Policy: config.EncryptionDisabled},
+		Protocols:  &config.ProtocolConfig{DisableDHT: true},
+	}
+	requirePrivate := &config.EncryptionConfig{Policy: config.EncryptionPrefer, RequirePrivate: true}
+
+	t.Run("Private", func(t *testing.T) {
+		data := makePrivate(t, createMultiPieceTorrent(t, 4))
+		seeder := seed(t, plaintext, data)
+
+		torr := leech(t, requirePrivate, data, fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort()))
+		expectNoDownload(t, torr)
+	})
+
+	t.Run("Public", func(t *testing.T) {
+		data := createMultiPieceTorrent(t, 4)
+		seeder := seed(t, plaintext, data)
+
+		torr := leech(t, requirePrivate, data, fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort()))
+		if peer := waitPeer(t, torr); peer.Encryption != EncryptionNone {
+			t.Errorf("expected a plaintext connection, got %q", peer.Encryption)
+		}
+		waitComplete(t, torr)
+	})
+}
+
+func TestPeerEncryption(t *testing.T) {
+	data := createMultiPieceTorrent(t, 4)
+
+	t.Run("RC4", func(t *testing.T) {
+		seeder := seed(t, &config.Config{Encryption: &config.EncryptionConfig{Policy: config.EncryptionRequire}, Protocols: &config.ProtocolConfig{DisableDHT: true}}, data)
+		torr := leech(t, nil, data, fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort()))
+		if peer := waitPeer(t, torr); !peer.Encrypted || peer.Encryption != EncryptionRC4 {
+			t.Errorf("expected %q, got %q", EncryptionRC4, peer.Encryption)
+		}
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		// No policy obfuscates only the handshake, so the seeder is a bare
+		// anacrolix client that picks plaintext for the payload
+		mi, err := metainfo.Load(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "movie.mkv"), bytes.Repeat([]byte("m"), 4*16384), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg := torrent.NewDefaultClientConfig()
+		cfg.DataDir = dir
+		cfg.Seed = true
+		cfg.ListenPort = 0
+		cfg.NoDHT = true
+		cfg.DisableIPv6 = true
+		cfg.DisableUTP = true
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true, RequirePreferred: true}
+		cfg.CryptoProvides = mse.CryptoMethodPlaintext
+		cfg.CryptoSelector = selectPlaintext
+		seeder, err := torrent.NewClient(cfg)
+		if err != nil {
+			t.Fatalf("failed to create seeder: %v", err)
+		}
+		defer seeder.Close()
+		if _, err := seeder.AddTorrent(mi); err != nil {
+			t.Fatalf("failed to add torrent: %v", err)
+		}
+
+		torr := leech(t, nil, data, fmt.Sprintf("127.0.0.1:%d", seeder.LocalPort()))
+		if peer := waitPeer(t, torr); !peer.Encrypted || peer.Encryption != EncryptionHeader {
+			t.Errorf("expected %q, got %q", EncryptionHeader, peer.Encryption)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package torrentclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+)
+
+// killSwitchEventBuffer is how many events a subscriber can fall behind by
+// before events are dropped for it.
+const killSwitchEventBuffer = 16
+
+// KillSwitchEvent records the kill switch engaging when the VPN is lost, or
+// releasing when it returns.
+type KillSwitchEvent struct {
+	Engaged bool
+	Time    time.Time
+	// Torrents are the info hashes of the torrents paused or resumed.
+	Torrents []string
+}
+
+// killSwitch holds running torrents while the VPN is down. Held torrents
+// send and accept nothing: transfers are disallowed, peer connections are
+// closed and trackers are not announced to.
+type killSwitch struct {
+	mu      sync.Mutex
+	engaged bool
+	// held maps the torrents paused by the kill switch to their connection
+	// limit before they were paused.
+	held        map[metainfo.Hash]int
+	subscribers map[chan KillSwitchEvent]struct{}
+}
+
+func newKillSwitch() *killSwitch {
+	return &killSwitch{
+		held:        make(map[metainfo.Hash]int),
+		subscribers: make(map[chan KillSwitchEvent]struct{}),
+	}
+}
+
+// startMonitor starts watching the VPN interface, engaging the kill switch
+// whenever the monitor stops allowing connections. It replaces the monitor
+// running before, if any.
+func (c *Client) startMonitor(m *network.Monitor) {
+	m.SetLogger(c.logger)
+	m.OnChange(func(bool) { c.applyKillSwitch() })
+
+	c.monitorMu.Lock()
+	old := c.networkMonitor
+	c.networkMonitor = m
+	c.monitorMu.Unlock()
+
+	c.applyKillSwitch()
+	m.Start()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+// stopMonitor stops watching the VPN interface and releases the kill
+// switch.
+func (c *Client) stopMonitor() {
+	c.monitorMu.Lock()
+	m := c.networkMonitor
+	c.networkMonitor = nil
+	c.monitorMu.Unlock()
+
+	if m != nil {
+		m.Stop()
+	}
+	c.releaseKillSwitch()
+}
+
+// connectionAllowed reports whether the network monitor, if there is one,
+// allows connections.
+func (c *Client) connectionAllowed() bool {
+	m := c.GetNetworkMonitor()
+	return m == nil || m.ShouldAllowConnection()
+}
+
+// applyKillSwitch engages or releases the kill switch to match the monitor.
+func (c *Client) applyKillSwitch() {
+	if c.connectionAllowed() {
+		c.releaseKillSwitch()
+	} else {
+		c.engageKillSwitch()
+	}
+}
+
+// engageKillSwitch pauses every running torrent and closes its peer
+// connections.
+func (c *Client) engageKillSwitch() {
+	// Torrents are listed first: a restart holds the client while it takes
+	// ks.mu
+	torrents := c.torrentClient().Torrents()
+	ks := c.killSwitch
+	ks.mu.Lock()
+	if ks.engaged {
+		ks.mu.Unlock()
+		return
+	}
+	ks.engaged = true
+
+	var paused []string
+	for _, t := range torrents {
+		if c.isStopped(t.InfoHash()) {
+			continue
+		}
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+		ks.held[t.InfoHash()] = t.SetMaxEstablishedConns(0)
+		paused = append(paused, t.InfoHash().HexString())
+	}
+	ks.publish(KillSwitchEvent{Engaged: true, Time: time.Now(), Torrents: paused})
+	ks.mu.Unlock()
+
+	c.logger.Warn("VPN lost, kill switch engaged",
+		logger.Int("paused", len(paused)),
+	)
+}
+
+// releaseKillSwitch resumes the torrents the kill switch paused, except
+// those stopped or removed in the meantime.
+func (c *Client) releaseKillSwitch() {
+	torrents := c.torrentClient().Torrents()
+	ks := c.killSwitch
+	ks.mu.Lock()
+	if !ks.engaged {
+		ks.mu.Unlock()
+		return
+	}
+	ks.engaged = false
+
+	var resumed []metainfo.Hash
+	for _, t := range torrents {
+		maxConns, ok := ks.held[t.InfoHash()]
+		if !ok {
+			continue
+		}
+		t.SetMaxEstablishedConns(maxConns)
+		if c.isStopped(t.InfoHash()) {
+			continue
+		}
+		t.AllowDataDownload()
+		t.AllowDataUpload()
+		resumed = append(resumed, t.InfoHash())
+	}
+	clear(ks.held)
+
+	hashes := make([]string, len(resumed))
+	for i, ih := range resumed {
+		hashes[i] = ih.HexString()
+	}
+	ks.publish(KillSwitchEvent{Engaged: false, Time: time.Now(), Torrents: hashes})
+	ks.mu.Unlock()
+
+	// Trackers were silent while held, so they are announced to afresh
+	for _, ih := range resumed {
+		c.kickTrackers(ih)
+	}
+
+	c.logger.Info("VPN restored, kill switch released",
+		logger.Int("resumed", len(resumed)),
+	)
+}
+
+// reapplyHold holds a torrent re-added by a restart if the kill switch had
+// paused it.
+func (c *Client) reapplyHold(t *torrent.Torrent) {
+	ks := c.killSwitch
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, held := ks.held[t.InfoHash()]; held {
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+		t.SetMaxEstablishedConns(0)
+	}
+}
+
+// isHeld reports whether the kill switch has paused a torrent.
+func (c *Client) isHeld(ih metainfo.Hash) bool {
+	ks := c.killSwitch
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	_, held := ks.held[ih]
+	return held
+}
+
+// KillSwitchEngaged reports whether the kill switch is holding torrents
+// because the VPN is down.
+func (c *Client) KillSwitchEngaged() bool {
+	ks := c.killSwitch
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	return ks.engaged
+}
+
+// SubscribeKillSwitch returns a channel receiving kill switch events and a
+// function that ends the subscription. Events are dropped for a subscriber
+// that falls too far behind.
+func (c *Client) SubscribeKillSwitch() (<-chan KillSwitchEvent, func()) {
+	ks := c.killSwitch
+	ch := make(chan KillSwitchEvent, killSwitchEventBuffer)
+
+	ks.mu.Lock()
+	ks.subscribers[ch] = struct{}{}
+	ks.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			ks.mu.Lock()
+			delete(ks.subscribers, ch)
+			ks.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish sends an event to the subscribers. The caller must hold ks.mu.
+func (ks *killSwitch) publish(event KillSwitchEvent) {
+	for ch := range ks.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
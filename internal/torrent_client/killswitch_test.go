@@ -0,0 +1,137 @@
+package torrentclient
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+)
+
+// fakeInterfaces is an InterfaceProvider with a single interface that can
+// be brought up and down.
+type fakeInterfaces struct {
+	mu   sync.Mutex
+	name string
+	up   bool
+}
+
+func (f *fakeInterfaces) InterfaceByName(name string) (network.Interface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if name != f.name {
+		return network.Interface{}, errors.NotFoundf("interface %q not found", name)
+	}
+	return network.Interface{Name: name, Index: 1, IsUp: f.up, IsVPN: true}, nil
+}
+
+func (f *fakeInterfaces) setUp(up bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.up = up
+}
+
+// nextKillSwitchEvent waits for a kill switch event.
+func nextKillSwitchEvent(t *testing.T, events <-chan KillSwitchEvent) KillSwitchEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no kill switch event")
+		return KillSwitchEvent{}
+	}
+}
+
+func TestKillSwitch(t *testing.T) {
+	seeder, data := newSeeder(t, 4)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+	ft := &fakeTracker{}
+	srv := httptest.NewServer(ft)
+	defer srv.Close()
+
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	vpn := &fakeInterfaces{name: "tun0", up: true}
+	monitor := network.NewNetworkMonitorWithProvider(
+		&network.VPNConfig{Enabled: true, InterfaceName: "tun0", KillSwitch: true}, vpn)
+	client.startMonitor(monitor)
+	events, unsubscribe := client.SubscribeKillSwitch()
+	defer unsubscribe()
+
+	download, err := client.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	announced, err := client.AddTorrent(context.Background(), createTrackerTorrent(t, srv.URL+"/announce"))
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	waitTracker(t, announced, 0, TrackerWorking)
+
+	// The VPN drops: both torrents are held
+	vpn.setUp(false)
+	monitor.Check()
+
+	event := nextKillSwitchEvent(t, events)
+	if !event.Engaged || len(event.Torrents) != 2 {
+		t.Fatalf("expected both torrents to be paused, got %+v", event)
+	}
+	if !client.KillSwitchEngaged() {
+		t.Error("expected the kill switch to be engaged")
+	}
+	if download.Status() != "stopped" || announced.Status() != "stopped" {
+		t.Errorf("expected held torrents to be stopped, got %s and %s", download.Status(), announced.Status())
+	}
+	download.Start()
+	if download.Status() != "stopped" {
+		t.Error("a held torrent was started while the VPN is down")
+	}
+	if err := announced.Reannounce(); !errors.IsConflict(err) {
+		t.Errorf("expected reannouncing a held torrent to conflict, got %v", err)
+	}
+
+	// No peer connects while held
+	if _, err := download.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if peers := download.torrent.Stats().ActivePeers; peers != 0 || download.BytesCompleted() != 0 {
+		t.Errorf("held torrent has %d peers and %d bytes", peers, download.BytesCompleted())
+	}
+
+	// A torrent stopped while held stays stopped, and nothing is announced
+	announced.Stop()
+	time.Sleep(100 * time.Millisecond)
+	if got := ft.announces(); !slices.Equal(got, []string{"started"}) {
+		t.Errorf("expected no announces while held, got %v", got)
+	}
+
+	// The VPN returns: only the torrent that is still wanted resumes
+	vpn.setUp(true)
+	monitor.Check()
+
+	event = nextKillSwitchEvent(t, events)
+	if event.Engaged || !slices.Equal(event.Torrents, []string{download.InfoHash()}) {
+		t.Fatalf("expected only %s to be resumed, got %+v", download.InfoHash(), event)
+	}
+	if announced.Status() != "stopped" {
+		t.Errorf("torrent stopped while held was resumed: %s", announced.Status())
+	}
+
+	if _, err := download.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitComplete(t, download)
+}
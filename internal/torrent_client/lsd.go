@@ -0,0 +1,308 @@
+package torrentclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+const (
+	// lsdInterval is how often torrents are announced on the local network.
+	lsdInterval = 5 * time.Minute
+	// lsdMinInterval keeps announces for newly added torrents apart.
+	lsdMinInterval = time.Minute
+	// lsdMaxInfoHashes bounds the info hashes of one announce, so it fits a
+	// single packet.
+	lsdMaxInfoHashes = 20
+	// peerSourceLSD marks peers found by Local Service Discovery.
+	peerSourceLSD torrent.PeerSource = "L"
+)
+
+// lsdGroups are the multicast groups of Local Service Discovery (BEP 14).
+var lsdGroups = []netip.AddrPort{
+	netip.MustParseAddrPort("239.192.152.143:6771"),
+	netip.MustParseAddrPort("[ff15::efc0:988f]:6771"),
+}
+
+// lsdService announces torrents to, and finds peers of them on, the local
+// network.
+type lsdService struct {
+	// cookie tells the service's own announces apart when they loop back.
+	cookie string
+	conns  []lsdConn
+	kick   chan struct{}
+	stop   func()
+}
+
+// lsdConn is a socket joined to a multicast group.
+type lsdConn struct {
+	conn  *net.UDPConn
+	group netip.AddrPort
+}
+
+// lsdAllowed reports whether LSD may announce and add peers. Announces
+// would leave the VPN by the local network, and proxied peers cannot be
+// reached there. VPN is enabled while the network monitor runs, which
+// SetVPNConfig keeps in step with the configuration.
+func (c *Client) lsdAllowed() bool {
+	if c.GetNetworkMonitor() != nil {
+		return false
+	}
+	p := c.config.Proxy
+	return !(p.Enabled() && p.Peers)
+}
+
+// startLSD joins the LSD groups of the IP versions in use and starts
+// announcing torrents.
+func (c *Client) startLSD() {
+	p := c.Protocols()
+	s := &lsdService{
+		cookie: strconv.FormatUint(rand.Uint64(), 36),
+		kick:   make(chan struct{}, 1),
+	}
+	for _, group := range lsdGroups {
+		network := "udp4"
+		if group.Addr().Is6() {
+			network = "udp6"
+			if !p.IPv6() {
+				continue
+			}
+		} else if !p.IPv4() {
+			continue
+		}
+		conn, err := net.ListenMulticastUDP(network, nil, net.UDPAddrFromAddrPort(group))
+		if err != nil {
+			c.logger.Warn("failed to join LSD group",
+				logger.String("group", group.String()),
+				logger.Err(err),
+			)
+			continue
+		}
+		s.conns = append(s.conns, lsdConn{conn: conn, group: group})
+	}
+	if len(s.conns) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, lc := range s.conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.receiveLSD(ctx, s, lc.conn)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.runLSD(ctx, s)
+	}()
+	s.stop = func() {
+		cancel()
+		for _, lc := range s.conns {
+			_ = lc.conn.Close()
+		}
+		wg.Wait()
+	}
+
+	c.clientMu.Lock()
+	c.lsd = s
+	c.clientMu.Unlock()
+	c.logger.Info("LSD started", logger.Int("groups", len(s.conns)))
+}
+
+// stopLSD stops announcing on the local network.
+func (c *Client) stopLSD() {
+	c.clientMu.Lock()
+	s := c.lsd
+	c.lsd = nil
+	c.clientMu.Unlock()
+
+	if s != nil {
+		s.stop()
+	}
+}
+
+// announceLSD announces torrents on the local network soon, as when one is
+// added.
+func (c *Client) announceLSD() {
+	c.clientMu.RLock()
+	s := c.lsd
+	c.clientMu.RUnlock()
+
+	if s == nil {
+		return
+	}
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// runLSD announces torrents every lsdInterval, and when announceLSD asks
+// for it but no sooner than lsdMinInterval after the last announce.
+func (c *Client) runLSD(ctx context.Context, s *lsdService) {
+	var last time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.kick:
+			timer.Reset(max(0, time.Until(last.Add(lsdMinInterval))))
+		case <-timer.C:
+			c.sendLSD(s)
+			last = time.Now()
+			timer.Reset(lsdInterval)
+		}
+	}
+}
+
+// sendLSD announces the public torrents looking for peers to every group.
+func (c *Client) sendLSD(s *lsdService) {
+	if !c.lsdAllowed() {
+		return
+	}
+
+	var hashes []metainfo.Hash
+	for _, t := range c.torrentClient().Torrents() {
+		if !isPrivate(t) && c.wantsPeers(t.InfoHash()) {
+			hashes = append(hashes, t.InfoHash())
+		}
+	}
+
+	port := int(c.announcePort())
+	for len(hashes) > 0 {
+		batch := hashes[:min(len(hashes), lsdMaxInfoHashes)]
+		hashes = hashes[len(batch):]
+		for _, lc := range s.conns {
+			msg := formatLSD(lc.group.String(), port, batch, s.cookie)
+			if _, err := lc.conn.WriteToUDPAddrPort(msg, lc.group); err != nil {
+				c.logger.Debug("failed to send LSD announce",
+					logger.String("group", lc.group.String()),
+					logger.Err(err),
+				)
+			}
+		}
+	}
+}
+
+// receiveLSD reads announces from a group socket until the service stops,
+// which closes it.
+func (c *Client) receiveLSD(ctx context.Context, s *lsdService, conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		c.handleLSD(from.Addr(), buf[:n], s.cookie)
+	}
+}
+
+// handleLSD adds the peer behind an announce to the torrents it names.
+// Announces carrying cookie are the client's own.
+func (c *Client) handleLSD(from netip.Addr, msg []byte, cookie string) {
+	announce, err := parseLSD(msg)
+	if err != nil {
+		c.logger.Debug("invalid LSD announce",
+			logger.String("from", from.String()),
+			logger.Err(err),
+		)
+		return
+	}
+	if (announce.cookie != "" && announce.cookie == cookie) || !c.lsdAllowed() {
+		return
+	}
+
+	addr := netip.AddrPortFrom(from.Unmap(), uint16(announce.port))
+	cl := c.torrentClient()
+	for _, ih := range announce.infoHashes {
+		t, ok := cl.Torrent(ih)
+		if !ok || isPrivate(t) || !c.wantsPeers(ih) {
+			continue
+		}
+		t.AddPeers([]torrent.PeerInfo{{
+			Addr:   torrent.StringAddr(addr.String()),
+			Source: peerSourceLSD,
+		}})
+	}
+}
+
+// lsdAnnounce is a parsed LSD announce.
+type lsdAnnounce struct {
+	port       int
+	infoHashes []metainfo.Hash
+	cookie     string
+}
+
+// formatLSD formats an LSD announce for the group host.
+func formatLSD(host string, port int, infoHashes []metainfo.Hash, cookie string) []byte {
+	var b bytes.Buffer
+	b.WriteString("BT-SEARCH * HTTP/1.1\r\n")
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	fmt.Fprintf(&b, "Port: %d\r\n", port)
+	for _, ih := range infoHashes {
+		fmt.Fprintf(&b, "Infohash: %s\r\n", ih.HexString())
+	}
+	if cookie != "" {
+		fmt.Fprintf(&b, "cookie: %s\r\n", cookie)
+	}
+	b.WriteString("\r\n\r\n")
+	return b.Bytes()
+}
+
+// parseLSD parses an LSD announce. Header names are case-insensitive and
+// unknown headers are ignored.
+func parseLSD(msg []byte) (lsdAnnounce, error) {
+	var announce lsdAnnounce
+	scanner := bufio.NewScanner(bytes.NewReader(msg))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "BT-SEARCH * HTTP/1.1" {
+		return announce, errors.ParseError("not an LSD announce", nil)
+	}
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil || port < 1 || port > 65535 {
+				return announce, errors.ParseError("invalid LSD port "+value, err)
+			}
+			announce.port = port
+		case "infohash":
+			var ih metainfo.Hash
+			if err := ih.FromHexString(value); err != nil {
+				return announce, errors.ParseError("invalid LSD info hash "+value, err)
+			}
+			announce.infoHashes = append(announce.infoHashes, ih)
+		case "cookie":
+			announce.cookie = value
+		}
+	}
+	if announce.port == 0 || len(announce.infoHashes) == 0 {
+		return announce, errors.ParseError("LSD announce lacks a port or info hash", nil)
+	}
+	return announce, nil
+}
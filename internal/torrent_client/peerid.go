@@ -0,0 +1,125 @@
+package torrentclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// azureusClients maps the two-letter codes of Azureus-style peer IDs
+// ("-qB4630-...") to client names.
+var azureusClients = map[string]string{
+	"AG": "Ares",
+	"AZ": "Vuze",
+	"BB": "BitBuddy",
+	"BC": "BitComet",
+	"BI": "BiglyBT",
+	"BT": "BitTorrent",
+	"BW": "BitWombat",
+	"DE": "Deluge",
+	"FD": "Free Download Manager",
+	"FW": "FrostWire",
+	"GT": "anacrolix/torrent",
+	"HL": "Halite",
+	"KT": "KTorrent",
+	"LT": "libtorrent",
+	"lt": "rTorrent",
+	"PI": "PicoTorrent",
+	"qB": "qBittorrent",
+	"SD": "Thunder",
+	"TL": "Tribler",
+	"TR": "Transmission",
+	"TT": "TuoTu",
+	"TX": "Tixati",
+	"UM": "µTorrent Mac",
+	"UT": "µTorrent",
+	"UW": "µTorrent Web",
+	"WD": "WebTorrent Desktop",
+	"WW": "WebTorrent",
+	"XL": "Xunlei",
+}
+
+// shadowClients maps the first character of Shadow-style peer IDs
+// ("T03I-----...") to client names.
+var shadowClients = map[byte]string{
+	'A': "ABC",
+	'O': "Osprey Permaseed",
+	'Q': "BTQueue",
+	'R': "Tribler",
+	'S': "Shadow",
+	'T': "BitTornado",
+	'U': "UPnP NAT BitTorrent",
+}
+
+// ParsePeerID decodes the client name and version from a peer ID. It
+// returns empty strings for clients it does not recognize.
+func ParsePeerID(id [20]byte) (client, version string) {
+	s := string(id[:])
+
+	// Azureus style: -XXVVVV-
+	if s[0] == '-' && s[7] == '-' {
+		name, ok := azureusClients[s[1:3]]
+		if !ok {
+			return "", ""
+		}
+		return name, azureusVersion(s[1:3], s[3:7])
+	}
+
+	// Mainline style: M4-3-6--
+	if s[0] == 'M' && s[2] == '-' {
+		end := strings.Index(s[1:], "--")
+		if end < 0 {
+			return "", ""
+		}
+		return "BitTorrent", strings.ReplaceAll(s[1:end+1], "-", ".")
+	}
+
+	// Shadow style: X followed by version characters and dashes
+	if name, ok := shadowClients[s[0]]; ok {
+		var parts []string
+		for _, c := range []byte(s[1:6]) {
+			if c == '-' {
+				break
+			}
+			parts = append(parts, strconv.Itoa(versionDigit(c)))
+		}
+		if len(parts) > 0 {
+			return name, strings.Join(parts, ".")
+		}
+	}
+
+	return "", ""
+}
+
+// azureusVersion decodes the four version characters of an Azureus-style
+// peer ID.
+func azureusVersion(code, v string) string {
+	digits := make([]int, len(v))
+	for i := range v {
+		digits[i] = versionDigit(v[i])
+	}
+
+	// Transmission before 4.0 used major.minor with a two-digit minor.
+	if code == "TR" && digits[0] < 4 {
+		return strconv.Itoa(digits[0]) + "." + v[1:3]
+	}
+
+	version := strconv.Itoa(digits[0]) + "." + strconv.Itoa(digits[1]) + "." + strconv.Itoa(digits[2])
+	if digits[3] != 0 {
+		version += "." + strconv.Itoa(digits[3])
+	}
+	return version
+}
+
+// versionDigit decodes a version character, where letters continue after 9.
+func versionDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,275 @@
+package torrentclient
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// Peer describes a peer connected to a torrent.
+type Peer struct {
+	Address string
+	IP      string
+	Port    int
+	Client  string
+	Version string
+	// Source is how the peer was found, as an anacrolix peer source code.
+	Source    string
+	Incoming  bool
+	Encrypted bool
+	// Encryption is how the connection is encrypted: EncryptionNone,
+	// EncryptionHeader or EncryptionRC4.
+	Encryption string
+	UTP        bool
+	// Choked is set while the peer refuses to send us data.
+	Choked bool
+	// Interested is set while the peer wants data from us.
+	Interested   bool
+	Progress     float64
+	DownloadRate int64
+	// RequestedRate is the rate of blocks the peer asks us for, including
+	// requests it later cancels. Sent data is not reported per connection.
+	RequestedRate int64
+}
+
+// rateWindow is the number of seconds per-peer rates are averaged over.
+const rateWindow = 5
+
+// rateCounter counts bytes in one-second buckets over the rate window.
+type rateCounter struct {
+	bytes   [rateWindow]int64
+	seconds [rateWindow]int64
+}
+
+func (r *rateCounter) add(now time.Time, n int64) {
+	s := now.Unix()
+	i := s % rateWindow
+	if r.seconds[i] != s {
+		r.seconds[i] = s
+		r.bytes[i] = 0
+	}
+	r.bytes[i] += n
+}
+
+func (r *rateCounter) rate(now time.Time) int64 {
+	s := now.Unix()
+	var total int64
+	for i := range r.bytes {
+		if s-r.seconds[i] < rateWindow {
+			total += r.bytes[i]
+		}
+	}
+	return total / rateWindow
+}
+
+// peerActivity is what a peer has told us since it connected.
+type peerActivity struct {
+	choked     bool
+	interested bool
+	down       rateCounter
+	requested  rateCounter
+}
+
+// peerTracker follows peer messages, which anacrolix does not expose per
+// connection.
+type peerTracker struct {
+	mu    sync.Mutex
+	peers map[*torrent.PeerConn]*peerActivity
+}
+
+func newPeerTracker() *peerTracker {
+	return &peerTracker{peers: make(map[*torrent.PeerConn]*peerActivity)}
+}
+
+// install registers the tracker's callbacks with a client configuration.
+func (pt *peerTracker) install(cfg *torrent.ClientConfig) {
+	cfg.Callbacks.ReadMessage = pt.readMessage
+	cfg.Callbacks.PeerConnClosed = pt.closed
+	cfg.Callbacks.ReceivedUsefulData = append(cfg.Callbacks.ReceivedUsefulData, pt.receivedData)
+}
+
+// activity returns the activity of a peer. The caller must hold pt.mu.
+func (pt *peerTracker) activity(pc *torrent.PeerConn) *peerActivity {
+	a, ok := pt.peers[pc]
+	if !ok {
+		// Connections start out choked and not interested.
+		a = &peerActivity{choked: true}
+		pt.peers[pc] = a
+	}
+	return a
+}
+
+func (pt *peerTracker) readMessage(pc *torrent.PeerConn, msg *pp.Message) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	a := pt.activity(pc)
+	switch msg.Type {
+	case pp.Choke:
+		a.choked = true
+	case pp.Unchoke:
+		a.choked = false
+	case pp.Interested:
+		a.interested = true
+	case pp.NotInterested:
+		a.interested = false
+	case pp.Request:
+		a.requested.add(time.Now(), int64(msg.Length))
+	}
+}
+
+func (pt *peerTracker) receivedData(event torrent.ReceivedUsefulDataEvent) {
+	pc, ok := event.Peer.TryAsPeerConn()
+	if !ok {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.activity(pc).down.add(time.Now(), int64(len(event.Message.Piece)))
+}
+
+func (pt *peerTracker) closed(pc *torrent.PeerConn) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	delete(pt.peers, pc)
+}
+
+// Peers returns the peers connected to the torrent.
+func (t *Torrent) Peers() []Peer {
+	conns := t.torrent.PeerConns()
+	numPieces := 0
+	if t.torrent.Info() != nil {
+		numPieces = t.torrent.NumPieces()
+	}
+
+	now := time.Now()
+	peers := make([]Peer, 0, len(conns))
+	for _, pc := range conns {
+		encryption := peerEncryption(pc)
+		peer := Peer{
+			Address:    pc.RemoteAddr.String(),
+			Source:     string(pc.Discovery),
+			Incoming:   pc.Discovery == torrent.PeerSourceIncoming,
+			Encrypted:  encryption != EncryptionNone,
+			Encryption: encryption,
+			UTP:        strings.Contains(pc.Network, "udp"),
+			Choked:     true,
+		}
+
+		if host, port, err := net.SplitHostPort(peer.Address); err == nil {
+			peer.IP = host
+			peer.Port, _ = strconv.Atoi(port)
+		}
+
+		peer.Client, peer.Version = ParsePeerID(pc.PeerID)
+		if peer.Client == "" {
+			if name, ok := pc.PeerClientName.Load().(string); ok {
+				peer.Client = name
+			}
+		}
+
+		if numPieces > 0 {
+			have := min(int(pc.PeerPieces().GetCardinality()), numPieces)
+			peer.Progress = float64(have) / float64(numPieces) * 100
+		}
+
+		t.client.peers.mu.Lock()
+		if a, ok := t.client.peers.peers[pc]; ok {
+			peer.Choked = a.choked
+			peer.Interested = a.interested
+			peer.DownloadRate = a.down.rate(now)
+			peer.RequestedRate = a.requested.rate(now)
+		}
+		t.client.peers.mu.Unlock()
+
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// ParsePeerAddr parses a peer address such as "192.0.2.1:6881" or
+// "[2001:db8::1]:6881".
+func ParsePeerAddr(addr string) (netip.AddrPort, error) {
+	ap, err := netip.ParseAddrPort(strings.TrimSpace(addr))
+	if err != nil {
+		return netip.AddrPort{}, errors.InvalidInputf("invalid peer address %q: expected ip:port", addr)
+	}
+	if ap.Port() == 0 {
+		return netip.AddrPort{}, errors.InvalidInputf("invalid peer address %q: port must not be 0", addr)
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), nil
+}
+
+// AddPeers adds peers to the torrent by address and returns how many were not
+// already known. Every address is validated before any is added.
+func (t *Torrent) AddPeers(addrs []string) (int, error) {
+	peers := make([]torrent.PeerInfo, len(addrs))
+	for i, addr := range addrs {
+		ap, err := ParsePeerAddr(addr)
+		if err != nil {
+			return 0, err
+		}
+		// Manually added peers are trusted the same way magnet x.pe hints are.
+		peers[i] = torrent.PeerInfo{
+			Addr:    torrent.StringAddr(ap.String()),
+			Source:  torrent.PeerSourceDirect,
+			Trusted: true,
+		}
+	}
+	return t.torrent.AddPeers(peers), nil
+}
+
+// DisconnectPeer closes the connection to the peer at the given address.
+func (t *Torrent) DisconnectPeer(address string) error {
+	for _, pc := range t.torrent.PeerConns() {
+		if pc.RemoteAddr.String() == address {
+			return pc.Close()
+		}
+	}
+	return errors.NotFoundf("peer %s not found", address)
+}
+
+// Encryption states of a peer connection.
+const (
+	// EncryptionNone is a plaintext connection.
+	EncryptionNone = "none"
+	// EncryptionHeader is a connection whose handshake is obfuscated but
+	// whose data is sent in plaintext.
+	EncryptionHeader = "header"
+	// EncryptionRC4 is a connection encrypted throughout with RC4.
+	EncryptionRC4 = "rc4"
+)
+
+// peerEncryption reports how a connection is encrypted. anacrolix only
+// exposes this through the connection flags in String, where E is a fully
+// encrypted stream and e an encrypted handshake.
+func peerEncryption(pc *torrent.PeerConn) string {
+	s := pc.String()
+	start := strings.Index(s, "flags=")
+	if start < 0 {
+		return EncryptionNone
+	}
+	flags := s[start+len("flags="):]
+	if end := strings.IndexByte(flags, ' '); end >= 0 {
+		flags = flags[:end]
+	}
+	for _, flag := range strings.Split(flags, ",") {
+		switch flag {
+		case "E":
+			return EncryptionRC4
+		case "e":
+			return EncryptionHeader
+		}
+	}
+	return EncryptionNone
+}
@@ -0,0 +1,259 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+func TestParsePeerID(t *testing.T) {
+	tests := []struct {
+		id      string
+		client  string
+		version string
+	}{
+		{"-qB4630-abcdefghijkl", "qBittorrent", "4.6.3"},
+		{"-TR2940-abcdefghijkl", "Transmission", "2.94"},
+		{"-TR4050-abcdefghijkl", "Transmission", "4.0.5"},
+		{"-LT2091-abcdefghijkl", "libtorrent", "2.0.9.1"},
+		{"-UT355W-abcdefghijkl", "µTorrent", "3.5.5.32"},
+		{"M4-3-6--abcdefghijkl", "BitTorrent", "4.3.6"},
+		{"T03I-----abcdefghijk", "BitTornado", "0.3.18"},
+		{"-ZZ1000-abcdefghijkl", "", ""},
+		{"abcdefghijklmnopqrst", "", ""},
+	}
+
+	for _, tt := range tests {
+		var id [20]byte
+		copy(id[:], tt.id)
+		client, version := ParsePeerID(id)
+		if client != tt.client || version != tt.version {
+			t.Errorf("%s: expected %q %q, got %q %q", tt.id, tt.client, tt.version, client, version)
+		}
+	}
+}
+
+func TestParsePeerAddr(t *testing.T) {
+	valid := map[string]string{
+		"192.0.2.1:6881":          "192.0.2.1:6881",
+		" 192.0.2.1:6881 ":        "192.0.2.1:6881",
+		"[2001:db8::1]:51413":     "[2001:db8::1]:51413",
+		"[::ffff:192.0.2.1]:6881": "192.0.2.1:6881",
+	}
+	for addr, want := range valid {
+		ap, err := ParsePeerAddr(addr)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", addr, err)
+		} else if ap.String() != want {
+			t.Errorf("expected %s for %q, got %s", want, addr, ap)
+		}
+	}
+
+	for _, addr := range []string{"", "192.0.2.1", "example.com:6881", "192.0.2.1:0", "2001:db8::1:6881"} {
+		if _, err := ParsePeerAddr(addr); !errors.IsInvalidInput(err) {
+			t.Errorf("expected invalid input for %q, got %v", addr, err)
+		}
+	}
+}
+
+func TestRateCounter(t *testing.T) {
+	var r rateCounter
+	now := time.Unix(1000, 0)
+
+	r.add(now, 5000)
+	r.add(now.Add(time.Second), 5000)
+	if got := r.rate(now.Add(time.Second)); got != 2000 {
+		t.Errorf("expected 2000 B/s, got %d", got)
+	}
+	if got := r.rate(now.Add(10 * time.Second)); got != 0 {
+		t.Errorf("expected old data to expire, got %d", got)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	log := logger.NewWithLevel(logger.ErrorLevel)
+	newTorrent := func() (*Client, *Torrent) {
+		client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, log)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+
+		torr, err := client.AddTorrent(context.Background(), createMultiPieceTorrent(t, 4))
+		if err != nil {
+			t.Fatalf("failed to add torrent: %v", err)
+		}
+		return client, torr
+	}
+
+	_, a := newTorrent()
+	clientB, b := newTorrent()
+
+	a.torrent.AddClientPeer(clientB.client)
+
+	var peers []Peer
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if peers = a.Peers(); len(peers) > 0 {
+			break
+		}
+	}
+	if len(peers) == 0 {
+		t.Fatal("expected the other client to connect")
+	}
+
+	peer := peers[0]
+	if peer.Client != "anacrolix/torrent" || peer.IP == "" || peer.Port == 0 {
+		t.Errorf("unexpected peer: %+v", peer)
+	}
+	if peer.Incoming {
+		t.Error("expected an outgoing connection")
+	}
+	if len(b.Peers()) > 0 && !b.Peers()[0].Incoming {
+		t.Error("expected the other side to see an incoming connection")
+	}
+
+	if err := a.DisconnectPeer("192.0.2.1:1"); !errors.IsNotFound(err) {
+		t.Errorf("expected not found for unknown peer, got %v", err)
+	}
+	if err := a.DisconnectPeer(peer.Address); err != nil {
+		t.Fatalf("failed to disconnect peer: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); connected(a, peer.Address); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("peer is still connected")
+		}
+	}
+}
+
+// connected reports whether a peer with the given address is connected.
+func connected(torr *Torrent, address string) bool {
+	for _, peer := range torr.Peers() {
+		if peer.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// newSeeder creates a client that has all the data of a torrent with the
+// given number of 16KB pieces and returns it with the torrent file.
+func newSeeder(t *testing.T, pieces int) (*Client, []byte) {
+	t.Helper()
+
+	data := createMultiPieceTorrent(t, pieces)
+	return seed(t, &config.Config{Protocols: &config.ProtocolConfig{DisableDHT: true}}, data), data
+}
+
+// seed creates a client with cfg that seeds a torrent made by
+// createMultiPieceTorrent.
+func seed(t *testing.T, cfg *config.Config, data []byte) *Client {
+	t.Helper()
+
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	dst := filepath.Join(dir, mi.HashInfoBytes().HexString(), "movie.mkv")
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, bytes.Repeat([]byte("m"), int(info.TotalLength())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.DownloadDir = dir
+	client, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	if _, err := client.AddTorrent(context.Background(), data); err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	return client
+}
+
+// waitComplete waits for a torrent to finish downloading.
+func waitComplete(t *testing.T, torr *Torrent) {
+	t.Helper()
+
+	deadline := time.Now().Add(20 * time.Second)
+	for torr.BytesCompleted() < torr.Length() {
+		if time.Now().After(deadline) {
+			t.Fatalf("download did not complete: %d of %d bytes", torr.BytesCompleted(), torr.Length())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestAddPeers(t *testing.T) {
+	seeder, data := newSeeder(t, 4)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+	leecher, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer leecher.Close()
+
+	torr, err := leecher.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	if _, err := torr.AddPeers([]string{addr, "not-an-address"}); err == nil {
+		t.Error("expected error for invalid address")
+	}
+	if _, err := torr.AddPeers([]string{"127.0.0.1:0"}); err == nil {
+		t.Error("expected error for port 0")
+	}
+
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitComplete(t, torr)
+}
+
+func TestAddMagnetWithPeerHint(t *testing.T) {
+	seeder, data := newSeeder(t, 4)
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leecher, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer leecher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	magnet := "magnet:?xt=urn:btih:" + mi.HashInfoBytes().HexString()
+	if _, err := leecher.AddMagnet(ctx, magnet+"&x.pe=bad"); !errors.IsInvalidInput(err) {
+		t.Errorf("expected invalid input for bad peer hint, got %v", err)
+	}
+
+	torr, err := leecher.AddMagnet(ctx, fmt.Sprintf("%s&x.pe=127.0.0.1:%d", magnet, seeder.client.LocalPort()))
+	if err != nil {
+		t.Fatalf("failed to add magnet: %v", err)
+	}
+	waitComplete(t, torr)
+}
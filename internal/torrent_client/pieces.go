@@ -0,0 +1,49 @@
+package torrentclient
+
+import "github.com/anacrolix/torrent"
+
+// PieceStatus is the state of a single piece of a torrent.
+type PieceStatus struct {
+	Complete bool
+	// Partial is set when some but not all of the piece has been downloaded.
+	Partial bool
+	// Checking is set while the piece is queued for or being hash checked.
+	Checking bool
+	// Wanted is set when the piece is incomplete and will be downloaded.
+	Wanted bool
+	// Availability is the number of connected peers that have the piece.
+	Availability int
+}
+
+// PieceStatuses returns the state of every piece, or nil if the torrent has
+// no metadata yet.
+func (t *Torrent) PieceStatuses() []PieceStatus {
+	if t.torrent.Info() == nil {
+		return nil
+	}
+
+	pieces := make([]PieceStatus, t.torrent.NumPieces())
+	i := 0
+	for _, run := range t.torrent.PieceStateRuns() {
+		for end := i + run.Length; i < end && i < len(pieces); i++ {
+			pieces[i] = PieceStatus{
+				Complete: run.Complete,
+				Partial:  run.Partial,
+				Checking: run.Checking,
+				Wanted:   !run.Complete && run.Priority != torrent.PiecePriorityNone,
+			}
+		}
+	}
+
+	for _, conn := range t.torrent.PeerConns() {
+		conn.PeerPieces().Iterate(func(x uint32) bool {
+			if int(x) >= len(pieces) {
+				return false
+			}
+			pieces[x].Availability++
+			return true
+		})
+	}
+
+	return pieces
+}
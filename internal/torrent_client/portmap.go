@@ -0,0 +1,81 @@
+package torrentclient
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/portmap"
+)
+
+// newPortMapper creates the mapper of the peer port, or returns nil if
+// port mapping is disabled.
+func newPortMapper(cfg *config.PortMappingConfig, log logger.Logger) *portmap.Mapper {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	opts := portmap.Options{
+		Methods:  cfg.Methods,
+		RootDesc: cfg.UPnPURL,
+		Lifetime: time.Duration(cfg.Lifetime) * time.Second,
+		Logger:   log,
+	}
+	if ap, err := netip.ParseAddrPort(cfg.Gateway); err == nil {
+		opts.Gateway = ap
+	} else if addr, err := netip.ParseAddr(cfg.Gateway); err == nil {
+		opts.Gateway = netip.AddrPortFrom(addr, portmap.ServerPort)
+	}
+	return portmap.New(opts)
+}
+
+// mapPeerPort maps the port cl listens on, replacing the mappings of the
+// previous client. Ports bound to the VPN interface are not mapped, as the
+// router would forward peers around the VPN. The caller holds clientMu or
+// has not shared the client yet.
+func (c *Client) mapPeerPort(cl *torrent.Client) {
+	if c.portMapper == nil {
+		return
+	}
+
+	port := cl.LocalPort()
+	c.portMapSkipped = ""
+	switch {
+	case c.binding != nil:
+		c.portMapSkipped = "peer port is not mapped while VPN binding is enabled"
+	case port == 0:
+		c.portMapSkipped = "peer port is not mapped as the client accepts no connections"
+	}
+	if c.portMapSkipped != "" {
+		c.portMapper.Stop()
+		c.logger.Info(c.portMapSkipped)
+		return
+	}
+
+	var protocols []string
+	if c.protocols.TCP() {
+		protocols = append(protocols, portmap.TCP)
+	}
+	// The DHT shares the UDP port with uTP
+	if c.protocols.UTP() || c.protocols.DHT() {
+		protocols = append(protocols, portmap.UDP)
+	}
+	c.portMapper.Start(port, protocols)
+}
+
+// PortMappingStatus returns the state of the peer port mapping, and false
+// if port mapping is disabled.
+func (c *Client) PortMappingStatus() (portmap.Status, bool) {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+
+	if c.portMapper == nil {
+		return portmap.Status{}, false
+	}
+	status := c.portMapper.Status()
+	if c.portMapSkipped != "" {
+		status.Error = c.portMapSkipped
+	}
+	return status, true
+}
@@ -0,0 +1,95 @@
+package torrentclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/portmap"
+	"github.com/ayutaz/orochi/internal/portmap/portmaptest"
+)
+
+func TestPortMapping(t *testing.T) {
+	gateway, err := portmaptest.NewNATPMP("203.0.113.7", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gateway.Close()
+
+	// waitMapped waits for the gateway to map port and nothing else
+	waitMapped := func(t *testing.T, port int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mappings := gateway.Mappings()
+			if len(mappings) == 2 && mappings[0].InternalPort == port && mappings[1].InternalPort == port {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected port %d to be mapped, got %+v", port, mappings)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	client, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		PortMapping: &config.PortMappingConfig{
+			Enabled: true,
+			Methods: []string{config.PortMapPCP},
+			Gateway: gateway.Addr.String(),
+		},
+		Protocols: &config.ProtocolConfig{DisableDHT: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			client.Close()
+		}
+	}()
+
+	t.Run("Mapped", func(t *testing.T) {
+		waitMapped(t, client.ListenPort())
+		status, enabled := client.PortMappingStatus()
+		if !enabled {
+			t.Fatal("expected port mapping to be enabled")
+		}
+		if status.Method != portmap.PCP || status.ExternalIP != "203.0.113.7" || status.InternalPort != client.ListenPort() {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("Relisten", func(t *testing.T) {
+		port := freePort(t)
+		if _, err := client.SetPeerPort(port, nil); err != nil {
+			t.Fatalf("failed to set peer port: %v", err)
+		}
+		waitMapped(t, port)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		closed = true
+		if err := client.Close(); err != nil {
+			t.Fatalf("failed to close client: %v", err)
+		}
+		if mappings := gateway.Mappings(); len(mappings) != 0 {
+			t.Errorf("expected the mappings to be removed, got %+v", mappings)
+		}
+	})
+}
+
+func TestPortMapping_Disabled(t *testing.T) {
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if _, enabled := client.PortMappingStatus(); enabled {
+		t.Error("expected port mapping to be disabled")
+	}
+}
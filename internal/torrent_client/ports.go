@@ -0,0 +1,91 @@
+package torrentclient
+
+import (
+	"math/rand/v2"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// peerPortAttempts bounds the ports of a range tried when the client
+// starts.
+const peerPortAttempts = 10
+
+// listenPorts returns the ports to try listening on, in order: the peer
+// port, random ports of the range, or zero to let the system pick one.
+// The caller holds clientMu.
+func (c *Client) listenPorts() []int {
+	if c.peerPort != 0 {
+		return []int{c.peerPort}
+	}
+	r := c.peerPortRange
+	if r == nil {
+		return []int{0}
+	}
+
+	n := r.Max - r.Min + 1
+	if n <= peerPortAttempts {
+		ports := make([]int, n)
+		for i, offset := range rand.Perm(n) {
+			ports[i] = r.Min + offset
+		}
+		return ports
+	}
+	ports := make([]int, 0, peerPortAttempts)
+	tried := make(map[int]bool, peerPortAttempts)
+	for len(ports) < peerPortAttempts {
+		port := r.Min + rand.IntN(n)
+		if !tried[port] {
+			tried[port] = true
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// PeerPort returns the configured peer port, zero for a random one, and the
+// range random ports are picked from.
+func (c *Client) PeerPort() (int, *config.PortRange) {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+
+	return c.peerPort, c.peerPortRange
+}
+
+// ListenPort returns the port peers connect to, or zero if the client does
+// not accept connections, as when peers are proxied.
+func (c *Client) ListenPort() int {
+	return c.torrentClient().LocalPort()
+}
+
+// SetPeerPort changes the peer port while running. The client restarts to
+// listen on the new port, keeping its torrents. A zero port picks a random
+// one from r, if set. It reports whether the client was restarted, which
+// it is not if nothing changed.
+func (c *Client) SetPeerPort(port int, r *config.PortRange) (bool, error) {
+	if err := config.ValidatePeerPort(port, r); err != nil {
+		return false, errors.InvalidInput(err.Error())
+	}
+
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	oldPort, oldRange := c.PeerPort()
+	if port == oldPort && samePortRange(r, oldRange) {
+		return false, nil
+	}
+	if err := c.restart(func() { c.peerPort, c.peerPortRange = port, r }); err != nil {
+		return true, err
+	}
+	// Peers on the local network learn the new port
+	c.announceLSD()
+	return true, nil
+}
+
+// samePortRange reports whether two ranges, which may be nil, are equal.
+func samePortRange(a, b *config.PortRange) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,144 @@
+package torrentclient
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestListenPorts(t *testing.T) {
+	t.Run("Fixed", func(t *testing.T) {
+		c := &Client{peerPort: 6881, peerPortRange: &config.PortRange{Min: 7000, Max: 7010}}
+		if ports := c.listenPorts(); len(ports) != 1 || ports[0] != 6881 {
+			t.Errorf("expected only the peer port, got %v", ports)
+		}
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		c := &Client{}
+		if ports := c.listenPorts(); len(ports) != 1 || ports[0] != 0 {
+			t.Errorf("expected the system to pick the port, got %v", ports)
+		}
+	})
+
+	t.Run("SmallRange", func(t *testing.T) {
+		c := &Client{peerPortRange: &config.PortRange{Min: 7000, Max: 7002}}
+		ports := c.listenPorts()
+		seen := make(map[int]bool)
+		for _, port := range ports {
+			seen[port] = true
+		}
+		if len(ports) != 3 || !seen[7000] || !seen[7001] || !seen[7002] {
+			t.Errorf("expected every port of the range, got %v", ports)
+		}
+	})
+
+	t.Run("LargeRange", func(t *testing.T) {
+		c := &Client{peerPortRange: &config.PortRange{Min: 10000, Max: 60000}}
+		ports := c.listenPorts()
+		if len(ports) != peerPortAttempts {
+			t.Fatalf("expected %d ports, got %d", peerPortAttempts, len(ports))
+		}
+		seen := make(map[int]bool)
+		for _, port := range ports {
+			if port < 10000 || port > 60000 || seen[port] {
+				t.Errorf("unexpected port %d in %v", port, ports)
+			}
+			seen[port] = true
+		}
+	})
+}
+
+func TestSetPeerPort(t *testing.T) {
+	port := freePort(t)
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), PeerPort: port, Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if got := client.ListenPort(); got != port {
+		t.Fatalf("expected to listen on %d, got %d", port, got)
+	}
+	torr, err := client.AddTorrent(context.Background(), createTrackerTorrent(t))
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		restarted, err := client.SetPeerPort(70000, nil)
+		if !errors.IsInvalidInput(err) || restarted {
+			t.Fatalf("expected an invalid input error, got %v", err)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		restarted, err := client.SetPeerPort(port, nil)
+		if err != nil || restarted {
+			t.Fatalf("expected no restart, got %v, %v", restarted, err)
+		}
+	})
+
+	t.Run("Relisten", func(t *testing.T) {
+		next := freePort(t)
+		restarted, err := client.SetPeerPort(next, nil)
+		if err != nil {
+			t.Fatalf("failed to set peer port: %v", err)
+		}
+		if !restarted {
+			t.Error("expected the client to restart")
+		}
+		if got := client.ListenPort(); got != next {
+			t.Errorf("expected to listen on %d, got %d", next, got)
+		}
+		if _, err := client.GetTorrent(torr.InfoHash()); err != nil {
+			t.Errorf("torrent lost: %v", err)
+		}
+		port = next
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		next := freePort(t)
+		if _, err := client.SetPeerPort(0, &config.PortRange{Min: next, Max: next}); err != nil {
+			t.Fatalf("failed to set peer port: %v", err)
+		}
+		if got := client.ListenPort(); got != next {
+			t.Errorf("expected to listen on %d, got %d", next, got)
+		}
+		port = next
+	})
+
+	t.Run("Taken", func(t *testing.T) {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		taken := l.Addr().(*net.TCPAddr).Port
+		if _, err := client.SetPeerPort(taken, nil); err == nil {
+			t.Fatal("expected a taken port to fail")
+		}
+		if got, _ := client.PeerPort(); got != 0 {
+			t.Errorf("expected the previous peer port to be restored, got %d", got)
+		}
+		if got := client.ListenPort(); got != port {
+			t.Errorf("expected to listen on %d again, got %d", port, got)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package torrentclient
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// FilePriority is the download priority of a file within a torrent.
+type FilePriority int
+
+// File priorities, from not downloaded at all to most urgent.
+const (
+	PrioritySkip FilePriority = iota
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+	PriorityMaximum
+)
+
+// priorityNames maps priorities to their API names.
+var priorityNames = map[FilePriority]string{
+	PrioritySkip:    "skip",
+	PriorityLow:     "low",
+	PriorityNormal:  "normal",
+	PriorityHigh:    "high",
+	PriorityMaximum: "maximum",
+}
+
+// String returns the API name of the priority.
+func (p FilePriority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return "normal"
+}
+
+// ParseFilePriority parses a priority name such as "high".
+func ParseFilePriority(name string) (FilePriority, error) {
+	for p, n := range priorityNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return PriorityNormal, errors.InvalidInputf("invalid file priority: %s", name)
+}
+
+// piecePriority maps a file priority to the piece priority anacrolix uses.
+// The library has no level below normal, so every level is shifted up one to
+// keep low distinct from normal. Maximum shares the urgency of data being
+// streamed.
+func (p FilePriority) piecePriority() torrent.PiecePriority {
+	switch p {
+	case PrioritySkip:
+		return torrent.PiecePriorityNone
+	case PriorityLow:
+		return torrent.PiecePriorityNormal
+	case PriorityHigh:
+		return torrent.PiecePriorityReadahead
+	case PriorityMaximum:
+		return torrent.PiecePriorityNow
+	default:
+		return torrent.PiecePriorityHigh
+	}
+}
+
+// filePriorityOf is the inverse of FilePriority.piecePriority.
+func filePriorityOf(p torrent.PiecePriority) FilePriority {
+	switch p {
+	case torrent.PiecePriorityNone:
+		return PrioritySkip
+	case torrent.PiecePriorityNormal:
+		return PriorityLow
+	case torrent.PiecePriorityHigh:
+		return PriorityNormal
+	case torrent.PiecePriorityNow:
+		return PriorityMaximum
+	default:
+		return PriorityHigh
+	}
+}
@@ -0,0 +1,310 @@
+package torrentclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+const (
+	// dhtAnnounceInterval is the pause between announces of a torrent to
+	// the DHT.
+	dhtAnnounceInterval = time.Minute
+	// dhtAnnounceTimeout bounds a single announce, as anacrolix does.
+	dhtAnnounceTimeout = 5 * time.Minute
+)
+
+// configureProtocols turns features and transports off in the torrent
+// client configuration. Torrents are announced to the DHT by announceDHT,
+// which leaves private torrents out, and private torrents do not exchange
+// peers.
+func configureProtocols(p *config.ProtocolConfig, clientConfig *torrent.ClientConfig) {
+	clientConfig.NoDHT = !p.DHT()
+	clientConfig.DisablePEX = !p.PEX()
+	clientConfig.DisableUTP = !p.UTP()
+	clientConfig.DisableTCP = !p.TCP()
+	clientConfig.DisableIPv4 = !p.IPv4()
+	clientConfig.DisableIPv6 = !p.IPv6()
+	clientConfig.PeriodicallyAnnounceTorrentsToDht = false
+	if p.PEX() {
+		clientConfig.Callbacks.ReadExtendedHandshake = withholdPrivatePEX
+	}
+}
+
+// withholdPrivatePEX hides a peer's support for peer exchange on
+// connections of private torrents, so peers are neither sent to it nor
+// taken from it.
+func withholdPrivatePEX(pc *torrent.PeerConn, msg *pp.ExtendedHandshakeMessage) {
+	if isPrivate(pc.Torrent()) {
+		delete(msg.M, pp.ExtensionNamePex)
+	}
+}
+
+// closePEXPeers closes the connections of a private torrent made before its
+// metadata arrived, as they may exchange peers. They are made again without
+// peer exchange.
+func (c *Client) closePEXPeers(t *torrent.Torrent) {
+	if !isPrivate(t) || !c.Protocols().PEX() {
+		return
+	}
+	conns := t.PeerConns()
+	for _, pc := range conns {
+		_ = pc.Close()
+	}
+	if len(conns) > 0 {
+		c.logger.Info("closed peer exchange connections of private torrent",
+			logger.String("info_hash", t.InfoHash().HexString()),
+			logger.Int("peers", len(conns)),
+		)
+	}
+}
+
+// announceDHT announces a torrent to the DHT and looks up its peers until
+// the torrent is closed. Private torrents are not announced once their
+// metadata shows they are private, nor are stopped or held torrents.
+func (c *Client) announceDHT(t *torrent.Torrent) {
+	for {
+		if !isPrivate(t) && c.wantsPeers(t.InfoHash()) {
+			c.announceDHTOnce(t)
+		}
+		select {
+		case <-t.Closed():
+			return
+		case <-time.After(dhtAnnounceInterval):
+		}
+	}
+}
+
+// announceDHTOnce announces a torrent to every DHT server and waits for the
+// announces to finish.
+func (c *Client) announceDHTOnce(t *torrent.Torrent) {
+	ctx, cancel := context.WithTimeout(context.Background(), dhtAnnounceTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range c.torrentClient().DhtServers() {
+		done, stop, err := t.AnnounceToDht(s)
+		if err != nil {
+			c.logger.Debug("failed to announce to DHT",
+				logger.String("info_hash", t.InfoHash().HexString()),
+				logger.Err(err),
+			)
+			continue
+		}
+		c.dhtAnnounces.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stop()
+			select {
+			case <-done:
+			case <-ctx.Done():
+			case <-t.Closed():
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// wantsPeers reports whether a torrent looks for peers: it is neither
+// stopped nor held by the kill switch.
+func (c *Client) wantsPeers(ih metainfo.Hash) bool {
+	return !c.isStopped(ih) && !c.isHeld(ih)
+}
+
+// Protocols returns the features and transports in use.
+func (c *Client) Protocols() *config.ProtocolConfig {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+
+	return c.protocols
+}
+
+// SetProtocols applies a protocol configuration while running. LSD is
+// started or stopped in place; other changes restart the client, which
+// keeps its torrents. It reports whether the client was restarted.
+func (c *Client) SetProtocols(p *config.ProtocolConfig) (bool, error) {
+	if err := p.Validate(); err != nil {
+		return false, errors.InvalidInput(err.Error())
+	}
+
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	old := c.Protocols()
+	restart := p.DHT() != old.DHT() || p.PEX() != old.PEX() ||
+		p.UTP() != old.UTP() || p.TCP() != old.TCP() ||
+		p.IPv4() != old.IPv4() || p.IPv6() != old.IPv6()
+	if restart {
+		if err := c.restart(func() { c.protocols = p }); err != nil {
+			return true, err
+		}
+	} else {
+		c.clientMu.Lock()
+		c.protocols = p
+		c.clientMu.Unlock()
+	}
+
+	// LSD sockets follow the IP versions in use
+	if p.LSD() != old.LSD() || restart {
+		c.stopLSD()
+		if p.LSD() {
+			c.startLSD()
+		}
+	}
+	return restart, nil
+}
+
+// restartedTorrent is a torrent kept across a restart. Magnets still
+// waiting for metadata have no info, and so no priorities.
+type restartedTorrent struct {
+	metainfo   metainfo.MetaInfo
+	priorities []FilePriority
+	// magnet is set, and metainfo left empty, for magnets.
+	magnet *torrent.TorrentSpec
+}
+
+// restart replaces the anacrolix client with one started after apply has
+// changed the protocols or peer port. Torrents are added back with their
+// file priorities, strategies and trackers; stopped torrents stay stopped
+// and held ones held. Magnets still waiting for metadata are added back by
+// info hash, name and trackers, for AddMagnet to go on waiting. If the new
+// client cannot be created, the previous settings are restored. The caller
+// must hold configMu.
+func (c *Client) restart(apply func()) error {
+	// Announcers are waited for before the client is locked, as they use it
+	c.stopAllTrackers()
+
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+
+	var saved []restartedTorrent
+	for _, t := range c.client.Torrents() {
+		// Trackers of torrents added since they were stopped
+		c.stopTrackers(t.InfoHash())
+		if t.Info() == nil {
+			mi := t.Metainfo()
+			saved = append(saved, restartedTorrent{magnet: &torrent.TorrentSpec{
+				InfoHash:    t.InfoHash(),
+				DisplayName: t.Name(),
+				Trackers:    mi.UpvertedAnnounceList(),
+			}})
+			continue
+		}
+		files := t.Files()
+		priorities := make([]FilePriority, len(files))
+		for i, f := range files {
+			priorities[i] = filePriorityOf(f.Priority())
+		}
+		mi := t.Metainfo()
+		if len(mi.PieceLayers) == 0 {
+			// An empty map of a v1 torrent is taken for missing v2 layers
+			mi.PieceLayers = nil
+		}
+		saved = append(saved, restartedTorrent{metainfo: mi, priorities: priorities})
+	}
+
+	c.saveDHTNodes(c.client)
+	c.client.Close()
+	c.closeDHT()
+	c.closeBinding()
+
+	// Followers of sequential strategies ended with their torrents, and the
+	// piece priorities they raised went too
+	c.mu.Lock()
+	for _, state := range c.strategies {
+		if state.stop != nil {
+			close(state.stop)
+			state.stop = nil
+		}
+		state.raised = make(map[int]torrent.PiecePriority)
+	}
+	c.mu.Unlock()
+
+	oldProtocols, oldPort, oldRange := c.protocols, c.peerPort, c.peerPortRange
+	apply()
+	torrentClient, startErr := c.start()
+	if startErr != nil {
+		c.logger.Error("failed to restart torrent client, restoring previous settings", logger.Err(startErr))
+		c.protocols, c.peerPort, c.peerPortRange = oldProtocols, oldPort, oldRange
+		var err error
+		if torrentClient, err = c.start(); err != nil {
+			return errors.InternalWithError("failed to restart torrent client", err)
+		}
+	}
+	c.client = torrentClient
+	c.mapPeerPort(torrentClient)
+
+	for _, rt := range saved {
+		if rt.magnet != nil {
+			c.readdMagnet(torrentClient, rt.magnet)
+			continue
+		}
+		mi := rt.metainfo
+		ih := mi.HashInfoBytes()
+		c.mu.Lock()
+		c.priorities[ih] = rt.priorities
+		c.mu.Unlock()
+
+		t, addErr := torrentClient.AddTorrent(&mi)
+		if addErr != nil {
+			c.logger.Error("failed to add torrent back after restart",
+				logger.String("info_hash", ih.HexString()),
+				logger.Err(addErr),
+			)
+			continue
+		}
+		if c.isStopped(ih) {
+			t.DisallowDataDownload()
+			t.DisallowDataUpload()
+		}
+		c.reapplyHold(t)
+		c.applyFilePriorities(t)
+		c.applyStrategies(t)
+		c.startTrackers(t)
+		go c.watchHashFailures(t)
+		go c.announceDHT(t)
+	}
+
+	c.logger.Info("torrent client restarted",
+		logger.Int("torrents", len(saved)),
+		logger.Int("peer_port", torrentClient.LocalPort()),
+		logger.Bool("dht", c.protocols.DHT()),
+		logger.Bool("pex", c.protocols.PEX()),
+		logger.Bool("utp", c.protocols.UTP()),
+		logger.Bool("tcp", c.protocols.TCP()),
+		logger.Bool("ipv4", c.protocols.IPv4()),
+		logger.Bool("ipv6", c.protocols.IPv6()),
+	)
+	if startErr != nil {
+		return errors.InternalWithError("failed to apply settings", startErr)
+	}
+	return nil
+}
+
+// readdMagnet adds a magnet still waiting for metadata back after a
+// restart. AddMagnet applies its priorities and strategies once the
+// metadata arrives.
+func (c *Client) readdMagnet(cl *torrent.Client, spec *torrent.TorrentSpec) {
+	t, _, err := cl.AddTorrentSpec(spec)
+	if err != nil {
+		c.logger.Error("failed to add magnet back after restart",
+			logger.String("info_hash", spec.InfoHash.HexString()),
+			logger.Err(err),
+		)
+		return
+	}
+	if c.isStopped(spec.InfoHash) {
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+	}
+	c.startTrackers(t)
+	go c.announceDHT(t)
+}
@@ -0,0 +1,302 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/tracker"
+)
+
+func TestSetProtocols(t *testing.T) {
+	seeder, data := newSeeder(t, 4)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+	client, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	downloaded, err := client.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	if _, err := downloaded.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitComplete(t, downloaded)
+
+	stopped, err := client.AddTorrent(context.Background(), createTrackerTorrent(t))
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	stopped.Stop()
+
+	t.Run("Invalid", func(t *testing.T) {
+		restarted, err := client.SetProtocols(&config.ProtocolConfig{DisableUTP: true, DisableTCP: true})
+		if !errors.IsInvalidInput(err) || restarted {
+			t.Fatalf("expected an invalid input error, got %v", err)
+		}
+		if !client.Protocols().TCP() {
+			t.Error("a rejected configuration was applied")
+		}
+	})
+
+	t.Run("LSDWithoutRestart", func(t *testing.T) {
+		restarted, err := client.SetProtocols(&config.ProtocolConfig{DisableDHT: true, DisableLSD: true})
+		if err != nil {
+			t.Fatalf("failed to set protocols: %v", err)
+		}
+		if restarted {
+			t.Error("expected LSD to be turned off without a restart")
+		}
+		if client.Protocols().LSD() {
+			t.Error("expected LSD to be off")
+		}
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		restarted, err := client.SetProtocols(&config.ProtocolConfig{DisableDHT: true, DisablePEX: true, DisableUTP: true})
+		if err != nil {
+			t.Fatalf("failed to set protocols: %v", err)
+		}
+		if !restarted {
+			t.Fatal("expected the client to restart")
+		}
+		if p := client.Protocols(); p.DHT() || p.PEX() || p.UTP() || !p.TCP() {
+			t.Errorf("unexpected protocols: %+v", p)
+		}
+		if got := len(client.ListTorrents()); got != 2 {
+			t.Fatalf("expected both torrents to be kept, got %d", got)
+		}
+		torr, err := client.GetTorrent(downloaded.InfoHash())
+		if err != nil {
+			t.Fatalf("downloaded torrent lost: %v", err)
+		}
+		waitComplete(t, torr)
+		torr, err = client.GetTorrent(stopped.InfoHash())
+		if err != nil {
+			t.Fatalf("stopped torrent lost: %v", err)
+		}
+		if torr.Status() != "stopped" {
+			t.Errorf("expected the torrent to stay stopped, got %s", torr.Status())
+		}
+	})
+
+	// The DHT client has no torrents: announcing races the DHT's routing
+	// table maintenance in anacrolix/dht.
+	t.Run("DisableDHT", func(t *testing.T) {
+		dhtClient, err := NewClient(&config.Config{
+			DownloadDir: t.TempDir(),
+			DHT:         &config.DHTConfig{DisablePublicBootstrap: true},
+		}, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer dhtClient.Close()
+
+		if n := len(dhtClient.torrentClient().DhtServers()); n == 0 {
+			t.Fatal("expected DHT servers")
+		}
+		restarted, err := dhtClient.SetProtocols(&config.ProtocolConfig{DisableDHT: true})
+		if err != nil || !restarted {
+			t.Fatalf("expected the client to restart: %v", err)
+		}
+		if n := len(dhtClient.torrentClient().DhtServers()); n != 0 {
+			t.Errorf("expected no DHT servers, got %d", n)
+		}
+	})
+}
+
+func TestSetProtocols_Strategies(t *testing.T) {
+	client, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	torr, err := client.AddTorrent(context.Background(), createMultiPieceTorrent(t, 8))
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	if err := torr.SetStrategies(Strategies{Torrent: StrategyFirstLast}); err != nil {
+		t.Fatalf("failed to set first_last: %v", err)
+	}
+	piecePriorities(t, torr)
+
+	restarted, err := client.SetProtocols(&config.ProtocolConfig{DisableDHT: true, DisableUTP: true})
+	if err != nil || !restarted {
+		t.Fatalf("expected the client to restart: %v", err)
+	}
+	torr, err = client.GetTorrent(torr.InfoHash())
+	if err != nil {
+		t.Fatalf("torrent lost: %v", err)
+	}
+	for i, p := range piecePriorities(t, torr) {
+		want := torrent.PiecePriorityHigh
+		if i == 0 || i == 7 {
+			want = torrent.PiecePriorityNext
+		}
+		if p != want {
+			t.Errorf("piece %d has priority %d after restart, want %d", i, p, want)
+		}
+	}
+}
+
+func TestSetProtocols_Magnet(t *testing.T) {
+	ts := tracker.NewServer("secret", time.Minute, time.Hour, func([20]byte) bool { return true })
+	srv := httptest.NewServer(http.HandlerFunc(ts.ServeAnnounce))
+	defer srv.Close()
+	announceURL := srv.URL + "/announce?passkey=secret"
+
+	data := createTrackerTorrent(t, announceURL)
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ih := mi.HashInfoBytes()
+
+	client, err := NewClient(&config.Config{
+		DownloadDir: t.TempDir(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true, DisableLSD: true},
+	}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	type result struct {
+		torr *Torrent
+		err  error
+	}
+	added := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		magnet := "magnet:?xt=urn:btih:" + ih.HexString() + "&dn=movie&tr=" + url.QueryEscape(announceURL)
+		torr, err := client.AddMagnet(ctx, magnet)
+		added <- result{torr, err}
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, ok := client.torrentClient().Torrent(ih); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("magnet was not added")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	restarted, err := client.SetProtocols(&config.ProtocolConfig{DisableDHT: true, DisableLSD: true, DisableUTP: true})
+	if err != nil || !restarted {
+		t.Fatalf("expected the client to restart: %v", err)
+	}
+	waiting, ok := client.torrentClient().Torrent(ih)
+	if !ok {
+		t.Fatal("expected the magnet to be kept")
+	}
+	if waiting.Name() != "movie" || len(waiting.Metainfo().AnnounceList) != 1 {
+		t.Errorf("expected the name and trackers to be kept, got %q and %v", waiting.Name(), waiting.Metainfo().AnnounceList)
+	}
+
+	// The seeder only appears after the restart, through the tracker
+	seed(t, &config.Config{Protocols: &config.ProtocolConfig{DisableDHT: true, DisableLSD: true}}, data)
+	res := <-added
+	if res.err != nil {
+		t.Fatalf("failed to add magnet: %v", res.err)
+	}
+	waitComplete(t, res.torr)
+}
+
+func TestParseLSD(t *testing.T) {
+	ih := metainfo.NewHashFromHex("0123456789abcdef0123456789abcdef01234567")
+
+	msg := formatLSD("239.192.152.143:6771", 6881, []metainfo.Hash{ih}, "abc")
+	announce, err := parseLSD(msg)
+	if err != nil {
+		t.Fatalf("failed to parse announce: %v", err)
+	}
+	if announce.port != 6881 || len(announce.infoHashes) != 1 || announce.infoHashes[0] != ih || announce.cookie != "abc" {
+		t.Errorf("unexpected announce: %+v", announce)
+	}
+
+	for _, msg := range []string{
+		"M-SEARCH * HTTP/1.1\r\nPort: 6881\r\nInfohash: " + ih.HexString() + "\r\n\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 0\r\nInfohash: " + ih.HexString() + "\r\n\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 6881\r\nInfohash: xyz\r\n\r\n\r\n",
+		"BT-SEARCH * HTTP/1.1\r\nPort: 6881\r\n\r\n\r\n",
+	} {
+		if _, err := parseLSD([]byte(msg)); !errors.IsParseError(err) {
+			t.Errorf("expected a parse error for %q, got %v", msg, err)
+		}
+	}
+}
+
+func TestHandleLSD(t *testing.T) {
+	// Announces are handed over directly, not heard on the network
+	noLSD := &config.ProtocolConfig{DisableDHT: true, DisableLSD: true}
+	public := createMultiPieceTorrent(t, 4)
+	private := makePrivate(t, createMultiPieceTorrent(t, 4))
+	publicSeeder := seed(t, &config.Config{Protocols: noLSD}, public)
+	privateSeeder := seed(t, &config.Config{Protocols: noLSD}, private)
+
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: noLSD}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	add := func(data []byte) *Torrent {
+		torr, err := client.AddTorrent(context.Background(), data)
+		if err != nil {
+			t.Fatalf("failed to add torrent: %v", err)
+		}
+		return torr
+	}
+	announce := func(seeder *Client, torr *Torrent, cookie string) {
+		ih := metainfo.NewHashFromHex(torr.InfoHash())
+		msg := formatLSD("239.192.152.143:6771", seeder.client.LocalPort(), []metainfo.Hash{ih}, cookie)
+		client.handleLSD(netip.MustParseAddr("127.0.0.1"), msg, "own")
+	}
+	publicTorrent := add(public)
+	privateTorrent := add(private)
+
+	t.Run("OwnAnnounce", func(t *testing.T) {
+		announce(publicSeeder, publicTorrent, "own")
+		expectNoDownload(t, publicTorrent)
+	})
+
+	t.Run("Private", func(t *testing.T) {
+		announce(privateSeeder, privateTorrent, "other")
+		expectNoDownload(t, privateTorrent)
+	})
+
+	t.Run("Public", func(t *testing.T) {
+		announce(publicSeeder, publicTorrent, "other")
+		waitComplete(t, publicTorrent)
+
+		peers := publicTorrent.Peers()
+		if len(peers) > 0 && peers[0].Source != string(peerSourceLSD) {
+			t.Errorf("expected the peer to come from LSD, got %q", peers[0].Source)
+		}
+	})
+}
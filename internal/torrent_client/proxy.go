@@ -0,0 +1,144 @@
+package torrentclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/proxy"
+)
+
+// proxyDHTTimeout is the wait for the proxy to open a UDP relay for the DHT.
+const proxyDHTTimeout = 30 * time.Second
+
+// configureProxy prepares the torrent client configuration for a proxy. The
+// built-in peer sockets and DHT are turned off where the proxy replaces them
+// or ProxyOnly refuses them. It returns nil if no proxy is configured.
+func configureProxy(cfg *config.ProxyConfig, clientConfig *torrent.ClientConfig) (*proxy.Dialer, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	d, err := proxy.New(cfg.Type, cfg.Address, cfg.Username, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Peers {
+		// Peers are dialed through the proxy, which cannot accept connections
+		// for the client.
+		clientConfig.DisableTCP = true
+		clientConfig.DisableUTP = true
+		clientConfig.AcceptPeerConnections = false
+		clientConfig.WebTransport = d.Transport()
+	}
+	// A proxied DHT is started on a relay once the client exists.
+	if cfg.DHT || cfg.ProxyOnly {
+		clientConfig.NoDHT = true
+	}
+	return d, nil
+}
+
+// startProxy routes tracker, peer, DHT and HTTP download traffic through
+// the proxy as configured, and refuses the rest with ProxyOnly.
+func (c *Client) startProxy(cl *torrent.Client, d *proxy.Dialer) {
+	cfg := c.config.Proxy
+	c.blocklist.HTTPClient = &http.Client{Timeout: 5 * time.Minute, Transport: d.Transport()}
+
+	switch {
+	case cfg.Trackers:
+		c.trackerClient.HTTPClient = &http.Client{Transport: d.Transport()}
+		if d.SupportsUDP() {
+			c.trackerClient.DialUDP = d.DialUDP
+		} else if cfg.ProxyOnly {
+			c.trackerClient.DialUDP = refuseUDP("UDP trackers cannot be reached through an HTTP proxy")
+		}
+	case cfg.ProxyOnly:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = refuseTCP("trackers are not proxied")
+		c.trackerClient.HTTPClient = &http.Client{Transport: transport}
+		c.trackerClient.DialUDP = refuseUDP("trackers are not proxied")
+	}
+
+	if cfg.Peers {
+		cl.AddDialer(peerDialer{d})
+	}
+
+	if cfg.DHT && c.protocols.DHT() {
+		if err := c.startProxiedDHT(cl, d); err != nil {
+			c.logger.Warn("DHT disabled: failed to relay it through the proxy", logger.Err(err))
+		}
+	}
+
+	c.logger.Info("proxy enabled",
+		logger.String("type", cfg.Type),
+		logger.String("address", cfg.Address),
+		logger.Bool("trackers", cfg.Trackers),
+		logger.Bool("peers", cfg.Peers),
+		logger.Bool("dht", cfg.DHT),
+		logger.Bool("proxy_only", cfg.ProxyOnly),
+	)
+}
+
+// startProxiedDHT runs the DHT on a UDP relay of the proxy.
+func (c *Client) startProxiedDHT(cl *torrent.Client, d *proxy.Dialer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), proxyDHTTimeout)
+	defer cancel()
+
+	pc, err := d.ListenPacket(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := cl.NewAnacrolixDhtServer(pc)
+	if err != nil {
+		_ = pc.Close()
+		return errors.InternalWithError("failed to start DHT", err)
+	}
+	cl.AddDhtServer(torrent.AnacrolixDhtServerWrapper{Server: s})
+	c.closeDHT = func() { s.Close() }
+	return nil
+}
+
+// peerDialer connects to peers through the proxy.
+type peerDialer struct {
+	proxy *proxy.Dialer
+}
+
+func (pd peerDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return pd.proxy.DialContext(ctx, "tcp", addr)
+}
+
+func (pd peerDialer) DialerNetwork() string {
+	return "tcp"
+}
+
+// refuseTCP returns a dial function that refuses every connection.
+func refuseTCP(reason string) func(context.Context, string, string) (net.Conn, error) {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.PermissionDeniedf("connection refused by proxy_only: %s", reason)
+	}
+}
+
+// refuseUDP returns a UDP dial function that refuses every connection.
+func refuseUDP(reason string) func(context.Context, string) (net.Conn, error) {
+	return func(context.Context, string) (net.Conn, error) {
+		return nil, errors.PermissionDeniedf("connection refused by proxy_only: %s", reason)
+	}
+}
+
+// announcePort returns the port announced to trackers. Without peer sockets,
+// as when peers are proxied, the port they would listen on is announced.
+func (c *Client) announcePort() uint16 {
+	if port := c.ListenPort(); port != 0 {
+		return uint16(port)
+	}
+	if port, _ := c.PeerPort(); port != 0 {
+		return uint16(port)
+	}
+	return config.DefaultPeerPort
+}
@@ -0,0 +1,146 @@
+package torrentclient
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/proxy/proxytest"
+)
+
+func newProxiedClient(t *testing.T, proxyCfg *config.ProxyConfig) *Client {
+	t.Helper()
+
+	// The DHT stays off unless it goes through the proxy. Its clients add
+	// no torrents: announcing races the DHT's routing table maintenance in
+	// anacrolix/dht.
+	cfg := &config.Config{DownloadDir: t.TempDir(), Proxy: proxyCfg}
+	if proxyCfg.DHT {
+		cfg.DHT = &config.DHTConfig{DisablePublicBootstrap: true}
+	} else {
+		cfg.Protocols = &config.ProtocolConfig{DisableDHT: true}
+	}
+	client, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func startSOCKS5(t *testing.T) *proxytest.SOCKS5 {
+	t.Helper()
+	s, err := proxytest.NewSOCKS5("user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestProxyPeers(t *testing.T) {
+	socks := startSOCKS5(t)
+	seeder, data := newSeeder(t, 4)
+	addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+	leecher := newProxiedClient(t, &config.ProxyConfig{
+		Type:      config.ProxySOCKS5,
+		Address:   socks.Addr,
+		Username:  "user",
+		Password:  "secret",
+		Peers:     true,
+		ProxyOnly: true,
+	})
+	if port := leecher.client.LocalPort(); port != 0 {
+		t.Errorf("expected no peer sockets with proxy_only, got port %d", port)
+	}
+
+	torr, err := leecher.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	if _, err := torr.AddPeers([]string{addr}); err != nil {
+		t.Fatalf("failed to add peer: %v", err)
+	}
+	waitComplete(t, torr)
+
+	if !slices.Contains(socks.Targets(), addr) {
+		t.Errorf("peer connection did not go through the proxy: %v", socks.Targets())
+	}
+}
+
+func TestProxyTrackers(t *testing.T) {
+	socks := startSOCKS5(t)
+	ft := &fakeTracker{}
+	srv := httptest.NewServer(ft)
+	defer srv.Close()
+
+	client := newProxiedClient(t, &config.ProxyConfig{
+		Type:     config.ProxySOCKS5,
+		Address:  socks.Addr,
+		Username: "user",
+		Password: "secret",
+		Trackers: true,
+	})
+	torr, err := client.AddTorrent(context.Background(), createTrackerTorrent(t, srv.URL+"/announce"))
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	waitTracker(t, torr, 0, TrackerWorking)
+	if !slices.Contains(socks.Targets(), strings.TrimPrefix(srv.URL, "http://")) {
+		t.Errorf("announce did not go through the proxy: %v", socks.Targets())
+	}
+}
+
+func TestProxyOnlyRefusesTrackers(t *testing.T) {
+	socks := startSOCKS5(t)
+	ft := &fakeTracker{}
+	srv := httptest.NewServer(ft)
+	defer srv.Close()
+
+	client := newProxiedClient(t, &config.ProxyConfig{
+		Type:      config.ProxySOCKS5,
+		Address:   socks.Addr,
+		Username:  "user",
+		Password:  "secret",
+		Peers:     true,
+		ProxyOnly: true,
+	})
+	torr, err := client.AddTorrent(context.Background(), createTrackerTorrent(t, srv.URL+"/announce"))
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	state := waitTracker(t, torr, 0, TrackerNotWorking)
+	if !strings.Contains(state.LastError, "proxy_only") {
+		t.Errorf("expected the announce to be refused by proxy_only, got %q", state.LastError)
+	}
+	if announces := ft.announces(); len(announces) != 0 {
+		t.Errorf("expected no direct announces, got %v", announces)
+	}
+}
+
+func TestProxyDHT(t *testing.T) {
+	socks := startSOCKS5(t)
+	client := newProxiedClient(t, &config.ProxyConfig{
+		Type:     config.ProxySOCKS5,
+		Address:  socks.Addr,
+		Username: "user",
+		Password: "secret",
+		DHT:      true,
+	})
+
+	servers := client.client.DhtServers()
+	if len(servers) != 1 {
+		t.Fatalf("expected one DHT server on the proxy relay, got %d", len(servers))
+	}
+	if addr := servers[0].Addr().String(); strings.HasSuffix(addr, fmt.Sprintf(":%d", client.client.LocalPort())) {
+		t.Errorf("DHT server uses the peer socket %s instead of the relay", addr)
+	}
+}
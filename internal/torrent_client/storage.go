@@ -0,0 +1,630 @@
+package torrentclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// partSuffix is appended to incomplete files when enabled.
+const partSuffix = ".part"
+
+// fileStorage stores torrent data on disk, one directory per info hash.
+// Unlike the stock anacrolix file storage, it keeps unfinished torrents in a
+// separate incomplete directory and can move a torrent's data to the download
+// directory while the torrent stays loaded.
+type fileStorage struct {
+	mu            sync.Mutex
+	downloadDir   string
+	incompleteDir string
+	partSuffix    bool
+	preallocate   bool
+	completion    storage.PieceCompletion
+	torrents      map[metainfo.Hash]*torrentStorage
+	names         map[metainfo.Hash]map[string]string
+}
+
+// fileStorageOpts configures a fileStorage.
+type fileStorageOpts struct {
+	DownloadDir   string
+	IncompleteDir string
+	PartSuffix    bool
+	Preallocate   bool
+}
+
+// newFileStorage creates a file storage rooted at the download directory.
+// Piece completion is tracked there so it survives moves.
+func newFileStorage(opts fileStorageOpts) *fileStorage {
+	completion, err := storage.NewDefaultPieceCompletionForDir(opts.DownloadDir)
+	if err != nil {
+		completion = storage.NewMapPieceCompletion()
+	}
+
+	return &fileStorage{
+		downloadDir:   opts.DownloadDir,
+		incompleteDir: opts.IncompleteDir,
+		partSuffix:    opts.PartSuffix,
+		preallocate:   opts.Preallocate,
+		completion:    completion,
+		torrents:      make(map[metainfo.Hash]*torrentStorage),
+		names:         make(map[metainfo.Hash]map[string]string),
+	}
+}
+
+// OpenTorrent implements storage.ClientImpl.
+func (s *fileStorage) OpenTorrent(
+	ctx context.Context,
+	info *metainfo.Info,
+	infoHash metainfo.Hash,
+) (storage.TorrentImpl, error) {
+	ts := &torrentStorage{
+		storage:  s,
+		info:     info,
+		infoHash: infoHash,
+		names:    s.fileNames(infoHash),
+	}
+	ts.incomplete = s.incompleteDir != "" && !s.isComplete(info, infoHash) && !ts.existsIn(s.downloadDir, false)
+
+	if err := ts.open(ctx); err != nil {
+		return storage.TorrentImpl{}, err
+	}
+
+	if s.preallocate {
+		if err := ts.preallocate(); err != nil {
+			return storage.TorrentImpl{}, fmt.Errorf("preallocate torrent files: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.torrents[infoHash] = ts
+	s.mu.Unlock()
+
+	return storage.TorrentImpl{
+		Piece: ts.piece,
+		Close: ts.close,
+		Flush: ts.flush,
+	}, nil
+}
+
+// Close releases the piece completion database.
+func (s *fileStorage) Close() error {
+	return s.completion.Close()
+}
+
+// get returns the storage of a loaded torrent.
+func (s *fileStorage) get(infoHash metainfo.Hash) (*torrentStorage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, ok := s.torrents[infoHash]
+	return ts, ok
+}
+
+// setFileNames records the renamed paths of a torrent's files, keyed by
+// their original path relative to the torrent directory. They apply the next
+// time the torrent is opened, so they must be set before it is added.
+func (s *fileStorage) setFileNames(infoHash metainfo.Hash, names map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(names) == 0 {
+		delete(s.names, infoHash)
+		return
+	}
+	s.names[infoHash] = copyNames(names)
+}
+
+// fileNames returns a copy of the renamed paths recorded for a torrent.
+func (s *fileStorage) fileNames(infoHash metainfo.Hash) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return copyNames(s.names[infoHash])
+}
+
+// isComplete reports whether every piece of the torrent is marked complete.
+func (s *fileStorage) isComplete(info *metainfo.Info, infoHash metainfo.Hash) bool {
+	for i := 0; i < info.NumPieces(); i++ {
+		c, err := s.completion.Get(metainfo.PieceKey{InfoHash: infoHash, Index: i})
+		if err != nil || !c.Ok || !c.Complete {
+			return false
+		}
+	}
+	return true
+}
+
+// torrentStorage is the storage of a single torrent. Piece I/O goes through
+// the current inner implementation under a read lock, so relocation can
+// swap it out without racing readers and writers.
+type torrentStorage struct {
+	storage    *fileStorage
+	info       *metainfo.Info
+	infoHash   metainfo.Hash
+	mu         sync.RWMutex
+	incomplete bool
+	names      map[string]string // Original path to renamed path, both relative to the torrent directory
+	impl       storage.TorrentImpl
+}
+
+// baseDir returns the directory currently holding the torrent's data.
+func (ts *torrentStorage) baseDir() string {
+	if ts.incomplete {
+		return ts.storage.incompleteDir
+	}
+	return ts.storage.downloadDir
+}
+
+// torrentDir returns the per-torrent directory inside baseDir.
+func (ts *torrentStorage) torrentDir(baseDir string) string {
+	return filepath.Join(baseDir, ts.infoHash.HexString())
+}
+
+// originalPath returns the path of a file relative to the torrent directory
+// as laid out by the torrent, in slash form.
+func (ts *torrentStorage) originalPath(file *metainfo.FileInfo) string {
+	var parts []string
+	if ts.info.BestName() != metainfo.NoName {
+		parts = append(parts, ts.info.BestName())
+	}
+	return path.Join(append(parts, file.BestPath()...)...)
+}
+
+// currentPath returns the path of a file relative to the torrent directory
+// after any renames, in slash form.
+func (ts *torrentStorage) currentPath(file *metainfo.FileInfo) string {
+	orig := ts.originalPath(file)
+	if renamed, ok := ts.names[orig]; ok {
+		return renamed
+	}
+	return orig
+}
+
+// relativePath returns the on-disk path of a file relative to the torrent
+// directory.
+func (ts *torrentStorage) relativePath(file *metainfo.FileInfo, incomplete bool) string {
+	return ts.diskPath(ts.currentPath(file), incomplete)
+}
+
+// diskPath converts a slash-separated path relative to the torrent directory
+// to an OS path, adding the part suffix to incomplete files when enabled.
+func (ts *torrentStorage) diskPath(rel string, incomplete bool) string {
+	p := filepath.FromSlash(rel)
+	if incomplete && ts.storage.partSuffix {
+		p += partSuffix
+	}
+	return p
+}
+
+// rootName returns the current name of the torrent's top-level file or
+// folder.
+func (ts *torrentStorage) rootName() string {
+	files := ts.info.UpvertedFiles()
+	root, _, _ := strings.Cut(ts.currentPath(&files[0]), "/")
+	return root
+}
+
+// filePath returns the absolute path of a file inside baseDir.
+func (ts *torrentStorage) filePath(baseDir string, file *metainfo.FileInfo, incomplete bool) string {
+	return filepath.Join(ts.torrentDir(baseDir), ts.relativePath(file, incomplete))
+}
+
+// existsIn reports whether any of the torrent's files exist in baseDir.
+func (ts *torrentStorage) existsIn(baseDir string, incomplete bool) bool {
+	for _, file := range ts.info.UpvertedFiles() {
+		if _, err := os.Stat(ts.filePath(baseDir, &file, incomplete)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// open creates the inner anacrolix file storage for the current location.
+// The caller must hold the write lock or have exclusive access.
+func (ts *torrentStorage) open(ctx context.Context) error {
+	incomplete := ts.incomplete
+	client := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir: ts.baseDir(),
+		TorrentDirMaker: func(baseDir string, _ *metainfo.Info, infoHash metainfo.Hash) string {
+			return filepath.Join(baseDir, infoHash.HexString())
+		},
+		FilePathMaker: func(opts storage.FilePathMakerOpts) string {
+			return ts.relativePath(opts.File, incomplete)
+		},
+		PieceCompletion: ts.storage.completion,
+	})
+
+	impl, err := client.OpenTorrent(ctx, ts.info, ts.infoHash)
+	if err != nil {
+		return err
+	}
+	ts.impl = impl
+	return nil
+}
+
+// preallocate allocates every file of the torrent to its full length, so
+// running out of space is detected up front rather than midway through the
+// download. Files that already have their full length are left alone.
+func (ts *torrentStorage) preallocate() error {
+	baseDir := ts.baseDir()
+	for _, file := range ts.info.UpvertedFiles() {
+		if file.Length == 0 {
+			continue
+		}
+
+		path := ts.filePath(baseDir, &file, ts.incomplete)
+		if st, err := os.Stat(path); err == nil && st.Size() >= file.Length {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		err = allocateFile(f, file.Length)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// piece returns a piece whose I/O follows the torrent across relocations.
+func (ts *torrentStorage) piece(p metainfo.Piece) storage.PieceImpl {
+	return &relocatablePiece{ts: ts, p: p}
+}
+
+// flush flushes the inner storage.
+func (ts *torrentStorage) flush() error {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if ts.impl.Flush == nil {
+		return nil
+	}
+	return ts.impl.Flush()
+}
+
+// close closes the inner storage and forgets the torrent.
+func (ts *torrentStorage) close() error {
+	ts.storage.mu.Lock()
+	if ts.storage.torrents[ts.infoHash] == ts {
+		delete(ts.storage.torrents, ts.infoHash)
+	}
+	ts.storage.mu.Unlock()
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if ts.impl.Close == nil {
+		return nil
+	}
+	return ts.impl.Close()
+}
+
+// dataPath returns the current location of the torrent's content.
+func (ts *torrentStorage) dataPath() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return filepath.Join(ts.torrentDir(ts.baseDir()), ts.rootName())
+}
+
+// savePath returns where the torrent's content lives once it is complete.
+func (ts *torrentStorage) savePath() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return filepath.Join(ts.torrentDir(ts.storage.downloadDir), ts.rootName())
+}
+
+// displayPaths returns the current path of every file relative to the
+// torrent's top-level folder, or the file name for single-file torrents.
+func (ts *torrentStorage) displayPaths() []string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	files := ts.info.UpvertedFiles()
+	paths := make([]string, len(files))
+	for i := range files {
+		paths[i] = ts.currentPath(&files[i])
+		if ts.info.IsDir() {
+			_, paths[i], _ = strings.Cut(paths[i], "/")
+		}
+	}
+	return paths
+}
+
+// fileNames returns a copy of the torrent's renamed paths.
+func (ts *torrentStorage) fileNames() map[string]string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return copyNames(ts.names)
+}
+
+// rename renames the file or folder at from to to, both slash-separated
+// paths relative to the torrent directory. Files are renamed on disk and
+// piece I/O switches to the new paths, so the torrent keeps seeding. If any
+// file fails to move, the ones already moved are put back.
+func (ts *torrentStorage) rename(from, to string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	files := ts.info.UpvertedFiles()
+	current := make([]string, len(files))
+	renamed := make([]string, len(files))
+	matched := false
+	for i := range files {
+		current[i] = ts.currentPath(&files[i])
+		renamed[i] = current[i]
+		if current[i] == from || strings.HasPrefix(current[i], from+"/") {
+			renamed[i] = to + current[i][len(from):]
+			matched = true
+		}
+	}
+	if !matched {
+		return errors.NotFoundf("no file or folder at %s", from)
+	}
+	if err := checkPathConflicts(renamed); err != nil {
+		return err
+	}
+
+	baseDir := ts.torrentDir(ts.baseDir())
+	for i := range files {
+		if renamed[i] == current[i] {
+			continue
+		}
+		dst := filepath.Join(baseDir, ts.diskPath(renamed[i], ts.incomplete))
+		if _, err := os.Stat(dst); err == nil {
+			return errors.AlreadyExistsf("%s already exists on disk", renamed[i])
+		}
+	}
+
+	if ts.impl.Flush != nil {
+		if err := ts.impl.Flush(); err != nil {
+			return errors.InternalWithError("failed to flush torrent data", err)
+		}
+	}
+
+	type move struct{ src, dst string }
+	var moved []move
+	for i := range files {
+		if renamed[i] == current[i] {
+			continue
+		}
+		src := filepath.Join(baseDir, ts.diskPath(current[i], ts.incomplete))
+		dst := filepath.Join(baseDir, ts.diskPath(renamed[i], ts.incomplete))
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue // Never written, e.g. deselected
+		}
+
+		if err := moveFile(src, dst); err != nil {
+			for j := len(moved) - 1; j >= 0; j-- {
+				_ = moveFile(moved[j].dst, moved[j].src)
+			}
+			return errors.InternalWithError(fmt.Sprintf("failed to rename %s", current[i]), err)
+		}
+		moved = append(moved, move{src: src, dst: dst})
+	}
+
+	names := make(map[string]string)
+	for i := range files {
+		if orig := ts.originalPath(&files[i]); renamed[i] != orig {
+			names[orig] = renamed[i]
+		}
+	}
+	ts.names = names
+	ts.storage.setFileNames(ts.infoHash, names)
+
+	if err := ts.open(context.Background()); err != nil {
+		return errors.InternalWithError("failed to reopen torrent storage", err)
+	}
+
+	// Drop folders left empty by the rename.
+	for _, m := range moved {
+		for dir := filepath.Dir(m.src); dir != baseDir && strings.HasPrefix(dir, baseDir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// moveToDownloadDir moves the torrent's files from the incomplete directory
+// to the download directory. Each file is renamed into place; if any move
+// fails, files already moved are put back so the torrent is never split
+// across both directories.
+func (ts *torrentStorage) moveToDownloadDir() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if !ts.incomplete {
+		return nil
+	}
+
+	if ts.impl.Flush != nil {
+		if err := ts.impl.Flush(); err != nil {
+			return fmt.Errorf("flush torrent data: %w", err)
+		}
+	}
+
+	type move struct{ src, dst string }
+	var moved []move
+	for _, file := range ts.info.UpvertedFiles() {
+		src := ts.filePath(ts.storage.incompleteDir, &file, true)
+		dst := ts.filePath(ts.storage.downloadDir, &file, false)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue // Never written, e.g. deselected
+		}
+
+		if err := moveFile(src, dst); err != nil {
+			for i := len(moved) - 1; i >= 0; i-- {
+				_ = moveFile(moved[i].dst, moved[i].src)
+			}
+			return fmt.Errorf("move %s: %w", src, err)
+		}
+		moved = append(moved, move{src: src, dst: dst})
+	}
+
+	ts.incomplete = false
+	if err := ts.open(context.Background()); err != nil {
+		return fmt.Errorf("reopen torrent storage: %w", err)
+	}
+
+	removeEmptyDirs(ts.torrentDir(ts.storage.incompleteDir))
+	return nil
+}
+
+// relocatablePiece implements storage.PieceImpl on top of whatever inner
+// storage the torrent currently uses.
+type relocatablePiece struct {
+	ts *torrentStorage
+	p  metainfo.Piece
+}
+
+// ReadAt implements io.ReaderAt.
+func (p *relocatablePiece) ReadAt(b []byte, off int64) (int, error) {
+	p.ts.mu.RLock()
+	defer p.ts.mu.RUnlock()
+	return p.ts.impl.Piece(p.p).ReadAt(b, off)
+}
+
+// WriteAt implements io.WriterAt.
+func (p *relocatablePiece) WriteAt(b []byte, off int64) (int, error) {
+	p.ts.mu.RLock()
+	defer p.ts.mu.RUnlock()
+	return p.ts.impl.Piece(p.p).WriteAt(b, off)
+}
+
+// MarkComplete implements storage.PieceImpl.
+func (p *relocatablePiece) MarkComplete() error {
+	p.ts.mu.RLock()
+	defer p.ts.mu.RUnlock()
+	return p.ts.impl.Piece(p.p).MarkComplete()
+}
+
+// MarkNotComplete implements storage.PieceImpl.
+func (p *relocatablePiece) MarkNotComplete() error {
+	p.ts.mu.RLock()
+	defer p.ts.mu.RUnlock()
+	return p.ts.impl.Piece(p.p).MarkNotComplete()
+}
+
+// Completion implements storage.PieceImpl.
+func (p *relocatablePiece) Completion() storage.Completion {
+	p.ts.mu.RLock()
+	defer p.ts.mu.RUnlock()
+	return p.ts.impl.Piece(p.p).Completion()
+}
+
+// checkPathConflicts returns a CONFLICT error if two files share a path or a
+// file's path is used as a folder by another file.
+func checkPathConflicts(paths []string) error {
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if seen[p] {
+			return errors.AlreadyExistsf("%s is used by more than one file", p)
+		}
+		seen[p] = true
+	}
+	for _, p := range paths {
+		for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if seen[dir] {
+				return errors.AlreadyExistsf("%s is a file and cannot contain %s", dir, p)
+			}
+		}
+	}
+	return nil
+}
+
+// copyNames returns a copy of a rename map, or nil if it is empty.
+func copyNames(names map[string]string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(names))
+	for k, v := range names {
+		result[k] = v
+	}
+	return result
+}
+
+// moveFile moves src to dst. It renames when possible and falls back to
+// copying into a temporary file next to dst followed by a rename, so dst
+// never exists in a partially written state.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// Rename fails across filesystems; copy instead.
+	tmp := dst + ".moving"
+	if err := copyFile(src, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst and syncs dst to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// removeEmptyDirs removes dir and any empty directories below it. Directories
+// that still contain files are left alone.
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, entry.Name()))
+		}
+	}
+	_ = os.Remove(dir) // Fails if not empty, which is fine
+}
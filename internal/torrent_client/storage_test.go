@@ -0,0 +1,332 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// buildTestInfo creates a multi-file torrent info from files written to a
+// temporary source directory and returns it along with the file contents.
+func buildTestInfo(t *testing.T) (*metainfo.Info, map[string][]byte) {
+	t.Helper()
+
+	srcRoot := t.TempDir()
+	src := filepath.Join(srcRoot, "album")
+	contents := map[string][]byte{
+		"a.bin":        bytes.Repeat([]byte("a"), 40000),
+		"disc2/b.bin":  bytes.Repeat([]byte("b"), 9000),
+		"disc2/readme": []byte("hello"),
+	}
+	for name, data := range contents {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info := &metainfo.Info{PieceLength: 16384}
+	if err := info.BuildFromFilePath(src); err != nil {
+		t.Fatalf("failed to build info: %v", err)
+	}
+
+	// Keep the source around only long enough to read the piece data.
+	var all bytes.Buffer
+	for _, file := range info.UpvertedFiles() {
+		data, err := os.ReadFile(filepath.Join(append([]string{src}, file.BestPath()...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all.Write(data)
+	}
+	contents[""] = all.Bytes()
+
+	return info, contents
+}
+
+// writeAllPieces writes the torrent's data through the storage and marks
+// every piece complete.
+func writeAllPieces(t *testing.T, s *fileStorage, info *metainfo.Info, infoHash metainfo.Hash, data []byte) {
+	t.Helper()
+
+	impl, err := s.OpenTorrent(context.Background(), info, infoHash)
+	if err != nil {
+		t.Fatalf("failed to open torrent storage: %v", err)
+	}
+
+	for i := 0; i < info.NumPieces(); i++ {
+		p := info.Piece(i)
+		piece := impl.Piece(p)
+		if _, err := piece.WriteAt(data[p.Offset():p.Offset()+p.Length()], 0); err != nil {
+			t.Fatalf("failed to write piece %d: %v", i, err)
+		}
+		if err := piece.MarkComplete(); err != nil {
+			t.Fatalf("failed to mark piece %d complete: %v", i, err)
+		}
+	}
+}
+
+func TestFileStorageMoveToDownloadDir(t *testing.T) {
+	for _, usePartSuffix := range []bool{false, true} {
+		name := "plain"
+		if usePartSuffix {
+			name = "part suffix"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			downloadDir := t.TempDir()
+			incompleteDir := t.TempDir()
+			info, contents := buildTestInfo(t)
+			infoHash := metainfo.HashBytes([]byte(name))
+
+			s := newFileStorage(fileStorageOpts{
+				DownloadDir:   downloadDir,
+				IncompleteDir: incompleteDir,
+				PartSuffix:    usePartSuffix,
+			})
+			defer s.Close()
+
+			writeAllPieces(t, s, info, infoHash, contents[""])
+
+			ts, ok := s.get(infoHash)
+			if !ok {
+				t.Fatal("torrent storage not registered")
+			}
+
+			incompleteFile := filepath.Join(incompleteDir, infoHash.HexString(), "album", "a.bin")
+			if usePartSuffix {
+				incompleteFile += partSuffix
+			}
+			if _, err := os.Stat(incompleteFile); err != nil {
+				t.Fatalf("expected data in incomplete dir: %v", err)
+			}
+			if got := ts.dataPath(); got != filepath.Join(incompleteDir, infoHash.HexString(), "album") {
+				t.Errorf("unexpected data path before move: %s", got)
+			}
+
+			if err := ts.moveToDownloadDir(); err != nil {
+				t.Fatalf("failed to move torrent: %v", err)
+			}
+
+			for rel, want := range contents {
+				if rel == "" {
+					continue
+				}
+				path := filepath.Join(downloadDir, infoHash.HexString(), "album", filepath.FromSlash(rel))
+				got, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("expected %s in download dir: %v", rel, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("content mismatch for %s", rel)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(incompleteDir, infoHash.HexString())); !os.IsNotExist(err) {
+				t.Errorf("expected incomplete torrent dir to be removed, got %v", err)
+			}
+
+			// Pieces must still be readable and complete from the new location.
+			p := info.Piece(0)
+			buf := make([]byte, p.Length())
+			piece := ts.piece(p)
+			if _, err := piece.ReadAt(buf, 0); err != nil {
+				t.Fatalf("failed to read piece after move: %v", err)
+			}
+			if !bytes.Equal(buf, contents[""][:p.Length()]) {
+				t.Error("piece data mismatch after move")
+			}
+			if c := piece.Completion(); !c.Complete {
+				t.Error("expected piece to remain complete after move")
+			}
+		})
+	}
+}
+
+func TestFileStorageOpensCompletedTorrentInDownloadDir(t *testing.T) {
+	downloadDir := t.TempDir()
+	incompleteDir := t.TempDir()
+	info, contents := buildTestInfo(t)
+	infoHash := metainfo.HashBytes([]byte("reopen"))
+
+	s := newFileStorage(fileStorageOpts{DownloadDir: downloadDir, IncompleteDir: incompleteDir, PartSuffix: true})
+	writeAllPieces(t, s, info, infoHash, contents[""])
+	ts, _ := s.get(infoHash)
+	if err := ts.moveToDownloadDir(); err != nil {
+		t.Fatalf("failed to move torrent: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh storage, as after a restart, must find the data in place.
+	s = newFileStorage(fileStorageOpts{DownloadDir: downloadDir, IncompleteDir: incompleteDir, PartSuffix: true})
+	defer s.Close()
+
+	if _, err := s.OpenTorrent(context.Background(), info, infoHash); err != nil {
+		t.Fatalf("failed to reopen torrent: %v", err)
+	}
+	ts, _ = s.get(infoHash)
+	if ts.incomplete {
+		t.Error("expected completed torrent to open in download dir")
+	}
+}
+
+func TestFileStorageWithoutIncompleteDir(t *testing.T) {
+	downloadDir := t.TempDir()
+	info, contents := buildTestInfo(t)
+	infoHash := metainfo.HashBytes([]byte("direct"))
+
+	s := newFileStorage(fileStorageOpts{DownloadDir: downloadDir, PartSuffix: true})
+	defer s.Close()
+
+	writeAllPieces(t, s, info, infoHash, contents[""])
+
+	if _, err := os.Stat(filepath.Join(downloadDir, infoHash.HexString(), "album", "a.bin")); err != nil {
+		t.Fatalf("expected data directly in download dir: %v", err)
+	}
+
+	ts, _ := s.get(infoHash)
+	if err := ts.moveToDownloadDir(); err != nil {
+		t.Errorf("move should be a no-op: %v", err)
+	}
+}
+
+func TestFileStoragePreallocate(t *testing.T) {
+	downloadDir := t.TempDir()
+	incompleteDir := t.TempDir()
+	info, _ := buildTestInfo(t)
+	infoHash := metainfo.HashBytes([]byte("prealloc"))
+
+	s := newFileStorage(fileStorageOpts{
+		DownloadDir:   downloadDir,
+		IncompleteDir: incompleteDir,
+		PartSuffix:    true,
+		Preallocate:   true,
+	})
+	defer s.Close()
+
+	if _, err := s.OpenTorrent(context.Background(), info, infoHash); err != nil {
+		t.Fatalf("failed to open torrent storage: %v", err)
+	}
+
+	for _, file := range info.UpvertedFiles() {
+		parts := append([]string{incompleteDir, infoHash.HexString(), "album"}, file.BestPath()...)
+		st, err := os.Stat(filepath.Join(parts...) + partSuffix)
+		if err != nil {
+			t.Fatalf("expected preallocated file: %v", err)
+		}
+		if st.Size() != file.Length {
+			t.Errorf("expected size %d, got %d", file.Length, st.Size())
+		}
+	}
+}
+
+func TestFileStorageRename(t *testing.T) {
+	downloadDir := t.TempDir()
+	info, contents := buildTestInfo(t)
+	infoHash := metainfo.HashBytes([]byte("rename"))
+
+	s := newFileStorage(fileStorageOpts{DownloadDir: downloadDir})
+	defer s.Close()
+
+	writeAllPieces(t, s, info, infoHash, contents[""])
+	ts, _ := s.get(infoHash)
+	torrentDir := filepath.Join(downloadDir, infoHash.HexString())
+
+	if err := ts.rename("album/a.bin", "album/first.bin"); err != nil {
+		t.Fatalf("failed to rename file: %v", err)
+	}
+	if err := ts.rename("album/disc2", "album/Disc 2"); err != nil {
+		t.Fatalf("failed to rename folder: %v", err)
+	}
+	if err := ts.rename("album", "Album (2020)"); err != nil {
+		t.Fatalf("failed to rename top-level folder: %v", err)
+	}
+
+	want := map[string]string{
+		"a.bin":        "Album (2020)/first.bin",
+		"disc2/b.bin":  "Album (2020)/Disc 2/b.bin",
+		"disc2/readme": "Album (2020)/Disc 2/readme",
+	}
+	for orig, renamed := range want {
+		got, err := os.ReadFile(filepath.Join(torrentDir, filepath.FromSlash(renamed)))
+		if err != nil {
+			t.Fatalf("expected %s on disk: %v", renamed, err)
+		}
+		if !bytes.Equal(got, contents[orig]) {
+			t.Errorf("content mismatch for %s", renamed)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(torrentDir, "album")); !os.IsNotExist(err) {
+		t.Errorf("expected old folder to be removed, got %v", err)
+	}
+	if got := ts.dataPath(); got != filepath.Join(torrentDir, "Album (2020)") {
+		t.Errorf("unexpected data path after rename: %s", got)
+	}
+
+	// Pieces must still be readable from the renamed files.
+	p := info.Piece(info.NumPieces() - 1)
+	buf := make([]byte, p.Length())
+	if _, err := ts.piece(p).ReadAt(buf, 0); err != nil {
+		t.Fatalf("failed to read piece after rename: %v", err)
+	}
+	if !bytes.Equal(buf, contents[""][p.Offset():]) {
+		t.Error("piece data mismatch after rename")
+	}
+
+	// A fresh storage given the saved names, as after a restart, must use them.
+	names := ts.fileNames()
+	if len(names) != len(want) {
+		t.Fatalf("expected %d renamed files, got %v", len(want), names)
+	}
+	s2 := newFileStorage(fileStorageOpts{DownloadDir: downloadDir})
+	defer s2.Close()
+	s2.setFileNames(infoHash, names)
+	if _, err := s2.OpenTorrent(context.Background(), info, infoHash); err != nil {
+		t.Fatalf("failed to reopen torrent: %v", err)
+	}
+	ts2, _ := s2.get(infoHash)
+	if got := ts2.displayPaths(); got[0] != "first.bin" || got[1] != "Disc 2/b.bin" {
+		t.Errorf("unexpected paths after reopen: %v", got)
+	}
+}
+
+func TestFileStorageRenameConflicts(t *testing.T) {
+	downloadDir := t.TempDir()
+	info, contents := buildTestInfo(t)
+	infoHash := metainfo.HashBytes([]byte("conflict"))
+
+	s := newFileStorage(fileStorageOpts{DownloadDir: downloadDir})
+	defer s.Close()
+
+	writeAllPieces(t, s, info, infoHash, contents[""])
+	ts, _ := s.get(infoHash)
+
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{name: "duplicate file", from: "album/disc2/b.bin", to: "album/disc2/readme"},
+		{name: "file used as folder", from: "album/disc2", to: "album/a.bin"},
+		{name: "missing path", from: "album/nope", to: "album/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ts.rename(tt.from, tt.to); err == nil {
+				t.Error("expected rename to fail")
+			}
+		})
+	}
+
+	if len(ts.fileNames()) != 0 {
+		t.Errorf("failed renames must not change names: %v", ts.fileNames())
+	}
+}
@@ -0,0 +1,262 @@
+package torrentclient
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// DownloadStrategy decides the order in which pieces are downloaded.
+type DownloadStrategy string
+
+const (
+	// StrategyRarestFirst downloads the pieces fewest peers have first. It is
+	// the engine's default and the best choice for swarm health.
+	StrategyRarestFirst DownloadStrategy = "rarest_first"
+	// StrategySequential downloads pieces in order, so files can be previewed
+	// while they download.
+	StrategySequential DownloadStrategy = "sequential"
+	// StrategyFirstLast downloads the first and last piece of each file
+	// before the rest, so container headers can be read early.
+	StrategyFirstLast DownloadStrategy = "first_last"
+)
+
+// sequentialWindow is how much data past the first missing piece of a
+// sequential file is prioritized. Pieces in the window are still fetched
+// rarest-first among themselves, which keeps several peers busy.
+const sequentialWindow = 16 << 20 // 16MB
+
+// minSequentialPieces is the smallest window for torrents with large pieces.
+const minSequentialPieces = 4
+
+// ParseDownloadStrategy parses a strategy name. An empty name is rarest-first.
+func ParseDownloadStrategy(name string) (DownloadStrategy, error) {
+	switch s := DownloadStrategy(name); s {
+	case "":
+		return StrategyRarestFirst, nil
+	case StrategyRarestFirst, StrategySequential, StrategyFirstLast:
+		return s, nil
+	default:
+		return StrategyRarestFirst, errors.InvalidInputf("invalid download strategy: %s", name)
+	}
+}
+
+// Strategies is the download strategy of a torrent along with per-file
+// overrides keyed by file index.
+type Strategies struct {
+	Torrent DownloadStrategy
+	Files   map[int]DownloadStrategy
+}
+
+// forFile returns the strategy that applies to a file.
+func (s Strategies) forFile(index int) DownloadStrategy {
+	if strategy, ok := s.Files[index]; ok {
+		return strategy
+	}
+	if s.Torrent == "" {
+		return StrategyRarestFirst
+	}
+	return s.Torrent
+}
+
+// sequential reports whether any file downloads sequentially, which needs
+// priorities to follow the download as pieces complete.
+func (s Strategies) sequential() bool {
+	if s.Torrent == StrategySequential {
+		return true
+	}
+	for _, strategy := range s.Files {
+		if strategy == StrategySequential {
+			return true
+		}
+	}
+	return false
+}
+
+// strategyState tracks the strategies of a torrent and the piece priorities
+// raised to carry them out.
+type strategyState struct {
+	strategies Strategies
+	raised     map[int]torrent.PiecePriority
+	stop       chan struct{}
+}
+
+// SetDownloadStrategies records the strategies of a torrent so they apply
+// when it is added.
+func (c *Client) SetDownloadStrategies(infoHash string, strategies Strategies) error {
+	if len(infoHash) != 40 {
+		return errors.InvalidInputf("invalid info hash length: %d (expected 40)", len(infoHash))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.strategyState(metainfo.NewHashFromHex(infoHash)).strategies = strategies
+	return nil
+}
+
+// ClearDownloadStrategies forgets the strategies recorded for a torrent
+// that could not be added.
+func (c *Client) ClearDownloadStrategies(infoHash string) {
+	c.dropStrategies(metainfo.NewHashFromHex(infoHash))
+}
+
+// strategyState returns the strategy state of a torrent, creating it if
+// needed. The caller must hold c.mu.
+func (c *Client) strategyState(ih metainfo.Hash) *strategyState {
+	state, ok := c.strategies[ih]
+	if !ok {
+		state = &strategyState{raised: make(map[int]torrent.PiecePriority)}
+		c.strategies[ih] = state
+	}
+	return state
+}
+
+// applyStrategies puts a torrent's strategies into effect and, for
+// sequential downloads, starts following piece completion.
+func (c *Client) applyStrategies(t *torrent.Torrent) {
+	c.mu.Lock()
+	state := c.strategyState(t.InfoHash())
+	switch {
+	case state.strategies.sequential() && state.stop == nil:
+		state.stop = make(chan struct{})
+		go c.followPieces(t, state.stop)
+	case !state.strategies.sequential() && state.stop != nil:
+		close(state.stop)
+		state.stop = nil
+	}
+	c.mu.Unlock()
+
+	c.updatePiecePriorities(t)
+}
+
+// dropStrategies stops applying strategies to a removed torrent.
+func (c *Client) dropStrategies(ih metainfo.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.strategies[ih]; ok && state.stop != nil {
+		close(state.stop)
+	}
+	delete(c.strategies, ih)
+}
+
+// followPieces moves the sequential window forward as pieces complete.
+func (c *Client) followPieces(t *torrent.Torrent, stop <-chan struct{}) {
+	sub := t.SubscribePieceStateChanges()
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.Closed():
+			return
+		case change, ok := <-sub.Values:
+			if !ok {
+				return
+			}
+			if change.Complete {
+				c.updatePiecePriorities(t)
+			}
+		}
+	}
+}
+
+// updatePiecePriorities raises the priority of the pieces the torrent's
+// strategies want early and resets pieces that no longer need it.
+func (c *Client) updatePiecePriorities(t *torrent.Torrent) {
+	info := t.Info()
+	if info == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.strategies[t.InfoHash()]
+	if !ok {
+		return
+	}
+
+	window := max(minSequentialPieces, int(sequentialWindow/max(info.PieceLength, 1)))
+	wanted := make(map[int]torrent.PiecePriority)
+	for i, f := range t.Files() {
+		begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+		if f.Priority() == torrent.PiecePriorityNone || begin >= end {
+			continue
+		}
+
+		switch state.strategies.forFile(i) {
+		case StrategyFirstLast:
+			for _, p := range []int{begin, end - 1} {
+				if !t.PieceState(p).Complete {
+					wanted[p] = torrent.PiecePriorityNext
+				}
+			}
+		case StrategySequential:
+			for p, n := begin, 0; p < end && n < window; p++ {
+				if !t.PieceState(p).Complete {
+					wanted[p] = torrent.PiecePriorityNext
+					n++
+				}
+			}
+		}
+	}
+
+	for p := range state.raised {
+		if _, ok := wanted[p]; !ok {
+			t.Piece(p).SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+	for p, priority := range wanted {
+		if state.raised[p] != priority {
+			t.Piece(p).SetPriority(priority)
+		}
+	}
+	state.raised = wanted
+}
+
+// SetStrategies sets the download strategies of the torrent.
+func (t *Torrent) SetStrategies(strategies Strategies) error {
+	if t.torrent.Info() == nil {
+		return errors.InvalidInputf("torrent %s has no metadata yet", t.InfoHash())
+	}
+
+	numFiles := len(t.torrent.Files())
+	for index := range strategies.Files {
+		if index < 0 || index >= numFiles {
+			return errors.InvalidInputf("file index %d out of range", index)
+		}
+	}
+
+	t.client.mu.Lock()
+	t.client.strategyState(t.torrent.InfoHash()).strategies = strategies
+	t.client.mu.Unlock()
+
+	t.client.applyStrategies(t.torrent)
+	return nil
+}
+
+// Strategies returns the download strategies of the torrent.
+func (t *Torrent) Strategies() Strategies {
+	t.client.mu.Lock()
+	defer t.client.mu.Unlock()
+
+	state, ok := t.client.strategies[t.torrent.InfoHash()]
+	if !ok {
+		return Strategies{Torrent: StrategyRarestFirst}
+	}
+
+	strategies := Strategies{Torrent: state.strategies.Torrent}
+	if strategies.Torrent == "" {
+		strategies.Torrent = StrategyRarestFirst
+	}
+	if len(state.strategies.Files) > 0 {
+		strategies.Files = make(map[int]DownloadStrategy, len(state.strategies.Files))
+		for index, strategy := range state.strategies.Files {
+			strategies.Files[index] = strategy
+		}
+	}
+	return strategies
+}
@@ -0,0 +1,177 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+)
+
+// createMultiPieceTorrent creates a single-file torrent with the given number
+// of 16KB pieces.
+func createMultiPieceTorrent(t *testing.T, pieces int) []byte {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(src, bytes.Repeat([]byte("m"), pieces*16384), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info := metainfo.Info{PieceLength: 16384}
+	if err := info.BuildFromFilePath(src); err != nil {
+		t.Fatalf("failed to build info: %v", err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// piecePriorities returns the current priority of every piece once the
+// initial piece check is done, since pieces being hashed have no priority.
+func piecePriorities(t *testing.T, torr *Torrent) []torrent.PiecePriority {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 0; i < torr.torrent.NumPieces(); i++ {
+		for torr.torrent.PieceState(i).Checking {
+			if time.Now().After(deadline) {
+				t.Fatalf("piece %d is still being checked", i)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	priorities := make([]torrent.PiecePriority, torr.torrent.NumPieces())
+	for i := range priorities {
+		priorities[i] = torr.torrent.PieceState(i).Priority
+	}
+	return priorities
+}
+
+func TestDownloadStrategies(t *testing.T) {
+	cfg := &config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}
+	client, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	data := createMultiPieceTorrent(t, 8)
+	torr, err := client.AddTorrent(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	if got := torr.Strategies().Torrent; got != StrategyRarestFirst {
+		t.Errorf("expected rarest_first by default, got %s", got)
+	}
+	for i, p := range piecePriorities(t, torr) {
+		if p != torrent.PiecePriorityHigh {
+			t.Errorf("rarest_first: piece %d has priority %d", i, p)
+		}
+	}
+
+	if err := torr.SetStrategies(Strategies{Torrent: StrategyFirstLast}); err != nil {
+		t.Fatalf("failed to set first_last: %v", err)
+	}
+	for i, p := range piecePriorities(t, torr) {
+		want := torrent.PiecePriorityHigh
+		if i == 0 || i == 7 {
+			want = torrent.PiecePriorityNext
+		}
+		if p != want {
+			t.Errorf("first_last: piece %d has priority %d, want %d", i, p, want)
+		}
+	}
+
+	if err := torr.SetStrategies(Strategies{Files: map[int]DownloadStrategy{0: StrategySequential}}); err != nil {
+		t.Fatalf("failed to set sequential file: %v", err)
+	}
+	for i, p := range piecePriorities(t, torr) {
+		if p != torrent.PiecePriorityNext {
+			t.Errorf("sequential: piece %d has priority %d", i, p)
+		}
+	}
+
+	// Skipped files are left alone.
+	if err := torr.SetFilePriority(0, PrioritySkip); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range piecePriorities(t, torr) {
+		if p != torrent.PiecePriorityNone {
+			t.Errorf("skipped: piece %d has priority %d", i, p)
+		}
+	}
+	if err := torr.SetFilePriority(0, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := torr.SetStrategies(Strategies{Files: map[int]DownloadStrategy{1: StrategySequential}}); err == nil {
+		t.Error("expected error for out of range file index")
+	}
+
+	if err := torr.SetStrategies(Strategies{Torrent: StrategyRarestFirst}); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range piecePriorities(t, torr) {
+		if p != torrent.PiecePriorityHigh {
+			t.Errorf("reset: piece %d has priority %d", i, p)
+		}
+	}
+
+	// Strategies recorded before the torrent is added apply on add.
+	if err := torr.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetDownloadStrategies(torr.InfoHash(), Strategies{Torrent: StrategyFirstLast}); err != nil {
+		t.Fatal(err)
+	}
+	torr, err = client.AddTorrent(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to re-add torrent: %v", err)
+	}
+	if got := torr.Strategies().Torrent; got != StrategyFirstLast {
+		t.Errorf("expected restored first_last, got %s", got)
+	}
+	if p := piecePriorities(t, torr)[7]; p != torrent.PiecePriorityNext {
+		t.Errorf("expected last piece to be raised, got %d", p)
+	}
+}
+
+func TestParseDownloadStrategy(t *testing.T) {
+	tests := map[string]DownloadStrategy{
+		"":             StrategyRarestFirst,
+		"rarest_first": StrategyRarestFirst,
+		"sequential":   StrategySequential,
+		"first_last":   StrategyFirstLast,
+	}
+	for name, want := range tests {
+		got, err := ParseDownloadStrategy(name)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("expected %s for %q, got %s", want, name, got)
+		}
+	}
+
+	if _, err := ParseDownloadStrategy("random"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
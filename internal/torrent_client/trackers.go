@@ -0,0 +1,406 @@
+package torrentclient
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/tracker"
+)
+
+// TrackerStatus is the announce state of a tracker.
+type TrackerStatus string
+
+const (
+	// TrackerNotContacted means the tracker has not been announced to yet.
+	TrackerNotContacted TrackerStatus = "not_contacted"
+	// TrackerUpdating means an announce is in progress.
+	TrackerUpdating TrackerStatus = "updating"
+	// TrackerWorking means the last announce succeeded.
+	TrackerWorking TrackerStatus = "working"
+	// TrackerNotWorking means the last announce failed.
+	TrackerNotWorking TrackerStatus = "not_working"
+	// TrackerDisabled means the tracker is not announced to, because the
+	// torrent is stopped or the tracker's scheme is not supported.
+	TrackerDisabled TrackerStatus = "disabled"
+)
+
+const (
+	// trackerTimeout bounds a single announce or scrape.
+	trackerTimeout = 30 * time.Second
+	// stoppedTimeout bounds the announce sent when leaving the swarm, which
+	// nothing waits on the answer of.
+	stoppedTimeout = 5 * time.Second
+	// defaultAnnounceInterval is used when a tracker does not send one.
+	defaultAnnounceInterval = 30 * time.Minute
+	// minRetryInterval is the wait after the first failed announce. It
+	// doubles with every further failure, up to defaultAnnounceInterval.
+	minRetryInterval = 30 * time.Second
+)
+
+// TrackerState describes a tracker of a torrent and its last announce.
+type TrackerState struct {
+	URL          string
+	Tier         int
+	Status       TrackerStatus
+	LastAnnounce time.Time
+	NextAnnounce time.Time
+	LastError    string
+	// Message is the warning sent with the last successful announce.
+	Message string
+	// Seeders, Leechers and Completed are the swarm counts from the last
+	// announce or scrape.
+	Seeders   int
+	Leechers  int
+	Completed int
+	// Peers is the number of peers returned by the last announce.
+	Peers int
+}
+
+// trackerAnnouncer announces a torrent to a single tracker until closed.
+// anacrolix keeps its announce state private, so the client announces
+// itself and every tracker of every tier is announced to.
+type trackerAnnouncer struct {
+	client  *Client
+	torrent *torrent.Torrent
+	kick    chan struct{}
+	exited  chan struct{}
+	// ctx is canceled when the announcer is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// key identifies this client to the tracker if its address changes.
+	key uint32
+	// trackerID is the tracker id from the last announce, sent back with
+	// later ones.
+	trackerID string
+
+	mu    sync.Mutex
+	state TrackerState
+}
+
+// startTrackers starts announcing a newly added torrent to its trackers. It
+// does nothing if the torrent is already announced.
+func (c *Client) startTrackers(t *torrent.Torrent) {
+	c.mu.Lock()
+	_, running := c.trackers[t.InfoHash()]
+	c.mu.Unlock()
+	if running {
+		return
+	}
+
+	var announcers []*trackerAnnouncer
+	for tier, urls := range t.Metainfo().AnnounceList {
+		for _, u := range urls {
+			ctx, cancel := context.WithCancel(context.Background())
+			a := &trackerAnnouncer{
+				client:  c,
+				torrent: t,
+				kick:    make(chan struct{}, 1),
+				exited:  make(chan struct{}),
+				ctx:     ctx,
+				cancel:  cancel,
+				key:     rand.Uint32(),
+				state:   TrackerState{URL: u, Tier: tier, Status: TrackerNotContacted},
+			}
+			if !tracker.Supported(u) {
+				a.state.Status = TrackerDisabled
+				a.state.LastError = "unsupported tracker scheme"
+				close(a.exited)
+			} else {
+				go a.run()
+			}
+			announcers = append(announcers, a)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, running := c.trackers[t.InfoHash()]; running {
+		for _, a := range announcers {
+			a.close()
+		}
+		return
+	}
+	c.trackers[t.InfoHash()] = announcers
+}
+
+// stopTrackers stops announcing a torrent. The trackers it was announced to
+// are sent a stopped event in the background.
+func (c *Client) stopTrackers(ih metainfo.Hash) {
+	c.mu.Lock()
+	announcers := c.trackers[ih]
+	delete(c.trackers, ih)
+	c.mu.Unlock()
+
+	for _, a := range announcers {
+		a.close()
+	}
+}
+
+// stopAllTrackers stops announcing every torrent and waits for the stopped
+// events to be sent.
+func (c *Client) stopAllTrackers() {
+	c.mu.Lock()
+	all := c.trackers
+	c.trackers = make(map[metainfo.Hash][]*trackerAnnouncer)
+	c.mu.Unlock()
+
+	for _, announcers := range all {
+		for _, a := range announcers {
+			a.close()
+		}
+	}
+	for _, announcers := range all {
+		for _, a := range announcers {
+			<-a.exited
+		}
+	}
+}
+
+// kickTrackers makes every tracker of a torrent announce now.
+func (c *Client) kickTrackers(ih metainfo.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, a := range c.trackers[ih] {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *trackerAnnouncer) run() {
+	defer close(a.exited)
+
+	ih := a.torrent.InfoHash()
+	announced := false
+	completeSent := false
+	failures := 0
+
+	for {
+		var wait <-chan time.Time
+		held := a.client.isHeld(ih)
+		if held || a.client.isStopped(ih) {
+			// Nothing may be sent while the kill switch holds the torrent,
+			// which is announced afresh when released.
+			if announced && !held {
+				_, _ = a.announce(tracker.EventStopped)
+			}
+			announced = false
+			a.mu.Lock()
+			a.state.Status = TrackerDisabled
+			a.state.NextAnnounce = time.Time{}
+			a.mu.Unlock()
+		} else {
+			complete := a.torrent.Info() != nil && a.torrent.BytesMissing() == 0
+			event := tracker.EventNone
+			switch {
+			case !announced:
+				event = tracker.EventStarted
+			case complete && !completeSent:
+				event = tracker.EventCompleted
+			}
+
+			interval, err := a.announce(event)
+			if err != nil {
+				failures++
+				interval = min(minRetryInterval<<min(failures-1, 6), defaultAnnounceInterval)
+			} else {
+				failures = 0
+				announced = true
+				// A torrent that is already complete when started has no
+				// completion to report.
+				completeSent = completeSent || complete
+			}
+
+			a.mu.Lock()
+			a.state.NextAnnounce = time.Now().Add(interval)
+			a.mu.Unlock()
+			wait = time.After(interval)
+		}
+
+		var completed <-chan struct{}
+		if announced && !completeSent && failures == 0 {
+			completed = a.torrent.Complete().On()
+		}
+
+		select {
+		case <-wait:
+		case <-a.kick:
+		case <-completed:
+		case <-a.ctx.Done():
+			if announced {
+				_, _ = a.announce(tracker.EventStopped)
+			}
+			return
+		}
+	}
+}
+
+// announce sends an announce to the tracker, adds the returned peers to the
+// torrent and records the result. It returns the interval until the next
+// regular announce.
+func (a *trackerAnnouncer) announce(event tracker.Event) (time.Duration, error) {
+	a.setStatus(TrackerUpdating)
+
+	stats := a.torrent.Stats()
+	left := int64(-1)
+	if a.torrent.Info() != nil {
+		left = a.torrent.BytesMissing()
+	}
+	numWant := int32(-1)
+	if event == tracker.EventStopped {
+		numWant = 0
+	}
+
+	// The stopped event is sent after the announcer is closed, so it cannot
+	// use the announcer's context.
+	parent, timeout := a.ctx, trackerTimeout
+	if event == tracker.EventStopped {
+		parent, timeout = context.Background(), stoppedTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	res, err := a.client.trackerClient.Announce(ctx, a.state.URL, tracker.AnnounceRequest{
+		InfoHash:   a.torrent.InfoHash(),
+		PeerID:     a.client.torrentClient().PeerID(),
+		Port:       a.client.announcePort(),
+		Uploaded:   stats.BytesWrittenData.Int64(),
+		Downloaded: stats.BytesReadUsefulData.Int64(),
+		Left:       left,
+		Event:      event,
+		NumWant:    numWant,
+		Key:        a.key,
+		TrackerID:  a.trackerID,
+	})
+	if err != nil {
+		a.mu.Lock()
+		a.state.LastAnnounce = time.Now()
+		a.state.Status = TrackerNotWorking
+		a.state.LastError = err.Error()
+		a.mu.Unlock()
+		a.client.logger.Debug("tracker announce failed",
+			logger.String("url", a.state.URL),
+			logger.Err(err),
+		)
+		return 0, err
+	}
+	if res.TrackerID != "" {
+		a.trackerID = res.TrackerID
+	}
+
+	completed, scraped := 0, false
+	if event != tracker.EventStopped {
+		a.addPeers(res.Peers)
+		completed, scraped = a.scrape(ctx)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.state.LastAnnounce = time.Now()
+	a.state.Status = TrackerWorking
+	a.state.LastError = ""
+	a.state.Message = res.Warning
+	a.state.Seeders = res.Seeders
+	a.state.Leechers = res.Leechers
+	a.state.Peers = len(res.Peers)
+	if scraped {
+		a.state.Completed = completed
+	}
+
+	interval := max(res.Interval, res.MinInterval)
+	if interval <= 0 {
+		interval = defaultAnnounceInterval
+	}
+	return interval, nil
+}
+
+// addPeers adds peers returned by the tracker to the torrent.
+func (a *trackerAnnouncer) addPeers(peers []tracker.Peer) {
+	infos := make([]torrent.PeerInfo, len(peers))
+	for i, p := range peers {
+		infos[i] = torrent.PeerInfo{
+			Addr:   torrent.StringAddr(p.Addr.String()),
+			Source: torrent.PeerSourceTracker,
+		}
+		copy(infos[i].Id[:], p.ID)
+	}
+	a.torrent.AddPeers(infos)
+}
+
+// scrape asks the tracker how many peers have completed the torrent. Many
+// trackers do not support scraping, so failures are not reported.
+func (a *trackerAnnouncer) scrape(ctx context.Context) (int, bool) {
+	ih := a.torrent.InfoHash()
+	res, err := a.client.trackerClient.Scrape(ctx, a.state.URL, ih)
+	if err != nil {
+		return 0, false
+	}
+	r, ok := res[ih]
+	return r.Completed, ok
+}
+
+func (a *trackerAnnouncer) setStatus(status TrackerStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.state.Status = status
+}
+
+func (a *trackerAnnouncer) snapshot() TrackerState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.state
+}
+
+// close stops the announcer, canceling any announce in progress.
+func (a *trackerAnnouncer) close() {
+	a.cancel()
+}
+
+// Trackers returns the state of every tracker of the torrent.
+func (t *Torrent) Trackers() []TrackerState {
+	t.client.mu.Lock()
+	announcers := t.client.trackers[t.torrent.InfoHash()]
+	t.client.mu.Unlock()
+
+	states := make([]TrackerState, len(announcers))
+	for i, a := range announcers {
+		states[i] = a.snapshot()
+	}
+	return states
+}
+
+// Swarm returns the largest seeder and leecher counts reported by the
+// torrent's working trackers.
+func (t *Torrent) Swarm() (seeders, leechers int) {
+	for _, s := range t.Trackers() {
+		if s.Status != TrackerWorking {
+			continue
+		}
+		seeders = max(seeders, s.Seeders)
+		leechers = max(leechers, s.Leechers)
+	}
+	return seeders, leechers
+}
+
+// Reannounce makes the torrent announce to all its trackers now.
+func (t *Torrent) Reannounce() error {
+	if t.client.isStopped(t.torrent.InfoHash()) {
+		return errors.Conflict("torrent is stopped")
+	}
+	if t.client.isHeld(t.torrent.InfoHash()) {
+		return errors.Conflict("torrent is paused by the VPN kill switch")
+	}
+	t.client.kickTrackers(t.torrent.InfoHash())
+	return nil
+}
@@ -0,0 +1,190 @@
+package torrentclient
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/tracker"
+)
+
+// fakeTracker is an in-process HTTP tracker that records announce events.
+type fakeTracker struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (ft *fakeTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/announce":
+		ft.mu.Lock()
+		ft.events = append(ft.events, r.URL.Query().Get("event"))
+		ft.mu.Unlock()
+
+		_ = bencode.NewEncoder(w).Encode(map[string]interface{}{
+			"interval":   1800,
+			"complete":   3,
+			"incomplete": 2,
+			"peers":      "",
+		})
+	case "/scrape":
+		ih := r.URL.Query().Get("info_hash")
+		_ = bencode.NewEncoder(w).Encode(map[string]interface{}{
+			"files": map[string]interface{}{
+				ih: map[string]int{"complete": 3, "downloaded": 7, "incomplete": 2},
+			},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ft *fakeTracker) announces() []string {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	return append([]string(nil), ft.events...)
+}
+
+// createTrackerTorrent creates a torrent announcing to the given trackers,
+// one tier each.
+func createTrackerTorrent(t *testing.T, trackers ...string) []byte {
+	t.Helper()
+
+	mi, err := metainfo.Load(bytes.NewReader(createMultiPieceTorrent(t, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range trackers {
+		mi.AnnounceList = append(mi.AnnounceList, []string{tr})
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// waitTracker waits until the tracker at index i reaches the given status.
+func waitTracker(t *testing.T, torr *Torrent, i int, status TrackerStatus) TrackerState {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		states := torr.Trackers()
+		if i < len(states) && states[i].Status == status {
+			return states[i]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tracker %d did not become %s: %+v", i, status, states)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTrackers(t *testing.T) {
+	ft := &fakeTracker{}
+	srv := httptest.NewServer(ft)
+	defer srv.Close()
+
+	client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	data := createTrackerTorrent(t, srv.URL+"/announce", "wss://tracker.example.com/announce")
+	torr, err := client.AddTorrent(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	state := waitTracker(t, torr, 0, TrackerWorking)
+	if state.Tier != 0 || state.Seeders != 3 || state.Leechers != 2 || state.Completed != 7 {
+		t.Errorf("unexpected tracker state: %+v", state)
+	}
+	if state.LastAnnounce.IsZero() || time.Until(state.NextAnnounce) < 29*time.Minute {
+		t.Errorf("unexpected announce times: last %v, next %v", state.LastAnnounce, state.NextAnnounce)
+	}
+
+	unsupported := torr.Trackers()[1]
+	if unsupported.Tier != 1 || unsupported.Status != TrackerDisabled {
+		t.Errorf("expected unsupported tracker to be disabled: %+v", unsupported)
+	}
+
+	if seeders, leechers := torr.Swarm(); seeders != 3 || leechers != 2 {
+		t.Errorf("expected swarm 3/2, got %d/%d", seeders, leechers)
+	}
+
+	t.Run("reannounce", func(t *testing.T) {
+		before := len(ft.announces())
+		if err := torr.Reannounce(); err != nil {
+			t.Fatalf("failed to reannounce: %v", err)
+		}
+
+		deadline := time.Now().Add(10 * time.Second)
+		for len(ft.announces()) <= before {
+			if time.Now().After(deadline) {
+				t.Fatal("reannounce did not reach the tracker")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		torr.Stop()
+		waitTracker(t, torr, 0, TrackerDisabled)
+
+		events := ft.announces()
+		if events[0] != "started" || events[len(events)-1] != "stopped" {
+			t.Errorf("unexpected announce events: %v", events)
+		}
+
+		if err := torr.Reannounce(); !errors.IsConflict(err) {
+			t.Errorf("expected conflict for a stopped torrent, got %v", err)
+		}
+	})
+}
+
+func TestAddMagnet_Tracker(t *testing.T) {
+	ts := tracker.NewServer("secret", time.Minute, time.Hour, func([20]byte) bool { return true })
+	srv := httptest.NewServer(http.HandlerFunc(ts.ServeAnnounce))
+	defer srv.Close()
+	announceURL := srv.URL + "/announce?passkey=secret"
+
+	// Without DHT and LSD, the tracker is the only way to the seeder
+	noDiscovery := func() *config.ProtocolConfig {
+		return &config.ProtocolConfig{DisableDHT: true, DisableLSD: true}
+	}
+	data := createTrackerTorrent(t, announceURL)
+	seed(t, &config.Config{Protocols: noDiscovery()}, data)
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leecher, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: noDiscovery()}, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer leecher.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	magnet := "magnet:?xt=urn:btih:" + mi.HashInfoBytes().HexString() + "&tr=" + url.QueryEscape(announceURL)
+	torr, err := leecher.AddMagnet(ctx, magnet)
+	if err != nil {
+		t.Fatalf("failed to add magnet: %v", err)
+	}
+	waitComplete(t, torr)
+}
@@ -0,0 +1,288 @@
+package torrentclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+)
+
+// bindingCheckInterval is how often the addresses of the VPN interface are
+// looked up to re-bind sockets.
+const bindingCheckInterval = 5 * time.Second
+
+// vpnBinding is the sockets bound to the VPN interface.
+type vpnBinding struct {
+	binding  *network.Binding
+	listener *network.Listener
+	dhtConn  *network.PacketConn
+	// closeDHT stops the DHT server on dhtConn.
+	closeDHT func()
+	// stop ends re-binding.
+	stop func()
+}
+
+// configureBinding prepares the torrent client configuration for binding to
+// the VPN interface. The built-in sockets, which cannot be moved to new
+// addresses, are replaced by bound ones once the client exists; uTP has no
+// replacement and is turned off. It returns nil if VPN binding is disabled.
+func configureBinding(cfg *config.Config, clientConfig *torrent.ClientConfig) *network.Binding {
+	if cfg.VPN == nil || !cfg.VPN.Enabled {
+		return nil
+	}
+	binding := network.NewBinding(cfg.VPN.InterfaceName)
+	binding.Refresh()
+
+	clientConfig.DisableTCP = true
+	clientConfig.DisableUTP = true
+	clientConfig.NoDHT = true
+	clientConfig.HTTPDialContext = binding.DialContext
+	return binding
+}
+
+// startBinding binds peer connections, trackers, the DHT and HTTP downloads
+// to the VPN interface, and starts re-binding when the interface addresses
+// change.
+func (c *Client) startBinding(cl *torrent.Client, binding *network.Binding, port int) {
+	// Traffic the proxy carries, or refuses with ProxyOnly, is left to it
+	p := c.config.Proxy
+	proxyPeers := p.Enabled() && p.Peers
+	proxyDHT := p.Enabled() && (p.DHT || p.ProxyOnly)
+	proxyTrackers := p.Enabled() && (p.Trackers || p.ProxyOnly)
+
+	vb := &vpnBinding{binding: binding, closeDHT: func() {}, stop: func() {}}
+	c.binding = vb
+
+	// Bound peer sockets are TCP only
+	if !proxyPeers && c.protocols.TCP() {
+		l, err := binding.Listen(port)
+		if err != nil {
+			c.logger.Warn("failed to listen on the VPN interface", logger.Err(err))
+		}
+		vb.listener = l
+		cl.AddListener(l)
+		port = l.Port()
+		cl.AddDialer(boundPeerDialer{binding})
+	}
+
+	if !proxyDHT && c.protocols.DHT() {
+		if err := c.startBoundDHT(cl, vb, port); err != nil {
+			c.logger.Warn("DHT disabled", logger.Err(err))
+		}
+	}
+
+	if !proxyTrackers {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = binding.DialContext
+		c.trackerClient.HTTPClient = &http.Client{Transport: transport}
+		c.trackerClient.DialUDP = binding.DialUDP
+	}
+
+	if !p.Enabled() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = binding.DialContext
+		c.blocklist.HTTPClient.Transport = transport
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	vb.stop = func() {
+		cancel()
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(bindingCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if binding.Refresh() {
+					c.rebind(vb)
+				}
+			}
+		}
+	}()
+
+	c.logger.Info("sockets bound to VPN interface",
+		logger.String("interface", binding.InterfaceName()),
+		logger.String("addresses", strings.Join(vb.addrs(), ", ")),
+	)
+}
+
+// startBoundDHT runs the DHT on a socket bound to the VPN interface.
+func (c *Client) startBoundDHT(cl *torrent.Client, vb *vpnBinding, port int) error {
+	pc, err := vb.binding.ListenPacket(port)
+	if err != nil {
+		c.logger.Warn("failed to bind DHT socket", logger.Err(err))
+	}
+	s, err := cl.NewAnacrolixDhtServer(pc)
+	if err != nil {
+		_ = pc.Close()
+		return errors.InternalWithError("failed to start DHT", err)
+	}
+	cl.AddDhtServer(torrent.AnacrolixDhtServerWrapper{Server: s})
+	vb.dhtConn = pc
+	vb.closeDHT = func() { s.Close() }
+	return nil
+}
+
+// rebind moves the bound sockets to the current addresses of the VPN
+// interface.
+func (c *Client) rebind(vb *vpnBinding) {
+	if vb.listener != nil {
+		if err := vb.listener.Rebind(); err != nil {
+			c.logger.Warn("failed to re-bind peer listener", logger.Err(err))
+		}
+	}
+	if vb.dhtConn != nil {
+		if err := vb.dhtConn.Rebind(); err != nil {
+			c.logger.Warn("failed to re-bind DHT socket", logger.Err(err))
+		}
+	}
+	c.logger.Info("VPN interface addresses changed",
+		logger.String("interface", vb.binding.InterfaceName()),
+		logger.String("addresses", strings.Join(vb.addrs(), ", ")),
+	)
+}
+
+// newMonitor creates a network monitor for a VPN configuration.
+func (c *Client) newMonitor(cfg *network.VPNConfig) *network.Monitor {
+	return network.NewNetworkMonitorWithProviders(cfg, c.interfaces, c.routes)
+}
+
+// SetVPNConfig applies a VPN configuration while running. It is rejected
+// unless it is valid and, with VPN binding enabled, the interface exists.
+// The network monitor is replaced and the kill switch follows the new one.
+// Bound sockets move to the new interface, or to every address if binding
+// is disabled; a client created without VPN binding keeps its sockets
+// unbound until it is restarted, as reported by BindingPending.
+func (c *Client) SetVPNConfig(cfg *network.VPNConfig) error {
+	if err := cfg.CheckInterface(c.interfaces); err != nil {
+		return err
+	}
+
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	if cfg.Enabled {
+		c.startMonitor(c.newMonitor(cfg))
+	} else {
+		c.stopMonitor()
+	}
+
+	c.clientMu.RLock()
+	vb := c.binding
+	c.clientMu.RUnlock()
+	if vb != nil {
+		name := ""
+		if cfg.Enabled {
+			name = cfg.InterfaceName
+		}
+		if name != vb.binding.InterfaceName() {
+			vb.binding.SetInterface(name)
+			c.rebind(vb)
+		}
+	}
+
+	c.logger.Info("VPN configuration applied",
+		logger.Bool("enabled", cfg.Enabled),
+		logger.String("interface", cfg.InterfaceName),
+		logger.Bool("kill_switch", cfg.KillSwitch),
+		logger.Bool("binding_pending", c.BindingPending()),
+	)
+	return nil
+}
+
+// BindingPending reports whether VPN binding was enabled after the client
+// was created without it. Its sockets, which cannot be moved, are bound to
+// the interface once the client is restarted; the kill switch already
+// applies.
+func (c *Client) BindingPending() bool {
+	c.clientMu.RLock()
+	vb := c.binding
+	c.clientMu.RUnlock()
+
+	return vb == nil && c.GetNetworkMonitor() != nil
+}
+
+// closeBinding stops re-binding and closes the bound sockets. The caller
+// must hold clientMu.
+func (c *Client) closeBinding() {
+	vb := c.binding
+	if vb == nil {
+		return
+	}
+	vb.stop()
+	vb.closeDHT()
+	if vb.dhtConn != nil {
+		_ = vb.dhtConn.Close()
+	}
+	if vb.listener != nil {
+		_ = vb.listener.Close()
+	}
+}
+
+// BoundAddrs returns the addresses torrent traffic is bound to: the peer
+// listeners and DHT socket with their ports, or the interface addresses if
+// those sockets are not bound. It returns nil without VPN binding.
+func (c *Client) BoundAddrs() []string {
+	c.clientMu.RLock()
+	vb := c.binding
+	c.clientMu.RUnlock()
+
+	if vb == nil {
+		return nil
+	}
+	return vb.addrs()
+}
+
+// addrs returns the addresses of the bound sockets, or nil if they are
+// unbound.
+func (vb *vpnBinding) addrs() []string {
+	if vb.binding.InterfaceName() == "" {
+		return nil
+	}
+
+	addrs := []string{}
+	if vb.listener != nil {
+		for _, a := range vb.listener.Addrs() {
+			addrs = append(addrs, "tcp/"+a.String())
+		}
+	}
+	if vb.dhtConn != nil {
+		if a, ok := vb.dhtConn.LocalAddr().(*net.UDPAddr); ok && !a.IP.IsUnspecified() {
+			addrs = append(addrs, "udp/"+a.String())
+		}
+	}
+	if vb.listener == nil && vb.dhtConn == nil {
+		for _, ip := range vb.binding.Addrs() {
+			addrs = append(addrs, ip.String())
+		}
+	}
+	return addrs
+}
+
+// boundPeerDialer connects to peers from the VPN interface.
+type boundPeerDialer struct {
+	binding *network.Binding
+}
+
+func (d boundPeerDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return d.binding.DialContext(ctx, "tcp", addr)
+}
+
+func (d boundPeerDialer) DialerNetwork() string {
+	return "tcp"
+}
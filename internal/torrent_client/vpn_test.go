@@ -0,0 +1,191 @@
+package torrentclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+)
+
+// loopbackInterface returns the name of the loopback interface.
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestVPNBinding(t *testing.T) {
+	t.Run("BoundAddrs", func(t *testing.T) {
+		// The DHT socket is bound as well. The client has no torrents:
+		// announcing races the DHT's routing table maintenance in
+		// anacrolix/dht.
+		cfg := &config.Config{
+			DownloadDir: t.TempDir(),
+			VPN:         &network.VPNConfig{Enabled: true, InterfaceName: loopbackInterface(t)},
+			DHT:         &config.DHTConfig{DisablePublicBootstrap: true},
+		}
+		client, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer client.Close()
+
+		port := client.client.LocalPort()
+		if port == 0 {
+			t.Fatal("expected a peer listener on the VPN interface")
+		}
+		bound := client.BoundAddrs()
+		for _, want := range []string{fmt.Sprintf("tcp/127.0.0.1:%d", port), fmt.Sprintf("udp/127.0.0.1:%d", port)} {
+			if !slices.Contains(bound, want) {
+				t.Errorf("bound addresses %v do not include %s", bound, want)
+			}
+		}
+		for _, a := range bound {
+			if strings.Contains(a, "0.0.0.0") || strings.Contains(a, "[::]") {
+				t.Errorf("socket bound to all interfaces: %s", a)
+			}
+		}
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		seeder, data := newSeeder(t, 4)
+		addr := fmt.Sprintf("127.0.0.1:%d", seeder.client.LocalPort())
+
+		cfg := &config.Config{
+			DownloadDir: t.TempDir(),
+			VPN:         &network.VPNConfig{Enabled: true, InterfaceName: loopbackInterface(t)},
+			Protocols:   &config.ProtocolConfig{DisableDHT: true},
+		}
+		leecher, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer leecher.Close()
+
+		torr, err := leecher.AddTorrent(context.Background(), data)
+		if err != nil {
+			t.Fatalf("failed to add torrent: %v", err)
+		}
+		if _, err := torr.AddPeers([]string{addr}); err != nil {
+			t.Fatalf("failed to add peer: %v", err)
+		}
+		waitComplete(t, torr)
+	})
+}
+
+func TestVPNBinding_InterfaceMissing(t *testing.T) {
+	cfg := &config.Config{
+		DownloadDir: t.TempDir(),
+		VPN:         &network.VPNConfig{Enabled: true, InterfaceName: "nonexistent-vpn"},
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	client, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if addrs := client.BoundAddrs(); len(addrs) != 0 {
+		t.Errorf("expected nothing bound without the interface, got %v", addrs)
+	}
+	if _, err := client.trackerClient.DialUDP(context.Background(), "127.0.0.1:6969"); err == nil {
+		t.Error("expected tracker traffic to be refused without the interface")
+	}
+}
+
+func TestClient_SetVPNConfig(t *testing.T) {
+	loopback := loopbackInterface(t)
+
+	t.Run("Bound", func(t *testing.T) {
+		cfg := &config.Config{
+			DownloadDir: t.TempDir(),
+			VPN:         &network.VPNConfig{Enabled: true, InterfaceName: loopback},
+			Protocols:   &config.ProtocolConfig{DisableDHT: true},
+		}
+		client, err := NewClient(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer client.Close()
+		monitor := client.GetNetworkMonitor()
+
+		// A missing interface is rejected and changes nothing
+		err = client.SetVPNConfig(&network.VPNConfig{Enabled: true, InterfaceName: "nonexistent-vpn"})
+		if !errors.IsInvalidInput(err) {
+			t.Errorf("expected a validation error, got %v", err)
+		}
+		if client.GetNetworkMonitor() != monitor || len(client.BoundAddrs()) == 0 {
+			t.Error("a rejected configuration was applied")
+		}
+
+		// Disabling unbinds the sockets and stops the monitor
+		if err := client.SetVPNConfig(&network.VPNConfig{Enabled: false, KillSwitch: true}); err != nil {
+			t.Fatalf("failed to disable VPN binding: %v", err)
+		}
+		if client.GetNetworkMonitor() != nil || client.BoundAddrs() != nil {
+			t.Errorf("expected no monitor and nothing bound, got %v", client.BoundAddrs())
+		}
+		port := client.client.LocalPort()
+		for _, a := range client.binding.listener.Addrs() {
+			if !a.Addr().IsUnspecified() || int(a.Port()) != port {
+				t.Errorf("expected to listen on every address at port %d, got %v", port, a)
+			}
+		}
+
+		// Enabling again binds the same sockets to the interface
+		if err := client.SetVPNConfig(&network.VPNConfig{Enabled: true, InterfaceName: loopback}); err != nil {
+			t.Fatalf("failed to enable VPN binding: %v", err)
+		}
+		if client.GetNetworkMonitor() == nil || client.BindingPending() {
+			t.Error("expected a monitor with the sockets bound")
+		}
+		if want := fmt.Sprintf("tcp/127.0.0.1:%d", port); !slices.Contains(client.BoundAddrs(), want) {
+			t.Errorf("bound addresses %v do not include %s", client.BoundAddrs(), want)
+		}
+	})
+
+	t.Run("EnabledWhileRunning", func(t *testing.T) {
+		client, err := NewClient(&config.Config{DownloadDir: t.TempDir(), Protocols: &config.ProtocolConfig{DisableDHT: true}}, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer client.Close()
+		vpn := &fakeInterfaces{name: "tun0", up: false}
+		client.interfaces = vpn
+
+		err = client.SetVPNConfig(&network.VPNConfig{Enabled: true, InterfaceName: "tun0", KillSwitch: true})
+		if err != nil {
+			t.Fatalf("failed to enable VPN binding: %v", err)
+		}
+		if !client.BindingPending() {
+			t.Error("expected binding to wait for a restart")
+		}
+		// The kill switch applies at once
+		if !client.KillSwitchEngaged() {
+			t.Error("expected the kill switch to engage while the interface is down")
+		}
+
+		if err := client.SetVPNConfig(&network.VPNConfig{Enabled: false}); err != nil {
+			t.Fatalf("failed to disable VPN binding: %v", err)
+		}
+		if client.KillSwitchEngaged() || client.BindingPending() {
+			t.Error("expected the kill switch to release once VPN binding is disabled")
+		}
+	})
+}
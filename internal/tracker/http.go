@@ -0,0 +1,272 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/zeebo/bencode"
+)
+
+// maxResponseSize bounds the body read from an HTTP tracker.
+const maxResponseSize = 4 << 20
+
+// httpAnnounceResponse is the bencoded answer of an HTTP tracker. Peers is
+// either a compact string or a list of dictionaries.
+type httpAnnounceResponse struct {
+	FailureReason  string             `bencode:"failure reason"`
+	WarningMessage string             `bencode:"warning message"`
+	Interval       int64              `bencode:"interval"`
+	MinInterval    int64              `bencode:"min interval"`
+	TrackerID      string             `bencode:"tracker id"`
+	Complete       int64              `bencode:"complete"`
+	Incomplete     int64              `bencode:"incomplete"`
+	Peers          bencode.RawMessage `bencode:"peers"`
+	Peers6         string             `bencode:"peers6"`
+}
+
+// httpPeer is a peer in the dictionary model.
+type httpPeer struct {
+	ID   string `bencode:"peer id"`
+	IP   string `bencode:"ip"`
+	Port int    `bencode:"port"`
+}
+
+// httpScrapeResponse is the bencoded answer of an HTTP scrape.
+type httpScrapeResponse struct {
+	FailureReason string                     `bencode:"failure reason"`
+	Files         map[string]httpScrapeEntry `bencode:"files"`
+}
+
+type httpScrapeEntry struct {
+	Complete   int64 `bencode:"complete"`
+	Downloaded int64 `bencode:"downloaded"`
+	Incomplete int64 `bencode:"incomplete"`
+}
+
+func (c *Client) announceHTTP(ctx context.Context, u *url.URL, req AnnounceRequest) (*AnnounceResponse, error) {
+	left := req.Left
+	if left < 0 {
+		left = math.MaxInt64
+	}
+
+	params := []string{
+		"info_hash=" + escapeBytes(req.InfoHash[:]),
+		"peer_id=" + escapeBytes(req.PeerID[:]),
+		"port=" + strconv.Itoa(int(req.Port)),
+		"uploaded=" + strconv.FormatInt(req.Uploaded, 10),
+		"downloaded=" + strconv.FormatInt(req.Downloaded, 10),
+		"left=" + strconv.FormatInt(left, 10),
+		"compact=1",
+		"key=" + fmt.Sprintf("%08X", req.Key),
+	}
+	if req.Event != EventNone {
+		params = append(params, "event="+req.Event.String())
+	}
+	if req.NumWant >= 0 {
+		params = append(params, "numwant="+strconv.Itoa(int(req.NumWant)))
+	}
+	if req.TrackerID != "" {
+		params = append(params, "trackerid="+url.QueryEscape(req.TrackerID))
+	}
+
+	body, err := c.getHTTP(ctx, withParams(u, params))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp httpAnnounceResponse
+	if err := bencode.DecodeBytes(body, &resp); err != nil {
+		return nil, errors.ParseError("invalid tracker response", err)
+	}
+	if resp.FailureReason != "" {
+		return nil, &FailureError{Reason: resp.FailureReason}
+	}
+
+	peers, err := parseHTTPPeers(resp.Peers)
+	if err != nil {
+		return nil, err
+	}
+	peers = append(peers, parseCompactPeers([]byte(resp.Peers6), 16)...)
+
+	return &AnnounceResponse{
+		Interval:    time.Duration(resp.Interval) * time.Second,
+		MinInterval: time.Duration(resp.MinInterval) * time.Second,
+		Seeders:     int(resp.Complete),
+		Leechers:    int(resp.Incomplete),
+		Peers:       peers,
+		Warning:     resp.WarningMessage,
+		TrackerID:   resp.TrackerID,
+	}, nil
+}
+
+func (c *Client) scrapeHTTP(ctx context.Context, u *url.URL, hashes [][20]byte) (map[[20]byte]ScrapeResult, error) {
+	scrapeURL, err := scrapeURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]string, len(hashes))
+	for i, h := range hashes {
+		params[i] = "info_hash=" + escapeBytes(h[:])
+	}
+
+	body, err := c.getHTTP(ctx, withParams(scrapeURL, params))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp httpScrapeResponse
+	if err := bencode.DecodeBytes(body, &resp); err != nil {
+		return nil, errors.ParseError("invalid tracker response", err)
+	}
+	if resp.FailureReason != "" {
+		return nil, &FailureError{Reason: resp.FailureReason}
+	}
+
+	results := make(map[[20]byte]ScrapeResult, len(hashes))
+	for _, h := range hashes {
+		if entry, ok := resp.Files[string(h[:])]; ok {
+			results[h] = ScrapeResult{
+				Seeders:   int(entry.Complete),
+				Leechers:  int(entry.Incomplete),
+				Completed: int(entry.Downloaded),
+			}
+		}
+	}
+	return results, nil
+}
+
+// getHTTP fetches a tracker URL. The body of an error status is returned
+// too if it carries a failure reason, since trackers send those with 4xx
+// statuses.
+func (c *Client) getHTTP(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid tracker URL %q", u)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.NetworkError("tracker request failed", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, errors.NetworkError("failed to read tracker response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Reason string `bencode:"failure reason"`
+		}
+		if bencode.DecodeBytes(body, &failure) == nil && failure.Reason != "" {
+			return nil, &FailureError{Reason: failure.Reason}
+		}
+		return nil, errors.NetworkError("tracker request failed", fmt.Errorf("status %s", resp.Status))
+	}
+	return body, nil
+}
+
+// parseHTTPPeers decodes the peers of an HTTP announce response.
+func parseHTTPPeers(raw bencode.RawMessage) ([]Peer, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	if raw[0] == 'l' {
+		var list []httpPeer
+		if err := bencode.DecodeBytes(raw, &list); err != nil {
+			return nil, errors.ParseError("invalid peer list", err)
+		}
+		peers := make([]Peer, 0, len(list))
+		for _, p := range list {
+			addr, err := netip.ParseAddr(p.IP)
+			if err != nil || p.Port <= 0 || p.Port > math.MaxUint16 {
+				continue
+			}
+			peers = append(peers, Peer{
+				Addr: netip.AddrPortFrom(addr.Unmap(), uint16(p.Port)),
+				ID:   []byte(p.ID),
+			})
+		}
+		return peers, nil
+	}
+
+	var compact string
+	if err := bencode.DecodeBytes(raw, &compact); err != nil {
+		return nil, errors.ParseError("invalid peer list", err)
+	}
+	return parseCompactPeers([]byte(compact), 4), nil
+}
+
+// parseCompactPeers decodes peers packed as addresses of ipLen bytes
+// followed by big-endian ports.
+func parseCompactPeers(b []byte, ipLen int) []Peer {
+	size := ipLen + 2
+	peers := make([]Peer, 0, len(b)/size)
+	for ; len(b) >= size; b = b[size:] {
+		addr, _ := netip.AddrFromSlice(b[:ipLen])
+		port := binary.BigEndian.Uint16(b[ipLen:size])
+		peers = append(peers, Peer{Addr: netip.AddrPortFrom(addr, port)})
+	}
+	return peers
+}
+
+// scrapeURL derives the scrape URL of an HTTP tracker, by convention the
+// announce URL with "announce" in its last path element replaced.
+func scrapeURL(u *url.URL) (*url.URL, error) {
+	i := strings.LastIndex(u.Path, "/")
+	if !strings.HasPrefix(u.Path[i+1:], "announce") {
+		return nil, errors.InvalidInputf("tracker %s does not support scraping", u.Redacted())
+	}
+
+	s := *u
+	s.Path = u.Path[:i+1] + "scrape" + strings.TrimPrefix(u.Path[i+1:], "announce")
+	s.RawPath = ""
+	return &s, nil
+}
+
+// withParams appends already-escaped query parameters to a URL, keeping any
+// query the URL has, such as a passkey.
+func withParams(u *url.URL, params []string) string {
+	s := *u
+	query := strings.Join(params, "&")
+	if s.RawQuery != "" {
+		query = s.RawQuery + "&" + query
+	}
+	s.RawQuery = query
+	return s.String()
+}
+
+// escapeBytes percent-encodes binary data such as info hashes, leaving only
+// unreserved characters as they are.
+func escapeBytes(b []byte) string {
+	const hex = "0123456789ABCDEF"
+
+	var sb strings.Builder
+	for _, c := range b {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0x0f])
+	}
+	return sb.String()
+}
@@ -0,0 +1,172 @@
+package tracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/zeebo/bencode"
+)
+
+var testHash = [20]byte{0x01, 0x20, 0x26, 0xff, 'a', 'b', '%', '&', ' ', '+'}
+
+// serveBencode responds with a bencoded value.
+func serveBencode(t *testing.T, v interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if err := bencode.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}
+}
+
+func TestHTTPAnnounce(t *testing.T) {
+	t.Run("Compact peers", func(t *testing.T) {
+		var query url.Values
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			serveBencode(t, map[string]interface{}{
+				"interval":     1800,
+				"min interval": 60,
+				"complete":     5,
+				"incomplete":   3,
+				"tracker id":   "abc",
+				"peers":        "\xc0\x00\x02\x01\x1a\xe1",
+				"peers6":       "\x20\x01\x0d\xb8" + string(make([]byte, 11)) + "\x01\x1a\xe1",
+			})(w, r)
+		}))
+		defer srv.Close()
+
+		resp, err := NewClient().Announce(context.Background(), srv.URL+"/announce?passkey=secret", AnnounceRequest{
+			InfoHash: testHash,
+			Port:     6881,
+			Left:     100,
+			Event:    EventStarted,
+			NumWant:  50,
+		})
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+
+		if got := query.Get("info_hash"); got != string(testHash[:]) {
+			t.Errorf("info_hash = %q, want %q", got, testHash[:])
+		}
+		for key, want := range map[string]string{
+			"passkey": "secret", "port": "6881", "left": "100", "event": "started", "numwant": "50", "compact": "1",
+		} {
+			if got := query.Get(key); got != want {
+				t.Errorf("%s = %q, want %q", key, got, want)
+			}
+		}
+
+		if resp.Interval.Seconds() != 1800 || resp.MinInterval.Seconds() != 60 {
+			t.Errorf("unexpected intervals: %v, %v", resp.Interval, resp.MinInterval)
+		}
+		if resp.Seeders != 5 || resp.Leechers != 3 || resp.TrackerID != "abc" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+		want := []netip.AddrPort{
+			netip.MustParseAddrPort("192.0.2.1:6881"),
+			netip.MustParseAddrPort("[2001:db8::1]:6881"),
+		}
+		if len(resp.Peers) != len(want) {
+			t.Fatalf("got %d peers, want %d", len(resp.Peers), len(want))
+		}
+		for i, p := range resp.Peers {
+			if p.Addr != want[i] {
+				t.Errorf("peer %d = %v, want %v", i, p.Addr, want[i])
+			}
+		}
+	})
+
+	t.Run("Dictionary peers", func(t *testing.T) {
+		srv := httptest.NewServer(serveBencode(t, map[string]interface{}{
+			"interval": 900,
+			"peers": []map[string]interface{}{
+				{"peer id": "-qB4630-abcdefghijkl", "ip": "198.51.100.7", "port": 51413},
+				{"peer id": "bad", "ip": "not an ip", "port": 1},
+			},
+			"warning message": "slow down",
+		}))
+		defer srv.Close()
+
+		resp, err := NewClient().Announce(context.Background(), srv.URL+"/announce", AnnounceRequest{InfoHash: testHash})
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if len(resp.Peers) != 1 || resp.Peers[0].Addr != netip.MustParseAddrPort("198.51.100.7:51413") {
+			t.Fatalf("unexpected peers: %+v", resp.Peers)
+		}
+		if string(resp.Peers[0].ID) != "-qB4630-abcdefghijkl" {
+			t.Errorf("peer id = %q", resp.Peers[0].ID)
+		}
+		if resp.Warning != "slow down" {
+			t.Errorf("warning = %q, want %q", resp.Warning, "slow down")
+		}
+	})
+
+	t.Run("Failure reason", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			serveBencode(t, map[string]string{"failure reason": "unregistered torrent"})(w, r)
+		}))
+		defer srv.Close()
+
+		_, err := NewClient().Announce(context.Background(), srv.URL+"/announce", AnnounceRequest{InfoHash: testHash})
+		failure, ok := err.(*FailureError)
+		if !ok || failure.Reason != "unregistered torrent" {
+			t.Errorf("expected failure reason, got %v", err)
+		}
+	})
+
+	t.Run("Tracker id is sent back", func(t *testing.T) {
+		var got string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.URL.Query().Get("trackerid")
+			serveBencode(t, map[string]interface{}{"interval": 900, "peers": ""})(w, r)
+		}))
+		defer srv.Close()
+
+		req := AnnounceRequest{InfoHash: testHash, TrackerID: "abc"}
+		if _, err := NewClient().Announce(context.Background(), srv.URL+"/announce", req); err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if got != "abc" {
+			t.Errorf("trackerid = %q, want %q", got, "abc")
+		}
+	})
+}
+
+func TestHTTPScrape(t *testing.T) {
+	other := [20]byte{0xaa}
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		serveBencode(t, map[string]interface{}{
+			"files": map[string]interface{}{
+				string(testHash[:]): map[string]int{"complete": 4, "downloaded": 9, "incomplete": 2},
+			},
+		})(w, r)
+	}))
+	defer srv.Close()
+
+	results, err := NewClient().Scrape(context.Background(), srv.URL+"/x/announce.php", testHash, other)
+	if err != nil {
+		t.Fatalf("Scrape() error = %v", err)
+	}
+	if path != "/x/scrape.php" {
+		t.Errorf("scrape path = %q, want /x/scrape.php", path)
+	}
+	if got := results[testHash]; got != (ScrapeResult{Seeders: 4, Leechers: 2, Completed: 9}) {
+		t.Errorf("unexpected result: %+v", got)
+	}
+	if _, ok := results[other]; ok {
+		t.Error("expected no result for an unknown torrent")
+	}
+
+	if _, err := NewClient().Scrape(context.Background(), srv.URL+"/tracker", testHash); err == nil {
+		t.Error("expected an error for a tracker without a scrape URL")
+	}
+}
@@ -0,0 +1,289 @@
+package tracker
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeebo/bencode"
+)
+
+const (
+	// defaultNumWant is the number of peers returned when a peer does not ask
+	// for a number.
+	defaultNumWant = 50
+	// maxNumWant is the largest number of peers returned in one announce.
+	maxNumWant = 200
+)
+
+// Server is an HTTP tracker serving a whitelist of torrents to peers that
+// know its passkey. Peers are always returned in compact form.
+type Server struct {
+	passkey  string
+	interval time.Duration
+	expiry   time.Duration
+	allowed  func(infoHash [20]byte) bool
+	// now is replaced in tests.
+	now func() time.Time
+
+	mu        sync.Mutex
+	swarms    map[[20]byte]*swarm
+	lastPrune time.Time
+}
+
+// swarm is the peers of one torrent.
+type swarm struct {
+	// peers is keyed by peer ID.
+	peers     map[string]*swarmPeer
+	completed int
+}
+
+type swarmPeer struct {
+	addr    netip.AddrPort
+	seeder  bool
+	expires time.Time
+}
+
+// NewServer creates a tracker. Peers must send the passkey, which cannot be
+// empty, and announce torrents for which allowed returns true. Peers are
+// told to announce every interval and forgotten when they have not announced
+// for expiry.
+func NewServer(passkey string, interval, expiry time.Duration, allowed func(infoHash [20]byte) bool) *Server {
+	return &Server{
+		passkey:  passkey,
+		interval: interval,
+		expiry:   expiry,
+		allowed:  allowed,
+		now:      time.Now,
+		swarms:   make(map[[20]byte]*swarm),
+	}
+}
+
+// ServeAnnounce handles announce requests.
+func (s *Server) ServeAnnounce(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !s.authorized(query) {
+		writeFailure(w, "invalid passkey")
+		return
+	}
+
+	infoHash, ok := parseInfoHash(query.Get("info_hash"))
+	if !ok {
+		writeFailure(w, "invalid info_hash")
+		return
+	}
+	if !s.allowed(infoHash) {
+		writeFailure(w, "unregistered torrent")
+		return
+	}
+
+	peerID := query.Get("peer_id")
+	if len(peerID) != 20 {
+		writeFailure(w, "invalid peer_id")
+		return
+	}
+	port, err := strconv.ParseUint(query.Get("port"), 10, 16)
+	if err != nil || port == 0 {
+		writeFailure(w, "invalid port")
+		return
+	}
+	left, err := strconv.ParseInt(query.Get("left"), 10, 64)
+	if err != nil {
+		writeFailure(w, "invalid left")
+		return
+	}
+	addr, ok := remoteAddr(r)
+	if !ok {
+		writeFailure(w, "unknown peer address")
+		return
+	}
+	numWant := defaultNumWant
+	if n, err := strconv.Atoi(query.Get("numwant")); err == nil && n >= 0 {
+		numWant = min(n, maxNumWant)
+	}
+
+	peer := swarmPeer{addr: netip.AddrPortFrom(addr, uint16(port)), seeder: left == 0}
+	resp := s.announce(infoHash, peerID, peer, query.Get("event"), numWant)
+	writeBencode(w, resp)
+}
+
+// announce records a peer and returns the response for it.
+func (s *Server) announce(
+	infoHash [20]byte, peerID string, peer swarmPeer, event string, numWant int,
+) map[string]interface{} {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(now)
+	sw := s.swarms[infoHash]
+	if sw == nil {
+		sw = &swarm{peers: make(map[string]*swarmPeer)}
+		s.swarms[infoHash] = sw
+	}
+
+	if event == EventStopped.String() {
+		delete(sw.peers, peerID)
+	} else {
+		if event == EventCompleted.String() {
+			sw.completed++
+		}
+		peer.expires = now.Add(s.expiry)
+		sw.peers[peerID] = &peer
+	}
+
+	var peers4, peers6 []byte
+	seeders, leechers := sw.counts()
+	for id, p := range sw.peers {
+		if numWant == 0 {
+			break
+		}
+		// Seeders have no use for other seeders.
+		if id == peerID || (peer.seeder && p.seeder) {
+			continue
+		}
+		if p.addr.Addr().Is4() {
+			peers4 = appendCompactPeer(peers4, p.addr)
+		} else {
+			peers6 = appendCompactPeer(peers6, p.addr)
+		}
+		numWant--
+	}
+
+	resp := map[string]interface{}{
+		"interval":   int(s.interval.Seconds()),
+		"complete":   seeders,
+		"incomplete": leechers,
+		"peers":      string(peers4),
+	}
+	if len(peers6) > 0 {
+		resp["peers6"] = string(peers6)
+	}
+	return resp
+}
+
+// ServeScrape handles scrape requests. Without info hashes, all swarms are
+// returned.
+func (s *Server) ServeScrape(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !s.authorized(query) {
+		writeFailure(w, "invalid passkey")
+		return
+	}
+
+	var hashes [][20]byte
+	for _, v := range query["info_hash"] {
+		infoHash, ok := parseInfoHash(v)
+		if !ok {
+			writeFailure(w, "invalid info_hash")
+			return
+		}
+		hashes = append(hashes, infoHash)
+	}
+
+	s.mu.Lock()
+	s.pruneLocked(s.now())
+	if len(hashes) == 0 {
+		for infoHash := range s.swarms {
+			hashes = append(hashes, infoHash)
+		}
+	}
+	files := make(map[string]interface{}, len(hashes))
+	for _, infoHash := range hashes {
+		if !s.allowed(infoHash) {
+			continue
+		}
+		var seeders, leechers, completed int
+		if sw := s.swarms[infoHash]; sw != nil {
+			seeders, leechers = sw.counts()
+			completed = sw.completed
+		}
+		files[string(infoHash[:])] = map[string]int{
+			"complete":   seeders,
+			"downloaded": completed,
+			"incomplete": leechers,
+		}
+	}
+	s.mu.Unlock()
+
+	writeBencode(w, map[string]interface{}{"files": files})
+}
+
+// authorized reports whether a request has the passkey.
+func (s *Server) authorized(query url.Values) bool {
+	return s.passkey != "" && subtle.ConstantTimeCompare([]byte(query.Get("passkey")), []byte(s.passkey)) == 1
+}
+
+// pruneLocked forgets expired peers and empty swarms, at most once per
+// interval.
+func (s *Server) pruneLocked(now time.Time) {
+	if now.Sub(s.lastPrune) < s.interval {
+		return
+	}
+	s.lastPrune = now
+
+	for infoHash, sw := range s.swarms {
+		for id, p := range sw.peers {
+			if now.After(p.expires) {
+				delete(sw.peers, id)
+			}
+		}
+		if len(sw.peers) == 0 && sw.completed == 0 {
+			delete(s.swarms, infoHash)
+		}
+	}
+}
+
+// counts returns the number of seeders and leechers of a swarm.
+func (sw *swarm) counts() (seeders, leechers int) {
+	for _, p := range sw.peers {
+		if p.seeder {
+			seeders++
+		} else {
+			leechers++
+		}
+	}
+	return seeders, leechers
+}
+
+func parseInfoHash(s string) ([20]byte, bool) {
+	if len(s) != 20 {
+		return [20]byte{}, false
+	}
+	return [20]byte([]byte(s)), true
+}
+
+// remoteAddr returns the address a request came from.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// appendCompactPeer appends a peer in the form parseCompactPeers reads.
+func appendCompactPeer(b []byte, addr netip.AddrPort) []byte {
+	b = append(b, addr.Addr().AsSlice()...)
+	return binary.BigEndian.AppendUint16(b, addr.Port())
+}
+
+func writeFailure(w http.ResponseWriter, reason string) {
+	writeBencode(w, map[string]string{"failure reason": reason})
+}
+
+func writeBencode(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "text/plain")
+	_ = bencode.NewEncoder(w).Encode(v)
+}
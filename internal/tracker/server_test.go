@@ -0,0 +1,140 @@
+package tracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// newTestServer serves a tracker that allows testHash.
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	s := NewServer("secret", 30*time.Minute, time.Hour, func(infoHash [20]byte) bool {
+		return infoHash == testHash
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", s.ServeAnnounce)
+	mux.HandleFunc("/scrape", s.ServeScrape)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv.URL + "/announce?passkey=secret"
+}
+
+func TestServerAnnounce(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+
+	t.Run("Peers of the swarm are returned", func(t *testing.T) {
+		_, announceURL := newTestServer(t)
+
+		seeder := AnnounceRequest{InfoHash: testHash, PeerID: NewPeerID(), Port: 6881, Event: EventStarted, NumWant: -1}
+		resp, err := client.Announce(ctx, announceURL, seeder)
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if len(resp.Peers) != 0 || resp.Seeders != 1 || resp.Interval != 30*time.Minute {
+			t.Errorf("unexpected first response: %+v", resp)
+		}
+
+		leecher := AnnounceRequest{InfoHash: testHash, PeerID: NewPeerID(), Port: 6882, Left: 100, NumWant: -1}
+		resp, err = client.Announce(ctx, announceURL, leecher)
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if resp.Seeders != 1 || resp.Leechers != 1 {
+			t.Errorf("unexpected swarm: %+v", resp)
+		}
+		if len(resp.Peers) != 1 || resp.Peers[0].Addr != netip.MustParseAddrPort("127.0.0.1:6881") {
+			t.Errorf("unexpected peers: %+v", resp.Peers)
+		}
+
+		// The seeder is only told about the leecher.
+		resp, err = client.Announce(ctx, announceURL, seeder)
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if len(resp.Peers) != 1 || resp.Peers[0].Addr.Port() != 6882 {
+			t.Errorf("unexpected peers: %+v", resp.Peers)
+		}
+
+		leecher.Event = EventStopped
+		if _, err := client.Announce(ctx, announceURL, leecher); err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		resp, err = client.Announce(ctx, announceURL, seeder)
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if len(resp.Peers) != 0 || resp.Leechers != 0 {
+			t.Errorf("stopped peer was returned: %+v", resp)
+		}
+	})
+
+	t.Run("Wrong passkey", func(t *testing.T) {
+		_, announceURL := newTestServer(t)
+
+		_, err := client.Announce(ctx, announceURL[:len(announceURL)-1], AnnounceRequest{InfoHash: testHash, Port: 1})
+		failure, ok := err.(*FailureError)
+		if !ok || failure.Reason != "invalid passkey" {
+			t.Errorf("expected invalid passkey, got %v", err)
+		}
+	})
+
+	t.Run("Torrent not in the whitelist", func(t *testing.T) {
+		_, announceURL := newTestServer(t)
+
+		_, err := client.Announce(ctx, announceURL, AnnounceRequest{InfoHash: [20]byte{0xaa}, Port: 1})
+		failure, ok := err.(*FailureError)
+		if !ok || failure.Reason != "unregistered torrent" {
+			t.Errorf("expected unregistered torrent, got %v", err)
+		}
+	})
+
+	t.Run("Peers expire", func(t *testing.T) {
+		s, announceURL := newTestServer(t)
+		now := time.Now()
+		s.now = func() time.Time { return now }
+
+		req := AnnounceRequest{InfoHash: testHash, PeerID: NewPeerID(), Port: 6881, Left: 1, NumWant: -1}
+		if _, err := client.Announce(ctx, announceURL, req); err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+
+		now = now.Add(2 * time.Hour)
+		req.PeerID = NewPeerID()
+		resp, err := client.Announce(ctx, announceURL, req)
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if len(resp.Peers) != 0 || resp.Leechers != 1 {
+			t.Errorf("expired peer was returned: %+v", resp)
+		}
+	})
+}
+
+func TestServerScrape(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	_, announceURL := newTestServer(t)
+
+	req := AnnounceRequest{InfoHash: testHash, PeerID: NewPeerID(), Port: 6881, Event: EventCompleted}
+	if _, err := client.Announce(ctx, announceURL, req); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+
+	other := [20]byte{0xaa}
+	results, err := client.Scrape(ctx, announceURL, testHash, other)
+	if err != nil {
+		t.Fatalf("Scrape() error = %v", err)
+	}
+	if got := results[testHash]; got != (ScrapeResult{Seeders: 1, Completed: 1}) {
+		t.Errorf("unexpected result: %+v", got)
+	}
+	if _, ok := results[other]; ok {
+		t.Error("expected no result for a torrent not in the whitelist")
+	}
+}
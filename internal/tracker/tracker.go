@@ -0,0 +1,207 @@
+// Package tracker announces to and scrapes BitTorrent trackers over HTTP
+// (BEP 3, BEP 23) and UDP (BEP 15), and serves an HTTP tracker.
+package tracker
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// Event is the announce event, with the values used by UDP trackers.
+type Event int32
+
+const (
+	// EventNone is sent with regular announces.
+	EventNone Event = iota
+	// EventCompleted is sent once when the download completes.
+	EventCompleted
+	// EventStarted is sent with the first announce.
+	EventStarted
+	// EventStopped is sent when leaving the swarm.
+	EventStopped
+)
+
+// String returns the event as sent to HTTP trackers.
+func (e Event) String() string {
+	switch e {
+	case EventCompleted:
+		return "completed"
+	case EventStarted:
+		return "started"
+	case EventStopped:
+		return "stopped"
+	default:
+		return ""
+	}
+}
+
+// AnnounceRequest is what is sent to a tracker in an announce.
+type AnnounceRequest struct {
+	InfoHash   [20]byte
+	PeerID     [20]byte
+	Port       uint16
+	Uploaded   int64
+	Downloaded int64
+	// Left is the number of bytes still to download. A negative value means
+	// unknown, which is sent as the largest possible value.
+	Left  int64
+	Event Event
+	// NumWant is the number of peers wanted, or -1 for the tracker default.
+	NumWant int32
+	// Key identifies the client if its address changes.
+	Key uint32
+	// TrackerID is the tracker id from a previous response. HTTP only.
+	TrackerID string
+}
+
+// Peer is a peer returned by a tracker.
+type Peer struct {
+	Addr netip.AddrPort
+	// ID is only set by HTTP trackers sending dictionary peers.
+	ID []byte
+}
+
+// AnnounceResponse is a tracker's answer to an announce.
+type AnnounceResponse struct {
+	Interval    time.Duration
+	MinInterval time.Duration
+	Seeders     int
+	Leechers    int
+	Peers       []Peer
+	// Warning is a message from the tracker about an announce that succeeded.
+	Warning string
+	// TrackerID is to be sent with later announces. HTTP only.
+	TrackerID string
+}
+
+// ScrapeResult is the swarm of a torrent as reported by a scrape.
+type ScrapeResult struct {
+	Seeders   int
+	Leechers  int
+	Completed int
+}
+
+// FailureError is returned when a tracker rejects a request.
+type FailureError struct {
+	Reason string
+}
+
+// Error returns the tracker's reason.
+func (e *FailureError) Error() string {
+	return "tracker failure: " + e.Reason
+}
+
+const (
+	// DefaultUDPTimeout is the wait for the first response from a UDP
+	// tracker. It doubles with every retry.
+	DefaultUDPTimeout = 5 * time.Second
+	// DefaultUDPRetries is the number of times a UDP request is resent.
+	DefaultUDPRetries = 2
+	// maxScrapeHashes is the largest number of info hashes a UDP tracker
+	// accepts in one scrape.
+	maxScrapeHashes = 74
+)
+
+// Client announces to and scrapes trackers. It is safe for concurrent use.
+type Client struct {
+	// HTTPClient is used for HTTP trackers.
+	HTTPClient *http.Client
+	// DialUDP connects to UDP trackers. If nil, they are connected to
+	// directly.
+	DialUDP func(ctx context.Context, addr string) (net.Conn, error)
+	// UserAgent is sent to HTTP trackers.
+	UserAgent string
+	// UDPTimeout and UDPRetries control resending of UDP requests.
+	UDPTimeout time.Duration
+	UDPRetries int
+
+	mu          sync.Mutex
+	connections map[string]udpConnection
+}
+
+// NewClient creates a tracker client with the default settings.
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:  &http.Client{},
+		UserAgent:   "Orochi",
+		UDPTimeout:  DefaultUDPTimeout,
+		UDPRetries:  DefaultUDPRetries,
+		connections: make(map[string]udpConnection),
+	}
+}
+
+// Supported reports whether a tracker URL uses a scheme the client speaks.
+func Supported(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "udp":
+		return true
+	default:
+		return false
+	}
+}
+
+// Announce sends an announce to a tracker.
+func (c *Client) Announce(ctx context.Context, rawURL string, req AnnounceRequest) (*AnnounceResponse, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid tracker URL %q", rawURL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return c.announceHTTP(ctx, u, req)
+	case "udp":
+		return c.announceUDP(ctx, u, req)
+	default:
+		return nil, errors.InvalidInputf("unsupported tracker scheme %q", u.Scheme)
+	}
+}
+
+// Scrape asks a tracker for the swarms of the given torrents, which do not
+// have to be torrents being downloaded. Torrents the tracker does not know
+// are missing from the result.
+func (c *Client) Scrape(ctx context.Context, rawURL string, hashes ...[20]byte) (map[[20]byte]ScrapeResult, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.InvalidInputf("invalid tracker URL %q", rawURL)
+	}
+	if len(hashes) == 0 {
+		return map[[20]byte]ScrapeResult{}, nil
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return c.scrapeHTTP(ctx, u, hashes)
+	case "udp":
+		if len(hashes) > maxScrapeHashes {
+			return nil, errors.InvalidInputf("cannot scrape more than %d torrents at once", maxScrapeHashes)
+		}
+		return c.scrapeUDP(ctx, u, hashes)
+	default:
+		return nil, errors.InvalidInputf("unsupported tracker scheme %q", u.Scheme)
+	}
+}
+
+// NewPeerID returns a random Azureus-style peer ID identifying Orochi.
+func NewPeerID() [20]byte {
+	const chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	var id [20]byte
+	copy(id[:], "-OR0001-")
+	for i := 8; i < len(id); i++ {
+		id[i] = chars[rand.IntN(len(chars))]
+	}
+	return id
+}
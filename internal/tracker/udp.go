@@ -0,0 +1,245 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+)
+
+// UDP tracker actions.
+const (
+	actionConnect  uint32 = 0
+	actionAnnounce uint32 = 1
+	actionScrape   uint32 = 2
+	actionError    uint32 = 3
+)
+
+const (
+	// protocolID is the magic connection ID of connect requests.
+	protocolID uint64 = 0x41727101980
+	// connectionLifetime is how long a connection ID may be used. Trackers
+	// accept them for two minutes, clients use them for one.
+	connectionLifetime = time.Minute
+	// maxUDPPacket is the size of the receive buffer.
+	maxUDPPacket = 2048
+)
+
+// udpConnection is a connection ID obtained from a UDP tracker.
+type udpConnection struct {
+	id      uint64
+	expires time.Time
+}
+
+func (c *Client) announceUDP(ctx context.Context, u *url.URL, req AnnounceRequest) (*AnnounceResponse, error) {
+	conn, err := c.dialUDP(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	left := req.Left
+	if left < 0 {
+		left = math.MaxInt64
+	}
+
+	payload := make([]byte, 0, 82)
+	payload = append(payload, req.InfoHash[:]...)
+	payload = append(payload, req.PeerID[:]...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(req.Downloaded))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(left))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(req.Uploaded))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(req.Event))
+	payload = binary.BigEndian.AppendUint32(payload, 0) // Use the sender's address
+	payload = binary.BigEndian.AppendUint32(payload, req.Key)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(req.NumWant))
+	payload = binary.BigEndian.AppendUint16(payload, req.Port)
+
+	resp, err := c.udpRequest(ctx, conn, u.Host, actionAnnounce, payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 12 {
+		return nil, errors.ParseError("truncated tracker response", nil)
+	}
+
+	// Peers have the address family of the connection to the tracker.
+	ipLen := 4
+	if addr, ok := conn.RemoteAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		ipLen = 16
+	}
+
+	return &AnnounceResponse{
+		Interval: time.Duration(binary.BigEndian.Uint32(resp[0:4])) * time.Second,
+		Leechers: int(binary.BigEndian.Uint32(resp[4:8])),
+		Seeders:  int(binary.BigEndian.Uint32(resp[8:12])),
+		Peers:    parseCompactPeers(resp[12:], ipLen),
+	}, nil
+}
+
+func (c *Client) scrapeUDP(ctx context.Context, u *url.URL, hashes [][20]byte) (map[[20]byte]ScrapeResult, error) {
+	conn, err := c.dialUDP(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	payload := make([]byte, 0, 20*len(hashes))
+	for _, h := range hashes {
+		payload = append(payload, h[:]...)
+	}
+
+	resp, err := c.udpRequest(ctx, conn, u.Host, actionScrape, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[[20]byte]ScrapeResult, len(hashes))
+	for i, h := range hashes {
+		entry := resp[min(12*i, len(resp)):]
+		if len(entry) < 12 {
+			break
+		}
+		results[h] = ScrapeResult{
+			Seeders:   int(binary.BigEndian.Uint32(entry[0:4])),
+			Completed: int(binary.BigEndian.Uint32(entry[4:8])),
+			Leechers:  int(binary.BigEndian.Uint32(entry[8:12])),
+		}
+	}
+	return results, nil
+}
+
+func (c *Client) dialUDP(ctx context.Context, u *url.URL) (net.Conn, error) {
+	if c.DialUDP != nil {
+		return c.DialUDP(ctx, u.Host)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", u.Host)
+	if err != nil {
+		return nil, errors.NetworkError("failed to connect to tracker", err)
+	}
+	return conn, nil
+}
+
+// udpRequest sends a request with the given action and payload, connecting
+// first if there is no valid connection ID for the host, and returns the
+// payload of the response.
+func (c *Client) udpRequest(
+	ctx context.Context, conn net.Conn, host string, action uint32, payload []byte,
+) ([]byte, error) {
+	id, cached, err := c.udpConnectionID(ctx, conn, host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.udpRoundTrip(ctx, conn, id, action, payload)
+	if _, failed := err.(*FailureError); cached && failed {
+		// The tracker may have forgotten the connection, so connect again.
+		c.mu.Lock()
+		delete(c.connections, host)
+		c.mu.Unlock()
+
+		if id, _, err = c.udpConnectionID(ctx, conn, host); err != nil {
+			return nil, err
+		}
+		resp, err = c.udpRoundTrip(ctx, conn, id, action, payload)
+	}
+	return resp, err
+}
+
+// udpConnectionID returns a cached connection ID for the host or obtains a
+// new one, and reports whether it was cached.
+func (c *Client) udpConnectionID(ctx context.Context, conn net.Conn, host string) (uint64, bool, error) {
+	c.mu.Lock()
+	cached, ok := c.connections[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.id, true, nil
+	}
+
+	resp, err := c.udpRoundTrip(ctx, conn, protocolID, actionConnect, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(resp) < 8 {
+		return 0, false, errors.ParseError("truncated tracker response", nil)
+	}
+	id := binary.BigEndian.Uint64(resp)
+
+	c.mu.Lock()
+	c.connections[host] = udpConnection{id: id, expires: time.Now().Add(connectionLifetime)}
+	c.mu.Unlock()
+	return id, false, nil
+}
+
+// udpRoundTrip sends a request and waits for the response with the same
+// transaction ID, resending it with a doubled timeout until the retries are
+// used up.
+func (c *Client) udpRoundTrip(
+	ctx context.Context, conn net.Conn, id uint64, action uint32, payload []byte,
+) ([]byte, error) {
+	tx := rand.Uint32()
+	packet := make([]byte, 0, 16+len(payload))
+	packet = binary.BigEndian.AppendUint64(packet, id)
+	packet = binary.BigEndian.AppendUint32(packet, action)
+	packet = binary.BigEndian.AppendUint32(packet, tx)
+	packet = append(packet, payload...)
+
+	// Unblock reads when the context is canceled.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	timeout := c.UDPTimeout
+	buf := make([]byte, maxUDPPacket)
+	for attempt := 0; attempt <= c.UDPRetries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, errors.NetworkError("tracker request canceled", ctx.Err())
+		}
+		if _, err := conn.Write(packet); err != nil {
+			return nil, errors.NetworkError("failed to send tracker request", err)
+		}
+
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		_ = conn.SetReadDeadline(deadline)
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, errors.NetworkError("tracker request canceled", ctx.Err())
+				}
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, errors.NetworkError("failed to read tracker response", err)
+			}
+			if n < 8 || binary.BigEndian.Uint32(buf[4:8]) != tx {
+				// A late answer to an earlier attempt.
+				continue
+			}
+
+			resp := append([]byte(nil), buf[8:n]...)
+			switch binary.BigEndian.Uint32(buf[0:4]) {
+			case action:
+				return resp, nil
+			case actionError:
+				return nil, &FailureError{Reason: string(resp)}
+			default:
+				return nil, errors.ParseError("unexpected tracker response action", nil)
+			}
+		}
+
+		timeout *= 2
+	}
+
+	return nil, errors.Timeout("tracker did not respond")
+}
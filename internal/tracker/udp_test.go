@@ -0,0 +1,214 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUDPTracker is an in-process BEP 15 tracker.
+type fakeUDPTracker struct {
+	conn net.PacketConn
+
+	mu sync.Mutex
+	// drop is the number of requests to ignore, to exercise retries.
+	drop     int
+	requests int
+	// failure makes announces fail with an error action.
+	failure string
+	// lastAnnounce is the payload of the last announce.
+	lastAnnounce []byte
+}
+
+func newFakeUDPTracker(t *testing.T) *fakeUDPTracker {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ft := &fakeUDPTracker{conn: conn}
+	t.Cleanup(func() { _ = conn.Close() })
+	go ft.serve()
+	return ft
+}
+
+func (ft *fakeUDPTracker) url() string {
+	return "udp://" + ft.conn.LocalAddr().String() + "/announce"
+}
+
+func (ft *fakeUDPTracker) serve() {
+	const connectionID = 0x1234
+
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := ft.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 16 {
+			continue
+		}
+
+		ft.mu.Lock()
+		ft.requests++
+		if ft.drop > 0 {
+			ft.drop--
+			ft.mu.Unlock()
+			continue
+		}
+		failure := ft.failure
+		ft.mu.Unlock()
+
+		id := binary.BigEndian.Uint64(buf[0:8])
+		action := binary.BigEndian.Uint32(buf[8:12])
+		tx := buf[12:16]
+		body := buf[16:n]
+
+		resp := binary.BigEndian.AppendUint32(nil, action)
+		resp = append(resp, tx...)
+		switch {
+		case action == actionConnect && id == protocolID:
+			resp = binary.BigEndian.AppendUint64(resp, connectionID)
+		case id != connectionID:
+			resp = binary.BigEndian.AppendUint32(nil, actionError)
+			resp = append(resp, tx...)
+			resp = append(resp, "bad connection id"...)
+		case action == actionAnnounce && failure != "":
+			resp = binary.BigEndian.AppendUint32(nil, actionError)
+			resp = append(resp, tx...)
+			resp = append(resp, failure...)
+		case action == actionAnnounce:
+			ft.mu.Lock()
+			ft.lastAnnounce = append([]byte(nil), body...)
+			ft.mu.Unlock()
+			resp = binary.BigEndian.AppendUint32(resp, 1800) // interval
+			resp = binary.BigEndian.AppendUint32(resp, 3)    // leechers
+			resp = binary.BigEndian.AppendUint32(resp, 5)    // seeders
+			resp = append(resp, 192, 0, 2, 1, 0x1a, 0xe1)
+		case action == actionScrape:
+			for i := 0; i+20 <= len(body); i += 20 {
+				resp = binary.BigEndian.AppendUint32(resp, 4) // seeders
+				resp = binary.BigEndian.AppendUint32(resp, 9) // completed
+				resp = binary.BigEndian.AppendUint32(resp, 2) // leechers
+			}
+		}
+		_, _ = ft.conn.WriteTo(resp, addr)
+	}
+}
+
+func newTestUDPClient() *Client {
+	c := NewClient()
+	c.UDPTimeout = 50 * time.Millisecond
+	return c
+}
+
+func TestUDPAnnounce(t *testing.T) {
+	ft := newFakeUDPTracker(t)
+
+	resp, err := newTestUDPClient().Announce(context.Background(), ft.url(), AnnounceRequest{
+		InfoHash: testHash,
+		Port:     6881,
+		Left:     100,
+		Event:    EventStarted,
+		NumWant:  -1,
+	})
+	if err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+
+	if resp.Interval != 1800*time.Second || resp.Seeders != 5 || resp.Leechers != 3 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if len(resp.Peers) != 1 || resp.Peers[0].Addr != netip.MustParseAddrPort("192.0.2.1:6881") {
+		t.Errorf("unexpected peers: %+v", resp.Peers)
+	}
+
+	ft.mu.Lock()
+	body := ft.lastAnnounce
+	ft.mu.Unlock()
+	if len(body) != 82 {
+		t.Fatalf("announce payload is %d bytes, want 82", len(body))
+	}
+	if [20]byte(body[0:20]) != testHash {
+		t.Error("info hash was not sent")
+	}
+	if left := binary.BigEndian.Uint64(body[48:56]); left != 100 {
+		t.Errorf("left = %d, want 100", left)
+	}
+	if event := binary.BigEndian.Uint32(body[64:68]); event != uint32(EventStarted) {
+		t.Errorf("event = %d, want %d", event, EventStarted)
+	}
+	if port := binary.BigEndian.Uint16(body[80:82]); port != 6881 {
+		t.Errorf("port = %d, want 6881", port)
+	}
+}
+
+func TestUDPRetries(t *testing.T) {
+	ft := newFakeUDPTracker(t)
+	ft.mu.Lock()
+	ft.drop = 2
+	ft.mu.Unlock()
+
+	_, err := newTestUDPClient().Announce(context.Background(), ft.url(), AnnounceRequest{InfoHash: testHash})
+	if err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	// Two dropped connects, then a connect and an announce.
+	if ft.requests != 4 {
+		t.Errorf("tracker got %d requests, want 4", ft.requests)
+	}
+}
+
+func TestUDPTimeout(t *testing.T) {
+	ft := newFakeUDPTracker(t)
+	ft.mu.Lock()
+	ft.drop = 100
+	ft.mu.Unlock()
+
+	_, err := newTestUDPClient().Announce(context.Background(), ft.url(), AnnounceRequest{InfoHash: testHash})
+	if err == nil {
+		t.Fatal("expected an error from a silent tracker")
+	}
+
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if ft.requests != DefaultUDPRetries+1 {
+		t.Errorf("tracker got %d requests, want %d", ft.requests, DefaultUDPRetries+1)
+	}
+}
+
+func TestUDPFailure(t *testing.T) {
+	ft := newFakeUDPTracker(t)
+	ft.mu.Lock()
+	ft.failure = "torrent not registered"
+	ft.mu.Unlock()
+
+	_, err := newTestUDPClient().Announce(context.Background(), ft.url(), AnnounceRequest{InfoHash: testHash})
+	failure, ok := err.(*FailureError)
+	if !ok || failure.Reason != "torrent not registered" {
+		t.Errorf("expected failure reason, got %v", err)
+	}
+}
+
+func TestUDPScrape(t *testing.T) {
+	ft := newFakeUDPTracker(t)
+	other := [20]byte{0xaa}
+
+	results, err := newTestUDPClient().Scrape(context.Background(), ft.url(), testHash, other)
+	if err != nil {
+		t.Fatalf("Scrape() error = %v", err)
+	}
+	for _, h := range [][20]byte{testHash, other} {
+		if got := results[h]; got != (ScrapeResult{Seeders: 4, Leechers: 2, Completed: 9}) {
+			t.Errorf("unexpected result for %x: %+v", h, got)
+		}
+	}
+}
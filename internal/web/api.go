@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/ayutaz/orochi/internal/errors"
@@ -27,6 +29,8 @@ type TorrentResponse struct {
 	Uploaded     int64               `json:"uploaded"`
 	DownloadRate int64               `json:"downloadRate"`
 	UploadRate   int64               `json:"uploadRate"`
+	Seeders      int                 `json:"seeders"`
+	Leechers     int                 `json:"leechers"`
 	AddedAt      string              `json:"addedAt"`
 	Error        string              `json:"error,omitempty"`
 }
@@ -42,6 +46,8 @@ func toTorrentResponse(t *torrent.Torrent) TorrentResponse {
 		Uploaded:     t.Uploaded,
 		DownloadRate: t.DownloadRate,
 		UploadRate:   t.UploadRate,
+		Seeders:      t.Seeders,
+		Leechers:     t.Leechers,
 		AddedAt:      t.AddedAt.Format(time.RFC3339),
 		Error:        t.Error,
 	}
@@ -118,12 +124,21 @@ func (s *Server) handleAddTorrent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := s.torrentManager.AddTorrent(data)
+	var id string
+	if adapter != nil {
+		id, err = adapter.AddTorrentWithOptions(data, torrent.AddOptions{Strategy: r.FormValue("strategy")})
+	} else {
+		id, err = s.torrentManager.AddTorrent(data)
+	}
 	if err != nil {
-		if errors.IsInvalidInput(err) || errors.IsParseError(err) {
+		switch {
+		case errors.IsInvalidInput(err) || errors.IsParseError(err):
 			s.logger.Warn("invalid torrent file", logger.Err(err))
 			writeError(w, http.StatusBadRequest, err.Error())
-		} else {
+		case errors.IsInsufficientStorage(err):
+			s.logger.Warn("not enough disk space for torrent", logger.Err(err))
+			writeError(w, http.StatusInsufficientStorage, err.Error())
+		default:
 			s.logger.Error("failed to add torrent", logger.Err(err))
 			writeError(w, http.StatusInternalServerError, "failed to add torrent")
 		}
@@ -137,7 +152,8 @@ func (s *Server) handleAddTorrent(w http.ResponseWriter, r *http.Request) {
 // handleAddMagnet handles POST /api/torrents/magnet.
 func (s *Server) handleAddMagnet(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Magnet string `json:"magnet"`
+		Magnet   string `json:"magnet"`
+		Strategy string `json:"strategy,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -151,12 +167,22 @@ func (s *Server) handleAddMagnet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := s.torrentManager.AddMagnet(req.Magnet)
+	var id string
+	var err error
+	if adapter, ok := s.torrentManager.(*torrent.ClientAdapter); ok {
+		id, err = adapter.AddMagnetWithOptions(req.Magnet, torrent.AddOptions{Strategy: req.Strategy})
+	} else {
+		id, err = s.torrentManager.AddMagnet(req.Magnet)
+	}
 	if err != nil {
-		if errors.IsInvalidInput(err) || errors.IsParseError(err) {
+		switch {
+		case errors.IsInvalidInput(err) || errors.IsParseError(err):
 			s.logger.Warn("invalid magnet link", logger.Err(err))
 			writeError(w, http.StatusBadRequest, err.Error())
-		} else {
+		case errors.IsInsufficientStorage(err):
+			s.logger.Warn("not enough disk space for magnet", logger.Err(err))
+			writeError(w, http.StatusInsufficientStorage, err.Error())
+		default:
 			s.logger.Error("failed to add magnet", logger.Err(err))
 			writeError(w, http.StatusInternalServerError, "failed to add magnet")
 		}
@@ -254,6 +280,8 @@ func (s *Server) handleGetSettings(w http.ResponseWriter, _ *http.Request) {
 			if db != nil {
 				var dbSettings map[string]interface{}
 				if err := db.GetSettingsJSON(&dbSettings); err == nil && dbSettings != nil {
+					s.putProtocolSettings(dbSettings)
+					s.putPeerPortSettings(dbSettings)
 					_ = writeJSON(w, http.StatusOK, dbSettings)
 					return
 				}
@@ -274,6 +302,8 @@ func (s *Server) handleGetSettings(w http.ResponseWriter, _ *http.Request) {
 		"peerExchange":       true,
 		"localPeerDiscovery": true,
 	}
+	s.putProtocolSettings(settings)
+	s.putPeerPortSettings(settings)
 	_ = writeJSON(w, http.StatusOK, settings)
 }
 
@@ -286,6 +316,54 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Protocol switches and the peer port are applied first, so settings
+	// that cannot be applied are not saved. Most of them restart the
+	// torrent client.
+	protocols, protocolsChanged := s.protocolsFromSettings(settings)
+	if err := protocols.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	port, portRange, portChanged, err := s.peerPortFromSettings(settings)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if protocolsChanged {
+		if client := s.torrentClient(); client != nil {
+			restarted, err := client.SetProtocols(protocols)
+			if err != nil {
+				s.logger.Error("failed to apply protocols", logger.Err(err))
+				writeError(w, http.StatusInternalServerError, "failed to apply protocols")
+				return
+			}
+			if restarted {
+				s.logger.Info("torrent client restarted to apply protocols")
+			}
+		}
+		s.config.Protocols = protocols
+		if err := s.saveConfig(); err != nil {
+			s.logger.Error("failed to save config", logger.Err(err))
+		}
+	}
+
+	// A new peer port is listened on by restarting the torrent client
+	if portChanged {
+		if client := s.torrentClient(); client != nil {
+			if _, err := client.SetPeerPort(port, portRange); err != nil {
+				s.logger.Error("failed to apply peer port", logger.Err(err))
+				writeError(w, http.StatusInternalServerError, "failed to apply peer port")
+				return
+			}
+			s.logger.Info("torrent client restarted to apply peer port", logger.Int("port", client.ListenPort()))
+		}
+		s.config.PeerPort, s.config.PeerPortRange = port, portRange
+		if err := s.saveConfig(); err != nil {
+			s.logger.Error("failed to save config", logger.Err(err))
+		}
+	}
+
 	// Save settings to database if available
 	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
 	if ok {
@@ -306,15 +384,44 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 	_ = writeJSON(w, http.StatusOK, settings)
 }
 
-// FileUpdateRequest represents a file update request.
+// FileUpdateRequest represents a file update request. Each entry addresses
+// a file by index or, if no index is given, by path. Files not listed are
+// left unchanged.
 type FileUpdateRequest struct {
 	Files []struct {
-		Path     string `json:"path"`
-		Selected bool   `json:"selected"`
+		Index    *int   `json:"index,omitempty"`
+		Path     string `json:"path,omitempty"`
+		Selected *bool  `json:"selected,omitempty"`
 		Priority string `json:"priority,omitempty"`
 	} `json:"files"`
 }
 
+// handleListFiles handles GET /api/torrents/:id/files.
+func (s *Server) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	files, err := adapter.Files(id)
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsInvalidInput(err) {
+			writeError(w, http.StatusNotFound, "torrent not found")
+		} else {
+			s.logger.Error("failed to list files", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to list files")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, files)
+}
+
 // handleUpdateFiles handles PUT /api/torrents/:id/files.
 func (s *Server) handleUpdateFiles(w http.ResponseWriter, r *http.Request) {
 	params := GetParams(r)
@@ -334,7 +441,6 @@ func (s *Server) handleUpdateFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update file selection in torrent client
 	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
 	if !ok {
 		s.logger.Error("torrent manager is not ClientAdapter")
@@ -342,120 +448,267 @@ func (s *Server) handleUpdateFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client, err := adapter.GetClient()
+	updates := make([]torrent.FileUpdate, len(req.Files))
+	for i, file := range req.Files {
+		updates[i] = torrent.FileUpdate{
+			Index:    file.Index,
+			Path:     file.Path,
+			Selected: file.Selected,
+			Priority: file.Priority,
+		}
+	}
+
+	if err := adapter.UpdateFiles(id, updates); err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.IsInvalidInput(err):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			s.logger.Error("failed to update files", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to update files")
+		}
+		return
+	}
+
+	s.logger.Info("file selection updated",
+		logger.String("torrent_id", id),
+		logger.Int("file_count", len(req.Files)),
+	)
+
+	files, err := adapter.Files(id)
 	if err != nil {
-		s.logger.Error("failed to get torrent client", logger.Err(err))
-		writeError(w, http.StatusInternalServerError, "failed to get torrent client")
+		s.logger.Error("failed to list files", logger.String("torrent_id", id), logger.Err(err))
+		writeError(w, http.StatusInternalServerError, "failed to list files")
 		return
 	}
+	_ = writeJSON(w, http.StatusOK, files)
+}
+
+// handleGetStrategy handles GET /api/torrents/:id/strategy.
+func (s *Server) handleGetStrategy(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
 
-	torr, err := client.GetTorrent(id)
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	strategy, err := adapter.DownloadStrategy(id)
 	if err != nil {
-		s.logger.Error("failed to get torrent from client", logger.Err(err))
+		if errors.IsNotFound(err) || errors.IsInvalidInput(err) {
+			writeError(w, http.StatusNotFound, "torrent not found")
+		} else {
+			s.logger.Error("failed to get download strategy", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to get download strategy")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, strategy)
+}
+
+// handleUpdateStrategy handles PUT /api/torrents/:id/strategy.
+func (s *Server) handleUpdateStrategy(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	// Check if torrent exists
+	if _, exists := s.torrentManager.GetTorrent(id); !exists {
 		writeError(w, http.StatusNotFound, "torrent not found")
 		return
 	}
 
-	// Update file selection
-	for i, file := range req.Files {
-		if err := torr.SetFileSelected(i, file.Selected); err != nil {
-			s.logger.Error("failed to set file selection",
-				logger.String("torrent_id", id),
-				logger.Int("file_index", i),
-				logger.Err(err),
-			)
+	var req torrent.DownloadStrategyInfo
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error("failed to decode request", logger.Err(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := adapter.SetDownloadStrategy(id, req); err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.IsInvalidInput(err):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			s.logger.Error("failed to update download strategy", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to update download strategy")
 		}
+		return
 	}
 
-	s.logger.Info("file selection updated",
+	s.logger.Info("download strategy updated",
 		logger.String("torrent_id", id),
-		logger.Int("file_count", len(req.Files)),
+		logger.String("strategy", req.Strategy),
 	)
 
-	_ = writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	s.handleGetStrategy(w, r)
 }
 
-// VPNStatusResponse represents VPN status in API responses.
-type VPNStatusResponse struct {
-	Enabled       bool                `json:"enabled"`
-	Active        bool                `json:"active"`
-	InterfaceName string              `json:"interface_name"`
-	KillSwitch    bool                `json:"kill_switch"`
-	LastCheck     string              `json:"last_check,omitempty"`
-	Interfaces    []network.Interface `json:"interfaces"`
+// RenameRequest represents a request to rename a file or folder.
+type RenameRequest struct {
+	Path string `json:"path,omitempty"`
+	Name string `json:"name"`
 }
 
-// handleGetVPNStatus handles GET /api/vpn/status.
-func (s *Server) handleGetVPNStatus(w http.ResponseWriter, _ *http.Request) {
-	// Get VPN config from server config
-	vpnConfig := s.config.VPN
-	if vpnConfig == nil {
-		vpnConfig = network.NewVPNConfig()
-	}
+// handleRenameFile handles PUT /api/torrents/:id/files/:index/name.
+func (s *Server) handleRenameFile(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
 
-	// Get network interfaces
-	interfaces, err := network.GetNetworkInterfaces()
+	index, err := strconv.Atoi(params["index"])
 	if err != nil {
-		s.logger.Error("failed to get network interfaces", logger.Err(err))
-		interfaces = []network.Interface{}
+		writeError(w, http.StatusBadRequest, "invalid file index")
+		return
 	}
 
-	response := VPNStatusResponse{
-		Enabled:       vpnConfig.Enabled,
-		Active:        false,
-		InterfaceName: vpnConfig.InterfaceName,
-		KillSwitch:    vpnConfig.KillSwitch,
-		Interfaces:    interfaces,
+	var req RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error("failed to decode request", logger.Err(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
 	}
 
-	// Check if VPN is active through torrent client
-	if adapter, ok := s.torrentManager.(*torrent.ClientAdapter); ok {
-		if client, err := adapter.GetClient(); err == nil && client != nil {
-			// Access network monitor through reflection or add a method
-			response.Active = !vpnConfig.Enabled // If disabled, consider as "active"
-
-			// If enabled, check actual interface status
-			if vpnConfig.Enabled && vpnConfig.InterfaceName != "" {
-				for _, iface := range interfaces {
-					if iface.Name == vpnConfig.InterfaceName && iface.IsUp {
-						response.Active = true
-						break
-					}
-				}
-			}
-		}
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
 	}
 
-	_ = writeJSON(w, http.StatusOK, response)
+	if err := adapter.RenameFile(id, index, req.Name); err != nil {
+		s.writeRenameError(w, id, err)
+		return
+	}
+
+	s.logger.Info("file renamed",
+		logger.String("torrent_id", id),
+		logger.Int("file_index", index),
+		logger.String("name", req.Name),
+	)
+	s.writeRenamedTorrent(w, id)
+}
+
+// handleRenameFolder handles PUT /api/torrents/:id/folders/name.
+func (s *Server) handleRenameFolder(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	var req RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error("failed to decode request", logger.Err(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := adapter.RenameFolder(id, req.Path, req.Name); err != nil {
+		s.writeRenameError(w, id, err)
+		return
+	}
+
+	s.logger.Info("folder renamed",
+		logger.String("torrent_id", id),
+		logger.String("path", req.Path),
+		logger.String("name", req.Name),
+	)
+	s.writeRenamedTorrent(w, id)
+}
+
+// writeRenameError writes the response for a failed rename.
+func (s *Server) writeRenameError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case errors.IsNotFound(err):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.IsInvalidInput(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.IsConflict(err):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.logger.Error("failed to rename", logger.String("torrent_id", id), logger.Err(err))
+		writeError(w, http.StatusInternalServerError, "failed to rename")
+	}
+}
+
+// writeRenamedTorrent writes the torrent after a rename so clients see the
+// new paths.
+func (s *Server) writeRenamedTorrent(w http.ResponseWriter, id string) {
+	torrentObj, exists := s.torrentManager.GetTorrent(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, "torrent not found")
+		return
+	}
+	_ = writeJSON(w, http.StatusOK, toTorrentResponse(torrentObj))
+}
+
+// VPNStatusResponse represents VPN status in API responses.
+type VPNStatusResponse struct {
+	Enabled           bool                `json:"enabled"`
+	Active            bool                `json:"active"`
+	InterfaceName     string              `json:"interface_name"`
+	KillSwitch        bool                `json:"kill_switch"`
+	KillSwitchEngaged bool                `json:"kill_switch_engaged"`
+	LastCheck         string              `json:"last_check,omitempty"`
+	LastChange        string              `json:"last_change,omitempty"`
+	Addresses         []string            `json:"addresses,omitempty"`
+	BoundAddresses    []string            `json:"bound_addresses,omitempty"`
+	Leak              bool                `json:"leak"`
+	LeakRoute         string              `json:"leak_route,omitempty"`
+	RestartRequired   bool                `json:"restart_required,omitempty"`
+	Interfaces        []network.Interface `json:"interfaces"`
+}
+
+// handleGetVPNStatus handles GET /api/vpn/status.
+func (s *Server) handleGetVPNStatus(w http.ResponseWriter, _ *http.Request) {
+	_ = writeJSON(w, http.StatusOK, s.vpnStatus())
 }
 
 // handleUpdateVPNConfig handles PUT /api/vpn/config.
 func (s *Server) handleUpdateVPNConfig(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Enabled       bool   `json:"enabled"`
-		InterfaceName string `json:"interface_name"`
-		KillSwitch    bool   `json:"kill_switch"`
+	// Fields left out of the request keep their current values
+	vpnConfig := network.NewVPNConfig()
+	if s.config.VPN != nil {
+		*vpnConfig = *s.config.VPN
+		vpnConfig.InterfacePatterns = slices.Clone(s.config.VPN.InterfacePatterns)
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(vpnConfig); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	// Update config
-	if s.config.VPN == nil {
-		s.config.VPN = network.NewVPNConfig()
+	// Apply the change first, so a configuration that cannot be applied is
+	// neither kept nor saved
+	var err error
+	if client := s.torrentClient(); client != nil {
+		err = client.SetVPNConfig(vpnConfig)
+	} else {
+		err = vpnConfig.CheckInterface(network.NewInterfaceProvider())
 	}
-
-	s.config.VPN.Enabled = req.Enabled
-	s.config.VPN.InterfaceName = req.InterfaceName
-	s.config.VPN.KillSwitch = req.KillSwitch
-
-	// Validate config
-	if err := s.config.VPN.Validate(); err != nil {
+	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	s.config.VPN = vpnConfig
+	s.rewatchVPN()
 
 	// Save config
 	if err := s.saveConfig(); err != nil {
@@ -465,9 +718,9 @@ func (s *Server) handleUpdateVPNConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("VPN configuration updated",
-		logger.Bool("enabled", req.Enabled),
-		logger.String("interface", req.InterfaceName),
-		logger.Bool("kill_switch", req.KillSwitch),
+		logger.Bool("enabled", vpnConfig.Enabled),
+		logger.String("interface", vpnConfig.InterfaceName),
+		logger.Bool("kill_switch", vpnConfig.KillSwitch),
 	)
 
 	_ = writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
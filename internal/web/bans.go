@@ -0,0 +1,87 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+// BanRequest represents a request to ban an IP address or CIDR range.
+type BanRequest struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+	// Duration is how long the ban lasts in seconds, or 0 for ever.
+	Duration int `json:"duration"`
+}
+
+// handleListBans handles GET /api/bans.
+func (s *Server) handleListBans(w http.ResponseWriter, _ *http.Request) {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, adapter.Bans())
+}
+
+// handleBan handles POST /api/bans.
+func (s *Server) handleBan(w http.ResponseWriter, r *http.Request) {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error("failed to decode request", logger.Err(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	ban, err := adapter.BanPeers(req.Address, req.Reason, time.Duration(req.Duration)*time.Second)
+	if err != nil {
+		if errors.IsInvalidInput(err) {
+			writeError(w, http.StatusBadRequest, err.Error())
+		} else {
+			s.logger.Error("failed to ban peers", logger.String("address", req.Address), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to ban peers")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusCreated, ban)
+}
+
+// handleUnban handles DELETE /api/bans?address=<ip or cidr>.
+func (s *Server) handleUnban(w http.ResponseWriter, r *http.Request) {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	address := r.URL.Query().Get("address")
+	if err := adapter.UnbanPeers(address); err != nil {
+		switch {
+		case errors.IsInvalidInput(err):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.IsNotFound(err):
+			writeError(w, http.StatusNotFound, "ban not found")
+		default:
+			s.logger.Error("failed to unban peers", logger.String("address", address), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to unban peers")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_Bans(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{DownloadDir: tmpDir, DataDir: tmpDir, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("POST /api/bans - CIDRをBAN", func(t *testing.T) {
+		body := `{"address": "192.0.2.77/24", "reason": "spam", "duration": 3600}`
+		req := httptest.NewRequest(http.MethodPost, "/api/bans", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var ban torrent.BanInfo
+		if err := json.NewDecoder(w.Body).Decode(&ban); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if ban.Address != "192.0.2.0/24" || ban.ExpiresAt == nil {
+			t.Errorf("unexpected ban: %+v", ban)
+		}
+	})
+
+	t.Run("POST /api/bans - 不正なアドレス", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/bans", strings.NewReader(`{"address": "nope"}`))
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("POST /api/bans - IPアドレスを永久BAN", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/bans", strings.NewReader(`{"address": "198.51.100.7"}`))
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("GET /api/bans - BAN一覧を返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/bans", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var bans []torrent.BanInfo
+		if err := json.NewDecoder(w.Body).Decode(&bans); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(bans) != 2 {
+			t.Errorf("expected 2 bans, got %+v", bans)
+		}
+	})
+
+	t.Run("DELETE /api/bans - BANを解除", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/bans?address="+url.QueryEscape("192.0.2.0/24"), http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("expected status 204, got %d: %s", w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404 for a lifted ban, got %d", w.Code)
+		}
+	})
+
+	t.Run("BANは再起動後も残る", func(t *testing.T) {
+		adapter.Close()
+
+		restarted, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create adapter: %v", err)
+		}
+		defer restarted.Close()
+
+		bans := restarted.Bans()
+		if len(bans) != 1 || bans[0].Address != "198.51.100.7/32" {
+			t.Errorf("unexpected bans after restart: %+v", bans)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+// handleGetBlocklist handles GET /api/blocklist.
+func (s *Server) handleGetBlocklist(w http.ResponseWriter, _ *http.Request) {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, adapter.Blocklist())
+}
+
+// handleRefreshBlocklist handles POST /api/blocklist/refresh.
+func (s *Server) handleRefreshBlocklist(w http.ResponseWriter, r *http.Request) {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := adapter.RefreshBlocklist(r.Context()); err != nil {
+		if errors.IsInvalidInput(err) {
+			writeError(w, http.StatusBadRequest, err.Error())
+		} else {
+			s.logger.Error("failed to refresh blocklist", logger.Err(err))
+			writeError(w, http.StatusBadGateway, "failed to refresh blocklist")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, adapter.Blocklist())
+}
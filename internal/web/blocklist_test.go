@@ -0,0 +1,88 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_Blocklist(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "ipfilter.dat")
+	if err := os.WriteFile(path, []byte("001.002.003.000 - 001.002.003.255 , 000 , Bad\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{DownloadDir: tmpDir, DataDir: tmpDir, Blocklist: &config.BlocklistConfig{Path: path}, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("GET /api/blocklist - ブロックリストの状態を返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/blocklist", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var info torrent.BlocklistInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if info.Rules != 1 || info.UpdatedAt == nil {
+			t.Errorf("unexpected blocklist: %+v", info)
+		}
+	})
+
+	t.Run("POST /api/blocklist/refresh - ブロックリストを再読み込み", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("10.0.0.0/8\n192.168.0.0/16\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/blocklist/refresh", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var info torrent.BlocklistInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if info.Rules != 2 {
+			t.Errorf("expected 2 rules, got %d", info.Rules)
+		}
+	})
+
+	t.Run("POST /api/blocklist/refresh - 壊れたブロックリスト", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("garbage\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/blocklist/refresh", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("expected status 502, got %d", w.Code)
+		}
+		if info := adapter.Blocklist(); info.Rules != 2 || info.LastError == "" {
+			t.Errorf("expected the previous rules to be kept with the error: %+v", info)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"time"
+)
+
+// DHTStatsResponse describes the DHT servers of the torrent client.
+type DHTStatsResponse struct {
+	// Enabled is false when the DHT is turned off in the protocols.
+	Enabled bool `json:"enabled"`
+	// Servers is the number of DHT servers, one per socket.
+	Servers            int   `json:"servers"`
+	Nodes              int   `json:"nodes"`
+	GoodNodes          int   `json:"good_nodes"`
+	BadNodes           int   `json:"bad_nodes"`
+	OutstandingQueries int   `json:"outstanding_queries"`
+	QueriesSent        int64 `json:"queries_sent"`
+	Announces          int64 `json:"announces"`
+	AnnouncesAccepted  int64 `json:"announces_accepted"`
+	AnnouncesReceived  int64 `json:"announces_received"`
+	StoredPeers        int   `json:"stored_peers"`
+	StoredTorrents     int   `json:"stored_torrents"`
+	// SavedNodes were saved in the data directory at SavedAt, which is
+	// left out until the routing table is saved.
+	SavedNodes int        `json:"saved_nodes"`
+	SavedAt    *time.Time `json:"saved_at,omitempty"`
+}
+
+// handleGetDHTStats handles GET /api/dht/stats.
+func (s *Server) handleGetDHTStats(w http.ResponseWriter, _ *http.Request) {
+	var response DHTStatsResponse
+	if client := s.torrentClient(); client != nil {
+		stats := client.DHTStats()
+		response = DHTStatsResponse{
+			Enabled:            client.Protocols().DHT(),
+			Servers:            stats.Servers,
+			Nodes:              stats.Nodes,
+			GoodNodes:          stats.GoodNodes,
+			BadNodes:           stats.BadNodes,
+			OutstandingQueries: stats.OutstandingQueries,
+			QueriesSent:        stats.QueriesSent,
+			Announces:          stats.Announces,
+			AnnouncesAccepted:  stats.AnnouncesAccepted,
+			AnnouncesReceived:  stats.AnnouncesReceived,
+			StoredPeers:        stats.StoredPeers,
+			StoredTorrents:     stats.StoredTorrents,
+			SavedNodes:         stats.SavedNodes,
+		}
+		if !stats.SavedAt.IsZero() {
+			response.SavedAt = &stats.SavedAt
+		}
+	}
+	_ = writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_DHTStats(t *testing.T) {
+	getStats := func(t *testing.T, server *Server) map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/dht/stats", http.NoBody)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var stats map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	t.Run("DHTサーバーの統計を返す", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		cfg := &config.Config{
+			DownloadDir: tmpDir,
+			DataDir:     tmpDir,
+			Protocols:   &config.ProtocolConfig{DisableLSD: true},
+			DHT:         &config.DHTConfig{DisablePublicBootstrap: true},
+		}
+		adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create adapter: %v", err)
+		}
+		defer adapter.Close()
+		server := NewServer(cfg)
+		server.SetTorrentManager(adapter)
+
+		stats := getStats(t, server)
+		if stats["enabled"] != true || stats["servers"].(float64) < 1 {
+			t.Errorf("unexpected stats: %v", stats)
+		}
+		for _, key := range []string{"nodes", "good_nodes", "outstanding_queries", "announces", "announces_received", "stored_peers"} {
+			if _, ok := stats[key]; !ok {
+				t.Errorf("expected %s in the stats", key)
+			}
+		}
+		if _, ok := stats["saved_at"]; ok {
+			t.Errorf("expected no saved_at before the nodes are saved, got %v", stats["saved_at"])
+		}
+	})
+
+	t.Run("DHT無効時", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		cfg := &config.Config{
+			DownloadDir: tmpDir,
+			DataDir:     tmpDir,
+			Protocols:   &config.ProtocolConfig{DisableDHT: true, DisableLSD: true},
+		}
+		adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create adapter: %v", err)
+		}
+		defer adapter.Close()
+		server := NewServer(cfg)
+		server.SetTorrentManager(adapter)
+
+		stats := getStats(t, server)
+		if stats["enabled"] != false || stats["servers"] != float64(0) || stats["nodes"] != float64(0) {
+			t.Errorf("unexpected stats: %v", stats)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package web
 
 import (
+	"bufio"
 	"context"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -176,6 +178,19 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades take over the connection, which the
+// upgrader requires of the ResponseWriter itself.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.statusCode = http.StatusSwitchingProtocols
+	rw.written = true
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
 // generateRequestID generates a simple request ID.
 func generateRequestID() string {
 	// Simple implementation - in production, use UUID
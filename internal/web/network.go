@@ -0,0 +1,38 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/ayutaz/orochi/internal/portmap"
+)
+
+// NetworkStatusResponse describes how peers reach the client.
+type NetworkStatusResponse struct {
+	// PeerPort is the configured peer port, 0 for a random one.
+	PeerPort int `json:"peer_port"`
+	// ListenPort is the port the client listens on, 0 when it accepts no
+	// connections.
+	ListenPort  int               `json:"listen_port"`
+	PortMapping PortMappingStatus `json:"port_mapping"`
+}
+
+// PortMappingStatus is the state of the peer port mapping on the router.
+type PortMappingStatus struct {
+	Enabled bool `json:"enabled"`
+	portmap.Status
+}
+
+// handleGetNetworkStatus handles GET /api/network/status.
+func (s *Server) handleGetNetworkStatus(w http.ResponseWriter, _ *http.Request) {
+	response := NetworkStatusResponse{
+		PeerPort:    s.config.PeerPort,
+		PortMapping: PortMappingStatus{Status: portmap.Status{Mappings: []portmap.MappingStatus{}}},
+	}
+	if client := s.torrentClient(); client != nil {
+		response.ListenPort = client.ListenPort()
+		if status, enabled := client.PortMappingStatus(); enabled {
+			response.PortMapping = PortMappingStatus{Enabled: true, Status: status}
+		}
+	}
+	_ = writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,101 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/portmap/portmaptest"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_NetworkStatus(t *testing.T) {
+	getStatus := func(t *testing.T, server *Server) map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/network/status", http.NoBody)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var status map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	t.Run("UPnPでマッピングした状態を返す", func(t *testing.T) {
+		igd, err := portmaptest.NewIGD("198.51.100.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer igd.Close()
+
+		tmpDir := t.TempDir()
+		cfg := &config.Config{
+			DownloadDir: tmpDir,
+			DataDir:     tmpDir,
+			PortMapping: &config.PortMappingConfig{
+				Enabled: true,
+				Methods: []string{config.PortMapUPnP},
+				UPnPURL: igd.RootDesc,
+			},
+			Protocols: &config.ProtocolConfig{DisableDHT: true},
+		}
+		adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+		if err != nil {
+			t.Fatalf("failed to create adapter: %v", err)
+		}
+		defer adapter.Close()
+		server := NewServer(cfg)
+		server.SetTorrentManager(adapter)
+
+		var status map[string]interface{}
+		var mapping map[string]interface{}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			status = getStatus(t, server)
+			mapping = status["port_mapping"].(map[string]interface{})
+			if mappings, _ := mapping["mappings"].([]interface{}); len(mappings) == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the port to be mapped: %v", status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		listenPort := status["listen_port"].(float64)
+		if listenPort == 0 || status["peer_port"] != float64(0) {
+			t.Errorf("unexpected ports: %v", status)
+		}
+		if mapping["enabled"] != true || mapping["method"] != "upnp" || mapping["external_ip"] != "198.51.100.4" {
+			t.Errorf("unexpected port mapping: %v", mapping)
+		}
+		if mapping["internal_port"] != listenPort {
+			t.Errorf("expected port %v to be mapped, got %v", listenPort, mapping["internal_port"])
+		}
+		first := mapping["mappings"].([]interface{})[0].(map[string]interface{})
+		if first["external_port"] != listenPort || first["expires_at"] == nil {
+			t.Errorf("unexpected mapping: %v", first)
+		}
+	})
+
+	t.Run("無効時はenabledがfalse", func(t *testing.T) {
+		server := NewServer(&config.Config{DownloadDir: t.TempDir(), PeerPort: 6881})
+		server.SetTorrentManager(torrent.NewManager())
+		status := getStatus(t, server)
+		mapping := status["port_mapping"].(map[string]interface{})
+		if mapping["enabled"] != false || status["peer_port"] != float64(6881) {
+			t.Errorf("unexpected status: %v", status)
+		}
+		if mappings, ok := mapping["mappings"].([]interface{}); !ok || len(mappings) != 0 {
+			t.Errorf("expected no mappings, got %v", mapping["mappings"])
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+// handleListPeers handles GET /api/torrents/:id/peers.
+func (s *Server) handleListPeers(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	peers, err := adapter.Peers(id)
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsInvalidInput(err) {
+			writeError(w, http.StatusNotFound, "torrent not found")
+		} else {
+			s.logger.Error("failed to list peers", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to list peers")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, peers)
+}
+
+// AddPeersRequest represents a request to add peers to a torrent.
+type AddPeersRequest struct {
+	Peers []string `json:"peers"`
+}
+
+// handleAddPeers handles POST /api/torrents/:id/peers.
+func (s *Server) handleAddPeers(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	// Check if torrent exists
+	if _, exists := s.torrentManager.GetTorrent(id); !exists {
+		writeError(w, http.StatusNotFound, "torrent not found")
+		return
+	}
+
+	var req AddPeersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger.Error("failed to decode request", logger.Err(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	if len(req.Peers) == 0 {
+		writeError(w, http.StatusBadRequest, "peers required")
+		return
+	}
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	added, err := adapter.AddPeers(id, req.Peers)
+	if err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			writeError(w, http.StatusNotFound, "torrent not found")
+		case errors.IsInvalidInput(err):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			s.logger.Error("failed to add peers", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to add peers")
+		}
+		return
+	}
+
+	s.logger.Info("peers added",
+		logger.String("torrent_id", id),
+		logger.Int("peer_count", len(req.Peers)),
+	)
+	_ = writeJSON(w, http.StatusOK, map[string]int{"added": added})
+}
+
+// handleDisconnectPeer handles DELETE /api/torrents/:id/peers/:address.
+// The address is the peer's ip:port as listed, URL-encoded.
+func (s *Server) handleDisconnectPeer(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+	address := params["address"]
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := adapter.DisconnectPeer(id, address); err != nil {
+		switch {
+		case errors.IsNotFound(err) || errors.IsInvalidInput(err):
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			s.logger.Error("failed to disconnect peer",
+				logger.String("torrent_id", id),
+				logger.String("peer", address),
+				logger.Err(err),
+			)
+			writeError(w, http.StatusInternalServerError, "failed to disconnect peer")
+		}
+		return
+	}
+
+	s.logger.Info("peer disconnected", logger.String("torrent_id", id), logger.String("peer", address))
+	w.WriteHeader(http.StatusNoContent)
+}
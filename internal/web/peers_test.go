@@ -0,0 +1,89 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_Peers(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{DownloadDir: tmpDir, DataDir: tmpDir, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	torrentData, _ := seededTorrent(t, tmpDir, "movie.mkv")
+	id, err := adapter.AddTorrent(torrentData)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("GET /api/torrents/:id/peers - ピア一覧を返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/peers", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var peers []torrent.PeerStatus
+		if err := json.NewDecoder(w.Body).Decode(&peers); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if peers == nil {
+			t.Error("expected an empty list, got null")
+		}
+	})
+
+	t.Run("DELETE /api/torrents/:id/peers/:address - 存在しないピア", func(t *testing.T) {
+		path := "/api/torrents/" + id + "/peers/" + url.PathEscape("[2001:db8::1]:6881")
+		req := httptest.NewRequest(http.MethodDelete, path, http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("POST /api/torrents/:id/peers - ピアを追加", func(t *testing.T) {
+		body := `{"peers": ["127.0.0.1:6881", "[::1]:6881"]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/torrents/"+id+"/peers", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("POST /api/torrents/:id/peers - 不正なアドレス", func(t *testing.T) {
+		body := `{"peers": ["127.0.0.1"]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/torrents/"+id+"/peers", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+	"github.com/gorilla/websocket"
+)
+
+// PiecesMessage is the full piece map of a torrent, sent over WebSocket when
+// a client subscribes.
+type PiecesMessage struct {
+	ID  string            `json:"id"`
+	Map *torrent.PieceMap `json:"map"`
+}
+
+// PieceUpdateMessage lists the pieces of a torrent that changed since the
+// previous update.
+type PieceUpdateMessage struct {
+	ID                string               `json:"id"`
+	Pieces            []torrent.PieceState `json:"pieces"`
+	DistributedCopies float64              `json:"distributed_copies"`
+}
+
+// handleGetPieces handles GET /api/torrents/:id/pieces.
+func (s *Server) handleGetPieces(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	pieces, err := adapter.PieceMap(id)
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsInvalidInput(err) {
+			writeError(w, http.StatusNotFound, "torrent not found")
+		} else {
+			s.logger.Error("failed to get piece map", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to get piece map")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, pieces)
+}
+
+// handleClientMessage handles a message from a WebSocket client. Clients
+// send subscribe_pieces with a torrent ID to receive its full piece map
+// followed by piece_update messages, and unsubscribe_pieces to stop.
+func (s *Server) handleClientMessage(conn *websocket.Conn, msg ClientMessage) {
+	switch msg.Type {
+	case "subscribe_pieces":
+		adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+		if !ok {
+			return
+		}
+		// Taken under piecesMu, so no update is diffed against an older
+		// snapshot than the one sent here
+		s.piecesMu.Lock()
+		defer s.piecesMu.Unlock()
+		states, pieces, err := adapter.PieceSnapshot(msg.Data.ID)
+		if err != nil {
+			s.wsHub.sendTo(conn, Message{Type: "error", Data: APIError{Error: "torrent not found"}})
+			return
+		}
+		// Existing subscribers were sent updates up to the recorded states,
+		// and a newer map only repeats some of those to this one
+		if _, ok := s.pieceStates[msg.Data.ID]; !ok {
+			if s.pieceStates == nil {
+				s.pieceStates = make(map[string][]torrent.PieceState)
+			}
+			s.pieceStates[msg.Data.ID] = states
+		}
+		s.wsHub.subscribePieces(conn, msg.Data.ID)
+		s.wsHub.sendTo(conn, Message{Type: "pieces", Data: PiecesMessage{ID: msg.Data.ID, Map: pieces}})
+
+	case "unsubscribe_pieces":
+		s.wsHub.unsubscribePieces(conn, msg.Data.ID)
+	}
+}
+
+// BroadcastPieceUpdates sends the pieces that changed since the last call to
+// the clients subscribed to each torrent.
+func (s *Server) BroadcastPieceUpdates() {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if s.wsHub == nil || !ok {
+		return
+	}
+
+	s.piecesMu.Lock()
+	defer s.piecesMu.Unlock()
+
+	last := make(map[string][]torrent.PieceState)
+	for _, id := range s.wsHub.pieceTopics() {
+		states, err := adapter.PieceStates(id)
+		if err != nil {
+			continue
+		}
+		last[id] = states
+
+		prev, ok := s.pieceStates[id]
+		if !ok {
+			continue
+		}
+		if changed := torrent.ChangedPieces(prev, states); len(changed) > 0 {
+			s.wsHub.publishPieces(id, Message{
+				Type: "piece_update",
+				Data: PieceUpdateMessage{
+					ID:                id,
+					Pieces:            changed,
+					DistributedCopies: torrent.DistributedCopies(states),
+				},
+			})
+		}
+	}
+	s.pieceStates = last
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+	"github.com/gorilla/websocket"
+)
+
+func TestAPI_Pieces(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{DownloadDir: tmpDir, DataDir: tmpDir, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	torrentData, _ := seededTorrent(t, tmpDir, "movie.mkv")
+	id, err := adapter.AddTorrent(torrentData)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("GET /api/torrents/:id/pieces - ピースマップを返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/pieces", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var pieces torrent.PieceMap
+		if err := json.NewDecoder(w.Body).Decode(&pieces); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if pieces.NumPieces != 4 || pieces.PieceLength != 16384 {
+			t.Errorf("unexpected piece map: %+v", pieces)
+		}
+		if len(pieces.Completed) != 1 || len(pieces.Availability) == 0 {
+			t.Errorf("unexpected bitfields: %+v", pieces)
+		}
+	})
+
+	t.Run("GET /api/torrents/:id/pieces - 存在しないトレント", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+strings.Repeat("0", 40)+"/pieces", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("WebSocketでピースマップを購読", func(t *testing.T) {
+		go server.wsHub.Run()
+		ts := httptest.NewServer(server.router)
+		defer ts.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		err = conn.WriteJSON(map[string]interface{}{"type": "subscribe_pieces", "data": map[string]string{"id": id}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg struct {
+			Type string        `json:"type"`
+			Data PiecesMessage `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if msg.Type != "pieces" || msg.Data.ID != id || msg.Data.Map == nil || msg.Data.Map.NumPieces != 4 {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+
+		if topics := server.wsHub.pieceTopics(); len(topics) != 1 || topics[0] != id {
+			t.Errorf("expected subscription to %s, got %v", id, topics)
+		}
+
+		// Updates are diffed against the map sent on subscribing
+		server.piecesMu.Lock()
+		states := server.pieceStates[id]
+		server.piecesMu.Unlock()
+		if len(states) != 4 {
+			t.Errorf("expected the sent piece states to be recorded, got %v", states)
+		}
+	})
+}
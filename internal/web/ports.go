@@ -0,0 +1,67 @@
+package web
+
+import (
+	"github.com/ayutaz/orochi/internal/config"
+)
+
+// peerPortFromSettings returns the peer port and the range random ports are
+// picked from with the peerPort and peerPortRange settings applied, and
+// whether they differ from the current ones. The range is written as
+// min-max; an empty string or null clears it.
+func (s *Server) peerPortFromSettings(settings map[string]interface{}) (int, *config.PortRange, bool, error) {
+	port, portRange := s.config.PeerPort, s.config.PeerPortRange
+	changed := false
+
+	if value, ok := settings["peerPort"]; ok {
+		n, ok := value.(float64)
+		if !ok || n != float64(int(n)) {
+			return 0, nil, false, config.ErrInvalidPeerPort
+		}
+		if int(n) != port {
+			port = int(n)
+			changed = true
+		}
+	}
+
+	if value, ok := settings["peerPortRange"]; ok {
+		var r *config.PortRange
+		switch v := value.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				var err error
+				if r, err = config.ParsePortRange(v); err != nil {
+					return 0, nil, false, err
+				}
+			}
+		default:
+			return 0, nil, false, config.ErrInvalidPeerPortRange
+		}
+		if (r == nil) != (portRange == nil) || (r != nil && *r != *portRange) {
+			portRange = r
+			changed = true
+		}
+	}
+
+	if err := config.ValidatePeerPort(port, portRange); err != nil {
+		return 0, nil, false, err
+	}
+	return port, portRange, changed, nil
+}
+
+// putPeerPortSettings sets the peer port settings from the configuration,
+// and listenPort to the port peers connect to, which differs from peerPort
+// when it is random.
+func (s *Server) putPeerPortSettings(settings map[string]interface{}) {
+	settings["peerPort"] = s.config.PeerPort
+	settings["peerPortRange"] = ""
+	if s.config.PeerPortRange != nil {
+		settings["peerPortRange"] = s.config.PeerPortRange.String()
+	}
+
+	listenPort := s.config.PeerPort
+	if client := s.torrentClient(); client != nil {
+		listenPort = client.ListenPort()
+	}
+	settings["listenPort"] = listenPort
+}
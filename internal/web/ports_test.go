@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_PeerPortSettings(t *testing.T) {
+	freePort := func() int {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port
+	}
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		PeerPort:    freePort(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+	client := server.torrentClient()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/settings", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	get := func() map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/api/settings", http.NoBody)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var settings map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+			t.Fatal(err)
+		}
+		return settings
+	}
+
+	t.Run("設定したポートで待ち受ける", func(t *testing.T) {
+		settings := get()
+		if settings["peerPort"] != float64(cfg.PeerPort) || settings["listenPort"] != float64(cfg.PeerPort) {
+			t.Errorf("unexpected settings: %v", settings)
+		}
+	})
+
+	t.Run("実行中にポートを変更", func(t *testing.T) {
+		port := freePort()
+		w := put(`{"peerPort": ` + strconv.Itoa(port) + `}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if cfg.PeerPort != port || client.ListenPort() != port {
+			t.Errorf("expected to listen on %d, got config %d and client %d", port, cfg.PeerPort, client.ListenPort())
+		}
+	})
+
+	t.Run("範囲からランダムに選ぶ", func(t *testing.T) {
+		port := freePort()
+		w := put(`{"peerPort": 0, "peerPortRange": "` + strconv.Itoa(port) + `-` + strconv.Itoa(port) + `"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		settings := get()
+		if settings["peerPort"] != float64(0) || settings["listenPort"] != float64(port) {
+			t.Errorf("unexpected settings: %v", settings)
+		}
+		if settings["peerPortRange"] != strconv.Itoa(port)+"-"+strconv.Itoa(port) {
+			t.Errorf("unexpected range: %v", settings["peerPortRange"])
+		}
+	})
+
+	t.Run("不正な範囲は拒否", func(t *testing.T) {
+		listenPort := client.ListenPort()
+		w := put(`{"peerPortRange": "7000-6000"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+		if cfg.PeerPortRange == nil || client.ListenPort() != listenPort {
+			t.Error("a rejected peer port was applied")
+		}
+	})
+}
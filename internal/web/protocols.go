@@ -0,0 +1,52 @@
+package web
+
+import (
+	"github.com/ayutaz/orochi/internal/config"
+)
+
+// protocolSettings maps the settings keys that turn protocols on and off to
+// the config field that turns them off.
+var protocolSettings = map[string]func(*config.ProtocolConfig) *bool{
+	"dht":                func(p *config.ProtocolConfig) *bool { return &p.DisableDHT },
+	"peerExchange":       func(p *config.ProtocolConfig) *bool { return &p.DisablePEX },
+	"localPeerDiscovery": func(p *config.ProtocolConfig) *bool { return &p.DisableLSD },
+	"utp":                func(p *config.ProtocolConfig) *bool { return &p.DisableUTP },
+	"tcp":                func(p *config.ProtocolConfig) *bool { return &p.DisableTCP },
+	"ipv4":               func(p *config.ProtocolConfig) *bool { return &p.DisableIPv4 },
+	"ipv6":               func(p *config.ProtocolConfig) *bool { return &p.DisableIPv6 },
+}
+
+// protocolsFromSettings returns the protocol configuration with the
+// switches in settings applied, and whether it differs from the current
+// one. Keys that are missing or not booleans are left as they are.
+func (s *Server) protocolsFromSettings(settings map[string]interface{}) (*config.ProtocolConfig, bool) {
+	protocols := &config.ProtocolConfig{}
+	if s.config.Protocols != nil {
+		*protocols = *s.config.Protocols
+	}
+
+	changed := false
+	for key, field := range protocolSettings {
+		on, ok := settings[key].(bool)
+		if !ok {
+			continue
+		}
+		if disabled := field(protocols); *disabled == on {
+			*disabled = !on
+			changed = true
+		}
+	}
+	return protocols, changed
+}
+
+// putProtocolSettings sets the protocol switches of settings from the
+// configuration, which settings saved in the database may disagree with.
+func (s *Server) putProtocolSettings(settings map[string]interface{}) {
+	protocols := &config.ProtocolConfig{}
+	if s.config.Protocols != nil {
+		*protocols = *s.config.Protocols
+	}
+	for key, field := range protocolSettings {
+		settings[key] = !*field(protocols)
+	}
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_ProtocolSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		DHT:         &config.DHTConfig{DisablePublicBootstrap: true},
+	}
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+	client := server.torrentClient()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/settings", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	get := func() map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/api/settings", http.NoBody)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var settings map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+			t.Fatal(err)
+		}
+		return settings
+	}
+
+	t.Run("既定ではすべて有効", func(t *testing.T) {
+		settings := get()
+		for key := range protocolSettings {
+			if settings[key] != true {
+				t.Errorf("expected %s to be on, got %v", key, settings[key])
+			}
+		}
+	})
+
+	t.Run("DHTとuTPを無効化", func(t *testing.T) {
+		w := put(`{"language": "en", "dht": false, "utp": false}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if cfg.Protocols == nil || !cfg.Protocols.DisableDHT || !cfg.Protocols.DisableUTP {
+			t.Fatalf("expected the config to be updated, got %+v", cfg.Protocols)
+		}
+		if p := client.Protocols(); p.DHT() || p.UTP() {
+			t.Errorf("expected the client to apply the protocols, got %+v", p)
+		}
+
+		settings := get()
+		if settings["dht"] != false || settings["utp"] != false || settings["tcp"] != true {
+			t.Errorf("unexpected settings: %v", settings)
+		}
+	})
+
+	t.Run("TCPも無効化すると拒否", func(t *testing.T) {
+		w := put(`{"tcp": false}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+		if cfg.Protocols.DisableTCP || !client.Protocols().TCP() {
+			t.Error("a rejected configuration was applied")
+		}
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/ayutaz/orochi/internal/config"
@@ -25,6 +26,17 @@ type Server struct {
 	torrentManager torrent.Manager
 	logger         logger.Logger
 	wsHub          *Hub
+
+	// stopVPN stops pushing VPN status changes to WebSocket clients.
+	// watchingVPN is set while they are pushed.
+	vpnMu       sync.Mutex
+	stopVPN     func()
+	watchingVPN bool
+
+	// pieceStates holds the piece states last sent to piece map subscribers,
+	// keyed by torrent ID.
+	piecesMu    sync.Mutex
+	pieceStates map[string][]torrent.PieceState
 }
 
 // Router returns the server's router for testing.
@@ -40,10 +52,11 @@ func NewServer(cfg *config.Config) *Server {
 	)
 
 	s := &Server{
-		config: cfg,
-		router: NewRouter(),
-		logger: log,
-		wsHub:  NewHub(log, cfg.AllowedOrigins),
+		config:  cfg,
+		router:  NewRouter(),
+		logger:  log,
+		wsHub:   NewHub(log, cfg.AllowedOrigins),
+		stopVPN: func() {},
 	}
 
 	// Set up middleware
@@ -105,6 +118,9 @@ func (s *Server) setupRoutes() {
 	// Metrics endpoint
 	s.router.GET("/metrics", s.wrapHandler(s.handleMetrics))
 
+	// Embedded tracker
+	s.setupTrackerRoutes()
+
 	// API routes group
 	api := s.router.Group("/api", RequireTorrentManager(s))
 
@@ -116,16 +132,41 @@ func (s *Server) setupRoutes() {
 	api.DELETE("/torrents/:id", s.wrapHandler(s.handleDeleteTorrent))
 	api.POST("/torrents/:id/start", s.wrapHandler(s.handleStartTorrent))
 	api.POST("/torrents/:id/stop", s.wrapHandler(s.handleStopTorrent))
+	api.GET("/torrents/:id/files", s.wrapHandler(s.handleListFiles))
 	api.PUT("/torrents/:id/files", s.wrapHandler(s.handleUpdateFiles))
+	api.PUT("/torrents/:id/files/:index/name", s.wrapHandler(s.handleRenameFile))
+	api.GET("/torrents/:id/files/:index/stream", s.wrapHandler(s.handleStreamFile))
+	api.PUT("/torrents/:id/folders/name", s.wrapHandler(s.handleRenameFolder))
+	api.GET("/torrents/:id/pieces", s.wrapHandler(s.handleGetPieces))
+	api.GET("/torrents/:id/peers", s.wrapHandler(s.handleListPeers))
+	api.POST("/torrents/:id/peers", s.wrapHandler(s.handleAddPeers))
+	api.DELETE("/torrents/:id/peers/:address", s.wrapHandler(s.handleDisconnectPeer))
+	api.GET("/torrents/:id/trackers", s.wrapHandler(s.handleListTrackers))
+	api.POST("/torrents/:id/reannounce", s.wrapHandler(s.handleReannounce))
+	api.GET("/torrents/:id/strategy", s.wrapHandler(s.handleGetStrategy))
+	api.PUT("/torrents/:id/strategy", s.wrapHandler(s.handleUpdateStrategy))
 
 	// Settings endpoints
 	api.GET("/settings", s.wrapHandler(s.handleGetSettings))
 	api.PUT("/settings", s.wrapHandler(s.handleUpdateSettings))
 
+	// Blocklist endpoints
+	api.GET("/blocklist", s.wrapHandler(s.handleGetBlocklist))
+	api.POST("/blocklist/refresh", s.wrapHandler(s.handleRefreshBlocklist))
+
+	// Ban endpoints
+	api.GET("/bans", s.wrapHandler(s.handleListBans))
+	api.POST("/bans", s.wrapHandler(s.handleBan))
+	api.DELETE("/bans", s.wrapHandler(s.handleUnban))
+
 	// VPN endpoints
 	api.GET("/vpn/status", s.wrapHandler(s.handleGetVPNStatus))
 	api.PUT("/vpn/config", s.wrapHandler(s.handleUpdateVPNConfig))
 
+	// Network endpoints
+	api.GET("/network/status", s.wrapHandler(s.handleGetNetworkStatus))
+	api.GET("/dht/stats", s.wrapHandler(s.handleGetDHTStats))
+
 	// WebSocket endpoint
 	s.router.GET("/ws", s.wrapHandler(s.handleWebSocket))
 
@@ -150,12 +191,21 @@ func (s *Server) wrapHandler(handler func(w http.ResponseWriter, r *http.Request
 func (s *Server) Start() error {
 	// Start WebSocket hub
 	go s.wsHub.Run()
+	s.vpnMu.Lock()
+	s.stopVPN = s.watchVPN()
+	s.watchingVPN = true
+	s.vpnMu.Unlock()
 
 	return s.httpServer.ListenAndServe()
 }
 
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown() error {
+	s.vpnMu.Lock()
+	s.stopVPN()
+	s.watchingVPN = false
+	s.vpnMu.Unlock()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	return s.httpServer.Shutdown(ctx)
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+// seededTorrent creates a single-file torrent whose data is already in the
+// download directory and returns the torrent file and the data.
+func seededTorrent(t *testing.T, downloadDir, name string) ([]byte, []byte) {
+	t.Helper()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	src := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info := metainfo.Info{PieceLength: 16384}
+	if err := info.BuildFromFilePath(src); err != nil {
+		t.Fatalf("failed to build info: %v", err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	dst := filepath.Join(downloadDir, mi.HashInfoBytes().HexString(), name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), data
+}
+
+func TestAPI_StreamFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{DownloadDir: tmpDir, DataDir: tmpDir, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	torrentData, data := seededTorrent(t, tmpDir, "movie.mkv")
+	id, err := adapter.AddTorrent(torrentData)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("Range指定で部分データを返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/files/0/stream", http.NoBody)
+		req.Header.Set("Range", "bytes=20000-20099")
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("expected status 206, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != "video/x-matroska" {
+			t.Errorf("expected video/x-matroska, got %s", got)
+		}
+		if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+			t.Errorf("expected Accept-Ranges bytes, got %s", got)
+		}
+		body, _ := io.ReadAll(w.Body)
+		if !bytes.Equal(body, data[20000:20100]) {
+			t.Error("range content mismatch")
+		}
+	})
+
+	t.Run("ファイル全体を返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/files/0/stream", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data) {
+			t.Error("content mismatch")
+		}
+	})
+
+	t.Run("ASCII以外のファイル名", func(t *testing.T) {
+		name := "映画\t1.mkv"
+		torrentData, _ := seededTorrent(t, tmpDir, name)
+		id, err := adapter.AddTorrent(torrentData)
+		if err != nil {
+			t.Fatalf("failed to add torrent: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/files/0/stream", http.NoBody)
+		req.Header.Set("Range", "bytes=0-0")
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		header := w.Header().Get("Content-Disposition")
+		for _, c := range header {
+			if c < 0x20 || c > 0x7e {
+				t.Fatalf("expected a printable ASCII Content-Disposition, got %q", header)
+			}
+		}
+		disposition, params, err := mime.ParseMediaType(header)
+		if err != nil {
+			t.Fatalf("invalid Content-Disposition %q: %v", header, err)
+		}
+		if disposition != "inline" || params["filename"] != name {
+			t.Errorf("expected inline with filename %q, got %s %v", name, disposition, params)
+		}
+	})
+
+	t.Run("存在しないファイル", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/files/5/stream", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package web
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/tracker"
+)
+
+// setupTrackerRoutes mounts the embedded tracker if it is enabled.
+func (s *Server) setupTrackerRoutes() {
+	cfg := s.config.Tracker
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	srv := tracker.NewServer(
+		cfg.Passkey,
+		time.Duration(cfg.Interval)*time.Second,
+		time.Duration(cfg.PeerExpiry)*time.Second,
+		s.isLoadedTorrent,
+	)
+	s.router.GET("/announce", s.wrapHandler(srv.ServeAnnounce))
+	s.router.GET("/scrape", s.wrapHandler(srv.ServeScrape))
+}
+
+// isLoadedTorrent reports whether a torrent is loaded, which is the whitelist
+// of the embedded tracker.
+func (s *Server) isLoadedTorrent(infoHash [20]byte) bool {
+	if s.torrentManager == nil {
+		return false
+	}
+	_, ok := s.torrentManager.GetTorrent(hex.EncodeToString(infoHash[:]))
+	return ok
+}
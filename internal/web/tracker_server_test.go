@@ -0,0 +1,90 @@
+package web
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+	"github.com/ayutaz/orochi/internal/tracker"
+)
+
+func TestTrackerServer(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		Tracker:     &config.TrackerConfig{Enabled: true, Passkey: "secret", Interval: 1800, PeerExpiry: 3600},
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	torrentData, _ := seededTorrent(t, tmpDir, "movie.mkv")
+	id, err := adapter.AddTorrent(torrentData)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+	infoHash, err := hex.DecodeString(id)
+	if err != nil {
+		t.Fatalf("invalid torrent ID %q: %v", id, err)
+	}
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+	srv := httptest.NewServer(server.Router())
+	defer srv.Close()
+
+	announceURL := srv.URL + "/announce?passkey=secret"
+	client := tracker.NewClient()
+
+	t.Run("GET /announce - 読み込まれたトレントをアナウンス", func(t *testing.T) {
+		req := tracker.AnnounceRequest{InfoHash: [20]byte(infoHash), PeerID: tracker.NewPeerID(), Port: 6881}
+		resp, err := client.Announce(context.Background(), announceURL, req)
+		if err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		if resp.Seeders != 1 {
+			t.Errorf("expected 1 seeder, got %d", resp.Seeders)
+		}
+	})
+
+	t.Run("GET /announce - 読み込まれていないトレント", func(t *testing.T) {
+		req := tracker.AnnounceRequest{InfoHash: [20]byte{0xaa}, PeerID: tracker.NewPeerID(), Port: 6881}
+		_, err := client.Announce(context.Background(), announceURL, req)
+		if _, ok := err.(*tracker.FailureError); !ok {
+			t.Errorf("expected a tracker failure, got %v", err)
+		}
+	})
+
+	t.Run("GET /scrape - スクレイプ", func(t *testing.T) {
+		results, err := client.Scrape(context.Background(), announceURL, [20]byte(infoHash))
+		if err != nil {
+			t.Fatalf("Scrape() error = %v", err)
+		}
+		if results[[20]byte(infoHash)].Seeders != 1 {
+			t.Errorf("unexpected scrape result: %+v", results)
+		}
+	})
+
+	t.Run("GET /announce - 無効時はマウントされない", func(t *testing.T) {
+		disabled := NewServer(&config.Config{DownloadDir: tmpDir, DataDir: tmpDir})
+		disabled.SetTorrentManager(adapter)
+
+		req := httptest.NewRequest(http.MethodGet, "/announce?passkey=secret", http.NoBody)
+		w := httptest.NewRecorder()
+		disabled.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/ayutaz/orochi/internal/errors"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+// handleListTrackers handles GET /api/torrents/:id/trackers.
+func (s *Server) handleListTrackers(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	trackers, err := adapter.Trackers(id)
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsInvalidInput(err) {
+			writeError(w, http.StatusNotFound, "torrent not found")
+		} else {
+			s.logger.Error("failed to list trackers", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to list trackers")
+		}
+		return
+	}
+
+	_ = writeJSON(w, http.StatusOK, trackers)
+}
+
+// handleReannounce handles POST /api/torrents/:id/reannounce.
+func (s *Server) handleReannounce(w http.ResponseWriter, r *http.Request) {
+	params := GetParams(r)
+	id := params["id"]
+
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		s.logger.Error("torrent manager is not ClientAdapter")
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := adapter.Reannounce(id); err != nil {
+		switch {
+		case errors.IsNotFound(err) || errors.IsInvalidInput(err):
+			writeError(w, http.StatusNotFound, "torrent not found")
+		case errors.IsConflict(err):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			s.logger.Error("failed to reannounce", logger.String("torrent_id", id), logger.Err(err))
+			writeError(w, http.StatusInternalServerError, "failed to reannounce")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
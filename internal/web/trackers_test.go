@@ -0,0 +1,89 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/torrent"
+)
+
+func TestAPI_Trackers(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{DownloadDir: tmpDir, DataDir: tmpDir, Protocols: &config.ProtocolConfig{DisableDHT: true}}
+
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	torrentData, _ := seededTorrent(t, tmpDir, "movie.mkv")
+	id, err := adapter.AddTorrent(torrentData)
+	if err != nil {
+		t.Fatalf("failed to add torrent: %v", err)
+	}
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("GET /api/torrents/:id/trackers - トラッカー一覧を返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/torrents/"+id+"/trackers", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var trackers []torrent.TrackerInfo
+		if err := json.NewDecoder(w.Body).Decode(&trackers); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if trackers == nil {
+			t.Error("expected an empty list, got null")
+		}
+	})
+
+	t.Run("GET /api/torrents/:id/trackers - 存在しないトレント", func(t *testing.T) {
+		path := "/api/torrents/0123456789abcdef0123456789abcdef01234567/trackers"
+		req := httptest.NewRequest(http.MethodGet, path, http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("POST /api/torrents/:id/reannounce - 再アナウンス", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/torrents/"+id+"/reannounce", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Errorf("expected status 202, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("POST /api/torrents/:id/reannounce - 停止中のトレント", func(t *testing.T) {
+		if err := adapter.StopTorrent(id); err != nil {
+			t.Fatalf("failed to stop torrent: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/torrents/"+id+"/reannounce", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", w.Code)
+		}
+	})
+}
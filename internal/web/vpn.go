@@ -0,0 +1,143 @@
+package web
+
+import (
+	"time"
+
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+	"github.com/ayutaz/orochi/internal/torrent"
+	torrentclient "github.com/ayutaz/orochi/internal/torrent_client"
+)
+
+// torrentClient returns the torrent client, or nil if the server is not
+// running one.
+func (s *Server) torrentClient() *torrentclient.Client {
+	adapter, ok := s.torrentManager.(*torrent.ClientAdapter)
+	if !ok {
+		return nil
+	}
+	client, err := adapter.GetClient()
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// vpnStatus describes the VPN binding. The state comes from the client's
+// network monitor; without one the interfaces are looked at directly.
+func (s *Server) vpnStatus() VPNStatusResponse {
+	vpnConfig := s.config.VPN
+	if vpnConfig == nil {
+		vpnConfig = network.NewVPNConfig()
+	}
+
+	interfaces, err := network.GetNetworkInterfaces()
+	if err != nil {
+		s.logger.Error("failed to get network interfaces", logger.Err(err))
+		interfaces = []network.Interface{}
+	}
+	for i := range interfaces {
+		interfaces[i].IsVPN = vpnConfig.IsVPNInterface(interfaces[i].Name)
+	}
+
+	response := VPNStatusResponse{
+		Enabled:       vpnConfig.Enabled,
+		Active:        !vpnConfig.Enabled, // If disabled, consider as "active"
+		InterfaceName: vpnConfig.InterfaceName,
+		KillSwitch:    vpnConfig.KillSwitch,
+		Interfaces:    interfaces,
+	}
+
+	client := s.torrentClient()
+	if client == nil {
+		return response
+	}
+	response.KillSwitchEngaged = client.KillSwitchEngaged()
+	response.BoundAddresses = client.BoundAddrs()
+	response.RestartRequired = client.BindingPending()
+
+	if monitor := client.GetNetworkMonitor(); monitor != nil {
+		status := monitor.Status()
+		response.Active = status.Active
+		response.Addresses = status.Addresses
+		response.LastCheck = status.LastCheck.Format(time.RFC3339)
+		response.LastChange = status.LastChange.Format(time.RFC3339)
+		response.Leak = status.Leak
+		response.LeakRoute = status.LeakRoute
+		return response
+	}
+
+	// Without a monitor, check the interface directly
+	if vpnConfig.Enabled {
+		for _, iface := range interfaces {
+			if iface.Name == vpnConfig.InterfaceName {
+				response.Active = iface.IsUp
+				response.Addresses = iface.Addresses
+				break
+			}
+		}
+	}
+	return response
+}
+
+// watchVPN sends a vpn_status message to WebSocket clients whenever the
+// VPN monitor or kill switch changes state. It returns a function that
+// stops watching.
+func (s *Server) watchVPN() func() {
+	client := s.torrentClient()
+	if client == nil || s.wsHub == nil {
+		return func() {}
+	}
+
+	killSwitch, stopKillSwitch := client.SubscribeKillSwitch()
+	var monitorStatus <-chan network.Status
+	stopMonitor := func() {}
+	if monitor := client.GetNetworkMonitor(); monitor != nil {
+		monitorStatus, stopMonitor = monitor.Subscribe()
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case _, ok := <-monitorStatus:
+				if !ok {
+					monitorStatus = nil
+					continue
+				}
+			case _, ok := <-killSwitch:
+				if !ok {
+					killSwitch = nil
+					continue
+				}
+			}
+			s.wsHub.BroadcastVPNStatus(s.vpnStatus())
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		stopKillSwitch()
+		stopMonitor()
+	}
+}
+
+// rewatchVPN follows the network monitor of the torrent client after a
+// configuration change replaced it, and sends the new status to WebSocket
+// clients.
+func (s *Server) rewatchVPN() {
+	s.vpnMu.Lock()
+	defer s.vpnMu.Unlock()
+	if !s.watchingVPN {
+		return
+	}
+
+	s.stopVPN()
+	s.stopVPN = s.watchVPN()
+	s.wsHub.BroadcastVPNStatus(s.vpnStatus())
+}
@@ -0,0 +1,195 @@
+package web
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayutaz/orochi/internal/config"
+	"github.com/ayutaz/orochi/internal/logger"
+	"github.com/ayutaz/orochi/internal/network"
+	"github.com/ayutaz/orochi/internal/torrent"
+	"github.com/gorilla/websocket"
+)
+
+func TestAPI_VPNStatus(t *testing.T) {
+	var loopback string
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		VPN:         &network.VPNConfig{Enabled: true, InterfaceName: loopback, KillSwitch: true},
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+
+	t.Run("GET /api/vpn/status - モニターの状態を返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/vpn/status", http.NoBody)
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var status VPNStatusResponse
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if !status.Enabled || !status.Active || status.KillSwitchEngaged {
+			t.Errorf("unexpected state: %+v", status)
+		}
+		if _, err := time.Parse(time.RFC3339, status.LastCheck); err != nil {
+			t.Errorf("invalid last_check %q", status.LastCheck)
+		}
+		if _, err := time.Parse(time.RFC3339, status.LastChange); err != nil {
+			t.Errorf("invalid last_change %q", status.LastChange)
+		}
+		if len(status.Addresses) == 0 || len(status.BoundAddresses) == 0 {
+			t.Errorf("expected interface and bound addresses: %+v", status)
+		}
+	})
+
+	t.Run("WebSocketでVPNの状態を受信", func(t *testing.T) {
+		go server.wsHub.Run()
+		ts := httptest.NewServer(server.router)
+		defer ts.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		// Wait for the hub to register the client before broadcasting
+		time.Sleep(100 * time.Millisecond)
+		server.wsHub.BroadcastVPNStatus(server.vpnStatus())
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg struct {
+			Type string            `json:"type"`
+			Data VPNStatusResponse `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if msg.Type != "vpn_status" || msg.Data.InterfaceName != loopback || !msg.Data.Active {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	})
+}
+
+func TestAPI_UpdateVPNConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DownloadDir: tmpDir,
+		DataDir:     tmpDir,
+		VPN:         network.NewVPNConfig(),
+		Protocols:   &config.ProtocolConfig{DisableDHT: true},
+	}
+	adapter, err := torrent.NewClientAdapter(cfg, logger.NewWithLevel(logger.ErrorLevel))
+	if err != nil {
+		t.Fatalf("failed to create adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	server := NewServer(cfg)
+	server.SetTorrentManager(adapter)
+	client := server.torrentClient()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/vpn/config", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("存在しないインターフェースは拒否", func(t *testing.T) {
+		w := put(`{"enabled": true, "interface_name": "nonexistent-vpn", "kill_switch": true}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+		if cfg.VPN.Enabled || client.GetNetworkMonitor() != nil {
+			t.Error("a rejected configuration was applied")
+		}
+	})
+
+	t.Run("有効化するとモニターが起動", func(t *testing.T) {
+		var loopback string
+		interfaces, err := net.Interfaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, iface := range interfaces {
+			if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+				loopback = iface.Name
+			}
+		}
+		if loopback == "" {
+			t.Skip("no loopback interface")
+		}
+
+		w := put(`{"enabled": true, "interface_name": "` + loopback + `", "kill_switch": true}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if !cfg.VPN.Enabled || client.GetNetworkMonitor() == nil {
+			t.Fatal("expected the monitor to start without a restart")
+		}
+
+		status := server.vpnStatus()
+		if !status.Enabled || !status.Active || !status.RestartRequired {
+			t.Errorf("unexpected status: %+v", status)
+		}
+
+		w = put(`{"enabled": false, "kill_switch": true}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if client.GetNetworkMonitor() != nil || server.vpnStatus().RestartRequired {
+			t.Error("expected the monitor to stop")
+		}
+	})
+
+	t.Run("省略したフィールドは保持", func(t *testing.T) {
+		w := put(`{"enabled": false, "interface_patterns": ["corp-*"]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		w = put(`{"enabled": false, "kill_switch": false}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if len(cfg.VPN.InterfacePatterns) != 1 || cfg.VPN.InterfacePatterns[0] != "corp-*" {
+			t.Errorf("expected the interface patterns to be kept, got %v", cfg.VPN.InterfacePatterns)
+		}
+		if cfg.VPN.KillSwitch {
+			t.Error("expected the kill switch to be turned off")
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package web
 
 import (
+	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/ayutaz/orochi/internal/logger"
@@ -36,14 +38,34 @@ type Message struct {
 	Data interface{} `json:"data"`
 }
 
+// ClientMessage represents a message received from a WebSocket client.
+type ClientMessage struct {
+	Type string `json:"type"`
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// directMessage is a message for a single client.
+type directMessage struct {
+	conn    *websocket.Conn
+	message Message
+}
+
 // Hub manages WebSocket connections.
 type Hub struct {
 	clients    map[*websocket.Conn]bool
 	broadcast  chan Message
+	direct     chan directMessage
 	register   chan *websocket.Conn
 	unregister chan *websocket.Conn
 	logger     logger.Logger
 	upgrader   websocket.Upgrader
+
+	// pieceSubs holds the clients subscribed to piece map updates, keyed by
+	// torrent ID.
+	mu        sync.Mutex
+	pieceSubs map[string]map[*websocket.Conn]bool
 }
 
 // NewHub creates a new WebSocket hub.
@@ -51,10 +73,12 @@ func NewHub(log logger.Logger, allowedOrigins []string) *Hub {
 	return &Hub{
 		clients:    make(map[*websocket.Conn]bool),
 		broadcast:  make(chan Message),
+		direct:     make(chan directMessage),
 		register:   make(chan *websocket.Conn),
 		unregister: make(chan *websocket.Conn),
 		logger:     log,
 		upgrader:   createUpgrader(allowedOrigins),
+		pieceSubs:  make(map[string]map[*websocket.Conn]bool),
 	}
 }
 
@@ -69,6 +93,7 @@ func (h *Hub) Run() {
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
+				h.unsubscribeAll(client)
 				client.Close()
 				h.logger.Info("WebSocket client disconnected", logger.Int("total_clients", len(h.clients)))
 			}
@@ -79,12 +104,90 @@ func (h *Hub) Run() {
 					h.logger.Error("Failed to send WebSocket message", logger.Err(err))
 					client.Close()
 					delete(h.clients, client)
+					h.unsubscribeAll(client)
 				}
 			}
+
+		case dm := <-h.direct:
+			if _, ok := h.clients[dm.conn]; !ok {
+				continue
+			}
+			if err := dm.conn.WriteJSON(dm.message); err != nil {
+				h.logger.Error("Failed to send WebSocket message", logger.Err(err))
+				dm.conn.Close()
+				delete(h.clients, dm.conn)
+				h.unsubscribeAll(dm.conn)
+			}
+		}
+	}
+}
+
+// subscribePieces subscribes a client to piece map updates of a torrent.
+func (h *Hub) subscribePieces(conn *websocket.Conn, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pieceSubs[id] == nil {
+		h.pieceSubs[id] = make(map[*websocket.Conn]bool)
+	}
+	h.pieceSubs[id][conn] = true
+}
+
+// unsubscribePieces unsubscribes a client from piece map updates of a torrent.
+func (h *Hub) unsubscribePieces(conn *websocket.Conn, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.pieceSubs[id], conn)
+	if len(h.pieceSubs[id]) == 0 {
+		delete(h.pieceSubs, id)
+	}
+}
+
+// unsubscribeAll removes every subscription of a client.
+func (h *Hub) unsubscribeAll(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, conns := range h.pieceSubs {
+		delete(conns, conn)
+		if len(conns) == 0 {
+			delete(h.pieceSubs, id)
 		}
 	}
 }
 
+// pieceTopics returns the IDs of the torrents that have piece map subscribers.
+func (h *Hub) pieceTopics() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]string, 0, len(h.pieceSubs))
+	for id := range h.pieceSubs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sendTo sends a message to a single client.
+func (h *Hub) sendTo(conn *websocket.Conn, message Message) {
+	h.direct <- directMessage{conn: conn, message: message}
+}
+
+// publishPieces sends a message to the piece map subscribers of a torrent.
+func (h *Hub) publishPieces(id string, message Message) {
+	h.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(h.pieceSubs[id]))
+	for conn := range h.pieceSubs[id] {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	for _, conn := range conns {
+		h.sendTo(conn, message)
+	}
+}
+
 // BroadcastTorrentUpdate sends a torrent update to all connected clients.
 func (h *Hub) BroadcastTorrentUpdate() {
 	h.broadcast <- Message{
@@ -103,6 +206,14 @@ func (h *Hub) BroadcastTorrentData(torrents interface{}) {
 	}
 }
 
+// BroadcastVPNStatus sends the VPN status to all connected clients.
+func (h *Hub) BroadcastVPNStatus(status VPNStatusResponse) {
+	h.broadcast <- Message{
+		Type: "vpn_status",
+		Data: status,
+	}
+}
+
 // handleWebSocket handles WebSocket connections.
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.wsHub.upgrader.Upgrade(w, r, nil)
@@ -126,13 +237,20 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		})
 
 		for {
-			_, _, err := conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					s.logger.Error("WebSocket error", logger.Err(err))
 				}
 				break
 			}
+
+			var msg ClientMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				s.logger.Debug("ignoring invalid WebSocket message", logger.Err(err))
+				continue
+			}
+			s.handleClientMessage(conn, msg)
 		}
 	}()
 
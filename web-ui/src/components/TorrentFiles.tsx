@@ -56,9 +56,11 @@ const TorrentFiles: React.FC<TorrentFilesProps> = ({ torrent }) => {
     try {
       await api.updateFiles(
         torrent.id,
-        files.map((file) => ({
-          path: file.path.join('/'),
+        files.map((file, index) => ({
+          index,
           selected: file.selected !== false,
+          // Priority overrides selection, so only send it for selected files
+          priority: file.selected === false ? undefined : file.priority,
         }))
       );
       setHasChanges(false);
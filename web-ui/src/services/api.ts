@@ -41,7 +41,7 @@ export const api = {
 
   updateFiles: async (
     torrentId: string,
-    files: Array<{ path: string; selected: boolean }>
+    files: Array<{ index?: number; path?: string; selected?: boolean; priority?: string }>
   ): Promise<void> => {
     await axios.put(`${API_BASE}/torrents/${torrentId}/files`, { files });
   },